@@ -0,0 +1,53 @@
+package main
+
+import (
+	"GoDance/engine"
+	"GoDance/utils"
+	"flag"
+	"fmt"
+)
+
+// runCheck
+// @Description godance check 子命令，检查索引文件的完整性
+// @Param args 命令行参数
+// @Return error 发现问题或检查失败时返回错误
+func runCheck(args []string) error {
+	var indexName string
+	var quarantine bool
+	var dataPaths string
+
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.StringVar(&indexName, "index", "", "检查的索引名，默认检查所有索引")
+	fs.BoolVar(&quarantine, "quarantine", false, "把损坏的段移到索引目录下的 quarantine 目录，段内的文档标记为删除")
+	dataPathsVar(fs, &dataPaths)
+	fs.Parse(args)
+
+	if err := setDataPaths(dataPaths); err != nil {
+		return err
+	}
+	logger, err := utils.NewLogger("GoDanceCheck")
+	if err != nil {
+		return err
+	}
+	engine.Engine = engine.NewDefaultEngine(logger)
+
+	reports, err := engine.Engine.Check(indexName, quarantine)
+	problems := 0
+	for _, report := range reports {
+		fmt.Printf("index %v : %v segments, %v problems\n", report.Index, report.Segments, len(report.Issues))
+		for _, issue := range report.Issues {
+			fmt.Printf("  [%v] %v : %v\n", issue.Segment, issue.Field, issue.Message)
+		}
+		for _, name := range report.Quarantined {
+			fmt.Printf("  quarantined %v\n", name)
+		}
+		problems += len(report.Issues)
+	}
+	if err != nil {
+		return err
+	}
+	if problems > 0 {
+		return fmt.Errorf("found %v problems", problems)
+	}
+	return nil
+}
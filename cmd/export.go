@@ -0,0 +1,63 @@
+package main
+
+import (
+	"GoDance/engine"
+	"GoDance/utils"
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+)
+
+// runExport
+// @Description godance export 子命令，按 docId 顺序导出索引中的文档
+// @Param args 命令行参数
+// @Return error 任何错误
+func runExport(args []string) error {
+	var indexName, format, out, query, fields, dataPaths string
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.StringVar(&indexName, "index", "", "导出的索引名")
+	fs.StringVar(&format, "format", engine.EXPORT_JSONL, "导出格式 jsonl 或 csv")
+	fs.StringVar(&out, "out", "", "输出文件，引擎的日志会打印到标准输出，所以必须指定")
+	fs.StringVar(&query, "q", "", "查询条件，与搜索接口的参数格式相同，如 title=作文&>year=2000")
+	fs.StringVar(&fields, "fields", "", "导出的字段，逗号分隔，默认导出所有字段")
+	dataPathsVar(fs, &dataPaths)
+	fs.Parse(args)
+
+	if indexName == "" || out == "" {
+		fs.Usage()
+		return errors.New("index and out are required")
+	}
+
+	params := make(map[string]string)
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return err
+		}
+		for k, v := range values {
+			params[k] = v[0]
+		}
+	}
+	params["index"] = indexName
+	params["format"] = format
+	params["fields"] = fields
+
+	fd, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if err := setDataPaths(dataPaths); err != nil {
+		return err
+	}
+	logger, err := utils.NewLogger("GoDanceExport")
+	if err != nil {
+		return err
+	}
+	engine.Engine = engine.NewDefaultEngine(logger)
+
+	return engine.Engine.Export(params, fd)
+}
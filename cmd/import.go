@@ -0,0 +1,394 @@
+package main
+
+import (
+	"GoDance/engine"
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 导入时坏数据的处理方式
+const (
+	ON_ERROR_SKIP  = "skip"  // 直接跳过
+	ON_ERROR_LOG   = "log"   // 跳过并记录
+	ON_ERROR_ABORT = "abort" // 终止导入
+)
+
+// importer 导入过程中的状态
+type importer struct {
+	indexName  string
+	columnMap  map[string]string
+	pkFields   []string
+	fieldTypes map[string]uint64
+	onError    string
+	badWriter  io.Writer
+	logger     *utils.Log4FE
+
+	indexed int
+	bad     int
+}
+
+// runImport
+// @Description godance import 子命令，流式导入 csv 或 jsonl 文件
+// @Param args 命令行参数
+// @Return error 任何错误
+func runImport(args []string) error {
+	var indexName, fileName, format, mapping, types, pk, onError, badFile, dataPaths string
+	var create bool
+	var from, progress, batchSize, checkpoint int
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.StringVar(&indexName, "index", "", "导入的索引名")
+	fs.StringVar(&fileName, "file", "", "导入的文件路径")
+	fs.StringVar(&format, "format", "", "文件格式 csv 或 jsonl，默认根据后缀判断")
+	fs.StringVar(&mapping, "map", "", "列名到字段名的映射，如 col1:field1,col2:field2")
+	fs.StringVar(&types, "types", "", "字段类型，如 id:pk,year:number,title:text，用于类型转换和自动建索引")
+	fs.StringVar(&pk, "pk", "", "自动建索引时的主键字段，多个字段用逗号分隔表示联合主键")
+	fs.BoolVar(&create, "create", false, "索引不存在时自动创建")
+	fs.StringVar(&onError, "on-error", ON_ERROR_LOG, "坏数据的处理方式 skip、log 或 abort")
+	fs.StringVar(&badFile, "bad-rows", "", "记录坏数据的文件，jsonl 格式")
+	fs.IntVar(&from, "from", 0, "从第几条记录之后开始导入，用于断点续传")
+	fs.IntVar(&progress, "progress", 10000, "每导入多少条记录输出一次进度")
+	fs.IntVar(&batchSize, "batch", utils.BULK_BATCH_SIZE, "每批写入的文档数")
+	fs.IntVar(&checkpoint, "checkpoint", int(utils.MAX_SEGMENT_SIZE), "每导入多少条记录持久化一次")
+	dataPathsVar(fs, &dataPaths)
+	fs.Parse(args)
+
+	if indexName == "" || fileName == "" {
+		fs.Usage()
+		return errors.New("index and file are required")
+	}
+	if onError != ON_ERROR_SKIP && onError != ON_ERROR_LOG && onError != ON_ERROR_ABORT {
+		return fmt.Errorf("unknown on-error mode %v", onError)
+	}
+	if batchSize <= 0 {
+		batchSize = utils.BULK_BATCH_SIZE
+	}
+
+	columnMap, err := parsePairs(mapping)
+	if err != nil {
+		return err
+	}
+	typeNames, err := parsePairs(types)
+	if err != nil {
+		return err
+	}
+	fieldTypes := make(map[string]uint64)
+	for field, name := range typeNames {
+		fieldType, err := utils.ParseFieldType(name)
+		if err != nil {
+			return err
+		}
+		fieldTypes[field] = fieldType
+	}
+	pkFields := make([]string, 0)
+	for _, field := range strings.Split(pk, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fieldTypes[field] = utils.IDX_TYPE_PK
+			pkFields = append(pkFields, field)
+		}
+	}
+
+	reader, err := openRecordReader(fileName, format)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := setDataPaths(dataPaths); err != nil {
+		return err
+	}
+	logger, err := utils.NewLogger("GoDanceImport")
+	if err != nil {
+		return err
+	}
+	engine.Engine = engine.NewDefaultEngine(logger)
+
+	imp := &importer{
+		indexName:  indexName,
+		columnMap:  columnMap,
+		pkFields:   pkFields,
+		fieldTypes: fieldTypes,
+		onError:    onError,
+		logger:     logger,
+	}
+	if badFile != "" {
+		fd, err := os.OpenFile(badFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		imp.badWriter = fd
+	}
+
+	startTime := time.Now()
+	ops := make([]gdindex.DocOperation, 0, batchSize)
+	lines := make([]int, 0, batchSize)
+	checked := false
+	processed := 0
+	lastCheckpoint := from
+
+	flush := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		errs, err := engine.Engine.ApplyOperations(indexName, ops)
+		if err != nil {
+			return err
+		}
+		for i, e := range errs {
+			if e == nil {
+				imp.indexed++
+				continue
+			}
+			if err := imp.badRow(lines[i], ops[i].Content, e); err != nil {
+				return err
+			}
+		}
+		ops = ops[:0]
+		lines = lines[:0]
+		return nil
+	}
+
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		// 读取文件出错后读取器不会再前进，只能中止并从断点重新导入
+		var recordErr *utils.RecordError
+		if err != nil && !errors.As(err, &recordErr) {
+			return imp.abort(lastCheckpoint, err)
+		}
+		line := reader.Line()
+		if line <= from {
+			continue
+		}
+		processed++
+		if err != nil {
+			if err := imp.badRow(line, nil, err); err != nil {
+				return imp.abort(lastCheckpoint, err)
+			}
+			continue
+		}
+
+		document := imp.mapRecord(record)
+
+		// 第一条有效记录到达时再检查索引，这样自动建索引时可以使用文件中的列
+		if !checked {
+			if err := imp.ensureIndex(document, create); err != nil {
+				return err
+			}
+			checked = true
+		}
+
+		if err := imp.coerce(document); err != nil {
+			if err := imp.badRow(line, record, err); err != nil {
+				return imp.abort(lastCheckpoint, err)
+			}
+			continue
+		}
+
+		ops = append(ops, gdindex.DocOperation{Action: gdindex.OP_INDEX, Content: document})
+		lines = append(lines, line)
+		if len(ops) >= batchSize {
+			if err := flush(); err != nil {
+				return imp.abort(lastCheckpoint, err)
+			}
+		}
+
+		if progress > 0 && processed%progress == 0 {
+			cost := time.Since(startTime).Seconds()
+			fmt.Printf("[INFO] import %v : line %v, indexed %v, bad %v, %.0f docs/s\n",
+				indexName, line, imp.indexed+len(ops), imp.bad, float64(imp.indexed+len(ops))/cost)
+		}
+
+		if checkpoint > 0 && processed%checkpoint == 0 {
+			if err := flush(); err != nil {
+				return imp.abort(lastCheckpoint, err)
+			}
+			if err := engine.Engine.SyncIndex(indexName); err != nil {
+				return imp.abort(lastCheckpoint, err)
+			}
+			lastCheckpoint = line
+			fmt.Printf("[INFO] import %v : checkpoint at line %v\n", indexName, line)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return imp.abort(lastCheckpoint, err)
+	}
+	if checked {
+		if err := engine.Engine.SyncIndex(indexName); err != nil {
+			return imp.abort(lastCheckpoint, err)
+		}
+	}
+
+	fmt.Printf("[INFO] import %v finish : lines %v, indexed %v, bad %v, cost %v\n",
+		indexName, reader.Line(), imp.indexed, imp.bad, time.Since(startTime))
+	return nil
+}
+
+// openRecordReader
+// @Description 根据格式打开流式读取器
+func openRecordReader(fileName, format string) (utils.RecordReader, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	}
+
+	switch format {
+	case "csv":
+		return utils.NewCsvStreamReader(fileName)
+	case "jsonl", "ndjson", "json":
+		return utils.NewJsonLinesReader(fileName)
+	}
+	return nil, fmt.Errorf("unknown file format %v", format)
+}
+
+// parsePairs
+// @Description 解析 a:b,c:d 形式的参数
+func parsePairs(value string) (map[string]string, error) {
+	res := make(map[string]string)
+	if strings.TrimSpace(value) == "" {
+		return res, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid pair [%v]", pair)
+		}
+		res[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return res, nil
+}
+
+// mapRecord
+// @Description 按列映射把记录转换为文档，没有映射的列保持原名
+func (imp *importer) mapRecord(record map[string]string) map[string]string {
+	document := make(map[string]string, len(record))
+	for col, value := range record {
+		if field, ok := imp.columnMap[col]; ok {
+			document[field] = value
+			continue
+		}
+		document[col] = value
+	}
+	return document
+}
+
+// ensureIndex
+// @Description 检查索引是否存在，需要时根据文档和字段类型自动建索引，并合并索引已有的字段类型
+func (imp *importer) ensureIndex(document map[string]string, create bool) error {
+	fields, err := engine.Engine.IndexMapping(imp.indexName)
+	if err != nil {
+		if !create {
+			return fmt.Errorf("index %v not found, use -create to create it", imp.indexName)
+		}
+
+		names := make([]string, 0, len(document))
+		for name := range document {
+			names = append(names, name)
+		}
+		for name := range imp.fieldTypes {
+			if _, ok := document[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		// 联合主键按 -pk 中的顺序组成，主键字段放在最前面
+		var idx engine.IndexStruct
+		added := make(map[string]bool)
+		for _, name := range imp.pkFields {
+			idx.FieldsMapping = append(idx.FieldsMapping, segment.SimpleFieldInfo{FieldName: name, FieldType: utils.IDX_TYPE_PK})
+			added[name] = true
+		}
+		for _, name := range names {
+			if added[name] {
+				continue
+			}
+			fieldType, ok := imp.fieldTypes[name]
+			if !ok {
+				fieldType = utils.IDX_TYPE_STRING
+			}
+			idx.FieldsMapping = append(idx.FieldsMapping, segment.SimpleFieldInfo{FieldName: name, FieldType: fieldType})
+		}
+
+		body, _ := json.Marshal(idx)
+		if err := engine.Engine.CreateIndex(imp.indexName, body); err != nil {
+			return err
+		}
+		fmt.Printf("[INFO] import : create index %v with %v fields\n", imp.indexName, len(idx.FieldsMapping))
+
+		if fields, err = engine.Engine.IndexMapping(imp.indexName); err != nil {
+			return err
+		}
+	}
+
+	// 命令行中指定的类型优先于索引中的类型
+	for name, fieldType := range fields {
+		if _, ok := imp.fieldTypes[name]; !ok {
+			imp.fieldTypes[name] = fieldType
+		}
+	}
+	return nil
+}
+
+// coerce
+// @Description 按字段类型转换文档中的值
+func (imp *importer) coerce(document map[string]string) error {
+	for name, value := range document {
+		fieldType, ok := imp.fieldTypes[name]
+		if !ok {
+			continue
+		}
+		v, err := utils.CoerceValue(fieldType, value)
+		if err != nil {
+			return fmt.Errorf("field %v : %v", name, err)
+		}
+		document[name] = v
+	}
+	return nil
+}
+
+// badRow
+// @Description 处理一条坏数据，abort 模式下返回错误
+func (imp *importer) badRow(line int, record map[string]string, cause error) error {
+	imp.bad++
+
+	switch imp.onError {
+	case ON_ERROR_ABORT:
+		return fmt.Errorf("line %v : %v", line, cause)
+	case ON_ERROR_LOG:
+		imp.logger.Warn("[WARN] import %v skip line %v : %v", imp.indexName, line, cause)
+	}
+
+	if imp.badWriter != nil {
+		buf, _ := json.Marshal(map[string]interface{}{
+			"line":   line,
+			"error":  cause.Error(),
+			"record": record,
+		})
+		imp.badWriter.Write(append(buf, '\n'))
+	}
+	return nil
+}
+
+// abort
+// @Description 导入中断时提示可以续传的位置
+func (imp *importer) abort(lastCheckpoint int, err error) error {
+	fmt.Printf("[ERROR] import %v aborted, indexed %v, bad %v, resume with -from %v\n",
+		imp.indexName, imp.indexed, imp.bad, lastCheckpoint)
+	return err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"GoDance/engine"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// badRows 读出坏数据文件中每条记录的行号和原因
+func badRows(t *testing.T, fileName string) map[int]string {
+	buf, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("read bad rows : %v", err)
+	}
+	rows := make(map[int]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		if line == "" {
+			continue
+		}
+		var row struct {
+			Line  int    `json:"line"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("bad row %q : %v", line, err)
+		}
+		rows[row.Line] = row.Error
+	}
+	return rows
+}
+
+// 按 -types 转换值，无法转换的记录写入坏数据文件，行号为记录的序号
+func TestImportCsvCoercion(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "books.csv")
+	content := "code,title,year,price,ok\n" +
+		"b1,Go,\"2,019\",12.5,true\n" +
+		"b2,Rust,abc,9,false\n" +
+		"b3,Zig,2021,x,true\n" +
+		"b4,C,1978.0,5,0\n"
+	if err := os.WriteFile(csvFile, []byte(content), 0644); err != nil {
+		t.Fatalf("write csv : %v", err)
+	}
+	badFile := filepath.Join(dir, "bad.jsonl")
+
+	args := []string{"-index", "books", "-file", csvFile, "-create", "-pk", "code", "-map", "title:name",
+		"-types", "year:number,price:double,ok:bool", "-bad-rows", badFile, "-data", filepath.Join(dir, "data"), "-progress", "0"}
+	if err := runImport(args); err != nil {
+		t.Fatalf("import : %v", err)
+	}
+
+	rows := badRows(t, badFile)
+	if len(rows) != 2 || !strings.Contains(rows[2], "year") || !strings.Contains(rows[3], "price") {
+		t.Fatalf("bad rows = %v, want line 2 year and line 3 price", rows)
+	}
+	for key, want := range map[string]map[string]string{
+		"b1": {"name": "Go", "year": "2019", "price": "12.5", "ok": "true"},
+		"b4": {"name": "C", "year": "1978", "price": "5", "ok": "false"},
+	} {
+		doc, err := engine.Engine.GetDocByKey(map[string]string{"index": "books", "pk": key})
+		if err != nil {
+			t.Fatalf("get %v : %v", key, err)
+		}
+		for field, value := range want {
+			if doc[field] != value {
+				t.Fatalf("get %v : %v = %q, want %q", key, field, doc[field], value)
+			}
+		}
+	}
+	for _, key := range []string{"b2", "b3"} {
+		if _, err := engine.Engine.GetDocByKey(map[string]string{"index": "books", "pk": key}); err == nil {
+			t.Fatalf("bad row %v was indexed", key)
+		}
+	}
+}
+
+// JSONL 中的空行不计入记录数，坏数据的行号与 -from 续传的位置一致
+func TestImportJsonLinesResume(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "users.jsonl")
+	content := `{"id":"u1","age":30}` + "\n\n" +
+		`{"id":"u2","age":` + "\n" +
+		"   \n" +
+		`{"id":"u3","age":"x"}` + "\n" +
+		`{"id":"u4","age":41.0}` + "\n"
+	if err := os.WriteFile(jsonFile, []byte(content), 0644); err != nil {
+		t.Fatalf("write jsonl : %v", err)
+	}
+	badFile := filepath.Join(dir, "bad.jsonl")
+
+	args := []string{"-index", "users", "-file", jsonFile, "-create", "-pk", "id", "-types", "age:number",
+		"-bad-rows", badFile, "-data", filepath.Join(dir, "data"), "-progress", "0"}
+	if err := runImport(args); err != nil {
+		t.Fatalf("import : %v", err)
+	}
+	rows := badRows(t, badFile)
+	if len(rows) != 2 || rows[2] == "" || !strings.Contains(rows[3], "age") {
+		t.Fatalf("bad rows = %v, want records 2 and 3", rows)
+	}
+	doc, err := engine.Engine.GetDocByKey(map[string]string{"index": "users", "pk": "u4"})
+	if err != nil || doc["age"] != "41" {
+		t.Fatalf("get u4 = %v, %v", doc, err)
+	}
+
+	// 从第 3 条记录之后续传时只处理第 4 条
+	resumeBad := filepath.Join(dir, "resume-bad.jsonl")
+	args = []string{"-index", "resumed", "-file", jsonFile, "-create", "-pk", "id", "-types", "age:number",
+		"-bad-rows", resumeBad, "-data", filepath.Join(dir, "resume"), "-progress", "0", "-from", "3"}
+	if err := runImport(args); err != nil {
+		t.Fatalf("resume import : %v", err)
+	}
+	if rows := badRows(t, resumeBad); len(rows) != 0 {
+		t.Fatalf("resumed import reported bad rows %v", rows)
+	}
+	if _, err := engine.Engine.GetDocByKey(map[string]string{"index": "resumed", "pk": "u4"}); err != nil {
+		t.Fatalf("get resumed u4 : %v", err)
+	}
+	if _, err := engine.Engine.GetDocByKey(map[string]string{"index": "resumed", "pk": "u1"}); err == nil {
+		t.Fatalf("resumed import indexed a record before -from")
+	}
+}
@@ -2,29 +2,68 @@ package main
 
 import (
 	"GoDance/engine"
+	"GoDance/index/segment"
 	"GoDance/utils"
 	"GoDance/web"
 	"flag"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"os"
 	"runtime"
+	"strings"
 )
 
+// commands 子命令，不带子命令时启动搜索服务
+var commands = map[string]func(args []string) error{
+	"import": runImport,
+	"export": runExport,
+	"check":  runCheck,
+}
+
+// dataPathsVar 注册 -data 参数，所有子命令共用
+func dataPathsVar(fs *flag.FlagSet, p *string) {
+	fs.StringVar(p, "data", utils.IDX_ROOT_PATH, "数据目录，多个目录用逗号分隔，第一个为保存引擎元信息的根目录，新索引放在剩余空间最大的目录中")
+}
+
+// setDataPaths 按 -data 参数设置数据目录，需要在创建引擎前调用
+func setDataPaths(value string) error {
+	return utils.SetDataPaths(strings.Split(value, ","))
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Printf("[ERROR] %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var cores int
 	var mport int
 	var lport int
 	var master int
 	var localip string
 	var masterip string
+	var maxFiles int
+	var dataPaths string
 	flag.IntVar(&cores, "core", runtime.NumCPU(), "CPU 核心数量")
 	flag.IntVar(&lport, "p", 9090, "启动端口，默认9991")
 	flag.IntVar(&master, "m", 0, "启动master，默认启动的为searcher")
 	flag.StringVar(&localip, "lip", "127.0.0.1", "本机ip地址，默认127.0.0.1")
 	flag.StringVar(&masterip, "mip", "127.0.0.1", "主节点ip地址，默认127.0.0.1")
 	flag.IntVar(&mport, "mp", 9990, "主节点端口，默认9990")
+	flag.IntVar(&maxFiles, "maxfiles", segment.DEFAULT_MAX_OPEN_FILES, "同时打开的段文件数量上限，默认1024")
+	dataPathsVar(flag.CommandLine, &dataPaths)
 
 	flag.Parse()
+	segment.SetMaxOpenFiles(maxFiles)
+	if err := setDataPaths(dataPaths); err != nil {
+		fmt.Printf("[ERROR] Set Data Paths Error: %v\n", err)
+		return
+	}
 	logger, err := utils.NewLogger("GoDanceEngine")
 	if err != nil {
 		fmt.Printf("[ERROR] Create logger Error: %v\n", err)
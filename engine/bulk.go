@@ -0,0 +1,195 @@
+package engine
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// bulkMeta 批量请求中动作行的元信息
+type bulkMeta struct {
+	Index     string `json:"_index"`
+	Id        string `json:"_id"`
+	IfVersion uint64 `json:"if_version"`
+}
+
+// BulkItem 批量请求中单个操作的执行结果
+type BulkItem struct {
+	Action string `json:"action"`
+	Index  string `json:"index"`
+	Id     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkResult 批量请求的返回结果
+type BulkResult struct {
+	CostTime string     `json:"costTime"`
+	Errors   bool       `json:"errors"`
+	Items    []BulkItem `json:"items"`
+}
+
+// bulkRequest 解析后的单个操作，item 指向返回结果中对应的位置
+type bulkRequest struct {
+	index string
+	op    gdindex.DocOperation
+	item  *BulkItem
+}
+
+// Bulk
+// @Description 批量新增、更新、删除文档，请求体为 NDJSON 格式
+// @Param params 请求参数，index 为默认索引名
+// @Param body  请求体，每个动作占一行，index/update 动作的下一行为文档内容
+// @Return BulkResult 每个操作的执行结果
+// @Return error 任何错误
+func (gde *GoDanceEngine) Bulk(params map[string]string, body []byte) (BulkResult, error) {
+	startTime := time.Now()
+	var result BulkResult
+
+	defaultIndex := params["index"]
+	items, requests, err := gde.parseBulkBody(defaultIndex, body)
+	if err != nil {
+		return result, err
+	}
+
+	// 相邻且属于同一索引的操作合并为一批，一批只加一次索引锁
+	for start := 0; start < len(requests); {
+		end := start + 1
+		for end < len(requests) && end-start < utils.BULK_BATCH_SIZE && requests[end].index == requests[start].index {
+			end++
+		}
+
+		batch := requests[start:end]
+		ops := make([]gdindex.DocOperation, len(batch))
+		for i, req := range batch {
+			ops[i] = req.op
+		}
+
+		// 新增文档时索引不存在，按匹配的模板创建
+		for _, req := range batch {
+			if req.op.Action == gdindex.OP_INDEX {
+				err = gde.ensureIndex(req.index)
+				break
+			}
+		}
+		var errs []error
+		if err == nil {
+			errs, err = gde.idxManager.applyOperations(batch[0].index, ops)
+		}
+		for i, req := range batch {
+			if err != nil {
+				req.item.Status = http.StatusNotFound
+				req.item.Error = err.Error()
+				continue
+			}
+			if IsConflict(errs[i]) {
+				req.item.Status = http.StatusConflict
+				req.item.Error = errs[i].Error()
+				continue
+			}
+			if errs[i] != nil {
+				req.item.Status = http.StatusBadRequest
+				req.item.Error = errs[i].Error()
+				continue
+			}
+			req.item.Status = http.StatusOK
+		}
+		start = end
+	}
+
+	result.Items = items
+	for _, item := range items {
+		if item.Status != http.StatusOK {
+			result.Errors = true
+			break
+		}
+	}
+	result.CostTime = fmt.Sprintf("%v", time.Since(startTime))
+
+	return result, nil
+}
+
+// parseBulkBody
+// @Description 解析 NDJSON 请求体，格式错误的操作直接记录在结果中，不影响其他操作
+func (gde *GoDanceEngine) parseBulkBody(defaultIndex string, body []byte) ([]BulkItem, []bulkRequest, error) {
+	lines := make([][]byte, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		lines = append(lines, append([]byte(nil), line...))
+	}
+	if err := scanner.Err(); err != nil {
+		gde.Logger.Error("[ERROR] Read Bulk Body Error : %v", err)
+		return nil, nil, errors.New(JsonParseError)
+	}
+
+	// 先确定结果切片的长度，保证 bulkRequest 中的指针不会因为扩容失效
+	items := make([]BulkItem, 0, len(lines))
+	requests := make([]bulkRequest, 0, len(lines))
+
+	for i := 0; i < len(lines); i++ {
+		action := make(map[string]bulkMeta)
+		if err := json.Unmarshal(lines[i], &action); err != nil || len(action) != 1 {
+			items = append(items, BulkItem{Status: http.StatusBadRequest, Error: "malformed action line"})
+			continue
+		}
+
+		var name string
+		var meta bulkMeta
+		for name, meta = range action {
+		}
+		if meta.Index == "" {
+			meta.Index = defaultIndex
+		}
+		items = append(items, BulkItem{Action: name, Index: meta.Index, Id: meta.Id})
+		item := &items[len(items)-1]
+
+		if meta.Index == "" {
+			item.Status = http.StatusBadRequest
+			item.Error = ParamsError
+			continue
+		}
+
+		op := gdindex.DocOperation{Action: name, Key: meta.Id, IfVersion: meta.IfVersion}
+		switch name {
+		case gdindex.OP_INDEX, gdindex.OP_UPDATE:
+			if i+1 >= len(lines) {
+				item.Status = http.StatusBadRequest
+				item.Error = "missing document line"
+				continue
+			}
+			i++
+			document := make(map[string]string)
+			if err := json.Unmarshal(lines[i], &document); err != nil {
+				item.Status = http.StatusBadRequest
+				item.Error = JsonParseError
+				continue
+			}
+			op.Content = document
+		case gdindex.OP_DELETE:
+			if meta.Id == "" {
+				item.Status = http.StatusBadRequest
+				item.Error = NoPrimaryKey
+				continue
+			}
+		default:
+			item.Status = http.StatusBadRequest
+			item.Error = fmt.Sprintf("unknown action %v", name)
+			continue
+		}
+
+		requests = append(requests, bulkRequest{index: meta.Index, op: op, item: item})
+	}
+
+	return items, requests, nil
+}
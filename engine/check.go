@@ -0,0 +1,15 @@
+package engine
+
+import (
+	gdindex "GoDance/index"
+)
+
+// Check
+// @Description 检查索引文件的完整性
+// @Param indexName 索引名，为空时检查所有索引
+// @Param quarantine 是否隔离有问题的段
+// @Return []gdindex.CheckReport 每个索引的检查结果
+// @Return error 任何错误
+func (gde *GoDanceEngine) Check(indexName string, quarantine bool) ([]gdindex.CheckReport, error) {
+	return gde.idxManager.check(indexName, quarantine)
+}
@@ -1,6 +1,9 @@
 package engine
 
-import "GoDance/index/segment"
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+)
 
 type NodeIndex struct {
 	IndexName    string                    `json:"indexname"`
@@ -14,4 +17,9 @@ type NodeIndex struct {
 type IndexStruct struct {
 	IndexName     string                    `json:"indexname"`
 	FieldsMapping []segment.SimpleFieldInfo `json:"fieldsmapping"`
+	TTL           string                    `json:"ttl"`                // 文档存活时间，如 7d、12h、3600
+	TTLField      string                    `json:"ttlField"`           // 计算过期时间的日期字段
+	Codec         string                    `json:"codec"`              // 字段内容的压缩方式，none 或 snappy，等同于 settings.codec
+	Dynamic       string                    `json:"dynamic"`            // 未知字段的处理方式，true、false 或 strict
+	Settings      *gdindex.IndexSettings    `json:"settings,omitempty"` // 持久化、合并、分词和相关度的设置
 }
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/search/boolea"
+	"GoDance/utils"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 导出支持的格式
+const (
+	EXPORT_JSONL = "jsonl"
+	EXPORT_CSV   = "csv"
+)
+
+// 导出时不作为查询条件的参数
+var exportReservedParams = map[string]struct{}{
+	"index":  {},
+	"format": {},
+	"fields": {},
+}
+
+// Export
+// @Description 按 docId 顺序导出索引中所有未删除的文档，可以带上与搜索相同的查询条件
+// @Param params 请求参数，index 为索引名，format 为 jsonl 或 csv，fields 为逗号分隔的导出字段，其余参数为查询条件
+// @Param w 输出
+// @Return error 任何错误
+func (gde *GoDanceEngine) Export(params map[string]string, w io.Writer) error {
+	indexName, hasIndex := params["index"]
+	if !hasIndex || indexName == "" {
+		return errors.New(ParamsError)
+	}
+
+	idx := gde.idxManager.GetIndex(indexName)
+	if idx == nil {
+		return errors.New(IndexNotFound)
+	}
+
+	format := params["format"]
+	if format == "" {
+		format = EXPORT_JSONL
+	}
+	if format != EXPORT_JSONL && format != EXPORT_CSV {
+		return fmt.Errorf("unknown export format %v", format)
+	}
+
+	columns := gde.exportColumns(params["fields"], idx)
+	include, exclude := gde.matchDocIds(params, idx)
+
+	writer := bufio.NewWriter(w)
+	var csvWriter *csv.Writer
+	if format == EXPORT_CSV {
+		csvWriter = csv.NewWriter(writer)
+		if err := csvWriter.Write(columns); err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, len(columns))
+	err := idx.ForEachDocument(func(docId uint64, doc map[string]string) error {
+		if include != nil {
+			if _, ok := include[docId]; !ok {
+				return nil
+			}
+		}
+		if _, ok := exclude[docId]; ok {
+			return nil
+		}
+
+		if csvWriter != nil {
+			for i, col := range columns {
+				record[i] = doc[col]
+			}
+			return csvWriter.Write(record)
+		}
+
+		out := make(map[string]string, len(columns))
+		for _, col := range columns {
+			out[col] = doc[col]
+		}
+		buf, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(buf); err != nil {
+			return err
+		}
+		return writer.WriteByte('\n')
+	})
+	if err != nil {
+		gde.Logger.Error("[ERROR] Export Index %v Error : %v", indexName, err)
+		return err
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// exportColumns
+// @Description 计算导出的字段，未指定时导出所有存储的字段
+func (gde *GoDanceEngine) exportColumns(fields string, idx *gdindex.Index) []string {
+	columns := make([]string, 0)
+	if strings.TrimSpace(fields) != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				columns = append(columns, field)
+			}
+		}
+		return columns
+	}
+
+	for name := range idx.FieldTypes() {
+		// 子字段的值从父字段复制，导出父字段即可
+		if !idx.IsSubField(name) {
+			columns = append(columns, name)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// matchDocIds
+// @Description 根据查询条件计算需要导出的文档，include 为 nil 表示不限制，exclude 中的文档不导出
+func (gde *GoDanceEngine) matchDocIds(params map[string]string, idx *gdindex.Index) (map[uint64]struct{}, map[uint64]struct{}) {
+	conditions := make(map[string]string)
+	for param, value := range params {
+		if _, ok := exportReservedParams[param]; !ok {
+			conditions[param] = value
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	searchFilters, searchQueries, notSearchQueries := parseParams(conditions, idx)
+
+	var docIds []uint64
+	restricted := false
+	if len(searchQueries) > 0 {
+		nodes := make([]utils.DocIdNode, 0)
+		for _, query := range searchQueries {
+			if ids, ok := idx.SearchKeyDocIds(query); ok {
+				nodes = boolea.UnionDocIdNode(nodes, ids)
+			}
+		}
+		docIds = utils.DocIdNodeChangeUint64(nodes)
+		restricted = true
+	}
+	for _, filter := range searchFilters {
+		ids, _ := idx.SearchFilterDocIds(filter)
+		if !restricted {
+			docIds = ids
+			restricted = true
+			continue
+		}
+		docIds = boolea.IntersectionUint64(docIds, ids)
+	}
+
+	var include map[uint64]struct{}
+	if restricted {
+		include = make(map[uint64]struct{}, len(docIds))
+		for _, docId := range docIds {
+			include[docId] = struct{}{}
+		}
+	}
+
+	exclude := make(map[uint64]struct{})
+	for _, query := range notSearchQueries {
+		ids, _ := idx.SearchKeyDocIds(query)
+		for _, node := range ids {
+			exclude[node.Docid] = struct{}{}
+		}
+	}
+
+	return include, exclude
+}
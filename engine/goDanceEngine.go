@@ -29,6 +29,7 @@ type GoDanceEngine struct {
 	MasterPort int           // 主节点端口号
 	Logger     *utils.Log4FE `json:"-"`
 	trie       related.Trie
+	tasks      *taskManager // 后台任务
 }
 
 // 一些返回的错误常量
@@ -39,18 +40,30 @@ const (
 	NoPrimaryKey   string = "没有主键"
 	QueryError     string = "查询条件有问题，请检查查询条件"
 	IndexNotFound  string = "未找到对应的索引"
+	IndexExists    string = "索引已存在"
+	TaskNotFound   string = "未找到对应的任务"
 	OK             string = `"status":"OK"`
 	NotFound       string = `"status":"NotFound"`
 	Fail           string = `"status":"Fail"`
+	Conflict       string = `"status":"Conflict"`
 )
 
+// KEY_PARAM 按主键获取和删除文档时直接给出主键的请求参数
+const KEY_PARAM = "pk"
+
+// IsConflict 判断错误是否为版本冲突
+func IsConflict(err error) bool {
+	return errors.Is(err, gdindex.ErrVersionConflict)
+}
+
 // NewDefaultEngine
 // @Description 初始化引擎
 // @Param logger 日志
 // @Return *GoDanceEngine 引擎对象
 func NewDefaultEngine(logger *utils.Log4FE) *GoDanceEngine {
 
-	this := &GoDanceEngine{Logger: logger, idxManager: newIndexManager(logger), trie: related.Constructor(utils.TRIE_PATH)}
+	this := &GoDanceEngine{Logger: logger, idxManager: newIndexManager(logger), trie: related.Constructor(utils.TriePath()),
+		tasks: newTaskManager()}
 	return this
 }
 
@@ -69,7 +82,41 @@ func (gde *GoDanceEngine) CreateIndex(indexName string, body []byte) error {
 		return errors.New(JsonParseError)
 	}
 
-	return gde.idxManager.CreateIndex(indexName, idx.FieldsMapping)
+	return gde.createIndex(indexName, idx)
+}
+
+// createIndex 按字段信息和设置创建索引，手动创建和按模板自动创建共用
+func (gde *GoDanceEngine) createIndex(indexName string, idx IndexStruct) error {
+	ttl, err := validIndexStruct(idx)
+	if err != nil {
+		return err
+	}
+
+	var settings gdindex.IndexSettings
+	if idx.Settings != nil {
+		settings = *idx.Settings
+	}
+	// 兼容放在请求顶层的 codec，settings 中同时给出时以 settings 为准
+	if idx.Codec != "" && settings.Codec == "" {
+		settings.Codec = idx.Codec
+	}
+
+	return gde.idxManager.CreateIndex(indexName, idx.FieldsMapping, func(index *gdindex.Index) error {
+		if idx.Dynamic != "" {
+			if err := index.SetDynamic(idx.Dynamic); err != nil {
+				return err
+			}
+		}
+		if settings != (gdindex.IndexSettings{}) {
+			if err := index.SetSettings(settings); err != nil {
+				return err
+			}
+		}
+		if ttl > 0 || idx.TTLField != "" {
+			return index.SetTTL(ttl, idx.TTLField)
+		}
+		return nil
+	})
 }
 
 // DeleteIndex todo 删除索引
@@ -114,6 +161,17 @@ func (gde *GoDanceEngine) AddDocument(params map[string]string, body []byte) (st
 		return "", errors.New(JsonParseError)
 	}
 
+	ifVersion, err := parseIfVersion(params)
+	if err != nil {
+		return Fail, err
+	}
+	if err := gde.ensureIndex(indexName); err != nil {
+		return Fail, err
+	}
+	if ifVersion > 0 {
+		return gde.writeWithVersion(indexName, gdindex.DocOperation{Action: gdindex.OP_INDEX, Content: document, IfVersion: ifVersion})
+	}
+
 	return gde.idxManager.addDocument(indexName, document)
 }
 
@@ -123,13 +181,73 @@ func (gde *GoDanceEngine) DeleteDocument(params map[string]string) (string, erro
 		return Fail, errors.New(ParamsError)
 	}
 
-	id, haspk := params["id"]
-	if !haspk {
+	idx := gde.idxManager.GetIndex(indexName)
+	if idx == nil {
+		return Fail, errors.New(IndexNotFound)
+	}
+
+	id, err := gde.primaryKeyOf(idx, params)
+	if err != nil {
 		return Fail, errors.New(NoPrimaryKey)
 	}
 
+	ifVersion, err := parseIfVersion(params)
+	if err != nil {
+		return Fail, err
+	}
+	if ifVersion > 0 {
+		return gde.writeWithVersion(indexName, gdindex.DocOperation{Action: gdindex.OP_DELETE, Key: id, IfVersion: ifVersion})
+	}
+
 	return gde.idxManager.deleteDocument(indexName, id)
 }
+
+// parseIfVersion
+// @Description 解析 if_version 参数，没有该参数时返回 0
+func parseIfVersion(params map[string]string) (uint64, error) {
+	value, ok := params["if_version"]
+	if !ok || value == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || version == 0 {
+		return 0, errors.New(ParamsError)
+	}
+	return version, nil
+}
+
+// writeWithVersion
+// @Description 执行一个带版本检查的写入操作，版本不一致时返回 Conflict
+func (gde *GoDanceEngine) writeWithVersion(indexName string, op gdindex.DocOperation) (string, error) {
+	errs, err := gde.idxManager.applyOperations(indexName, []gdindex.DocOperation{op})
+	if err != nil {
+		return Fail, err
+	}
+	if IsConflict(errs[0]) {
+		return Conflict, errs[0]
+	}
+	if errs[0] != nil {
+		return Fail, errs[0]
+	}
+	return OK, nil
+}
+
+// primaryKeyOf
+// @Description 从请求参数中取出主键，KEY_PARAM 参数直接给出主键，否则按主键字段名逐个取值，用于联合主键
+func (gde *GoDanceEngine) primaryKeyOf(idx *gdindex.Index, params map[string]string) (string, error) {
+	if key, ok := params[KEY_PARAM]; ok && key != "" {
+		return key, nil
+	}
+	return idx.PrimaryKeyOf(params)
+}
+
+// UpdateDocument
+// @Description 更新文档
+// @Param params 请求参数，partial=true 时只更新给出的字段，upsert=true 时主键不存在则新增，
+// if_version 不为空时只有当前版本与之相同才更新
+// @Param body  请求体
+// @Return string JSON字符串
+// @Return error
 func (gde *GoDanceEngine) UpdateDocument(params map[string]string, body []byte) (string, error) {
 	indexName, hasIndex := params["index"]
 	if !hasIndex || indexName == "" {
@@ -142,7 +260,90 @@ func (gde *GoDanceEngine) UpdateDocument(params map[string]string, body []byte)
 		return Fail, errors.New(JsonParseError)
 	}
 
-	return gde.idxManager.updateDocument(indexName, document)
+	ifVersion, err := parseIfVersion(params)
+	if err != nil {
+		return Fail, err
+	}
+	opts := gdindex.UpdateOptions{
+		Partial:   params["partial"] == "true",
+		Upsert:    params["upsert"] == "true",
+		IfVersion: ifVersion,
+	}
+	if opts.Upsert {
+		if err := gde.ensureIndex(indexName); err != nil {
+			return Fail, err
+		}
+	}
+	msg, err := gde.idxManager.updateDocument(indexName, document, opts)
+	if IsConflict(err) {
+		return Conflict, err
+	}
+	return msg, err
+}
+
+// IndexMapping
+// @Description 获取索引的字段信息
+// @Param indexName 索引名
+// @Return map[string]uint64 字段名到字段类型的映射
+// @Return error 索引不存在时返回错误
+func (gde *GoDanceEngine) IndexMapping(indexName string) (map[string]uint64, error) {
+	idx := gde.idxManager.GetIndex(indexName)
+	if idx == nil {
+		return nil, errors.New(IndexNotFound)
+	}
+
+	fieldTypes := idx.FieldTypes()
+	fields := make(map[string]uint64, len(fieldTypes))
+	for name, fieldType := range fieldTypes {
+		fields[name] = fieldType
+	}
+	return fields, nil
+}
+
+// GetSettings
+// @Description 获取索引当前生效的设置
+// @Param indexName 索引名
+// @Return gdindex.IndexSettings 设置，没有指定的项为默认值
+// @Return error 索引不存在时返回错误
+func (gde *GoDanceEngine) GetSettings(indexName string) (gdindex.IndexSettings, error) {
+	idx := gde.idxManager.GetIndex(indexName)
+	if idx == nil {
+		return gdindex.IndexSettings{}, errors.New(IndexNotFound)
+	}
+	return idx.EffectiveSettings(), nil
+}
+
+// UpdateSettings
+// @Description 修改索引的设置，请求体中没有的项保持不变
+// @Param indexName 索引名
+// @Param body 请求体，Json格式的设置
+// @Return gdindex.IndexSettings 修改后生效的设置
+// @Return error 任何错误
+func (gde *GoDanceEngine) UpdateSettings(indexName string, body []byte) (gdindex.IndexSettings, error) {
+	idx := gde.idxManager.GetIndex(indexName)
+	if idx == nil {
+		return gdindex.IndexSettings{}, errors.New(IndexNotFound)
+	}
+
+	return idx.UpdateSettings(body)
+}
+
+// ApplyOperations
+// @Description 对某个索引批量执行文档操作
+// @Param indexName 索引名
+// @Param ops 文档操作
+// @Return []error 每个操作的错误
+// @Return error 索引不存在时返回错误
+func (gde *GoDanceEngine) ApplyOperations(indexName string, ops []gdindex.DocOperation) ([]error, error) {
+	return gde.idxManager.applyOperations(indexName, ops)
+}
+
+// SyncIndex
+// @Description 将索引的内存段持久化到磁盘
+// @Param indexName 索引名
+// @Return error 任何错误
+func (gde *GoDanceEngine) SyncIndex(indexName string) error {
+	return gde.idxManager.sync(indexName)
 }
 
 // RealTimeSearch
@@ -192,7 +393,8 @@ func (gde *GoDanceEngine) Search(params map[string]string) (utils.DefaultResult,
 	}
 
 	// 建立过滤条件和搜索条件
-	searchFilters, searchQueries, notSearchQueries := gde.parseParams(params, idx)
+	gde.recordKeywords(params)
+	searchFilters, searchQueries, notSearchQueries := parseParams(params, idx)
 	QueryNodes := make([]utils.DocIdNode, 0)
 	docFilterIds := make([]uint64, 0)
 	notDocQueryNodes := make([]utils.DocIdNode, 0)
@@ -209,18 +411,13 @@ func (gde *GoDanceEngine) Search(params map[string]string) (utils.DefaultResult,
 	//fmt.Printf("query: %v\n", len(QueryNodes))
 
 	// 对每个 筛选词文档 求交集
-	if len(searchFilters) == 1 {
-		docFilterIds, _ = idx.SearchFilterDocIds(searchFilters[0])
-	} else {
-		for _, filter := range searchFilters {
-			var ids []uint64
-			var ok bool
-
-			ids, ok = idx.SearchFilterDocIds(filter)
-			if ok {
-				docFilterIds = boolea.IntersectionUint64(docFilterIds, ids)
-			}
+	for i, filter := range searchFilters {
+		ids, _ := idx.SearchFilterDocIds(filter)
+		if i == 0 {
+			docFilterIds = ids
+			continue
 		}
+		docFilterIds = boolea.IntersectionUint64(docFilterIds, ids)
 	}
 
 	fmt.Printf("filter: %v\n", docFilterIds)
@@ -237,7 +434,10 @@ func (gde *GoDanceEngine) Search(params map[string]string) (utils.DefaultResult,
 	// 对 搜索词和筛选词文档求交集，再对过滤词文档 NOT
 	// 搜索词跟筛选词求交集
 	var keyFilter []uint64
-	if len(searchFilters) != 0 {
+	if len(searchQueries) == 0 {
+		// 没有搜索词时过滤的结果就是命中的文档，如只给出 exists=price，复制一份避免 NOT 时改动 docFilterIds
+		keyFilter = append([]uint64(nil), docFilterIds...)
+	} else if len(searchFilters) != 0 {
 		keyFilter = boolea.IntersectionDocIdAndUint64(QueryNodes, docFilterIds)
 	} else {
 		keyFilter = utils.DocIdNodeChangeUint64(QueryNodes)
@@ -250,6 +450,42 @@ func (gde *GoDanceEngine) Search(params map[string]string) (utils.DefaultResult,
 	// 对 docMergeFilter 的所有文档进行权重排序
 	docWeightSort := DocWeightSort(docAndNot, notDocQueryNodes, searchQueries, idx, docFilterIds)
 
+	// 按字段排序、统计和折叠，统计针对所有命中的文档
+	if sortParam := params["sort"]; sortParam != "" {
+		specs, err := parseSortSpecs(sortParam)
+		if err != nil {
+			return resultSet, err
+		}
+		if err := idx.SortDocIds(docWeightSort, specs); err != nil {
+			return resultSet, err
+		}
+	}
+	if facetParam := params["facet"]; facetParam != "" {
+		size := 10
+		if sizeParam := params["facet_size"]; sizeParam != "" {
+			n, err := strconv.Atoi(sizeParam)
+			if err != nil || n <= 0 {
+				return resultSet, errors.New(ParamsError)
+			}
+			size = n
+		}
+		resultSet.Facets = make(map[string][]utils.FacetItem)
+		for _, field := range strings.Split(facetParam, ",") {
+			items, err := idx.Facet(docWeightSort, strings.TrimSpace(field), size)
+			if err != nil {
+				return resultSet, err
+			}
+			resultSet.Facets[strings.TrimSpace(field)] = items
+		}
+	}
+	if collapseParam := params["collapse"]; collapseParam != "" {
+		collapsed, err := idx.Collapse(docWeightSort, collapseParam)
+		if err != nil {
+			return resultSet, err
+		}
+		docWeightSort = collapsed
+	}
+
 	lens := int64(len(docWeightSort))
 	fmt.Printf("lens : %v\n", lens)
 	fmt.Printf("docWeightSort:", docWeightSort)
@@ -268,9 +504,16 @@ func (gde *GoDanceEngine) Search(params map[string]string) (utils.DefaultResult,
 	resultSet.Results = make([]map[string]string, 0)
 	for _, docId := range docWeightSort[start:end] {
 		doc, ok := idx.GetDocument(docId)
-		doc["id"] = fmt.Sprintf("%v", docId)
 		// fmt.Println(doc)
 		if ok {
+			// 结果中原来用 id 返回 docId，文档自己有 id 字段（如主键）时保留文档的值，docId 总是放在 _id 中
+			doc["_id"] = fmt.Sprintf("%v", docId)
+			if _, has := doc["id"]; !has {
+				doc["id"] = doc["_id"]
+			}
+			if version, ok := idx.Version(doc); ok {
+				doc["_version"] = fmt.Sprintf("%v", version)
+			}
 			resultSet.Results = append(resultSet.Results, doc)
 		}
 	}
@@ -328,44 +571,258 @@ func (gde *GoDanceEngine) calcStartEnd(ps, cp string, docSize int64) (int64, int
 	return start, end, nil
 }
 
-// parseParams
-// @Description 根据请求参数生成对应的搜索条件和过滤条件
-func (gde *GoDanceEngine) parseParams(params map[string]string, idx *gdindex.Index) ([]utils.SearchFilters, []utils.SearchQuery, []utils.SearchQuery) {
+// 搜索时不作为查询条件的参数
+var searchReservedParams = map[string]struct{}{
+	"sort":       {},
+	"facet":      {},
+	"facet_size": {},
+	"collapse":   {},
+}
 
-	searchFilters := make([]utils.SearchFilters, 0)
-	searchQueries := make([]utils.SearchQuery, 0)
-	notSearchQueries := make([]utils.SearchQuery, 0)
+// parseSortSpecs
+// @Description 解析排序参数，如 year:desc,title:asc:first，默认升序，第三部分为没有值的文档排在最前(first)或最后(last)，默认最后
+func parseSortSpecs(value string) ([]gdindex.SortSpec, error) {
+	specs := make([]gdindex.SortSpec, 0)
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), ":", 3)
+		if parts[0] == "" {
+			continue
+		}
+		spec := gdindex.SortSpec{Field: parts[0]}
+		if len(parts) >= 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc", "":
+			case "desc":
+				spec.Desc = true
+			default:
+				return nil, fmt.Errorf("invalid sort order %v", parts[1])
+			}
+		}
+		if len(parts) == 3 {
+			switch strings.ToLower(parts[2]) {
+			case "last":
+			case "first":
+				spec.MissingFirst = true
+			default:
+				return nil, fmt.Errorf("invalid sort missing %v", parts[2])
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
 
-	fmt.Println(params)
+// filterValue
+// @Description 按字段类型把过滤条件的值转换为正排中存储的数字范围，浮点数可以带小数，
+// 日期和日期时间可以是日期字符串或 now-7d/d 形式的日期运算，取整时返回所在单位的起止，否则起止相同
+// @Param idx 索引
+// @Param fieldName 字段名
+// @Param value 过滤条件的值
+// @Param now 日期运算中 now 表示的时间
+// @Return int64 范围的起点
+// @Return int64 范围的终点
+// @Return error 无法解析时返回错误
+func filterValue(idx *gdindex.Index, fieldName, value string, now time.Time) (int64, int64, error) {
+	switch idx.FieldTypes()[fieldName] {
+	case utils.IDX_TYPE_DOUBLE:
+		v, err := utils.ParseDouble(value)
+		return v, v, err
+	case utils.IDX_TYPE_FLOAT:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return -1, -1, err
+		}
+		return int64(f * 100), int64(f * 100), nil
+	case utils.IDX_TYPE_DATETIME:
+		return idx.DateParser(fieldName).ParseMath(value, now)
+	case utils.IDX_TYPE_BOOL:
+		// 布尔值按 0 和 1 建立索引
+		b, err := utils.ParseBool(value)
+		if err != nil {
+			return -1, -1, err
+		}
+		if b {
+			return 1, 1, nil
+		}
+		return 0, 0, nil
+	case utils.IDX_TYPE_DATE:
+		// 日期存储的是本地时区的秒级时间戳，兼容直接给出时间戳
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v, v, nil
+		}
+		parser, err := utils.NewDateParser("", "Local")
+		if err != nil {
+			return -1, -1, err
+		}
+		lo, hi, err := parser.ParseMath(value, now)
+		if err != nil {
+			return -1, -1, err
+		}
+		return utils.FloorDiv(lo, 1000), utils.FloorDiv(hi, 1000), nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	return v, v, err
+}
+
+// ipFilter
+// @Description IP 地址字段的过滤条件，按 16 字节的地址比较，等于过滤和范围的两端都可以是 CIDR
+// @Param op 过滤的前缀 - > < ~
+// @Param fieldName 字段名
+// @Param value 地址、CIDR 或逗号分隔的范围
+// @Return utils.SearchFilters 过滤条件
+// @Return error 无法解析时返回错误
+func ipFilter(op byte, fieldName, value string) (utils.SearchFilters, error) {
+	sf := utils.SearchFilters{FieldName: fieldName}
+	if op == '~' {
+		minMax := strings.Split(value, ",")
+		if len(minMax) != 2 {
+			return sf, fmt.Errorf("invalid ip range [%v]", value)
+		}
+		start, _, err := utils.ParseIPRange(minMax[0])
+		if err != nil {
+			return sf, err
+		}
+		_, end, err := utils.ParseIPRange(minMax[1])
+		if err != nil {
+			return sf, err
+		}
+		sf.Type, sf.StartTerm, sf.EndTerm = utils.FILT_RANGE, start, end
+		return sf, nil
+	}
+
+	start, end, err := utils.ParseIPRange(value)
+	if err != nil {
+		return sf, err
+	}
+	switch op {
+	case '-':
+		sf.Type, sf.StartTerm, sf.EndTerm = utils.FILT_EQ, start, end
+	case '>':
+		sf.Type, sf.StartTerm = utils.FILT_OVER, start
+	case '<':
+		sf.Type, sf.EndTerm = utils.FILT_LESS, end
+	}
+	return sf, nil
+}
+
+// eqFilter
+// @Description 等于过滤条件，日期运算取整后为范围过滤
+func eqFilter(fieldName string, lo, hi int64) utils.SearchFilters {
+	if lo == hi {
+		return utils.SearchFilters{FieldName: fieldName, Type: utils.FILT_EQ, Start: lo}
+	}
+	return utils.SearchFilters{FieldName: fieldName, Type: utils.FILT_RANGE, Start: lo, End: hi}
+}
+
+// isKeywordParam 判断请求参数是否为关键词搜索，其余参数为过滤条件或保留参数
+func isKeywordParam(param string) bool {
+	if param == "" || param == "index" || param == "pageSize" || param == "curPage" || param == "exists" || param == "missing" {
+		return false
+	}
+	if _, ok := searchReservedParams[param]; ok {
+		return false
+	}
+	return strings.IndexByte("-><~_", param[0]) < 0
+}
+
+// recordKeywords
+// @Description 把搜索的关键词加入联想词的 Trie 树并写入联想词文件，只有搜索请求需要记录
+// @Param params 请求参数
+func (gde *GoDanceEngine) recordKeywords(params map[string]string) {
 	// 打开要写入的文件
-	trieFd, err := os.OpenFile(utils.TRIE_PATH, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	trieFd, err := os.OpenFile(utils.TriePath(), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		gde.Logger.Error("[ERROR] Open Trie File Error : %v", err)
+		return
+	}
 	defer trieFd.Close()
 	writer := bufio.NewWriter(trieFd)
 	defer writer.Flush()
-	if err != nil {
-		return nil, nil, nil
-	}
+
 	var isInsert = false
 	insertNum := 100
 	insertWords := make([]string, insertNum)
 
+	for param, value := range params {
+		if !isKeywordParam(param) {
+			continue
+		}
+
+		// value 加进 Trie 树
+		if !isInsert {
+			gde.trie.Insert(value)
+			isInsert = true
+		}
+
+		// 将value写入TriePath的文件中，个数到达insertNum再一起写入
+		insertNum--
+		if insertNum <= 0 {
+			for _, val := range insertWords {
+				if _, err := writer.WriteString(val + "\n"); err != nil {
+					return
+				}
+			}
+			insertNum = 100
+		} else {
+			insertWords[100-insertNum] = value
+		}
+	}
+}
+
+// parseParams
+// @Description 根据请求参数生成对应的搜索条件和过滤条件，没有副作用，搜索和导出共用
+func parseParams(params map[string]string, idx *gdindex.Index) ([]utils.SearchFilters, []utils.SearchQuery, []utils.SearchQuery) {
+
+	searchFilters := make([]utils.SearchFilters, 0)
+	searchQueries := make([]utils.SearchQuery, 0)
+	notSearchQueries := make([]utils.SearchQuery, 0)
+
+	fmt.Println(params)
+	now := time.Now()
+	// 字段信息和设置取一次快照，解析期间新增的动态字段不影响本次查询
+	fields := idx.FieldTypes()
+	analyzer := idx.EffectiveSettings().Analyzer
+
 	for param, value := range params {
 
 		// todo 还有一些其余的请求参数
 		if param == "index" || param == "pageSize" || param == "curPage" {
 			continue
 		}
+		if _, ok := searchReservedParams[param]; ok {
+			continue
+		}
+		// exists=a,b 和 missing=a,b 过滤字段有值或没有值的文档
+		if param == "exists" || param == "missing" {
+			filterType := utils.FILT_EXISTS
+			if param == "missing" {
+				filterType = utils.FILT_MISSING
+			}
+			for _, fieldName := range strings.Split(value, ",") {
+				if fieldName = strings.TrimSpace(fieldName); fieldName != "" {
+					searchFilters = append(searchFilters, utils.SearchFilters{FieldName: fieldName, Type: filterType})
+				}
+			}
+			continue
+		}
+
+		// IP 地址字段的过滤条件不是数字
+		if len(param) > 1 && strings.IndexByte("-><~", param[0]) >= 0 && fields[param[1:]] == utils.IDX_TYPE_IP {
+			if sf, err := ipFilter(param[0], param[1:], value); err == nil {
+				searchFilters = append(searchFilters, sf)
+			}
+			continue
+		}
 
 		switch param[0] {
 		case '-':
-			eqValue, err := strconv.ParseInt(value, 10, 64)
+			eqStart, eqEnd, err := filterValue(idx, param[1:], value, now)
 			if err != nil {
 				continue
 			}
-			sf := utils.SearchFilters{FieldName: param[1:], Type: utils.FILT_EQ, Start: eqValue}
-			searchFilters = append(searchFilters, sf)
+			searchFilters = append(searchFilters, eqFilter(param[1:], eqStart, eqEnd))
 		case '>':
-			overValue, err := strconv.ParseInt(value, 10, 64)
+			overValue, _, err := filterValue(idx, param[1:], value, now)
 			if err != nil {
 				continue
 			}
@@ -373,7 +830,7 @@ func (gde *GoDanceEngine) parseParams(params map[string]string, idx *gdindex.Ind
 			sf := utils.SearchFilters{FieldName: param[1:], Type: utils.FILT_OVER, Start: overValue}
 			searchFilters = append(searchFilters, sf)
 		case '<':
-			lessValue, err := strconv.ParseInt(value, 10, 64)
+			_, lessValue, err := filterValue(idx, param[1:], value, now)
 			if err != nil {
 				continue
 			}
@@ -384,11 +841,11 @@ func (gde *GoDanceEngine) parseParams(params map[string]string, idx *gdindex.Ind
 			if len(minMax) != 2 {
 				continue
 			}
-			start, err1 := strconv.ParseInt(minMax[0], 10, 64)
+			start, _, err1 := filterValue(idx, param[1:], minMax[0], now)
 			if err1 != nil {
 				continue
 			}
-			end, err2 := strconv.ParseInt(minMax[1], 10, 64)
+			_, end, err2 := filterValue(idx, param[1:], minMax[1], now)
 			if err2 != nil {
 				continue
 			}
@@ -404,35 +861,15 @@ func (gde *GoDanceEngine) parseParams(params map[string]string, idx *gdindex.Ind
 			}
 
 		default:
-			segmenter := utils.GetGseSegmenter()
 			var terms = make([]string, 0)
 
-			// value 加进 Trie 树
-			if !isInsert {
-				gde.trie.Insert(value)
-				isInsert = true
-			}
-
-			// 将value写入TriePath的文件中，个数到达insertNum再一起写入
-			insertNum--
-			if insertNum <= 0 {
-				for _, val := range insertWords {
-					_, err2 := writer.WriteString(val + "\n")
-					if err2 != nil {
-						return nil, nil, nil
-					}
-				}
-				insertNum = 100
-			} else {
-				insertWords[100-insertNum] = value
-			}
-			fieldType, ok := idx.Fields[param]
+			fieldType, ok := fields[param]
 			if ok {
 				switch fieldType {
-				case utils.IDX_TYPE_STRING:
+				case utils.IDX_TYPE_STRING, utils.IDX_TYPE_PK:
 					terms = append(terms, value)
 				case utils.IDX_TYPE_STRING_SEG:
-					terms = segmenter.CutSearch(value, false)
+					terms = utils.Analyze(analyzer, value)
 				}
 			}
 
@@ -467,10 +904,38 @@ func (gde *GoDanceEngine) GetDocById(indexName, id string) (map[string]string, e
 	if !ok {
 		return nil, errors.New("doc not found")
 	}
+	if version, ok := idx.Version(document); ok {
+		document["_version"] = fmt.Sprintf("%v", version)
+	}
 	return document, nil
 
 }
 
+// GetDocByKey
+// @Description 根据主键获取文档，pk 参数直接给出主键，联合主键可以按字段名分别给出各字段的值
+// @Param params 请求参数，index 为索引名
+// @Return map[string]string 文档内容
+// @Return error 任何错误
+func (gde *GoDanceEngine) GetDocByKey(params map[string]string) (map[string]string, error) {
+	idx := gde.idxManager.GetIndex(params["index"])
+	if idx == nil {
+		return nil, errors.New("index not found")
+	}
+
+	key, err := gde.primaryKeyOf(idx, params)
+	if err != nil {
+		return nil, errors.New(NoPrimaryKey)
+	}
+	document, ok := idx.GetDocumentByKey(key)
+	if !ok {
+		return nil, errors.New("doc not found")
+	}
+	if version, ok := idx.Version(document); ok {
+		document["_version"] = fmt.Sprintf("%v", version)
+	}
+	return document, nil
+}
+
 //
 //  DocWeightSort
 //  @Description: 将文档按照权重进行排序
@@ -488,6 +953,10 @@ func DocWeightSort(docMergeFilter []uint64, notDocQueryNodes []utils.DocIdNode,
 		return nil
 	}
 	keyLen := len(searchQueries)
+	// 没有搜索词时不计算相关度，按文档 id 的顺序返回
+	if keyLen == 0 {
+		return docMergeFilter
+	}
 	docNum := float64(docLen)
 	// 搜索词向量权重
 	vectorKey := make([]float64, keyLen)
@@ -550,12 +1019,16 @@ func DocWeightSort(docMergeFilter []uint64, notDocQueryNodes []utils.DocIdNode,
 	//fmt.Println("docvw : ", docVectorWeight)
 
 	//fmt.Println("coord:", coord)
-	// 协调因子乘向量权重后排序
+	// 协调因子乘向量权重后排序，boolean 相关度只按协调因子排序
+	boolean := idx.EffectiveSettings().Similarity == gdindex.SIMILARITY_BOOLEAN
 	var coordWeights utils.CoordWeightSort
 	for k, v := range docVectorWeight {
 		var cw utils.CoordWeight
 		cw.DocId = k
 		cw.Weight = v * coord[k]
+		if boolean {
+			cw.Weight = coord[k]
+		}
 		coordWeights = append(coordWeights, cw)
 	}
 	sort.Sort(coordWeights)
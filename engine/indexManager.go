@@ -8,6 +8,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
@@ -20,8 +22,9 @@ type IndexInfo struct {
 type IndexManager struct {
 	indexers       map[string]*gdindex.Index
 	indexMapLocker *sync.RWMutex
-	IndexInfos     map[string]IndexInfo `json:"indexinfos"`
-	Logger         *utils.Log4FE        `json:"-"`
+	IndexInfos     map[string]IndexInfo     `json:"indexinfos"`
+	Templates      map[string]IndexTemplate `json:"templates"` // 索引模板，按模板名存储
+	Logger         *utils.Log4FE            `json:"-"`
 }
 
 // 一个引擎对应一个索引管理器
@@ -30,13 +33,14 @@ func newIndexManager(logger *utils.Log4FE) *IndexManager {
 		indexers:       make(map[string]*gdindex.Index),
 		indexMapLocker: new(sync.RWMutex),
 		IndexInfos:     make(map[string]IndexInfo),
+		Templates:      make(map[string]IndexTemplate),
 		Logger:         logger,
 	}
 
 	// 如果之前有记录则进行反序列化
-	if utils.Exist(fmt.Sprintf("%v%v.idm.meta", utils.IDX_ROOT_PATH, utils.GODANCEENGINE)) {
+	if utils.Exist(idm.metaFileName()) {
 
-		metaFileName := fmt.Sprintf("%v%v.idm.meta", utils.IDX_ROOT_PATH, utils.GODANCEENGINE)
+		metaFileName := idm.metaFileName()
 		buffer, err := utils.ReadFromJson(metaFileName)
 		if err != nil {
 			return idm
@@ -46,10 +50,25 @@ func newIndexManager(logger *utils.Log4FE) *IndexManager {
 		if err != nil {
 			return idm
 		}
+		if idm.Templates == nil {
+			idm.Templates = make(map[string]IndexTemplate)
+		}
 		idm.Logger.Info("[INFO]  New Index Manager ")
-		for _, idxInfo := range idm.IndexInfos {
+		moved := false
+		for name, idxInfo := range idm.IndexInfos {
+			// 旧版本记录的是相对工作目录的路径，按数据根目录加载
+			if !filepath.IsAbs(idxInfo.Path) && idxInfo.Path != utils.DataRoot() {
+				idxInfo.Path = utils.DataRoot()
+				idm.IndexInfos[name] = idxInfo
+				moved = true
+			}
 			idm.indexers[idxInfo.Name] = gdindex.NewIndexFromLocalFile(idxInfo.Name, idxInfo.Path, logger)
-			log.Printf("idx %v loaded", idxInfo.Name)
+			log.Printf("idx %v loaded from %v", idxInfo.Name, idxInfo.Path)
+		}
+		if moved {
+			if err := idm.storeIndexManager(); err != nil {
+				idm.Logger.Error("[ERROR] Store Index Manager Error : %v", err)
+			}
 		}
 	}
 
@@ -58,6 +77,9 @@ func newIndexManager(logger *utils.Log4FE) *IndexManager {
 		for {
 			<-ticker.C
 			for _, idx := range idm.indexers {
+				if _, err := idx.ExpireDocuments(); err != nil {
+					idm.Logger.Error("[ERROR] Expire Documents Of Index %v Error : %v", idx.Name, err)
+				}
 				if idx.CheckMerge() {
 					idx.MergeSegments()
 				}
@@ -65,6 +87,24 @@ func newIndexManager(logger *utils.Log4FE) *IndexManager {
 		}
 	}()
 
+	// 按各索引的 refreshInterval 定时持久化内存段
+	go func() {
+		ticker := time.NewTicker(gdindex.MIN_REFRESH_INTERVAL)
+		for now := range ticker.C {
+			idm.indexMapLocker.RLock()
+			indexers := make([]*gdindex.Index, 0, len(idm.indexers))
+			for _, idx := range idm.indexers {
+				indexers = append(indexers, idx)
+			}
+			idm.indexMapLocker.RUnlock()
+			for _, idx := range indexers {
+				if err := idx.RefreshIfDue(now); err != nil {
+					idm.Logger.Error("[ERROR] Refresh Index %v Error : %v", idx.Name, err)
+				}
+			}
+		}
+	}()
+
 	idm.Logger.Info("[INFO]  New Index Manager ")
 	return idm
 }
@@ -81,22 +121,42 @@ func (idm *IndexManager) GetIndex(indexName string) *gdindex.Index {
 	return index
 }
 
-func (idm *IndexManager) CreateIndex(indexName string, fields []segment.SimpleFieldInfo) error {
+// errIndexExists 创建的索引已经存在
+var errIndexExists = errors.New(IndexExists)
+
+// CreateIndex
+// @Description 持有管理器的锁创建索引，添加字段并由 configure 设置好之后才注册，其他请求看不到配置到一半的索引
+// @Param indexName 索引名
+// @Param fields 字段信息
+// @Param configure 注册前对索引的设置，可以为 nil
+// @Return error 索引已存在时返回 errIndexExists
+func (idm *IndexManager) CreateIndex(indexName string, fields []segment.SimpleFieldInfo, configure func(idx *gdindex.Index) error) error {
 
 	idm.indexMapLocker.Lock()
 	defer idm.indexMapLocker.Unlock()
 	if _, ok := idm.indexers[indexName]; ok {
 		idm.Logger.Error("[ERROR] index[%v] Exist", indexName)
-		return nil
+		return errIndexExists
 	}
 
-	idm.indexers[indexName] = gdindex.NewEmptyIndex(indexName, utils.IDX_ROOT_PATH, idm.Logger)
-	idm.IndexInfos[indexName] = IndexInfo{Name: indexName, Path: utils.IDX_ROOT_PATH}
+	// 新索引放在剩余空间最大的数据目录中
+	path := utils.PickDataPath()
+	idx := gdindex.NewEmptyIndex(indexName, path, idm.Logger)
 	for _, field := range fields {
-		// fmt.Println("Add Fields")
-		idm.indexers[indexName].AddField(field)
+		if err := idx.AddField(field); err != nil {
+			idx.Close()
+			return err
+		}
+	}
+	if configure != nil {
+		if err := configure(idx); err != nil {
+			idx.Close()
+			return err
+		}
 	}
 
+	idm.indexers[indexName] = idx
+	idm.IndexInfos[indexName] = IndexInfo{Name: indexName, Path: path}
 	fmt.Println("Create Index Over")
 
 	return idm.storeIndexManager()
@@ -152,7 +212,7 @@ func (idm *IndexManager) deleteDocument(indexName string, pk string) (string, er
 	return OK, err
 }
 
-func (idm *IndexManager) updateDocument(indexName string, document map[string]string) (string, error) {
+func (idm *IndexManager) updateDocument(indexName string, document map[string]string, opts gdindex.UpdateOptions) (string, error) {
 	idm.indexMapLocker.RLock()
 	defer idm.indexMapLocker.RUnlock()
 	if _, ok := idm.indexers[indexName]; !ok {
@@ -160,14 +220,29 @@ func (idm *IndexManager) updateDocument(indexName string, document map[string]st
 		return Fail, fmt.Errorf("[ERROR] index[%v] not found", indexName)
 	}
 
-	err := idm.indexers[indexName].UpdateDocument(document)
+	err := idm.indexers[indexName].UpdateDocumentWithOptions(document, opts)
 
 	return OK, err
 }
 
+func (idm *IndexManager) applyOperations(indexName string, ops []gdindex.DocOperation) ([]error, error) {
+	idm.indexMapLocker.RLock()
+	defer idm.indexMapLocker.RUnlock()
+	if _, ok := idm.indexers[indexName]; !ok {
+		idm.Logger.Error("[ERROR] index[%v] not found", indexName)
+		return nil, fmt.Errorf("[ERROR] index[%v] not found", indexName)
+	}
+
+	return idm.indexers[indexName].ApplyOperations(ops), nil
+}
+
+// metaFileName 索引管理器的元信息保存在数据根目录下
+func (idm *IndexManager) metaFileName() string {
+	return fmt.Sprintf("%v%v.idm.meta", utils.DataRoot(), utils.GODANCEENGINE)
+}
+
 func (idm *IndexManager) storeIndexManager() error {
-	metaFileName := fmt.Sprintf("%v%v.idm.meta", utils.IDX_ROOT_PATH, utils.GODANCEENGINE)
-	if err := utils.WriteToJson(idm, metaFileName); err != nil {
+	if err := utils.WriteToJson(idm, idm.metaFileName()); err != nil {
 		return err
 	}
 	return nil
@@ -183,3 +258,71 @@ func (idm *IndexManager) sync(indexName string) error {
 
 	return idm.indexers[indexName].SyncMemorySegment()
 }
+
+// stats 汇总所有索引的统计信息
+func (idm *IndexManager) stats() EngineStats {
+	idm.indexMapLocker.RLock()
+	defer idm.indexMapLocker.RUnlock()
+
+	res := EngineStats{
+		IndexCount: len(idm.indexers),
+		Files:      segment.GetFileCacheStats(),
+		Indexes:    make(map[string]IndexSummary),
+	}
+	for name, idx := range idm.indexers {
+		stats := idx.Stats()
+		res.DocCount += stats.DocCount
+		res.DeletedDocs += stats.DeletedDocs
+		res.SegmentCount += stats.SegmentCount
+		res.Bytes += stats.Bytes
+		res.Indexes[name] = IndexSummary{
+			DocCount:     stats.DocCount,
+			DeletedDocs:  stats.DeletedDocs,
+			SegmentCount: stats.SegmentCount,
+			Bytes:        stats.Bytes,
+			Path:         idm.IndexInfos[name].Path,
+		}
+	}
+
+	for _, path := range utils.DataPaths() {
+		pathStats := DataPathStats{Path: path, Indexes: make([]string, 0)}
+		pathStats.FreeBytes, _ = utils.FreeSpace(path)
+		for name, info := range idm.IndexInfos {
+			if info.Path == path {
+				pathStats.Indexes = append(pathStats.Indexes, name)
+			}
+		}
+		sort.Strings(pathStats.Indexes)
+		res.DataPaths = append(res.DataPaths, pathStats)
+	}
+	return res
+}
+
+// check 检查索引，indexName 为空时检查所有索引
+func (idm *IndexManager) check(indexName string, quarantine bool) ([]gdindex.CheckReport, error) {
+	idm.indexMapLocker.RLock()
+	defer idm.indexMapLocker.RUnlock()
+
+	names := make([]string, 0, len(idm.indexers))
+	if indexName != "" {
+		if _, ok := idm.indexers[indexName]; !ok {
+			return nil, errors.New(IndexNotFound)
+		}
+		names = append(names, indexName)
+	} else {
+		for name := range idm.indexers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	reports := make([]gdindex.CheckReport, 0, len(names))
+	for _, name := range names {
+		report, err := idm.indexers[name].Check(quarantine)
+		reports = append(reports, report)
+		if err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
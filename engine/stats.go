@@ -0,0 +1,68 @@
+package engine
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"errors"
+)
+
+// EngineStats 引擎中所有索引的汇总信息
+type EngineStats struct {
+	IndexCount   int                     `json:"indexCount"`
+	DocCount     uint64                  `json:"docCount"`
+	DeletedDocs  uint64                  `json:"deletedDocs"`
+	SegmentCount int                     `json:"segmentCount"`
+	Bytes        int64                   `json:"bytes"`
+	Files        segment.FileCacheStats  `json:"files"` // 打开的段文件
+	Indexes      map[string]IndexSummary `json:"indexes"`
+	DataPaths    []DataPathStats         `json:"dataPaths"` // 数据目录，第一个为数据根目录
+}
+
+// DataPathStats 数据目录的剩余空间和存放的索引
+type DataPathStats struct {
+	Path      string   `json:"path"`
+	FreeBytes uint64   `json:"freeBytes"`
+	Indexes   []string `json:"indexes"`
+}
+
+// IndexSummary 单个索引的概要信息
+type IndexSummary struct {
+	DocCount     uint64 `json:"docCount"`
+	DeletedDocs  uint64 `json:"deletedDocs"`
+	SegmentCount int    `json:"segmentCount"`
+	Bytes        int64  `json:"bytes"`
+	Path         string `json:"path"` // 索引所在的数据目录
+}
+
+// Stats
+// @Description 获取所有索引的汇总信息
+// @Return EngineStats 汇总信息
+func (gde *GoDanceEngine) Stats() EngineStats {
+	return gde.idxManager.stats()
+}
+
+// IndexStats
+// @Description 获取索引的统计信息
+// @Param indexName 索引名
+// @Return gdindex.IndexStats 统计信息
+// @Return error 任何错误
+func (gde *GoDanceEngine) IndexStats(indexName string) (gdindex.IndexStats, error) {
+	idx := gde.idxManager.GetIndex(indexName)
+	if idx == nil {
+		return gdindex.IndexStats{}, errors.New(IndexNotFound)
+	}
+	return idx.Stats(), nil
+}
+
+// IndexSegments
+// @Description 获取索引中每个段的统计信息
+// @Param indexName 索引名
+// @Return []segment.SegmentStats 段的统计信息
+// @Return error 任何错误
+func (gde *GoDanceEngine) IndexSegments(indexName string) ([]segment.SegmentStats, error) {
+	idx := gde.idxManager.GetIndex(indexName)
+	if idx == nil {
+		return nil, errors.New(IndexNotFound)
+	}
+	return idx.Segments(), nil
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	gdindex "GoDance/index"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 后台任务的状态
+const (
+	TASK_RUNNING   = "running"
+	TASK_COMPLETED = "completed"
+	TASK_FAILED    = "failed"
+)
+
+// MAX_FINISHED_TASKS 保留的已结束任务的数量，超过时删除最早结束的任务
+const MAX_FINISHED_TASKS = 100
+
+// Task 后台任务的信息
+type Task struct {
+	Id        string      `json:"id"`
+	Action    string      `json:"action"`
+	Index     string      `json:"index"`
+	Status    string      `json:"status"`
+	StartTime time.Time   `json:"startTime"`
+	EndTime   *time.Time  `json:"endTime,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+}
+
+// taskManager 记录引擎中的后台任务
+type taskManager struct {
+	mutex  sync.Mutex
+	nextId uint64
+	tasks  map[string]*Task
+}
+
+func newTaskManager() *taskManager {
+	return &taskManager{nextId: 1, tasks: make(map[string]*Task)}
+}
+
+// start 在后台执行任务，返回任务信息
+func (tm *taskManager) start(action, index string, fn func() (interface{}, error)) Task {
+	tm.mutex.Lock()
+	task := &Task{
+		Id:        strconv.FormatUint(tm.nextId, 10),
+		Action:    action,
+		Index:     index,
+		Status:    TASK_RUNNING,
+		StartTime: time.Now(),
+	}
+	tm.nextId++
+	tm.tasks[task.Id] = task
+	snapshot := *task
+	tm.mutex.Unlock()
+
+	go func() {
+		result, err := fn()
+
+		tm.mutex.Lock()
+		defer tm.mutex.Unlock()
+		now := time.Now()
+		task.EndTime = &now
+		task.Result = result
+		task.Status = TASK_COMPLETED
+		if err != nil {
+			task.Status = TASK_FAILED
+			task.Error = err.Error()
+		}
+		tm.prune()
+	}()
+
+	return snapshot
+}
+
+// prune 删除最早结束的任务，只保留 MAX_FINISHED_TASKS 个已结束的任务
+func (tm *taskManager) prune() {
+	finished := make([]*Task, 0)
+	for _, task := range tm.tasks {
+		if task.Status != TASK_RUNNING {
+			finished = append(finished, task)
+		}
+	}
+	if len(finished) <= MAX_FINISHED_TASKS {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].EndTime.Before(*finished[j].EndTime) })
+	for _, task := range finished[:len(finished)-MAX_FINISHED_TASKS] {
+		delete(tm.tasks, task.Id)
+	}
+}
+
+func (tm *taskManager) get(id string) (Task, bool) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	task, ok := tm.tasks[id]
+	if !ok {
+		return Task{}, false
+	}
+	return *task, true
+}
+
+// list 按任务编号排序的所有任务
+func (tm *taskManager) list() []Task {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	tasks := make([]Task, 0, len(tm.tasks))
+	for _, task := range tm.tasks {
+		tasks = append(tasks, *task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		a, _ := strconv.ParseUint(tasks[i].Id, 10, 64)
+		b, _ := strconv.ParseUint(tasks[j].Id, 10, 64)
+		return a < b
+	})
+	return tasks
+}
+
+// ForceMerge
+// @Description 在后台强制合并索引的段
+// @Param params 请求参数，index 必填，可选 max_num_segments、only_expunge_deletes、deletes_pct_allowed
+// @Return Task 合并任务
+// @Return error 任何错误
+func (gde *GoDanceEngine) ForceMerge(params map[string]string) (Task, error) {
+	idx := gde.idxManager.GetIndex(params["index"])
+	if idx == nil {
+		return Task{}, errors.New(IndexNotFound)
+	}
+
+	opts := gdindex.ForceMergeOptions{DeletesPctAllowed: gdindex.DEFAULT_DELETES_PCT_ALLOWED}
+	if n := params["max_num_segments"]; n != "" {
+		num, err := strconv.Atoi(n)
+		if err != nil || num <= 0 {
+			return Task{}, errors.New(ParamsError)
+		}
+		opts.MaxNumSegments = num
+	}
+	if expunge := params["only_expunge_deletes"]; expunge != "" {
+		b, err := strconv.ParseBool(expunge)
+		if err != nil {
+			return Task{}, errors.New(ParamsError)
+		}
+		opts.OnlyExpungeDeletes = b
+	}
+	if pct := params["deletes_pct_allowed"]; pct != "" {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p < 0 || p > 100 {
+			return Task{}, errors.New(ParamsError)
+		}
+		opts.DeletesPctAllowed = p
+	}
+	if opts.OnlyExpungeDeletes && opts.MaxNumSegments > 0 {
+		return Task{}, fmt.Errorf("%v : max_num_segments can't be used with only_expunge_deletes", ParamsError)
+	}
+
+	return gde.tasks.start("forcemerge", idx.Name, func() (interface{}, error) {
+		res, err := idx.ForceMerge(opts)
+		if err != nil {
+			gde.Logger.Error("[ERROR] Force Merge Index %v Error : %v", idx.Name, err)
+		}
+		return res, err
+	}), nil
+}
+
+// Tasks
+// @Description 获取所有后台任务
+// @Return []Task 任务列表
+func (gde *GoDanceEngine) Tasks() []Task {
+	return gde.tasks.list()
+}
+
+// GetTask
+// @Description 获取后台任务
+// @Param id 任务编号
+// @Return Task 任务信息
+// @Return error 任务不存在时返回错误
+func (gde *GoDanceEngine) GetTask(id string) (Task, error) {
+	task, ok := gde.tasks.get(id)
+	if !ok {
+		return Task{}, errors.New(TaskNotFound)
+	}
+	return task, nil
+}
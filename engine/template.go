@@ -0,0 +1,207 @@
+package engine
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// TemplateNotFound 模板不存在
+const TemplateNotFound string = "未找到对应的模板"
+
+// IndexTemplate 索引模板，向不存在的索引写入文档时，按索引名匹配模板自动创建索引
+type IndexTemplate struct {
+	Name          string   `json:"name"`
+	IndexPatterns []string `json:"indexPatterns"` // 索引名的通配符，如 logs-*
+	Priority      int      `json:"priority"`      // 多个模板匹配时使用优先级最高的
+	IndexStruct            // 创建索引时使用的字段信息和设置
+}
+
+// matches 判断索引名是否与模板匹配
+func (t *IndexTemplate) matches(indexName string) bool {
+	for _, pattern := range t.IndexPatterns {
+		if ok, _ := path.Match(pattern, indexName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validIndexStruct 检查创建索引的设置
+func validIndexStruct(idx IndexStruct) (int64, error) {
+	var ttl int64
+	if idx.TTL != "" {
+		var err error
+		if ttl, err = utils.ParseTTL(idx.TTL); err != nil {
+			return 0, err
+		}
+	}
+	if !segment.IsValidCodec(idx.Codec) {
+		return 0, fmt.Errorf("unknown codec %v", idx.Codec)
+	}
+	if !gdindex.IsValidDynamic(idx.Dynamic) {
+		return 0, fmt.Errorf("unknown dynamic mapping %v", idx.Dynamic)
+	}
+	if err := validDateFields(idx.FieldsMapping); err != nil {
+		return 0, err
+	}
+	if idx.Settings != nil {
+		if err := idx.Settings.Validate(); err != nil {
+			return 0, err
+		}
+	}
+	return ttl, nil
+}
+
+// validDateFields 检查日期时间字段及其子字段的时区
+func validDateFields(fields []segment.SimpleFieldInfo) error {
+	for _, field := range fields {
+		if field.FieldType == utils.IDX_TYPE_DATETIME {
+			if _, err := utils.NewDateParser(field.Format, field.TimeZone); err != nil {
+				return fmt.Errorf("invalid datetime field %v : %v", field.FieldName, err)
+			}
+		}
+		if err := validDateFields(field.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutTemplate
+// @Description 新增或替换索引模板
+// @Param name 模板名
+// @Param body 请求体，Json格式，包含 indexPatterns、priority 以及创建索引的字段信息和设置
+// @Return error 任何错误
+func (gde *GoDanceEngine) PutTemplate(name string, body []byte) error {
+	if name == "" {
+		return errors.New(ParamsError)
+	}
+	var template IndexTemplate
+	if err := json.Unmarshal(body, &template); err != nil {
+		gde.Logger.Error("[ERROR]  %v : %v ", JsonParseError, err)
+		return errors.New(JsonParseError)
+	}
+	template.Name = name
+	template.IndexName = ""
+
+	if len(template.IndexPatterns) == 0 {
+		return fmt.Errorf("%v : indexPatterns is required", ParamsError)
+	}
+	for _, pattern := range template.IndexPatterns {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("%v : bad index pattern %q", ParamsError, pattern)
+		}
+	}
+	if _, err := validIndexStruct(template.IndexStruct); err != nil {
+		return err
+	}
+
+	return gde.idxManager.putTemplate(template)
+}
+
+// GetTemplates
+// @Description 获取所有索引模板，按模板名排序
+// @Return []IndexTemplate 模板列表
+func (gde *GoDanceEngine) GetTemplates() []IndexTemplate {
+	return gde.idxManager.templates()
+}
+
+// GetTemplate
+// @Description 获取索引模板
+// @Param name 模板名
+// @Return IndexTemplate 模板
+// @Return error 模板不存在时返回错误
+func (gde *GoDanceEngine) GetTemplate(name string) (IndexTemplate, error) {
+	for _, template := range gde.idxManager.templates() {
+		if template.Name == name {
+			return template, nil
+		}
+	}
+	return IndexTemplate{}, errors.New(TemplateNotFound)
+}
+
+// DeleteTemplate
+// @Description 删除索引模板，已经创建的索引不受影响
+// @Param name 模板名
+// @Return error 模板不存在时返回错误
+func (gde *GoDanceEngine) DeleteTemplate(name string) error {
+	return gde.idxManager.deleteTemplate(name)
+}
+
+// ensureIndex 索引不存在时按匹配的模板创建索引，没有匹配的模板时不做处理
+func (gde *GoDanceEngine) ensureIndex(indexName string) error {
+	if indexName == "" || gde.idxManager.hasIndex(indexName) {
+		return nil
+	}
+	template, ok := gde.idxManager.matchTemplate(indexName)
+	if !ok {
+		return nil
+	}
+
+	gde.Logger.Info("[INFO] Create Index %v From Template %v", indexName, template.Name)
+	idx := template.IndexStruct
+	idx.IndexName = indexName
+	// 并发写入同一个新索引时只有一个请求能创建成功，其他请求直接使用已创建的索引
+	if err := gde.createIndex(indexName, idx); err != nil && !errors.Is(err, errIndexExists) {
+		return err
+	}
+	return nil
+}
+
+func (idm *IndexManager) putTemplate(template IndexTemplate) error {
+	idm.indexMapLocker.Lock()
+	defer idm.indexMapLocker.Unlock()
+
+	idm.Templates[template.Name] = template
+	return idm.storeIndexManager()
+}
+
+func (idm *IndexManager) deleteTemplate(name string) error {
+	idm.indexMapLocker.Lock()
+	defer idm.indexMapLocker.Unlock()
+
+	if _, ok := idm.Templates[name]; !ok {
+		return errors.New(TemplateNotFound)
+	}
+	delete(idm.Templates, name)
+	return idm.storeIndexManager()
+}
+
+func (idm *IndexManager) templates() []IndexTemplate {
+	idm.indexMapLocker.RLock()
+	defer idm.indexMapLocker.RUnlock()
+
+	res := make([]IndexTemplate, 0, len(idm.Templates))
+	for _, template := range idm.Templates {
+		res = append(res, template)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// matchTemplate 与索引名匹配的优先级最高的模板，优先级相同时取模板名最小的
+func (idm *IndexManager) matchTemplate(indexName string) (IndexTemplate, bool) {
+	var res IndexTemplate
+	found := false
+	for _, template := range idm.templates() {
+		if template.matches(indexName) && (!found || template.Priority > res.Priority) {
+			res = template
+			found = true
+		}
+	}
+	return res, found
+}
+
+func (idm *IndexManager) hasIndex(indexName string) bool {
+	idm.indexMapLocker.RLock()
+	defer idm.indexMapLocker.RUnlock()
+
+	_, ok := idm.indexers[indexName]
+	return ok
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"GoDance/index/segment"
+	"errors"
+	"strconv"
+)
+
+// 列出词典时默认和最多返回的词数
+const (
+	DEFAULT_TERMS_SIZE = 100
+	MAX_TERMS_SIZE     = 10000
+)
+
+// TermsResult 词典的一页结果
+type TermsResult struct {
+	Terms []segment.TermFreq `json:"terms"`
+	Next  string             `json:"next,omitempty"` // 下一页的游标，作为 after 参数传入，为空表示没有更多
+}
+
+// Terms
+// @Description 按字典序列出字段中的词及文档数
+// @Param params 请求参数，index、field 必填，可选 prefix、from、to、after、size、exclude_deleted
+// @Return TermsResult 词及文档数
+// @Return error 任何错误
+func (gde *GoDanceEngine) Terms(params map[string]string) (TermsResult, error) {
+	var res TermsResult
+	idx := gde.idxManager.GetIndex(params["index"])
+	if idx == nil {
+		return res, errors.New(IndexNotFound)
+	}
+	if params["field"] == "" {
+		return res, errors.New(ParamsError)
+	}
+
+	opts := segment.TermsOptions{
+		Prefix: params["prefix"],
+		From:   params["from"],
+		To:     params["to"],
+		After:  params["after"],
+		Size:   DEFAULT_TERMS_SIZE,
+	}
+	if size := params["size"]; size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 {
+			return res, errors.New(ParamsError)
+		}
+		opts.Size = n
+	}
+	if opts.Size > MAX_TERMS_SIZE {
+		opts.Size = MAX_TERMS_SIZE
+	}
+	if excludeDeleted := params["exclude_deleted"]; excludeDeleted != "" {
+		b, err := strconv.ParseBool(excludeDeleted)
+		if err != nil {
+			return res, errors.New(ParamsError)
+		}
+		opts.ExcludeDeleted = b
+	}
+
+	terms, more, err := idx.Terms(params["field"], opts)
+	if err != nil {
+		return res, err
+	}
+	res.Terms = terms
+	if more && len(terms) > 0 {
+		res.Next = terms[len(terms)-1].Term
+	}
+	return res, nil
+}
@@ -21,6 +21,7 @@ require (
 	github.com/gin-gonic/gin v1.8.0
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/go-sql-driver/mysql v1.6.0
+	github.com/golang/snappy v0.0.4
 	github.com/smallnest/rpcx v1.7.4
 	github.com/yanyiwu/gojieba v1.1.2
 	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
@@ -51,7 +52,6 @@ require (
 	github.com/go-task/slim-sprig v0.0.0-20210107165309-348f09dbbbc0 // indirect
 	github.com/goccy/go-json v0.9.7 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/grandcat/zeroconf v1.0.0 // indirect
 	github.com/hashicorp/consul/api v1.13.0 // indirect
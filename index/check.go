@@ -0,0 +1,347 @@
+/**
+ * @Note 索引的完整性检查
+ **/
+
+package gdindex
+
+import (
+	"GoDance/index/segment"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// QUARANTINE_DIR 隔离损坏段的目录，位于索引的存储路径下
+const QUARANTINE_DIR = "quarantine"
+
+// 主键检查最多报告的问题数
+const maxPrimaryKeyIssues = 100
+
+// CheckReport 索引的检查结果
+type CheckReport struct {
+	Index       string               `json:"index"`
+	Segments    int                  `json:"segments"`
+	Issues      []segment.CheckIssue `json:"issues"`
+	Quarantined []string             `json:"quarantined,omitempty"` // 被隔离的段
+}
+
+// Check
+// @Description 检查所有段的文件以及主键树与文档中的主键是否一致，检查段文件时不持有写锁，
+// 发现的主键问题持锁复查后再报告，避免检查期间的写入造成误报
+// @Param quarantine 是否把有问题的段移到隔离目录，段内的文档会被标记为删除
+// @Return CheckReport 检查结果
+// @Return error 隔离段时的错误
+func (idx *Index) Check(quarantine bool) (CheckReport, error) {
+	// 检查期间段列表只会追加新段，被检查的段不会被合并删除
+	idx.mergeMutex.Lock()
+	defer idx.mergeMutex.Unlock()
+
+	snap := idx.checkSnapshot()
+	report := CheckReport{
+		Index:    idx.Name,
+		Segments: len(snap.segments),
+		Issues:   make([]segment.CheckIssue, 0),
+	}
+
+	corrupt := make(map[string]bool)
+	var prev *segment.Segment
+	for _, seg := range snap.segments {
+		issues := seg.Check()
+		if prev != nil && seg.StartDocId < prev.MaxDocId {
+			issues = append(issues, segment.CheckIssue{Segment: seg.SegmentName,
+				Message: fmt.Sprintf("docIds overlap with segment %v", prev.SegmentName)})
+		}
+		if seg.MaxDocId > snap.maxDocId {
+			issues = append(issues, segment.CheckIssue{Segment: seg.SegmentName,
+				Message: fmt.Sprintf("maxDocId %v exceeds index maxDocId %v", seg.MaxDocId, snap.maxDocId)})
+		}
+		if len(issues) > 0 {
+			corrupt[seg.SegmentName] = true
+			report.Issues = append(report.Issues, issues...)
+		}
+		prev = seg
+	}
+
+	if snap.hasPrimaryKey {
+		report.Issues = append(report.Issues, idx.checkPrimaryKeys(snap, corrupt)...)
+	}
+
+	if quarantine && len(corrupt) > 0 {
+		quarantined, err := idx.quarantineSegments(corrupt)
+		report.Quarantined = quarantined
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// checkSnapshot 检查开始时的索引状态
+type checkSnapshot struct {
+	segments      []*segment.Segment // 持久化的段
+	maxDocId      uint64
+	pkMap         map[string]string // 内存中还没刷到主键树的主键
+	hasPrimaryKey bool
+}
+
+// checkSnapshot 持有写锁复制检查需要的索引状态
+func (idx *Index) checkSnapshot() checkSnapshot {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	snap := checkSnapshot{
+		segments:      append([]*segment.Segment(nil), idx.segments...),
+		maxDocId:      idx.MaxDocId,
+		pkMap:         make(map[string]string, len(idx.pkMap)),
+		hasPrimaryKey: idx.PrimaryKey != "",
+	}
+	for key, value := range idx.pkMap {
+		snap.pkMap[key] = value
+	}
+	return snap
+}
+
+// checkPrimaryKeys 主键树中的每个主键需要指向存有该主键的文档，每个未删除的文档需要能通过主键找到
+// 损坏的段中的文档不检查。先不持锁检查持久化的段，有问题的主键和文档持锁按当前状态复查，内存段持锁检查
+func (idx *Index) checkPrimaryKeys(snap checkSnapshot, corrupt map[string]bool) []segment.CheckIssue {
+	issues := make([]segment.CheckIssue, 0)
+	dropped := 0
+	report := func(format string, args ...interface{}) {
+		if len(issues) >= maxPrimaryKeyIssues {
+			dropped++
+			return
+		}
+		issues = append(issues, segment.CheckIssue{Field: PRIMARY_BTREE, Message: fmt.Sprintf(format, args...)})
+	}
+
+	suspectKeys := make([]string, 0)
+	suspectDocs := make([]uint64, 0)
+
+	// 内存中还没刷到主键树的主键优先，持锁检查
+	err := idx.primary.ForEach(PRIMARY_BTREE, func(key []byte, value string) error {
+		if _, ok := snap.pkMap[string(key)]; ok {
+			return nil
+		}
+		docId, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			report("key %q has invalid docId %v", key, value)
+			return nil
+		}
+		if idx.checkKey(string(key), docId, snap.maxDocId, snap.segments, corrupt) != "" {
+			suspectKeys = append(suspectKeys, string(key))
+		}
+		return nil
+	})
+	if err != nil {
+		report("primary btree cannot be read : %v", err)
+	}
+
+	snapLookup := func(key string) (uint64, bool) {
+		if value, ok := snap.pkMap[key]; ok {
+			docId, err := strconv.ParseUint(value, 10, 64)
+			return docId, err == nil
+		}
+		ok, docId := idx.primary.SearchString(PRIMARY_BTREE, key)
+		return docId, ok
+	}
+	for _, seg := range snap.segments {
+		if corrupt[seg.SegmentName] {
+			continue
+		}
+		for docId := seg.StartDocId; docId < seg.MaxDocId; docId++ {
+			if idx.checkDoc(docId, seg, snapLookup) != "" {
+				suspectDocs = append(suspectDocs, docId)
+			}
+		}
+	}
+
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	segs := idx.segments
+	if idx.memorySegment != nil {
+		segs = append(segs[:len(segs):len(segs)], idx.memorySegment)
+	}
+	pending := make([]string, 0, len(idx.pkMap))
+	for key := range idx.pkMap {
+		pending = append(pending, key)
+	}
+	sort.Strings(pending)
+	for _, key := range append(suspectKeys, pending...) {
+		if docId, ok := idx.findPrimaryKey(key); ok {
+			if message := idx.checkKey(key, docId, idx.MaxDocId, segs, corrupt); message != "" {
+				report("%v", message)
+			}
+		}
+	}
+
+	if idx.memorySegment != nil {
+		for docId := idx.memorySegment.StartDocId; docId < idx.memorySegment.MaxDocId; docId++ {
+			suspectDocs = append(suspectDocs, docId)
+		}
+	}
+	for _, docId := range suspectDocs {
+		seg := idx.segmentOf(docId)
+		if seg == nil || corrupt[seg.SegmentName] {
+			continue
+		}
+		if message := idx.checkDoc(docId, seg, idx.findPrimaryKey); message != "" {
+			report("%v", message)
+		}
+	}
+
+	if dropped > 0 {
+		issues = append(issues, segment.CheckIssue{Field: PRIMARY_BTREE, Message: fmt.Sprintf("%v more issues omitted", dropped)})
+	}
+	return issues
+}
+
+// checkKey 检查主键指向的文档，没有问题时返回空字符串
+func (idx *Index) checkKey(key string, docId, maxDocId uint64, segs []*segment.Segment, corrupt map[string]bool) string {
+	if docId >= maxDocId {
+		return fmt.Sprintf("key %q points to docId %v beyond maxDocId %v", key, docId, maxDocId)
+	}
+	if idx.bitmap.GetBit(docId) == 1 {
+		return ""
+	}
+	var seg *segment.Segment
+	for _, s := range segs {
+		if docId >= s.StartDocId && docId < s.MaxDocId {
+			seg = s
+			break
+		}
+	}
+	if seg == nil {
+		return fmt.Sprintf("key %q points to missing docId %v", key, docId)
+	}
+	if corrupt[seg.SegmentName] {
+		return ""
+	}
+	doc, _ := seg.GetDocument(docId)
+	if stored, err := idx.PrimaryKeyOf(doc); err != nil || stored != key {
+		return fmt.Sprintf("key %q points to docId %v whose stored key is %q", key, docId, stored)
+	}
+	return ""
+}
+
+// checkDoc 检查未删除的文档能否通过主键找到，没有问题时返回空字符串
+func (idx *Index) checkDoc(docId uint64, seg *segment.Segment, lookup func(key string) (uint64, bool)) string {
+	if idx.bitmap.GetBit(docId) == 1 {
+		return ""
+	}
+	doc, _ := seg.GetDocument(docId)
+	key, err := idx.PrimaryKeyOf(doc)
+	if err != nil {
+		return fmt.Sprintf("docId %v has no primary key : %v", docId, err)
+	}
+	if found, ok := lookup(key); !ok || found != docId {
+		return fmt.Sprintf("docId %v with key %q is not indexed by the primary btree", docId, key)
+	}
+	return ""
+}
+
+// quarantineSegments 把损坏的段移到隔离目录并从索引中移除，段内的文档标记为删除，指向这些文档的主键和版本也一起删除
+func (idx *Index) quarantineSegments(corrupt map[string]bool) ([]string, error) {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	quarantineDir := filepath.Join(idx.PathName, QUARANTINE_DIR)
+	if err := idx.dir.MkdirAll(quarantineDir); err != nil {
+		return nil, err
+	}
+
+	var renameErr error
+	quarantined := make([]string, 0)
+	removed := make([]*segment.Segment, 0)
+	segments := make([]*segment.Segment, 0, len(idx.segments))
+	segmentNames := make([]string, 0, len(idx.segments))
+	for _, seg := range idx.segments {
+		if corrupt[seg.SegmentName] && renameErr == nil {
+			// 移动失败的段保留在索引中
+			target := filepath.Join(quarantineDir, filepath.Base(filepath.Clean(seg.SegmentName)))
+			if renameErr = idx.dir.Rename(seg.SegmentName, target); renameErr == nil {
+				for docId := seg.StartDocId; docId < seg.MaxDocId; docId++ {
+					idx.bitmap.SetBit(docId, 1)
+				}
+				idx.Logger.Warn("[WARN] Segment %v quarantined to %v", seg.SegmentName, target)
+				quarantined = append(quarantined, seg.SegmentName)
+				removed = append(removed, seg)
+				continue
+			}
+		}
+		segments = append(segments, seg)
+		segmentNames = append(segmentNames, seg.SegmentName)
+	}
+
+	idx.setSegments(segments, segmentNames)
+	// 正在进行的搜索结束后才关闭隔离的段
+	for _, seg := range removed {
+		seg.Retire(false)
+	}
+	if err := idx.removeKeys(removed); err != nil {
+		return quarantined, err
+	}
+	if err := idx.storeIndex(); err != nil {
+		return quarantined, err
+	}
+	return quarantined, renameErr
+}
+
+// removeKeys 删除当前指向这些段中文档的主键和版本，调用前需持有 docMutex
+func (idx *Index) removeKeys(segs []*segment.Segment) error {
+	if idx.PrimaryKey == "" || len(segs) == 0 {
+		return nil
+	}
+	inSegments := func(docId uint64) bool {
+		for _, seg := range segs {
+			if docId >= seg.StartDocId && docId < seg.MaxDocId {
+				return true
+			}
+		}
+		return false
+	}
+
+	candidates := make([]string, 0)
+	err := idx.primary.ForEach(PRIMARY_BTREE, func(key []byte, value string) error {
+		candidates = append(candidates, string(key))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for key := range idx.pkMap {
+		candidates = append(candidates, key)
+	}
+
+	keys := make([]string, 0)
+	for _, key := range candidates {
+		if docId, ok := idx.findPrimaryKey(key); ok && inSegments(docId) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	idx.versionMutex.Lock()
+	defer idx.versionMutex.Unlock()
+	for _, key := range keys {
+		delete(idx.pkMap, key)
+		delete(idx.versionMap, key)
+	}
+	if err := idx.primary.DeleteBatchString(PRIMARY_BTREE, keys); err != nil {
+		return err
+	}
+	if err := idx.primary.DeleteBatchString(VERSION_BTREE, keys); err != nil {
+		return err
+	}
+	idx.Logger.Warn("[WARN] Index %v Removed %v Keys Of Quarantined Segments", idx.Name, len(keys))
+	return nil
+}
@@ -0,0 +1,86 @@
+/**
+ * @Note 日期时间字段，按字段的格式和时区解析，转换为毫秒时间戳后写入段中
+ **/
+
+package gdindex
+
+import (
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"fmt"
+	"strconv"
+)
+
+// DateFieldOptions 日期时间字段的格式和时区
+type DateFieldOptions struct {
+	Format   string `json:"format,omitempty"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// addDateField 检查并保存日期时间字段的格式和时区
+func (idx *Index) addDateField(field segment.SimpleFieldInfo) error {
+	parser, err := utils.NewDateParser(field.Format, field.TimeZone)
+	if err != nil {
+		return fmt.Errorf("invalid datetime field %v : %v", field.FieldName, err)
+	}
+	if field.Format != "" || field.TimeZone != "" {
+		if idx.DateFields == nil {
+			idx.DateFields = make(map[string]DateFieldOptions)
+		}
+		idx.DateFields[field.FieldName] = DateFieldOptions{Format: field.Format, TimeZone: field.TimeZone}
+	}
+	idx.dateParsers.Store(field.FieldName, parser)
+	return nil
+}
+
+// deleteDateField 删除字段时一起删除它的格式和时区
+func (idx *Index) deleteDateField(fieldName string) {
+	delete(idx.DateFields, fieldName)
+	idx.dateParsers.Delete(fieldName)
+}
+
+// DateParser
+// @Description 获取日期时间字段的解析器，没有设置格式和时区的字段使用默认格式和 UTC
+// @Param fieldName 字段名
+// @Return *utils.DateParser 解析器
+func (idx *Index) DateParser(fieldName string) *utils.DateParser {
+	if parser, ok := idx.dateParsers.Load(fieldName); ok {
+		return parser.(*utils.DateParser)
+	}
+
+	opts := idx.DateFields[fieldName]
+	parser, err := utils.NewDateParser(opts.Format, opts.TimeZone)
+	if err != nil {
+		// 时区在新增字段时已经检查过，只有时区数据缺失时才会出错
+		idx.Logger.Error("[ERROR] DateParser of %v Error : %v", fieldName, err)
+		parser, _ = utils.NewDateParser(opts.Format, "")
+	}
+	idx.dateParsers.Store(fieldName, parser)
+	return parser
+}
+
+// normalizeDates 把日期时间字段的值转换为毫秒时间戳，无法解析时拒绝写入
+func (idx *Index) normalizeDates(content map[string]string) (map[string]string, error) {
+	var doc map[string]string
+	fields := idx.FieldTypes()
+	for field, value := range content {
+		if value == "" || fields[field] != utils.IDX_TYPE_DATETIME {
+			continue
+		}
+		ms, err := idx.DateParser(field).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %v : %v", field, err)
+		}
+		if doc == nil {
+			doc = make(map[string]string, len(content))
+			for k, v := range content {
+				doc[k] = v
+			}
+		}
+		doc[field] = strconv.FormatInt(ms, 10)
+	}
+	if doc == nil {
+		return content, nil
+	}
+	return doc, nil
+}
@@ -0,0 +1,86 @@
+/**
+ * @Note 动态映射，处理文档中不在索引字段中的字段
+ **/
+
+package gdindex
+
+import (
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"fmt"
+	"sort"
+)
+
+// 动态映射的模式
+const (
+	DYNAMIC_TRUE   = "true"   // 根据值推断类型并新增字段
+	DYNAMIC_FALSE  = "false"  // 忽略未知字段
+	DYNAMIC_STRICT = "strict" // 文档包含未知字段时拒绝写入
+)
+
+// DYNAMIC_KEYWORD_MAX_LEN 动态映射时不超过该字符数的字符串推断为全词匹配，更长的推断为切词匹配
+const DYNAMIC_KEYWORD_MAX_LEN = 32
+
+// IsValidDynamic 判断是否为支持的动态映射模式，为空表示 false
+func IsValidDynamic(dynamic string) bool {
+	switch dynamic {
+	case "", DYNAMIC_TRUE, DYNAMIC_FALSE, DYNAMIC_STRICT:
+		return true
+	}
+	return false
+}
+
+// SetDynamic
+// @Description 设置索引的动态映射模式，只对之后写入的文档生效
+// @Param dynamic true、false 或 strict
+// @Return error 任何错误
+func (idx *Index) SetDynamic(dynamic string) error {
+	if !IsValidDynamic(dynamic) {
+		return fmt.Errorf("unknown dynamic mapping %v", dynamic)
+	}
+	if dynamic == DYNAMIC_FALSE {
+		dynamic = ""
+	}
+
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+
+	idx.Dynamic = dynamic
+	return idx.storeIndex()
+}
+
+// applyDynamic 按动态映射模式处理文档中的未知字段，调用前需持有 docMutex
+func (idx *Index) applyDynamic(content map[string]string) error {
+	if idx.Dynamic == "" {
+		return nil
+	}
+
+	fields := idx.FieldTypes()
+	unknown := make([]string, 0)
+	for field := range content {
+		if _, ok := fields[field]; !ok && field != TTL_FIELD {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+
+	if idx.Dynamic == DYNAMIC_STRICT {
+		return fmt.Errorf("strict dynamic mapping : unknown fields %v", unknown)
+	}
+
+	for _, field := range unknown {
+		// 空值无法推断类型，等有值的文档写入时再新增字段
+		if content[field] == "" {
+			continue
+		}
+		fieldType := utils.InferFieldType(content[field], DYNAMIC_KEYWORD_MAX_LEN)
+		idx.Logger.Info("[INFO] Index %v Dynamic Add Field %v Type %v", idx.Name, field, fieldType)
+		if err := idx.AddField(segment.SimpleFieldInfo{FieldName: field, FieldType: fieldType}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+/**
+ * @Note 强制合并段，合并到指定的段数，或只重写删除文档比例过高的段
+ **/
+
+package gdindex
+
+import (
+	"GoDance/index/segment"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// DEFAULT_DELETES_PCT_ALLOWED 只清理删除文档时，默认允许段内删除文档所占的百分比
+const DEFAULT_DELETES_PCT_ALLOWED = 10.0
+
+// ForceMergeOptions 强制合并的参数
+type ForceMergeOptions struct {
+	MaxNumSegments     int     `json:"maxNumSegments"`     // 合并后最多保留的段数，0 表示合并为 1 个段
+	OnlyExpungeDeletes bool    `json:"onlyExpungeDeletes"` // 只重写删除文档比例超过阈值的段，不能与 MaxNumSegments 同时使用
+	DeletesPctAllowed  float64 `json:"deletesPctAllowed"`  // 段内删除文档的百分比超过该值时重写
+}
+
+// ForceMergeResult 强制合并的结果
+type ForceMergeResult struct {
+	SegmentsBefore int `json:"segmentsBefore"`
+	SegmentsAfter  int `json:"segmentsAfter"`
+	MergedSegments int `json:"mergedSegments"` // 被重写的段数
+	ExpungedDocs   int `json:"expungedDocs"`   // 从段文件中清理掉的删除文档数
+}
+
+// ForceMerge
+// @Description 强制合并段，只在选择要合并的段和替换段列表时持有写锁，合并段文件期间文档的增删改和搜索不受影响
+// @Param opts 合并参数
+// @Return ForceMergeResult 合并结果
+// @Return error 任何错误
+func (idx *Index) ForceMerge(opts ForceMergeOptions) (ForceMergeResult, error) {
+	var res ForceMergeResult
+	if opts.MaxNumSegments < 0 || opts.DeletesPctAllowed < 0 || opts.DeletesPctAllowed > 100 {
+		return res, errors.New("invalid force merge options")
+	}
+	if opts.OnlyExpungeDeletes && opts.MaxNumSegments > 0 {
+		return res, errors.New("max_num_segments can't be used with only_expunge_deletes")
+	}
+	if opts.MaxNumSegments == 0 {
+		opts.MaxNumSegments = 1
+	}
+
+	idx.mergeMutex.Lock()
+	defer idx.mergeMutex.Unlock()
+
+	// 先把过期的文档标记为删除，合并时一起清理
+	if _, err := idx.ExpireDocuments(); err != nil {
+		return res, err
+	}
+	// 内存段先持久化，一起参与合并，持久化期间持有文档写入锁
+	if err := idx.SyncMemorySegment(); err != nil {
+		return res, err
+	}
+
+	return idx.mergeSegmentGroups(func(delDocSet map[uint64]struct{}) [][]int {
+		if opts.OnlyExpungeDeletes {
+			return idx.expungeGroups(delDocSet, opts.DeletesPctAllowed)
+		}
+		return idx.balancedGroups(opts.MaxNumSegments)
+	})
+}
+
+// mergeSegmentGroups 按 plan 选出的分组合并段，后台合并和强制合并共用，调用前需持有 mergeMutex
+// 只在选择分组和替换段列表时持有写锁，合并段文件期间文档的增删改和搜索不受影响
+func (idx *Index) mergeSegmentGroups(plan func(delDocSet map[uint64]struct{}) [][]int) (ForceMergeResult, error) {
+	var res ForceMergeResult
+	snapshot, snapshotNames, delDocSet, groups, targets, err := idx.planMerge(plan)
+	if err != nil {
+		return res, err
+	}
+	res.SegmentsBefore = len(snapshot)
+	if len(groups) == 0 {
+		res.SegmentsAfter = res.SegmentsBefore
+		return res, nil
+	}
+	idx.Logger.Info("[INFO] Index %v Merge %v Groups Start", idx.Name, len(groups))
+
+	segments := make([]*segment.Segment, 0, len(snapshot))
+	segmentNames := make([]string, 0, len(snapshot))
+	replaced := make([]*segment.Segment, 0)
+	// 合并过的段范围内的删除记录不再需要保留
+	merged := make(map[uint64]struct{})
+	var mergeErr error
+	next := 0
+	for i, group := range groups {
+		if mergeErr != nil {
+			// 已经合并的组生效，失败的组和之后的组保持原样
+			targets[i].Close()
+			continue
+		}
+		segments = append(segments, snapshot[next:group[0]]...)
+		segmentNames = append(segmentNames, snapshotNames[next:group[0]]...)
+		next = group[0]
+
+		needMergeSegments := snapshot[group[0] : group[len(group)-1]+1]
+		newSegment, err := idx.mergeGroup(targets[i], needMergeSegments, delDocSet)
+		if err != nil {
+			mergeErr = err
+			continue
+		}
+		for docId := range delDocSet {
+			if docId >= newSegment.StartDocId && docId < newSegment.MaxDocId {
+				merged[docId] = struct{}{}
+			}
+		}
+		res.MergedSegments += len(needMergeSegments)
+		replaced = append(replaced, needMergeSegments...)
+		segments = append(segments, newSegment)
+		segmentNames = append(segmentNames, newSegment.SegmentName)
+		next = group[len(group)-1] + 1
+	}
+	segments = append(segments, snapshot[next:]...)
+	segmentNames = append(segmentNames, snapshotNames[next:]...)
+
+	res.ExpungedDocs = len(merged)
+	if len(replaced) > 0 {
+		after, err := idx.commitForceMerge(len(snapshot), segments, segmentNames, merged)
+		if err != nil {
+			return res, err
+		}
+		res.SegmentsAfter = after
+		// 新的段列表生效后，等正在进行的搜索结束再删除被合并的段
+		for _, seg := range replaced {
+			seg.Retire(true)
+		}
+	} else {
+		res.SegmentsAfter = res.SegmentsBefore
+	}
+	if mergeErr != nil {
+		return res, mergeErr
+	}
+	idx.Logger.Info("[INFO] Index %v Merge Finish, Segments %v -> %v", idx.Name, res.SegmentsBefore, res.SegmentsAfter)
+	return res, nil
+}
+
+// planMerge 持有写锁按 plan 选择要合并的段，并为每组创建合并后的段
+func (idx *Index) planMerge(plan func(delDocSet map[uint64]struct{}) [][]int) ([]*segment.Segment, []string,
+	map[uint64]struct{}, [][]int, []*segment.Segment, error) {
+
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	delDocSet, err := idx.readDelDocs()
+	if err != nil {
+		return nil, nil, nil, nil, nil, err
+	}
+
+	groups := plan(delDocSet)
+	fields := idx.segmentFields()
+	targets := make([]*segment.Segment, len(groups))
+	for i, group := range groups {
+		targets[i] = idx.newSegment(idx.nextSegmentName(), idx.segments[group[0]].StartDocId, fields)
+	}
+	snapshot := append([]*segment.Segment(nil), idx.segments...)
+	snapshotNames := append([]string(nil), idx.SegmentNames...)
+	return snapshot, snapshotNames, delDocSet, groups, targets, nil
+}
+
+// policyGroups 按合并策略分组，跳过开头文档数超过 MaxMergeDocs 的段，之后每 SegmentsPerMerge 个段一组
+func (idx *Index) policyGroups(policy MergePolicy) [][]int {
+	start := 0
+	for start < len(idx.segments) && idx.segments[start].MaxDocId-idx.segments[start].StartDocId > policy.MaxMergeDocs {
+		start++
+	}
+	groups := make([][]int, 0)
+	for ; start < len(idx.segments); start += policy.SegmentsPerMerge {
+		end := start + policy.SegmentsPerMerge
+		if end > len(idx.segments) {
+			end = len(idx.segments)
+		}
+		if end-start < 2 {
+			break
+		}
+		group := make([]int, 0, end-start)
+		for j := start; j < end; j++ {
+			group = append(group, j)
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// balancedGroups 把段按顺序分成不超过 n 组，只有一个段的组不需要合并
+func (idx *Index) balancedGroups(n int) [][]int {
+	segSize := len(idx.segments)
+	if segSize <= n {
+		return nil
+	}
+	groups := make([][]int, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		size := segSize / n
+		if i < segSize%n {
+			size++
+		}
+		if size > 1 {
+			group := make([]int, 0, size)
+			for j := start; j < start+size; j++ {
+				group = append(group, j)
+			}
+			groups = append(groups, group)
+		}
+		start += size
+	}
+	return groups
+}
+
+// expungeGroups 删除文档比例超过阈值的段，相邻的段合并为一组
+func (idx *Index) expungeGroups(delDocSet map[uint64]struct{}, pctAllowed float64) [][]int {
+	deleted := make([]int, len(idx.segments))
+	for docId := range delDocSet {
+		if i := idx.segmentIndexOf(docId); i >= 0 {
+			deleted[i]++
+		}
+	}
+
+	groups := make([][]int, 0)
+	var group []int
+	for i, seg := range idx.segments {
+		size := seg.MaxDocId - seg.StartDocId
+		if size > 0 && float64(deleted[i])*100/float64(size) > pctAllowed {
+			group = append(group, i)
+			continue
+		}
+		if len(group) > 0 {
+			groups = append(groups, group)
+			group = nil
+		}
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// segmentIndexOf 文档所在的持久化段的下标，不在持久化段中时返回 -1
+func (idx *Index) segmentIndexOf(docId uint64) int {
+	for i, seg := range idx.segments {
+		if docId >= seg.StartDocId && docId < seg.MaxDocId {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergeGroup 把相邻的段合并到 tmpSegment 中，原来的段由调用方在替换段列表后删除
+func (idx *Index) mergeGroup(tmpSegment *segment.Segment, needMergeSegments []*segment.Segment,
+	delDocSet map[uint64]struct{}) (*segment.Segment, error) {
+
+	segmentName := tmpSegment.SegmentName
+	if err := idx.dir.MkdirAll(segmentName); err != nil {
+		idx.Logger.Error("Mkdir error : %v", err)
+	}
+
+	if err := tmpSegment.MergeSegments(needMergeSegments, delDocSet); err != nil {
+		tmpSegment.Close()
+		idx.dir.RemoveAll(segmentName)
+		return nil, err
+	}
+	tmpSegment.Close()
+
+	return segment.NewSegmentFromLocalFile(segmentName, idx.dir, idx.Logger), nil
+}
+
+// nextSegmentName 分配新段的段名，调用前需持有 segmentMutex
+func (idx *Index) nextSegmentName() string {
+	segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
+	idx.NextSegmentSuffix++
+	return segmentName
+}
+
+// commitForceMerge 持有写锁替换段列表，合并期间持久化的段追加在后面，删除文件中只保留没有被合并清理的文档
+// 合并期间新删除的文档不在合并时的删除记录中，重新读取删除文件保留它们
+func (idx *Index) commitForceMerge(snapshotLen int, segments []*segment.Segment, segmentNames []string,
+	merged map[uint64]struct{}) (int, error) {
+
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	idx.setSegments(append(segments, idx.segments[snapshotLen:]...), append(segmentNames, idx.SegmentNames[snapshotLen:]...))
+
+	delDocSet, err := idx.readDelDocs()
+	if err != nil {
+		return len(idx.segments), err
+	}
+	remain := make([]uint64, 0, len(delDocSet))
+	for docId := range delDocSet {
+		if _, ok := merged[docId]; !ok {
+			remain = append(remain, docId)
+		}
+	}
+	if err := idx.writeDelDocs(remain); err != nil {
+		return len(idx.segments), err
+	}
+	return len(idx.segments), idx.storeIndex()
+}
+
+// readDelDocs 读取删除文件中记录的文档
+func (idx *Index) readDelDocs() (map[uint64]struct{}, error) {
+	delFileName := fmt.Sprintf("%v%v.del", idx.PathName, idx.Name)
+	delDocSet := make(map[uint64]struct{})
+	if !idx.dir.Exist(delFileName) {
+		return delDocSet, nil
+	}
+	buf, err := idx.dir.ReadFile(delFileName)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < idx.DelDocNum && (i+1)*8 <= len(buf); i++ {
+		delDocSet[binary.LittleEndian.Uint64(buf[i*8:])] = struct{}{}
+	}
+	return delDocSet, nil
+}
+
+// writeDelDocs 重写删除文件
+func (idx *Index) writeDelDocs(docIds []uint64) error {
+	delFileName := fmt.Sprintf("%v%v.del", idx.PathName, idx.Name)
+	buf := make([]byte, len(docIds)*8)
+	for i, docId := range docIds {
+		binary.LittleEndian.PutUint64(buf[i*8:], docId)
+	}
+	if err := idx.dir.WriteFile(delFileName, buf); err != nil {
+		return err
+	}
+	idx.DelDocNum = len(docIds)
+	return nil
+}
@@ -14,34 +14,96 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// 批量写入支持的操作类型
+const (
+	OP_INDEX  = "index"  // 新增文档
+	OP_UPDATE = "update" // 更新文档
+	OP_DELETE = "delete" // 删除文档
+)
+
+const (
+	PRIMARY_BTREE = "_primary" // 主键树名，key 为主键的字节串，value 为 docId
+	VERSION_BTREE = "_version" // 版本树名，与主键树在同一个文件中，key 为主键，value 为文档版本
+	PK_SEPARATOR  = "\x1f"     // 联合主键各字段之间的分隔符
+)
+
+const (
+	EXPIRE_FIELD = "_expire" // 文档过期时间字段，unix 秒，根据存活时间计算得到
+	TTL_FIELD    = "_ttl"    // 文档中指定存活时间的字段，不存储
+)
+
+// ErrVersionConflict 写入时指定的版本与当前版本不一致
+var ErrVersionConflict = errors.New("version conflict")
+
+// DocOperation 批量写入中的单个文档操作
+type DocOperation struct {
+	Action    string            // 操作类型
+	Key       string            // 主键，删除时使用
+	Content   map[string]string // 文档内容，新增和更新时使用
+	IfVersion uint64            // 不为 0 时只有当前版本与之相同才执行
+}
+
+// UpdateOptions 更新文档的方式
+type UpdateOptions struct {
+	Partial   bool   // 只更新给出的字段，其余字段保留原文档的内容
+	Upsert    bool   // 主键不存在时新增文档
+	IfVersion uint64 // 不为 0 时只有当前版本与之相同才更新
+}
+
+// SortSpec 按字段排序的条件
+type SortSpec struct {
+	Field        string // 字段名
+	Desc         bool   // 是否降序
+	MissingFirst bool   // 没有值的文档排在最前，默认排在最后
+}
+
 // Index 索引类
 type Index struct {
-	Name              string            `json:"name"`
-	PathName          string            `json:"pathName"`
-	Fields            map[string]uint64 `json:"fields"`
-	PrimaryKey        string            `json:"primaryKey"`
-	StartDocId        uint64            `json:"startDocId"`
-	MaxDocId          uint64            `json:"maxDocId"`
-	DelDocNum         int               `json:"delDocNum"`
-	NextSegmentSuffix uint64            `json:"nextSegmentSuffix"`
-	SegmentNames      []string          `json:"segmentNames"`
+	Name              string                      `json:"name"`
+	PathName          string                      `json:"pathName"`
+	Fields            map[string]uint64           `json:"fields"` // 字段名到字段类型，只会复制后整体替换，读取时使用 FieldTypes
+	PrimaryKey        string                      `json:"primaryKey"`
+	PrimaryKeyFields  []string                    `json:"primaryKeyFields"`     // 组成主键的字段，多个字段时为联合主键
+	TTL               int64                       `json:"ttl"`                  // 文档默认的存活时间，单位秒，0 表示不过期
+	TTLField          string                      `json:"ttlField"`             // 计算过期时间的日期字段，过期时间为该字段的值加上 TTL
+	Dynamic           string                      `json:"dynamic"`              // 动态映射模式，为空表示忽略未知字段
+	SubFields         map[string][]string         `json:"subFields,omitempty"`  // 父字段到子字段的映射，子字段的值从父字段复制
+	DateFields        map[string]DateFieldOptions `json:"dateFields,omitempty"` // 日期时间字段的格式和时区
+	Settings          IndexSettings               `json:"settings"`             // 持久化、合并、分词和相关度的设置
+	StartDocId        uint64                      `json:"startDocId"`
+	MaxDocId          uint64                      `json:"maxDocId"`
+	DelDocNum         int                         `json:"delDocNum"`
+	NextSegmentSuffix uint64                      `json:"nextSegmentSuffix"`
+	SegmentNames      []string                    `json:"segmentNames"`
 
 	segments      []*segment.Segment
 	memorySegment *segment.Segment
 	primary       *tree.BTreeDB
 	bitmap        *utils.Bitmap
-
-	pkMap map[int64]string // 内存中的主键信息
-
-	segmentMutex *sync.Mutex
-	Logger       *utils.Log4FE `json:"-"`
+	dir           utils.Directory // 索引文件所在的目录
+	dateParsers   sync.Map        // 日期时间字段的解析器，字段名到 *utils.DateParser
+	refreshedAt   time.Time       // 上次持久化内存段的时间，用于定时持久化
+
+	pkMap        map[string]string // 内存中的主键信息
+	versionMap   map[string]string // 内存中的版本信息，与主键信息一起写入
+	versionMutex *sync.RWMutex     // 版本信息的读写锁，搜索结果读取版本时不需要等待写入
+
+	segmentMutex  *sync.Mutex
+	docMutex      *sync.Mutex   // 文档写入锁，保证增删改操作串行执行
+	mergeMutex    *sync.Mutex   // 合并、强制合并和检查互斥，它们读取段文件时不持有写锁
+	fieldsMutex   *sync.RWMutex // 保护 Fields 的替换，Fields 只会复制后整体替换，搜索时读取快照
+	settingsMutex *sync.RWMutex // 保护 Settings 的替换，搜索和合并读取设置时不需要等待写入
+	snapshotMutex *sync.RWMutex // 保护段列表的替换，搜索时在读锁下取段列表的快照
+	Logger        *utils.Log4FE `json:"-"`
 }
 
 // NewEmptyIndex
@@ -50,6 +112,16 @@ type Index struct {
 // @Param pathname
 // @Return
 func NewEmptyIndex(name, pathname string, logger *utils.Log4FE) *Index {
+	return NewEmptyIndexIn(utils.DefaultDirectory, name, pathname, logger)
+}
+
+// NewEmptyIndexIn
+// @Description 在指定的目录中创建新索引
+// @Param dir 索引文件所在的目录
+// @Param name 索引名
+// @Param pathname 索引的存储路径
+// @Return 返回索引
+func NewEmptyIndexIn(dir utils.Directory, name, pathname string, logger *utils.Log4FE) *Index {
 	idx := &Index{
 		Name:              name,
 		PathName:          pathname,
@@ -60,22 +132,31 @@ func NewEmptyIndex(name, pathname string, logger *utils.Log4FE) *Index {
 		NextSegmentSuffix: 1000,
 		SegmentNames:      make([]string, 0),
 		segments:          make([]*segment.Segment, 0),
-		pkMap:             make(map[int64]string),
+		pkMap:             make(map[string]string),
+		versionMap:        make(map[string]string),
+		versionMutex:      new(sync.RWMutex),
 		segmentMutex:      new(sync.Mutex),
+		docMutex:          new(sync.Mutex),
+		mergeMutex:        new(sync.Mutex),
+		fieldsMutex:       new(sync.RWMutex),
+		settingsMutex:     new(sync.RWMutex),
+		snapshotMutex:     new(sync.RWMutex),
+		refreshedAt:       time.Now(),
+		dir:               dir,
 		Logger:            logger,
 	}
 
 	bitmapName := fmt.Sprintf("%v%v.bitmap", pathname, name)
-	utils.MakeBitmapFile(bitmapName)
-	idx.bitmap = utils.NewBitmap(bitmapName)
+	utils.MakeBitmapFileIn(dir, bitmapName)
+	idx.bitmap = utils.NewBitmapIn(dir, bitmapName)
 
 	delFileName := fmt.Sprintf("%v%v.del", pathname, name)
-	delFile, err := os.Create(delFileName)
-	defer delFile.Close()
+	delFile, err := dir.Create(delFileName)
 	if err != nil {
 		logger.Error("[ERROR] Create delFile ERROR : %v", err)
 		return idx
 	}
+	delFile.Close()
 
 	return idx
 }
@@ -86,20 +167,39 @@ func NewEmptyIndex(name, pathname string, logger *utils.Log4FE) *Index {
 // @Param pathname 索引的存储路径
 // @Return 返回索引
 func NewIndexFromLocalFile(name, pathname string, logger *utils.Log4FE) *Index {
+	return NewIndexFromLocalFileIn(utils.DefaultDirectory, name, pathname, logger)
+}
+
+// NewIndexFromLocalFileIn
+// @Description 从指定的目录中反序列化索引
+// @Param dir 索引文件所在的目录
+// @Param name 索引名
+// @Param pathname 索引的存储路径
+// @Return 返回索引
+func NewIndexFromLocalFileIn(dir utils.Directory, name, pathname string, logger *utils.Log4FE) *Index {
 
 	idx := &Index{
-		Name:         name,
-		PathName:     pathname,
-		Fields:       make(map[string]uint64),
-		SegmentNames: make([]string, 0),
-		segments:     make([]*segment.Segment, 0),
-		pkMap:        make(map[int64]string),
-		segmentMutex: new(sync.Mutex),
-		Logger:       logger,
+		Name:          name,
+		PathName:      pathname,
+		Fields:        make(map[string]uint64),
+		SegmentNames:  make([]string, 0),
+		segments:      make([]*segment.Segment, 0),
+		pkMap:         make(map[string]string),
+		versionMap:    make(map[string]string),
+		versionMutex:  new(sync.RWMutex),
+		segmentMutex:  new(sync.Mutex),
+		docMutex:      new(sync.Mutex),
+		mergeMutex:    new(sync.Mutex),
+		fieldsMutex:   new(sync.RWMutex),
+		settingsMutex: new(sync.RWMutex),
+		snapshotMutex: new(sync.RWMutex),
+		refreshedAt:   time.Now(),
+		dir:           dir,
+		Logger:        logger,
 	}
 
 	metaFileName := fmt.Sprintf("%v%v.meta", pathname, name)
-	buffer, err := utils.ReadFromJson(metaFileName)
+	buffer, err := utils.ReadFromJsonIn(dir, metaFileName)
 	if err != nil {
 		return idx
 	}
@@ -109,32 +209,44 @@ func NewIndexFromLocalFile(name, pathname string, logger *utils.Log4FE) *Index {
 		return idx
 	}
 
-	for _, segmentName := range idx.SegmentNames {
-		seg := segment.NewSegmentFromLocalFile(segmentName, logger)
-		idx.segments = append(idx.segments, seg)
+	// 旧版本的压缩方式记录在元信息的顶层，迁移到设置中
+	var legacy struct {
+		Codec string `json:"codec"`
+	}
+	if json.Unmarshal(buffer, &legacy) == nil && legacy.Codec != "" && idx.Settings.Codec == "" {
+		idx.Settings.Codec = legacy.Codec
 	}
 
-	segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
-
-	fields := make(map[string]uint64)
-
-	for fieldName, fieldType := range idx.Fields {
-		if fieldType != utils.IDX_TYPE_PK {
-			fields[fieldName] = fieldType
+	// 数据目录移动后元信息中记录的还是原来的路径，按实际的存储路径修正段名
+	if idx.PathName != pathname {
+		for i, segmentName := range idx.SegmentNames {
+			idx.SegmentNames[i] = fmt.Sprintf("%v%v/", pathname, filepath.Base(segmentName))
 		}
+		idx.PathName = pathname
 	}
 
-	// fmt.Println(fields)
+	for _, segmentName := range idx.SegmentNames {
+		seg := segment.NewSegmentFromLocalFile(segmentName, dir, logger)
+		idx.segments = append(idx.segments, seg)
+	}
 
-	idx.memorySegment = segment.NewEmptySegmentByFieldsInfo(segmentName, idx.MaxDocId, fields, idx.Logger)
+	segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
+
+	idx.memorySegment = idx.newSegment(segmentName, idx.MaxDocId, idx.segmentFields())
 	idx.NextSegmentSuffix++
 
 	bitmapName := fmt.Sprintf("%v%v.bitmap", pathname, idx.Name)
-	idx.bitmap = utils.NewBitmap(bitmapName)
+	idx.bitmap = utils.NewBitmapIn(dir, bitmapName)
 
 	if idx.PrimaryKey != "" {
-		primaryName := fmt.Sprintf("%v%v_primary.pk", idx.PathName, idx.Name)
-		idx.primary = tree.NewBTDB(primaryName, logger)
+		idx.primary = idx.openPrimary()
+		idx.primary.AddBTree(VERSION_BTREE)
+
+		if len(idx.PrimaryKeyFields) == 0 {
+			if err := idx.migratePrimaryKey(); err != nil {
+				idx.Logger.Error("[ERROR] Migrate PrimaryKey Error : %v", err)
+			}
+		}
 	}
 
 	idx.Logger.Info("[INFO] Load Index %v success", idx.Name)
@@ -147,60 +259,81 @@ func NewIndexFromLocalFile(name, pathname string, logger *utils.Log4FE) *Index {
 // @Param field  新增的字段描述信息
 // @Return 任何error
 func (idx *Index) AddField(field segment.SimpleFieldInfo) error {
-	if _, ok := idx.Fields[field.FieldName]; ok {
+	if len(field.Fields) > 0 {
+		return idx.addMultiField(field)
+	}
+	return idx.addField(field, "")
+}
+
+// addField 新增字段，parent 不为空时作为 parent 的子字段，只建索引不存储内容
+func (idx *Index) addField(field segment.SimpleFieldInfo, parent string) error {
+	if _, ok := idx.FieldTypes()[field.FieldName]; ok {
 		idx.Logger.Info("[INFO] Load Index %v success", idx.Name)
 		return nil
 	}
+	if field.FieldType == utils.IDX_TYPE_DATETIME {
+		if err := idx.addDateField(field); err != nil {
+			return err
+		}
+	}
 
-	idx.Fields[field.FieldName] = field.FieldType
+	idx.setFieldType(field.FieldName, field.FieldType)
 
-	// 如果是主键 则替换当前主键，只要有文档内容就不应该替换主键
+	// 只要有文档内容就不应该修改主键
 	if field.FieldType == utils.IDX_TYPE_PK {
-		idx.PrimaryKey = field.FieldName
-		primaryBtree := fmt.Sprintf("%v%v_primary.pk", idx.PathName, idx.Name)
-		idx.primary = tree.NewBTDB(primaryBtree, idx.Logger)
-		idx.primary.AddBTree(field.FieldName)
+		if idx.MaxDocId > 0 {
+			idx.Logger.Error("[ERROR] PrimaryKey Can't Change After Documents Added : %v", field.FieldName)
+			idx.deleteFieldType(field.FieldName)
+			return errors.New("primary key can't be changed after documents added")
+		}
+		if idx.primary == nil {
+			idx.primary = idx.openPrimary()
+			idx.primary.AddBTree(PRIMARY_BTREE)
+			idx.primary.AddBTree(VERSION_BTREE)
+		}
+		if idx.PrimaryKey == "" {
+			idx.PrimaryKey = field.FieldName
+		}
+		idx.PrimaryKeyFields = append(idx.PrimaryKeyFields, field.FieldName)
+
+		// 主键在段内按全词匹配的字符串存储，这样可以按主键检索和取回
+		field.FieldType = utils.IDX_TYPE_STRING
+	}
+
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	if parent != "" {
+		if idx.SubFields == nil {
+			idx.SubFields = make(map[string][]string)
+		}
+		idx.SubFields[parent] = append(idx.SubFields[parent], field.FieldName)
+	}
+
+	if idx.memorySegment == nil {
+		// 如果内存段为 nil 则新建一个内存段并添加字段
+		segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
+		idx.memorySegment = idx.newSegment(segmentName, idx.MaxDocId, idx.segmentFields())
+		idx.NextSegmentSuffix++
 	} else {
-		idx.segmentMutex.Lock()
-		defer idx.segmentMutex.Unlock()
-
-		if idx.memorySegment == nil {
-			// 如果内存段为 nil 则新建一个内存段并添加字段
-			segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
-			fields := make(map[string]uint64)
-			for fieldName, fieldType := range idx.Fields {
-				if fieldType != utils.IDX_TYPE_PK {
-					fields[fieldName] = fieldType
-				}
-			}
-			idx.memorySegment = segment.NewEmptySegmentByFieldsInfo(segmentName, idx.MaxDocId, fields, idx.Logger)
-			idx.NextSegmentSuffix++
-		} else if idx.memorySegment.IsEmpty() {
-			// 如果内存段大小为0，则直接添加字段
-			err := idx.memorySegment.AddField(field)
-			if err != nil {
-				idx.Logger.Error("[ERROR] Add Field Error : %v", err)
-				return err
-			}
+		// 直接给内存段添加字段，内存段中已有的文档在新字段中为空值，之前持久化的段中没有该字段
+		var err error
+		if parent != "" {
+			err = idx.memorySegment.AddSubField(field, parent)
 		} else {
-			// 如果内存段不为空，则序列化内存段，重新创建一个内存段，这个新的内存段有新增的属性
-			tempSegment := idx.memorySegment
-
-			if err := tempSegment.Serialization(); err != nil {
-				return err
-			}
-			idx.segments = append(idx.segments, tempSegment)
-			idx.SegmentNames = append(idx.SegmentNames, tempSegment.SegmentName)
-
-			segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
-			fields := make(map[string]uint64)
-			for fieldName, fieldType := range idx.Fields {
-				if fieldType != utils.IDX_TYPE_PK {
-					fields[fieldName] = fieldType
+			err = idx.memorySegment.AddField(field)
+		}
+		if err != nil {
+			idx.Logger.Error("[ERROR] Add Field Error : %v", err)
+			idx.deleteFieldType(field.FieldName)
+			if parent != "" {
+				subs := idx.SubFields[parent]
+				idx.SubFields[parent] = subs[:len(subs)-1]
+				if len(idx.SubFields[parent]) == 0 {
+					delete(idx.SubFields, parent)
 				}
 			}
-			idx.memorySegment = segment.NewEmptySegmentByFieldsInfo(segmentName, idx.MaxDocId, fields, idx.Logger)
-			idx.NextSegmentSuffix++
+			return err
 		}
 	}
 	return idx.storeIndex()
@@ -211,7 +344,7 @@ func (idx *Index) AddField(field segment.SimpleFieldInfo) error {
 // @Param fieldName 要删除的字段名
 // @Return error 任何错误
 func (idx *Index) DeleteField(fieldName string) error {
-	if _, ok := idx.Fields[fieldName]; !ok {
+	if _, ok := idx.FieldTypes()[fieldName]; !ok {
 		idx.Logger.Warn("[WARN] Field Not Found : %v", fieldName)
 		return nil
 	}
@@ -221,20 +354,19 @@ func (idx *Index) DeleteField(fieldName string) error {
 		return nil
 	}
 
+	if err := idx.deleteSubFields(fieldName); err != nil {
+		return err
+	}
+	idx.deleteDateField(fieldName)
+
 	idx.segmentMutex.Lock()
 	defer idx.segmentMutex.Unlock()
 
-	delete(idx.Fields, fieldName)
+	idx.deleteFieldType(fieldName)
 
 	if idx.memorySegment == nil {
 		segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
-		fields := make(map[string]uint64)
-		for fieldName, fieldType := range idx.Fields {
-			if fieldType != utils.IDX_TYPE_PK {
-				fields[fieldName] = fieldType
-			}
-		}
-		idx.memorySegment = segment.NewEmptySegmentByFieldsInfo(segmentName, idx.MaxDocId, fields, idx.Logger)
+		idx.memorySegment = idx.newSegment(segmentName, idx.MaxDocId, idx.segmentFields())
 		idx.NextSegmentSuffix++
 	} else if idx.memorySegment.IsEmpty() {
 		err := idx.memorySegment.DeleteField(fieldName)
@@ -248,17 +380,10 @@ func (idx *Index) DeleteField(fieldName string) error {
 		if err := tempSegment.Serialization(); err != nil {
 			return err
 		}
-		idx.segments = append(idx.segments, tempSegment)
-		idx.SegmentNames = append(idx.SegmentNames, tempSegment.SegmentName)
+		idx.setSegments(append(idx.segments, tempSegment), append(idx.SegmentNames, tempSegment.SegmentName))
 
 		segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
-		fields := make(map[string]uint64)
-		for fieldName, fieldType := range idx.Fields {
-			if fieldType != utils.IDX_TYPE_PK {
-				fields[fieldName] = fieldType
-			}
-		}
-		idx.memorySegment = segment.NewEmptySegmentByFieldsInfo(segmentName, idx.MaxDocId, fields, idx.Logger)
+		idx.memorySegment = idx.newSegment(segmentName, idx.MaxDocId, idx.segmentFields())
 		idx.NextSegmentSuffix++
 	}
 
@@ -271,14 +396,68 @@ func (idx *Index) DeleteField(fieldName string) error {
 // @Return uint32 文档Id
 // @Return error 任何error
 func (idx *Index) AddDocument(content map[string]string) (uint64, error) {
-	if len(idx.Fields) == 0 {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+
+	return idx.addDocument(content)
+}
+
+// ApplyOperations
+// @Description 批量执行文档操作，整批操作只加一次写入锁
+// @Param ops 需要执行的操作
+// @Return []error 每个操作对应的错误，成功则为 nil
+func (idx *Index) ApplyOperations(ops []DocOperation) []error {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		switch op.Action {
+		case OP_INDEX:
+			if errs[i] = idx.checkContentVersion(op.Content, op.IfVersion); errs[i] == nil {
+				_, errs[i] = idx.addDocument(op.Content)
+			}
+		case OP_UPDATE:
+			errs[i] = idx.updateDocument(op.Content, UpdateOptions{IfVersion: op.IfVersion})
+		case OP_DELETE:
+			if errs[i] = idx.checkVersion(op.Key, op.IfVersion); errs[i] == nil {
+				errs[i] = idx.deleteDocument(op.Key)
+			}
+		default:
+			errs[i] = fmt.Errorf("unknown operation %v", op.Action)
+		}
+	}
+	return errs
+}
+
+func (idx *Index) addDocument(content map[string]string) (uint64, error) {
+	if len(idx.FieldTypes()) == 0 && idx.Dynamic != DYNAMIC_TRUE {
 		idx.Logger.Error("[ERROR] Index has no Field")
 		return 0, errors.New("index has no Field")
 	}
 
-	// 在段内文档数到达阈值时进行持久化
-	if idx.memorySegment != nil && idx.memorySegment.MaxDocId-idx.memorySegment.StartDocId >= utils.MAX_SEGMENT_SIZE {
-		err := idx.SyncMemorySegment()
+	content, err := idx.applyTTL(content)
+	if err != nil {
+		return 0, err
+	}
+	content = idx.copySubFields(content)
+	if err := idx.applyDynamic(content); err != nil {
+		return 0, err
+	}
+	if content, err = idx.normalizeDates(content); err != nil {
+		return 0, err
+	}
+
+	var key string
+	if idx.PrimaryKey != "" {
+		if key, err = idx.PrimaryKeyOf(content); err != nil {
+			return 0, err
+		}
+	}
+
+	// 在段内文档数或写入的字节数到达阈值时进行持久化
+	if idx.needFlush() {
+		err := idx.syncMemorySegment()
 		if err != nil {
 			return 0, err
 		}
@@ -289,13 +468,7 @@ func (idx *Index) AddDocument(content map[string]string) (uint64, error) {
 
 		segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
 
-		fields := make(map[string]uint64)
-		for fieldName, fieldType := range idx.Fields {
-			if fieldType != utils.IDX_TYPE_PK {
-				fields[fieldName] = fieldType
-			}
-		}
-		idx.memorySegment = segment.NewEmptySegmentByFieldsInfo(segmentName, idx.MaxDocId, fields, idx.Logger)
+		idx.memorySegment = idx.newSegment(segmentName, idx.MaxDocId, idx.segmentFields())
 		idx.NextSegmentSuffix++
 
 		if err := idx.storeIndex(); err != nil {
@@ -309,18 +482,24 @@ func (idx *Index) AddDocument(content map[string]string) (uint64, error) {
 	idx.MaxDocId++
 
 	if idx.PrimaryKey != "" {
-
-		pkval, err := strconv.Atoi(content[idx.PrimaryKey])
-		if err != nil {
-			return 0, err
+		// 主键已存在时用新文档替换旧文档
+		if oldDocId, ok := idx.findPrimaryKey(key); ok && idx.bitmap.GetBit(oldDocId) == 0 {
+			if idx.bitmap.SetBit(oldDocId, 1) {
+				idx.deleteDocumentByDocId(oldDocId)
+			}
 		}
 
-		idx.pkMap[int64(pkval)] = fmt.Sprintf("%v", docId)
+		idx.pkMap[key] = fmt.Sprintf("%v", docId)
+		idx.bumpVersion(key)
 
-		if idx.MaxDocId%500000 == 0 {
-			idx.primary.SetBatch(idx.PrimaryKey, idx.pkMap)
+		if idx.MaxDocId%idx.Settings.withDefaults().PkBatchSize == 0 {
+			idx.versionMutex.Lock()
+			idx.primary.SetBatchString(PRIMARY_BTREE, idx.pkMap)
+			idx.primary.SetBatchString(VERSION_BTREE, idx.versionMap)
 			idx.pkMap = nil
-			idx.pkMap = make(map[int64]string)
+			idx.pkMap = make(map[string]string)
+			idx.versionMap = make(map[string]string)
+			idx.versionMutex.Unlock()
 		}
 
 	}
@@ -332,34 +511,59 @@ func (idx *Index) AddDocument(content map[string]string) (uint64, error) {
 // @Param content 更新后的内容
 // @Return error  任何错误
 func (idx *Index) UpdateDocument(content map[string]string) error {
-	if _, ok := content[idx.PrimaryKey]; !ok {
-		idx.Logger.Error("[ERROR] Primary Key Not Found %v", idx.PrimaryKey)
-		return errors.New("no Primary Key")
-	}
+	return idx.UpdateDocumentWithOptions(content, UpdateOptions{})
+}
 
-	pk, err := strconv.ParseInt(content[idx.PrimaryKey], 10, 64)
+// UpdateDocumentWithOptions
+// @Description 按指定方式更新文档，支持部分更新和不存在时新增
+// @Param content 更新的内容，必须包含主键
+// @Param opts 更新方式
+// @Return error 任何错误
+func (idx *Index) UpdateDocumentWithOptions(content map[string]string, opts UpdateOptions) error {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+
+	return idx.updateDocument(content, opts)
+}
+
+func (idx *Index) updateDocument(content map[string]string, opts UpdateOptions) error {
+	key, err := idx.PrimaryKeyOf(content)
 	if err != nil {
+		idx.Logger.Error("[ERROR] Primary Key Not Found %v", idx.PrimaryKeyFields)
 		return err
 	}
 
-	oldDocId, ok := idx.findPrimaryKey(pk)
-	if idx.bitmap.GetBit(oldDocId) == 1 {
-		return errors.New("doc has been deleted or not exist")
+	if err := idx.checkVersion(key, opts.IfVersion); err != nil {
+		return err
 	}
-	if ok {
-		success := idx.bitmap.SetBit(oldDocId, 1)
-		if success {
-			idx.deleteDocumentByDocId(oldDocId)
+
+	oldDocId, ok := idx.findPrimaryKey(key)
+	if !ok || idx.bitmap.GetBit(oldDocId) == 1 {
+		if opts.Upsert {
+			_, err = idx.addDocument(content)
+			return err
 		}
+		return errors.New("doc has been deleted or not exist")
 	}
 
-	docId := idx.MaxDocId
-	idx.MaxDocId++
-
-	if err := idx.updatePrimaryKey(pk, oldDocId); err != nil {
-		return err
+	if opts.Partial {
+		// 以原文档为基础，覆盖给出的字段
+		oldContent, ok := idx.GetDocument(oldDocId)
+		if !ok {
+			return errors.New("doc has been deleted or not exist")
+		}
+		merged := make(map[string]string, len(oldContent)+len(content))
+		for field, value := range oldContent {
+			merged[field] = value
+		}
+		for field, value := range content {
+			merged[field] = value
+		}
+		content = merged
 	}
-	return idx.memorySegment.AddDocument(docId, content)
+
+	_, err = idx.addDocument(content)
+	return err
 }
 
 // GetDocument
@@ -367,12 +571,17 @@ func (idx *Index) UpdateDocument(content map[string]string) error {
 // @Param docId 文档ID
 // @Return map[string]string 文档内容，key是字段名，value是内容
 func (idx *Index) GetDocument(docId uint64) (map[string]string, bool) {
-	for _, seg := range idx.segments {
+	segments := idx.acquireSegments()
+	defer releaseSegments(segments)
+
+	for _, seg := range segments {
 		if docId >= seg.StartDocId && docId < seg.MaxDocId {
-			return seg.GetDocument(docId)
+			doc, ok := seg.GetDocument(docId)
+			return idx.stripSubFields(doc), ok
 		}
 	}
-	return idx.memorySegment.GetDocument(docId)
+	doc, ok := idx.memorySegment.GetDocument(docId)
+	return idx.stripSubFields(doc), ok
 }
 
 // DeleteDocument
@@ -380,14 +589,19 @@ func (idx *Index) GetDocument(docId uint64) (map[string]string, bool) {
 // @param primaryKey 根据
 // @return error 任何错误
 func (idx *Index) DeleteDocument(primaryKey string) error {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
 
-	pk, err := strconv.ParseInt(primaryKey, 10, 64)
+	return idx.deleteDocument(primaryKey)
+}
 
-	if err != nil {
-		return err
+func (idx *Index) deleteDocument(primaryKey string) error {
+	if idx.PrimaryKey == "" {
+		idx.Logger.Error("[ERROR] primaryKey is not exist")
+		return errors.New("no Primary Key")
 	}
 
-	docId, ok := idx.findPrimaryKey(pk)
+	docId, ok := idx.findPrimaryKey(primaryKey)
 	if ok {
 		if idx.bitmap.GetBit(docId) == 1 {
 			return nil
@@ -395,17 +609,148 @@ func (idx *Index) DeleteDocument(primaryKey string) error {
 		success := idx.bitmap.SetBit(docId, 1)
 		if success {
 			idx.deleteDocumentByDocId(docId)
+			// 删除也是一次写入，持有旧版本的写入方不能再覆盖
+			idx.bumpVersion(primaryKey)
 		}
-		return nil
 	}
 
-	return err
+	return nil
+}
+
+// GetDocumentByKey
+// @Description 根据主键获取文档内容
+// @Param primaryKey 主键，联合主键的各字段值用 PK_SEPARATOR 连接
+// @Return map[string]string 文档内容
+// @Return bool 文档是否存在
+func (idx *Index) GetDocumentByKey(primaryKey string) (map[string]string, bool) {
+	idx.docMutex.Lock()
+	docId, ok := idx.findPrimaryKey(primaryKey)
+	idx.docMutex.Unlock()
+
+	if !ok || idx.bitmap.GetBit(docId) == 1 || idx.isExpired(docId, time.Now().Unix()) {
+		return nil, false
+	}
+	return idx.GetDocument(docId)
+}
+
+// Version
+// @Description 获取文档的当前版本
+// @Param content 文档内容，需要包含主键字段
+// @Return uint64 版本号，每次新增、更新、删除都会加一
+// @Return bool 索引没有主键或者文档从未写入时返回 false
+func (idx *Index) Version(content map[string]string) (uint64, bool) {
+	key, err := idx.PrimaryKeyOf(content)
+	if err != nil {
+		return 0, false
+	}
+
+	idx.versionMutex.RLock()
+	defer idx.versionMutex.RUnlock()
+
+	version := idx.currentVersion(key)
+	return version, version > 0
+}
+
+// PrimaryKeyOf
+// @Description 计算文档的主键，联合主键按字段声明的顺序用 PK_SEPARATOR 连接
+// @Param content 文档内容
+// @Return string 主键
+// @Return error 缺少主键字段时返回错误
+func (idx *Index) PrimaryKeyOf(content map[string]string) (string, error) {
+	if len(idx.PrimaryKeyFields) == 0 {
+		return "", errors.New("no Primary Key")
+	}
+
+	values := make([]string, len(idx.PrimaryKeyFields))
+	for i, field := range idx.PrimaryKeyFields {
+		value, ok := content[field]
+		if !ok || value == "" {
+			return "", fmt.Errorf("primary key field %v is missing", field)
+		}
+		values[i] = value
+	}
+	return strings.Join(values, PK_SEPARATOR), nil
+}
+
+// ForEachDocument
+// @Description 按 docId 顺序遍历开始遍历时所有未删除的文档，持锁取得段列表、删除标记和内存段文档的快照后，
+// 遍历时不持有锁，fn 中的耗时操作不会阻塞写入、持久化和合并，fn 返回错误时停止遍历
+// @Param fn 处理文档的函数
+// @Return error fn 返回的错误
+func (idx *Index) ForEachDocument(fn func(docId uint64, doc map[string]string) error) error {
+	idx.docMutex.Lock()
+	idx.segmentMutex.Lock()
+	segments := idx.acquireSegments()
+	var deleted *utils.Bitmap
+	if idx.bitmap != nil {
+		deleted = idx.bitmap.Copy(idx.MaxDocId)
+	}
+	memoryDocs := idx.memoryDocuments()
+	idx.segmentMutex.Unlock()
+	idx.docMutex.Unlock()
+	defer releaseSegments(segments)
+
+	now := time.Now().Unix()
+	isDeleted := func(docId uint64) bool {
+		return deleted != nil && deleted.GetBit(docId) == 1
+	}
+	for _, seg := range segments {
+		for docId := seg.StartDocId; docId < seg.MaxDocId; docId++ {
+			if isDeleted(docId) || idx.isExpiredIn(segments, docId, now) {
+				continue
+			}
+			doc, ok := seg.GetDocument(docId)
+			if !ok {
+				continue
+			}
+			if err := fn(docId, idx.stripSubFields(doc)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, memoryDoc := range memoryDocs {
+		if isDeleted(memoryDoc.docId) || isExpiredValue(memoryDoc.doc[EXPIRE_FIELD], now) {
+			continue
+		}
+		if err := fn(memoryDoc.docId, idx.stripSubFields(memoryDoc.doc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memoryDocument 内存段中文档的副本
+type memoryDocument struct {
+	docId uint64
+	doc   map[string]string
+}
+
+// memoryDocuments 复制内存段中的文档，内存段的文档数受持久化阈值限制，调用前需持有 docMutex
+func (idx *Index) memoryDocuments() []memoryDocument {
+	if idx.memorySegment == nil {
+		return nil
+	}
+	docs := make([]memoryDocument, 0, idx.memorySegment.MaxDocId-idx.memorySegment.StartDocId)
+	for docId := idx.memorySegment.StartDocId; docId < idx.memorySegment.MaxDocId; docId++ {
+		if doc, ok := idx.memorySegment.GetDocument(docId); ok {
+			docs = append(docs, memoryDocument{docId: docId, doc: doc})
+		}
+	}
+	return docs
 }
 
 // SyncMemorySegment
-// @Description 内存段序列化
+// @Description 内存段序列化，持有文档写入锁，持久化期间不会有文档写入内存段
 // @Return 任何error
 func (idx *Index) SyncMemorySegment() error {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+
+	return idx.syncMemorySegment()
+}
+
+// syncMemorySegment 内存段序列化，调用前需持有 docMutex
+func (idx *Index) syncMemorySegment() error {
 	if idx.memorySegment == nil {
 		return nil
 	}
@@ -425,12 +770,12 @@ func (idx *Index) SyncMemorySegment() error {
 
 	idx.memorySegment.Close()
 	idx.memorySegment = nil
+	idx.refreshedAt = time.Now()
 
-	newSegment := segment.NewSegmentFromLocalFile(segmentName, idx.Logger)
+	newSegment := segment.NewSegmentFromLocalFile(segmentName, idx.dir, idx.Logger)
 
-	idx.segments = append(idx.segments, newSegment)
 	// 添加segmentNames
-	idx.SegmentNames = append(idx.SegmentNames, segmentName)
+	idx.setSegments(append(idx.segments, newSegment), append(idx.SegmentNames, segmentName))
 
 	return idx.storeIndex()
 
@@ -439,11 +784,14 @@ func (idx *Index) SyncMemorySegment() error {
 // CheckMerge
 // @Description 判断是否需要合并段
 func (idx *Index) CheckMerge() bool {
+	policy := idx.EffectiveSettings().Merge
+	segments := idx.acquireSegments()
+	defer releaseSegments(segments)
 	num := 0
-	for _, seg := range idx.segments {
-		if seg.MaxDocId-seg.StartDocId < 1000000 {
+	for _, seg := range segments {
+		if seg.MaxDocId-seg.StartDocId < policy.MaxMergeDocs {
 			num++
-			if num >= 10 {
+			if num >= policy.SegmentsPerMerge {
 				return true
 			}
 		}
@@ -453,101 +801,23 @@ func (idx *Index) CheckMerge() bool {
 }
 
 // MergeSegments
-// @Description 合并段
+// @Description 按合并策略合并段，与强制合并使用同一套加锁的选择、合并和提交流程
 // @Return 任何error
 func (idx *Index) MergeSegments() error {
 
-	idx.segmentMutex.Lock()
-	defer idx.segmentMutex.Unlock()
-
-	segSize := len(idx.segments)
-
-	if segSize == 1 {
-		return nil
-	}
-
-	fields := make(map[string]uint64)
-	for fieldName, fieldType := range idx.Fields {
-		if fieldType != utils.IDX_TYPE_PK {
-			fields[fieldName] = fieldType
-		}
-	}
-
-	start := 0
-	for start != segSize && idx.segments[start].MaxDocId-idx.segments[start].StartDocId > 1000000 {
-		start++
-	}
-	origin := start
-	end := start + 10
-
-	fn := float64(segSize-start) / 10
-	n := int(math.Ceil(fn))
-
-	delFileName := fmt.Sprintf("%v%v.del", idx.PathName, idx.Name)
-
-	delMmap, err := utils.NewMmap(delFileName, utils.MODE_APPEND)
-	if err != nil {
+	// 先把过期的文档标记为删除，合并时一起清理
+	if _, err := idx.ExpireDocuments(); err != nil {
 		return err
 	}
-	delDocSet := delMmap.ReadIdsSet(0, idx.DelDocNum)
-
-	tmpSegList := make([]*segment.Segment, 0)
-	tmpSegNameList := make([]string, 0)
-
-	for i := 0; i < n; i++ {
-
-		if i == n-1 {
-			end = segSize
-		}
-
-		needMergeSegments := idx.segments[start:end]
-
-		segmentName := fmt.Sprintf("%v%v_%v/", idx.PathName, idx.Name, idx.NextSegmentSuffix)
-		err := os.MkdirAll(segmentName, 0755)
-
-		if err != nil {
-			idx.Logger.Error("Mkdir error : %v", err)
-		}
-
-		tmpSegment := segment.NewEmptySegmentByFieldsInfo(segmentName, needMergeSegments[0].StartDocId, fields, idx.Logger)
-		idx.NextSegmentSuffix++
-
-		err = tmpSegment.MergeSegments(needMergeSegments, delDocSet)
-		if err != nil {
-			return err
-		}
-		tmpSegment.Close()
-
-		tmpSegment = nil
-
-		for _, seg := range needMergeSegments {
-			seg.Destroy()
-		}
-		tmpSegment = segment.NewSegmentFromLocalFile(segmentName, idx.Logger)
-
-		tmpSegList = append(tmpSegList, tmpSegment)
-		tmpSegNameList = append(tmpSegNameList, segmentName)
-
-		start += 10
-		end += 10
-	}
 
-	if origin > 0 {
-		idx.segments = idx.segments[:origin]
-		idx.SegmentNames = idx.SegmentNames[:origin]
-	} else {
-		idx.segments = make([]*segment.Segment, 0)
-		idx.SegmentNames = make([]string, 0)
-	}
+	idx.mergeMutex.Lock()
+	defer idx.mergeMutex.Unlock()
 
-	idx.segments = append(idx.segments, tmpSegList...)
-	idx.SegmentNames = append(idx.SegmentNames, tmpSegNameList...)
-
-	delMmap.Unmap()
-	os.Truncate(delFileName, 0)
-	idx.DelDocNum = 0
-
-	return idx.storeIndex()
+	policy := idx.EffectiveSettings().Merge
+	_, err := idx.mergeSegmentGroups(func(map[uint64]struct{}) [][]int {
+		return idx.policyGroups(policy)
+	})
+	return err
 }
 
 // Close
@@ -566,6 +836,14 @@ func (idx *Index) Close() error {
 		}
 	}
 
+	// 持久化的段也要关闭，否则 seg.bt 的文件锁不会释放，同一个目录无法再次加载
+	for _, seg := range idx.segments {
+		err := seg.Close()
+		if err != nil {
+			return err
+		}
+	}
+
 	if idx.primary != nil {
 		err := idx.primary.Close()
 		if err != nil {
@@ -596,10 +874,25 @@ func (idx *Index) SearchKeyDocIds(query utils.SearchQuery) ([]utils.DocIdNode, b
 	// 最终返回的结果
 	docIds := make([]utils.DocIdNode, 0)
 
-	for _, seg := range idx.segments {
+	// 搜索期间被合并替换的段在搜索结束后才删除
+	segments := idx.acquireSegments()
+	defer releaseSegments(segments)
+	for _, seg := range segments {
 		docIds, _ = seg.SearchDocIds(query, idx.bitmap, docIds)
 	}
 
+	// 过期但还没有被清理的文档不返回
+	if _, ok := idx.FieldTypes()[EXPIRE_FIELD]; ok && len(docIds) > 0 {
+		now := time.Now().Unix()
+		alive := make([]utils.DocIdNode, 0, len(docIds))
+		for _, node := range docIds {
+			if !idx.isExpiredIn(segments, node.Docid, now) {
+				alive = append(alive, node)
+			}
+		}
+		docIds = alive
+	}
+
 	if len(docIds) > 0 {
 		return docIds, true
 	}
@@ -615,9 +908,23 @@ func (idx *Index) SearchFilterDocIds(filter utils.SearchFilters) ([]uint64, bool
 
 	// 最终返回的结果
 	docIds := make([]uint64, 0)
-	for _, seg := range idx.segments {
+	segments := idx.acquireSegments()
+	defer releaseSegments(segments)
+	for _, seg := range segments {
 		docIds, _ = seg.SearchDocFilter(filter, idx.bitmap, docIds)
 	}
+
+	// 过期但还没有被清理的文档不返回
+	if _, ok := idx.FieldTypes()[EXPIRE_FIELD]; ok && len(docIds) > 0 {
+		now := time.Now().Unix()
+		alive := make([]uint64, 0, len(docIds))
+		for _, docId := range docIds {
+			if !idx.isExpiredIn(segments, docId, now) {
+				alive = append(alive, docId)
+			}
+		}
+		docIds = alive
+	}
 	if len(docIds) > 0 {
 		sort.Slice(docIds, func(i, j int) bool {
 			return docIds[i] < docIds[j]
@@ -627,51 +934,613 @@ func (idx *Index) SearchFilterDocIds(filter utils.SearchFilters) ([]uint64, bool
 	return docIds, false
 }
 
+// SortDocIds
+// @Description 按字段的值对文档排序，排序是稳定的，值相同的文档保持原来的顺序，空值按 MissingFirst 排在最前或最后
+// @Param docIds 需要排序的文档
+// @Param specs 排序条件，前面的优先
+// @Return error 字段不存在时返回错误
+func (idx *Index) SortDocIds(docIds []uint64, specs []SortSpec) error {
+	for _, spec := range specs {
+		if _, ok := idx.FieldTypes()[spec.Field]; !ok {
+			return fmt.Errorf("sort field %v not found", spec.Field)
+		}
+	}
+
+	type sortKey struct {
+		docId   uint64
+		numbers []int64
+		strs    []string
+		nulls   []bool
+	}
+
+	segments := idx.acquireSegments()
+	defer releaseSegments(segments)
+	keys := make([]sortKey, len(docIds))
+	for i, docId := range docIds {
+		key := sortKey{docId: docId, numbers: make([]int64, len(specs)), strs: make([]string, len(specs)), nulls: make([]bool, len(specs))}
+		seg := idx.segmentIn(segments, docId)
+		for j, spec := range specs {
+			if seg == nil {
+				key.nulls[j] = true
+				continue
+			}
+			if key.nulls[j] = !seg.HasValue(docId, spec.Field); key.nulls[j] {
+				continue
+			}
+			if idx.isNumericField(spec.Field) {
+				key.numbers[j], _ = seg.NumericValue(docId, spec.Field)
+			} else {
+				key.strs[j], _ = seg.KeywordValue(docId, spec.Field)
+			}
+		}
+		keys[i] = key
+	}
+
+	sort.SliceStable(keys, func(a, b int) bool {
+		for j, spec := range specs {
+			ka, kb := keys[a], keys[b]
+			if ka.nulls[j] || kb.nulls[j] {
+				if ka.nulls[j] == kb.nulls[j] {
+					continue
+				}
+				return kb.nulls[j] != spec.MissingFirst
+			}
+
+			var cmp int
+			if idx.isNumericField(spec.Field) {
+				if ka.numbers[j] < kb.numbers[j] {
+					cmp = -1
+				} else if ka.numbers[j] > kb.numbers[j] {
+					cmp = 1
+				}
+			} else {
+				cmp = strings.Compare(ka.strs[j], kb.strs[j])
+			}
+			if cmp == 0 {
+				continue
+			}
+			if spec.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	for i, key := range keys {
+		docIds[i] = key.docId
+	}
+	return nil
+}
+
+// Facet
+// @Description 统计文档中某个字段各个值出现的次数
+// @Param docIds 参与统计的文档
+// @Param fieldName 字段名
+// @Param size 返回的个数，按次数从多到少
+// @Return []utils.FacetItem 统计结果
+// @Return error 字段不存在时返回错误
+func (idx *Index) Facet(docIds []uint64, fieldName string, size int) ([]utils.FacetItem, error) {
+	if _, ok := idx.FieldTypes()[fieldName]; !ok {
+		return nil, fmt.Errorf("facet field %v not found", fieldName)
+	}
+
+	// 按段分组，每个段内按序号统计
+	segments := idx.acquireSegments()
+	defer releaseSegments(segments)
+	segDocIds := make(map[*segment.Segment][]uint64)
+	for _, docId := range docIds {
+		if seg := idx.segmentIn(segments, docId); seg != nil {
+			segDocIds[seg] = append(segDocIds[seg], docId)
+		}
+	}
+	counts := make(map[string]int)
+	for seg, ids := range segDocIds {
+		seg.FacetCounts(fieldName, ids, counts)
+	}
+
+	items := make([]utils.FacetItem, 0, len(counts))
+	for value, count := range counts {
+		items = append(items, utils.FacetItem{Value: value, Count: count})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Value < items[j].Value
+	})
+	if size > 0 && len(items) > size {
+		items = items[:size]
+	}
+	return items, nil
+}
+
+// Terms
+// @Description 按字典序列出字段中的词及包含该词的文档数，只支持有倒排索引的字段
+// @Param fieldName 字段名
+// @Param opts 前缀、范围、分页等条件
+// @Return []segment.TermFreq 词及文档数
+// @Return bool 是否还有更多的词
+// @Return error 任何错误
+func (idx *Index) Terms(fieldName string, opts segment.TermsOptions) ([]segment.TermFreq, bool, error) {
+	fieldType, ok := idx.FieldTypes()[fieldName]
+	if !ok {
+		return nil, false, fmt.Errorf("terms field %v not found", fieldName)
+	}
+	if fieldType != utils.IDX_TYPE_STRING && fieldType != utils.IDX_TYPE_STRING_SEG && fieldType != utils.IDX_TYPE_PK {
+		return nil, false, fmt.Errorf("field %v has no terms", fieldName)
+	}
+
+	// 内存段在写入时会修改，需要持有文档写入锁
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	segs := idx.segments
+	if idx.memorySegment != nil {
+		segs = append(segs[:len(segs):len(segs)], idx.memorySegment)
+	}
+	return segment.Terms(segs, fieldName, opts, idx.bitmap)
+}
+
+// Collapse
+// @Description 按字段折叠文档，每个值只保留第一个文档，没有值的文档全部保留
+// @Param docIds 需要折叠的文档，保持其中的顺序
+// @Param fieldName 字段名
+// @Return []uint64 折叠后的文档
+// @Return error 字段不存在时返回错误
+func (idx *Index) Collapse(docIds []uint64, fieldName string) ([]uint64, error) {
+	if _, ok := idx.FieldTypes()[fieldName]; !ok {
+		return nil, fmt.Errorf("collapse field %v not found", fieldName)
+	}
+
+	numeric := idx.isNumericField(fieldName)
+	seenNumbers := make(map[int64]struct{})
+	seenStrs := make(map[string]struct{})
+	res := make([]uint64, 0, len(docIds))
+	segments := idx.acquireSegments()
+	defer releaseSegments(segments)
+	for _, docId := range docIds {
+		seg := idx.segmentIn(segments, docId)
+		if seg == nil {
+			continue
+		}
+		if !seg.HasValue(docId, fieldName) {
+			res = append(res, docId)
+			continue
+		}
+		if numeric {
+			value, _ := seg.NumericValue(docId, fieldName)
+			if _, seen := seenNumbers[value]; seen {
+				continue
+			}
+			seenNumbers[value] = struct{}{}
+		} else {
+			value, _ := seg.KeywordValue(docId, fieldName)
+			if _, seen := seenStrs[value]; seen {
+				continue
+			}
+			seenStrs[value] = struct{}{}
+		}
+		res = append(res, docId)
+	}
+	return res, nil
+}
+
+// SetTTL
+// @Description 设置索引中文档的存活时间，只对之后写入的文档生效
+// @Param ttl 存活时间，单位秒
+// @Param ttlField 日期字段，不为空时过期时间为该字段的值加上 ttl，否则为写入时间加上 ttl
+// @Return error 任何错误
+func (idx *Index) SetTTL(ttl int64, ttlField string) error {
+	if ttl < 0 {
+		return fmt.Errorf("invalid ttl %v", ttl)
+	}
+	if ttlField != "" {
+		if fieldType, ok := idx.FieldTypes()[ttlField]; !ok || (fieldType != utils.IDX_TYPE_DATE && fieldType != utils.IDX_TYPE_DATETIME) {
+			return fmt.Errorf("ttl field %v must be a date field", ttlField)
+		}
+	}
+
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+
+	idx.TTL = ttl
+	idx.TTLField = ttlField
+	if ttl > 0 || ttlField != "" {
+		if err := idx.ensureExpireField(); err != nil {
+			return err
+		}
+	}
+	return idx.storeIndex()
+}
+
+// ExpireDocuments
+// @Description 把已经过期的文档标记为删除，由后台定时调用
+// @Return int 本次标记的文档数
+// @Return error 任何错误
+func (idx *Index) ExpireDocuments() (int, error) {
+	if _, ok := idx.FieldTypes()[EXPIRE_FIELD]; !ok {
+		return 0, nil
+	}
+
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+
+	now := time.Now().Unix()
+	expired := make([]uint64, 0)
+
+	// 已经持久化的段通过过期时间的正排索引查找，空值为 -1 不会被查到
+	idx.segmentMutex.Lock()
+	filter := utils.SearchFilters{FieldName: EXPIRE_FIELD, Type: utils.FILT_RANGE, Start: 0, End: now}
+	for _, seg := range idx.segments {
+		expired, _ = seg.SearchDocFilter(filter, idx.bitmap, expired)
+	}
+	// 内存段没有正排索引，逐个判断
+	if idx.memorySegment != nil {
+		for docId := idx.memorySegment.StartDocId; docId < idx.memorySegment.MaxDocId; docId++ {
+			if idx.bitmap.GetBit(docId) == 0 && idx.isExpired(docId, now) {
+				expired = append(expired, docId)
+			}
+		}
+	}
+	idx.segmentMutex.Unlock()
+
+	count := 0
+	for _, docId := range expired {
+		if idx.bitmap.GetBit(docId) == 1 {
+			continue
+		}
+		if idx.bitmap.SetBit(docId, 1) {
+			idx.deleteDocumentByDocId(docId)
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+	idx.Logger.Info("[INFO] Index %v Expire %v Documents", idx.Name, count)
+	return count, idx.storeIndex()
+}
+
 // 内部方法
 func (idx *Index) storeIndex() error {
 	metaFileName := fmt.Sprintf("%v%v.meta", idx.PathName, idx.Name)
 
-	if err := utils.WriteToJson(idx, metaFileName); err != nil {
+	idx.fieldsMutex.RLock()
+	idx.settingsMutex.RLock()
+	err := utils.WriteToJsonIn(idx.dir, idx, metaFileName)
+	idx.settingsMutex.RUnlock()
+	idx.fieldsMutex.RUnlock()
+	if err != nil {
 		return err
 	}
+	idx.versionMutex.Lock()
+	defer idx.versionMutex.Unlock()
 	if idx.PrimaryKey != "" {
-		idx.primary.SetBatch(idx.PrimaryKey, idx.pkMap)
+		idx.primary.SetBatchString(PRIMARY_BTREE, idx.pkMap)
+		idx.primary.SetBatchString(VERSION_BTREE, idx.versionMap)
 	}
 
 	idx.pkMap = nil
-	idx.pkMap = make(map[int64]string)
+	idx.pkMap = make(map[string]string)
+	idx.versionMap = make(map[string]string)
 
 	return nil
 }
 
-func (idx *Index) findPrimaryKey(primaryKey int64) (uint64, bool) {
+// setSegments 替换段列表，调用前需持有 segmentMutex，被移出的段由调用方调用 Retire
+func (idx *Index) setSegments(segments []*segment.Segment, segmentNames []string) {
+	idx.snapshotMutex.Lock()
+	defer idx.snapshotMutex.Unlock()
+	idx.segments = segments
+	idx.SegmentNames = segmentNames
+}
+
+// acquireSegments 取持久化段列表的快照并增加各段的引用计数，使用完后调用 releaseSegments
+func (idx *Index) acquireSegments() []*segment.Segment {
+	idx.snapshotMutex.RLock()
+	defer idx.snapshotMutex.RUnlock()
+	segments := make([]*segment.Segment, len(idx.segments))
+	copy(segments, idx.segments)
+	for _, seg := range segments {
+		seg.Acquire()
+	}
+	return segments
+}
+
+// releaseSegments 释放段列表快照的引用
+func releaseSegments(segments []*segment.Segment) {
+	for _, seg := range segments {
+		seg.Release()
+	}
+}
+
+// FieldTypes
+// @Description 获取字段信息的快照，字段变化时整体替换，读取时不需要持有写锁
+// @Return map[string]uint64 字段名到字段类型，不能修改
+func (idx *Index) FieldTypes() map[string]uint64 {
+	idx.fieldsMutex.RLock()
+	defer idx.fieldsMutex.RUnlock()
+	return idx.Fields
+}
+
+// setFieldType 复制字段信息后新增或修改字段，读取中的快照不受影响
+func (idx *Index) setFieldType(fieldName string, fieldType uint64) {
+	idx.fieldsMutex.Lock()
+	defer idx.fieldsMutex.Unlock()
+
+	fields := make(map[string]uint64, len(idx.Fields)+1)
+	for name, t := range idx.Fields {
+		fields[name] = t
+	}
+	fields[fieldName] = fieldType
+	idx.Fields = fields
+}
+
+// deleteFieldType 复制字段信息后删除字段
+func (idx *Index) deleteFieldType(fieldName string) {
+	idx.fieldsMutex.Lock()
+	defer idx.fieldsMutex.Unlock()
+
+	fields := make(map[string]uint64, len(idx.Fields))
+	for name, t := range idx.Fields {
+		if name != fieldName {
+			fields[name] = t
+		}
+	}
+	idx.Fields = fields
+}
+
+// segmentFields 段内字段信息，主键在段内按全词匹配的字符串存储
+func (idx *Index) segmentFields() map[string]uint64 {
+	fields := make(map[string]uint64)
+	for fieldName, fieldType := range idx.FieldTypes() {
+		if fieldType == utils.IDX_TYPE_PK {
+			fieldType = utils.IDX_TYPE_STRING
+		}
+		fields[fieldName] = fieldType
+	}
+	return fields
+}
+
+// applyTTL 计算文档的过期时间，返回去掉 _ttl 并带上 _expire 的文档
+func (idx *Index) applyTTL(content map[string]string) (map[string]string, error) {
+	ttlValue, hasTTL := content[TTL_FIELD]
+	if !hasTTL && idx.TTL == 0 && idx.TTLField == "" {
+		return content, nil
+	}
+
+	doc := make(map[string]string, len(content)+1)
+	for field, value := range content {
+		if field != TTL_FIELD {
+			doc[field] = value
+		}
+	}
+
+	var expire int64
+	switch {
+	case hasTTL:
+		ttl, err := utils.ParseTTL(ttlValue)
+		if err != nil {
+			return nil, err
+		}
+		expire = time.Now().Unix() + ttl
+	case idx.TTLField != "":
+		// 没有日期的文档不过期
+		base, err := idx.ttlBase(content[idx.TTLField])
+		if err != nil {
+			return doc, nil
+		}
+		expire = base + idx.TTL
+	default:
+		expire = time.Now().Unix() + idx.TTL
+	}
+
+	if err := idx.ensureExpireField(); err != nil {
+		return nil, err
+	}
+	doc[EXPIRE_FIELD] = strconv.FormatInt(expire, 10)
+	return doc, nil
+}
+
+// ttlBase 计算过期时间的日期字段的值，单位秒
+func (idx *Index) ttlBase(value string) (int64, error) {
+	if idx.FieldTypes()[idx.TTLField] == utils.IDX_TYPE_DATETIME {
+		ms, err := idx.DateParser(idx.TTLField).Parse(value)
+		return utils.FloorDiv(ms, 1000), err
+	}
+	return utils.IsDateTime(value)
+}
+
+func (idx *Index) ensureExpireField() error {
+	if _, ok := idx.FieldTypes()[EXPIRE_FIELD]; ok {
+		return nil
+	}
+	return idx.AddField(segment.SimpleFieldInfo{FieldName: EXPIRE_FIELD, FieldType: utils.IDX_TYPE_NUMBER})
+}
+
+// openPrimary 打开主键的 boltdb，boltdb 需要本地文件，通过目录取得本地路径
+func (idx *Index) openPrimary() *tree.BTreeDB {
+	primaryName := fmt.Sprintf("%v%v_primary.pk", idx.PathName, idx.Name)
+	path, err := idx.dir.LocalPath(primaryName)
+	if err != nil {
+		idx.Logger.Error("[ERROR] Open PrimaryKey Error : %v", err)
+		return nil
+	}
+	return tree.NewBTDB(path, idx.Logger)
+}
+
+// newSegment 按索引的压缩方式和分词器新建内存段
+func (idx *Index) newSegment(segmentName string, start uint64, fields map[string]uint64) *segment.Segment {
+	seg := segment.NewEmptySegmentByFieldsInfo(segmentName, start, fields, idx.dir, idx.Logger)
+	if err := seg.SetCodec(idx.Settings.Codec); err != nil {
+		idx.Logger.Error("[ERROR] Set Codec Error : %v", err)
+	}
+	if err := seg.SetAnalyzer(idx.Settings.Analyzer); err != nil {
+		idx.Logger.Error("[ERROR] Set Analyzer Error : %v", err)
+	}
+	if err := seg.SetSubFields(idx.segmentSubFields()); err != nil {
+		idx.Logger.Error("[ERROR] Set Sub Fields Error : %v", err)
+	}
+	return seg
+}
+
+// segmentOf 文档所在的段，调用前需持有 segmentMutex 或 docMutex
+func (idx *Index) segmentOf(docId uint64) *segment.Segment {
+	return idx.segmentIn(idx.segments, docId)
+}
+
+// segmentIn 文档在段列表的快照或内存段中所在的段
+func (idx *Index) segmentIn(segments []*segment.Segment, docId uint64) *segment.Segment {
+	for _, seg := range segments {
+		if docId >= seg.StartDocId && docId < seg.MaxDocId {
+			return seg
+		}
+	}
+	if idx.memorySegment != nil && docId >= idx.memorySegment.StartDocId && docId < idx.memorySegment.MaxDocId {
+		return idx.memorySegment
+	}
+	return nil
+}
+
+// isNumericField 数字类字段和布尔型字段按原始值比较，其余字段按字符串比较，IP 地址按 16 字节的形式比较
+func (idx *Index) isNumericField(fieldName string) bool {
+	fieldType := idx.FieldTypes()[fieldName]
+	return fieldType == utils.IDX_TYPE_NUMBER || fieldType == utils.IDX_TYPE_DATE || fieldType == utils.IDX_TYPE_FLOAT || fieldType == utils.IDX_TYPE_DOUBLE || fieldType == utils.IDX_TYPE_DATETIME ||
+		fieldType == utils.IDX_TYPE_BOOL
+}
+
+// isExpired 判断文档在 now 时是否已经过期
+func (idx *Index) isExpired(docId uint64, now int64) bool {
+	if _, ok := idx.FieldTypes()[EXPIRE_FIELD]; !ok {
+		return false
+	}
+
+	segments := idx.acquireSegments()
+	defer releaseSegments(segments)
+	return idx.isExpiredIn(segments, docId, now)
+}
+
+// isExpiredIn 在段列表的快照中判断文档在 now 时是否已经过期
+func (idx *Index) isExpiredIn(segments []*segment.Segment, docId uint64, now int64) bool {
+	if _, ok := idx.FieldTypes()[EXPIRE_FIELD]; !ok {
+		return false
+	}
+
+	seg := idx.segmentIn(segments, docId)
+	if seg == nil {
+		return false
+	}
+
+	value, ok := seg.GetValue(docId, EXPIRE_FIELD)
+	if !ok {
+		return false
+	}
+	return isExpiredValue(value, now)
+}
+
+// isExpiredValue 判断 _expire 字段的值是否已经过期，没有过期时间时不过期
+func isExpiredValue(value string, now int64) bool {
+	expire, err := strconv.ParseInt(value, 10, 64)
+	return err == nil && expire > 0 && expire <= now
+}
+
+func (idx *Index) findPrimaryKey(primaryKey string) (uint64, bool) {
 	// 判断是否存在主键
 	if idx.PrimaryKey == "" {
 		idx.Logger.Error("[ERROR] primaryKey is not exist")
 		return 0, false
 	}
 
-	ok, docId := idx.primary.Search(idx.PrimaryKey, primaryKey)
+	// 还没有刷到主键树中的主键
+	if value, ok := idx.pkMap[primaryKey]; ok {
+		docId, err := strconv.ParseUint(value, 10, 64)
+		return docId, err == nil
+	}
+
+	ok, docId := idx.primary.SearchString(PRIMARY_BTREE, primaryKey)
 	if !ok {
 		return 0, false
 	}
 	return docId, true
 }
 
-func (idx *Index) updatePrimaryKey(key int64, docId uint64) error {
-	// 判断是否存在主键
+// bumpVersion 主键的版本加一，调用前需持有 docMutex
+func (idx *Index) bumpVersion(primaryKey string) {
+	idx.versionMutex.Lock()
+	defer idx.versionMutex.Unlock()
+	idx.versionMap[primaryKey] = fmt.Sprintf("%v", idx.currentVersion(primaryKey)+1)
+}
+
+// currentVersion 主键当前的版本，从未写入过时为 0，调用前需持有 docMutex 或 versionMutex
+func (idx *Index) currentVersion(primaryKey string) uint64 {
+	if value, ok := idx.versionMap[primaryKey]; ok {
+		version, _ := strconv.ParseUint(value, 10, 64)
+		return version
+	}
+
+	ok, version := idx.primary.SearchString(VERSION_BTREE, primaryKey)
+	if !ok {
+		return 0
+	}
+	return version
+}
+
+func (idx *Index) checkVersion(primaryKey string, ifVersion uint64) error {
+	if ifVersion == 0 {
+		return nil
+	}
 	if idx.PrimaryKey == "" {
-		idx.Logger.Error("[ERROR] primaryKey is not exist")
-		return errors.New("[ERROR] primaryKey is not exist")
+		return errors.New("no Primary Key")
 	}
 
-	err := idx.primary.Set(idx.PrimaryKey, key, docId)
+	if version := idx.currentVersion(primaryKey); version != ifVersion {
+		return fmt.Errorf("%w : current version is %v, not %v", ErrVersionConflict, version, ifVersion)
+	}
+	return nil
+}
 
+func (idx *Index) checkContentVersion(content map[string]string, ifVersion uint64) error {
+	if ifVersion == 0 {
+		return nil
+	}
+	key, err := idx.PrimaryKeyOf(content)
 	if err != nil {
-		idx.Logger.Error("[ERROR] update Put key error : %v", err)
 		return err
 	}
-	return nil
+	return idx.checkVersion(key, ifVersion)
+}
+
+// migratePrimaryKey
+// @Description 旧版本的主键树以 int64 为 key、以主键字段名为树名，加载时转换为字符串主键
+func (idx *Index) migratePrimaryKey() error {
+	if err := idx.primary.AddBTree(PRIMARY_BTREE); err != nil {
+		return err
+	}
+
+	kv := make(map[string]string)
+	err := idx.primary.ForEach(idx.PrimaryKey, func(key []byte, value string) error {
+		if len(key) != 8 {
+			return fmt.Errorf("invalid legacy primary key %v", key)
+		}
+		kv[strconv.FormatInt(int64(binary.BigEndian.Uint64(key)), 10)] = value
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := idx.primary.SetBatchString(PRIMARY_BTREE, kv); err != nil {
+		return err
+	}
+	idx.primary.DeleteBTree(idx.PrimaryKey)
+
+	idx.PrimaryKeyFields = []string{idx.PrimaryKey}
+	idx.Logger.Info("[INFO] Migrate PrimaryKey of Index %v : %v keys", idx.Name, len(kv))
+
+	return idx.storeIndex()
 }
 
 func (idx *Index) deleteDocumentByDocId(docId uint64) {
@@ -680,12 +1549,12 @@ func (idx *Index) deleteDocumentByDocId(docId uint64) {
 
 	binary.LittleEndian.PutUint64(buf, docId)
 	delFileName := fmt.Sprintf("%v%v.del", idx.PathName, idx.Name)
-	delFile, err := os.OpenFile(delFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
-	defer delFile.Close()
-
+	delFile, err := idx.dir.OpenFile(delFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 	if err != nil {
 		idx.Logger.Error("[ERROR] Open DelFile Error : %v", err)
+		return
 	}
+	defer delFile.Close()
 
 	_, err = delFile.Write(buf)
 
@@ -0,0 +1,134 @@
+/**
+ * @Note 多字段，同一个字段的值按不同类型索引到多个子字段中，文档中只保存一份
+ **/
+
+package gdindex
+
+import (
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"fmt"
+	"strings"
+)
+
+// SUB_FIELD_SEPARATOR 子字段名由父字段名、分隔符和子字段名组成，如 title.keyword
+const SUB_FIELD_SEPARATOR = "."
+
+// addMultiField 新增带子字段的字段，父字段已存在时只新增还没有的子字段
+func (idx *Index) addMultiField(field segment.SimpleFieldInfo) error {
+	subFields := make([]segment.SimpleFieldInfo, 0, len(field.Fields))
+	for _, sub := range field.Fields {
+		if sub.FieldName == "" || strings.Contains(sub.FieldName, SUB_FIELD_SEPARATOR) || len(sub.Fields) > 0 {
+			return fmt.Errorf("invalid sub field %q of %v", sub.FieldName, field.FieldName)
+		}
+		switch sub.FieldType {
+		case utils.IDX_TYPE_STRING, utils.IDX_TYPE_STRING_SEG, utils.IDX_TYPE_NUMBER, utils.IDX_TYPE_FLOAT,
+			utils.IDX_TYPE_DOUBLE, utils.IDX_TYPE_DATE, utils.IDX_TYPE_DATETIME, utils.IDX_TYPE_BOOL, utils.IDX_TYPE_IP:
+		default:
+			return fmt.Errorf("sub field %v%v%v can't be type %v", field.FieldName, SUB_FIELD_SEPARATOR, sub.FieldName, sub.FieldType)
+		}
+		subFields = append(subFields, segment.SimpleFieldInfo{
+			FieldName: field.FieldName + SUB_FIELD_SEPARATOR + sub.FieldName,
+			FieldType: sub.FieldType,
+			Format:    sub.Format,
+			TimeZone:  sub.TimeZone,
+		})
+	}
+
+	parent := segment.SimpleFieldInfo{FieldName: field.FieldName, FieldType: field.FieldType, Format: field.Format, TimeZone: field.TimeZone}
+	if err := idx.AddField(parent); err != nil {
+		return err
+	}
+
+	for _, sub := range subFields {
+		if _, ok := idx.FieldTypes()[sub.FieldName]; ok {
+			continue
+		}
+		if err := idx.addField(sub, field.FieldName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteSubFields 删除字段时一起删除它的子字段，删除的是子字段时从父字段中移除
+func (idx *Index) deleteSubFields(fieldName string) error {
+	for _, sub := range idx.SubFields[fieldName] {
+		if err := idx.DeleteField(sub); err != nil {
+			return err
+		}
+	}
+	delete(idx.SubFields, fieldName)
+
+	for parent, subs := range idx.SubFields {
+		for i, sub := range subs {
+			if sub == fieldName {
+				idx.SubFields[parent] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(idx.SubFields[parent]) == 0 {
+			delete(idx.SubFields, parent)
+		}
+	}
+	return nil
+}
+
+// segmentSubFields 子字段名到父字段名的映射，新建的段按它把子字段设为只建索引
+func (idx *Index) segmentSubFields() map[string]string {
+	subFields := make(map[string]string)
+	for parent, subs := range idx.SubFields {
+		for _, sub := range subs {
+			subFields[sub] = parent
+		}
+	}
+	return subFields
+}
+
+// copySubFields 把父字段的值复制到子字段用于建索引，子字段不存储内容，请求中直接给出的子字段的值不生效
+func (idx *Index) copySubFields(content map[string]string) map[string]string {
+	if len(idx.SubFields) == 0 {
+		return content
+	}
+
+	doc := make(map[string]string, len(content)+len(idx.SubFields))
+	for field, value := range content {
+		doc[field] = value
+	}
+	for parent, subs := range idx.SubFields {
+		value, ok := content[parent]
+		for _, sub := range subs {
+			if ok {
+				doc[sub] = value
+			} else {
+				delete(doc, sub)
+			}
+		}
+	}
+	return doc
+}
+
+// stripSubFields 返回文档时去掉子字段，只保留父字段的值
+func (idx *Index) stripSubFields(doc map[string]string) map[string]string {
+	for _, subs := range idx.SubFields {
+		for _, sub := range subs {
+			delete(doc, sub)
+		}
+	}
+	return doc
+}
+
+// IsSubField
+// @Description 判断字段是否为子字段
+// @Param fieldName 字段名
+// @Return bool 是否为子字段
+func (idx *Index) IsSubField(fieldName string) bool {
+	for _, subs := range idx.SubFields {
+		for _, sub := range subs {
+			if sub == fieldName {
+				return true
+			}
+		}
+	}
+	return false
+}
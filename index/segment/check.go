@@ -0,0 +1,238 @@
+/**
+ * @Note 段文件的完整性检查
+ **/
+
+package segment
+
+import (
+	"GoDance/utils"
+	"fmt"
+	"strconv"
+)
+
+// 每个字段最多报告的问题数，避免损坏严重时输出过多
+const maxIssuesPerField = 10
+
+// CheckIssue 检查发现的问题
+type CheckIssue struct {
+	Segment string `json:"segment"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Check
+// @Description 检查段的元信息与各字段文件是否一致，内存段不检查
+// @Return []CheckIssue 发现的问题，为空表示没有问题
+func (seg *Segment) Check() []CheckIssue {
+	issues := make([]CheckIssue, 0)
+	if seg.isMemory {
+		return issues
+	}
+
+	// 元信息无法加载时没有字段可以检查，字段文件的尾部有问题时由下面的完整校验报告
+	if seg.loadErr != nil && len(seg.fields) == 0 {
+		return append(issues, CheckIssue{Segment: seg.SegmentName, Message: fmt.Sprintf("meta cannot be loaded : %v", seg.loadErr)})
+	}
+	if seg.MaxDocId < seg.StartDocId {
+		return append(issues, CheckIssue{Segment: seg.SegmentName,
+			Message: fmt.Sprintf("maxDocId %v is less than startDocId %v", seg.MaxDocId, seg.StartDocId)})
+	}
+
+	if seg.btdb != nil {
+		if err := seg.verifyBtree(); err != nil {
+			issues = append(issues, CheckIssue{Segment: seg.SegmentName, Message: err.Error()})
+		}
+	}
+	for name, field := range seg.fields {
+		for _, message := range field.check(seg.SegmentName, seg.Version) {
+			issues = append(issues, CheckIssue{Segment: seg.SegmentName, Field: name, Message: message})
+		}
+	}
+	return issues
+}
+
+// issueList 收集一个字段的问题，超过上限后只计数
+type issueList struct {
+	messages []string
+	dropped  int
+}
+
+func (l *issueList) add(format string, args ...interface{}) {
+	if len(l.messages) >= maxIssuesPerField {
+		l.dropped++
+		return
+	}
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *issueList) result() []string {
+	if l.dropped > 0 {
+		l.messages = append(l.messages, fmt.Sprintf("%v more issues omitted", l.dropped))
+	}
+	return l.messages
+}
+
+// check 检查字段文件的校验值，以及正排、字段内容、倒排和数字索引文件的内容
+func (f *Field) check(segmentName string, version uint32) []string {
+	issues := &issueList{}
+	docNum := f.maxDocId - f.startDocId
+
+	for _, issue := range f.verifyFiles(segmentName, version) {
+		issues.add("%v", issue)
+	}
+	if !f.indexOnly {
+		f.checkProfile(segmentName, docNum, issues)
+	}
+	if f.ivt != nil {
+		f.checkInvert(issues)
+	}
+	if f.pfi != nil {
+		f.checkProfileIndex(issues)
+	}
+	if f.dv != nil && f.dv.count != docNum {
+		issues.add("docvalues has %v docs, expected %v", f.dv.count, docNum)
+	}
+	if f.vb != nil && f.vb.count != docNum {
+		issues.add("exists has %v docs, expected %v", f.vb.count, docNum)
+	}
+	return issues.result()
+}
+
+// checkProfile 正排文件每个文档 8 字节，布尔型字段每个文档一位，字符串字段的偏移需要落在字段内容文件内
+func (f *Field) checkProfile(segmentName string, docNum uint64, issues *issueList) {
+	pflFileName := fmt.Sprintf("%v%v_profile.pfl", segmentName, f.fieldName)
+	footer, err := readFooter(f.dir, pflFileName)
+	var pflMmap *utils.Mmap
+	if err == nil {
+		pflMmap, err = f.pflFile.acquire()
+	}
+	if err != nil || pflMmap == nil {
+		issues.add("profile cannot be opened : %v", err)
+		return
+	}
+	defer f.pflFile.release()
+	// 没有尾部信息的空文件在打开时会被扩展为 utils.APPEND_DATA
+	expected := int64(docNum) * 8
+	if f.fieldType == utils.IDX_TYPE_BOOL {
+		// 布尔型字段的正排文件是位图
+		expected = vbHeaderSize + int64((docNum+63)/64)*8
+		if f.dataLength(pflMmap) >= vbHeaderSize {
+			if count := pflMmap.ReadUInt64(0); count != docNum {
+				issues.add("profile bits has %v docs, expected %v", count, docNum)
+			}
+		}
+	}
+	if footer.DataLen != expected && !(expected == 0 && footer.DataLen == utils.APPEND_DATA) {
+		issues.add("profile has %v bytes, expected %v for %v docs", footer.DataLen, expected, docNum)
+	}
+
+	if !hasDetail(f.fieldType) {
+		return
+	}
+	dtlMmap, err := f.dtlFile.acquire()
+	if err != nil || dtlMmap == nil {
+		issues.add("detail cannot be opened : %v", err)
+		return
+	}
+	defer f.dtlFile.release()
+
+	pflLen := f.dataLength(pflMmap)
+	dtlLen := f.dataLength(dtlMmap)
+	compressed := f.pfl != nil && isCompressed(f.pfl.codec)
+	for pos := uint64(0); pos < docNum && int64(pos+1)*8 <= pflLen; pos++ {
+		offset := pflMmap.ReadInt64(int64(pos) * 8)
+		if compressed {
+			if _, err := readBlockValue(dtlMmap, offset, pos); err != nil {
+				issues.add("doc %v : %v", f.startDocId+pos, err)
+			}
+			continue
+		}
+		if offset < 0 || offset+8 > dtlLen {
+			issues.add("doc %v : detail offset %v out of range %v", f.startDocId+pos, offset, dtlLen)
+			continue
+		}
+		if lens := dtlMmap.ReadInt64(offset); lens < 0 || offset+8+lens > dtlLen {
+			issues.add("doc %v : detail length %v at offset %v out of range %v", f.startDocId+pos, lens, offset, dtlLen)
+		}
+	}
+}
+
+// checkInvert fst 中的偏移需要落在倒排文件内，倒排链中的文档需要在段的范围内
+func (f *Field) checkInvert(issues *issueList) {
+	if f.ivt.fst == nil {
+		issues.add("fst cannot be opened")
+		return
+	}
+	idxMmap, err := f.idxFile.acquire()
+	if err != nil || idxMmap == nil {
+		issues.add("invert cannot be opened : %v", err)
+		return
+	}
+	defer f.idxFile.release()
+
+	idxLen := f.dataLength(idxMmap)
+	iter, err := f.ivt.fst.Iterator(nil, nil)
+	for err == nil {
+		key, value := iter.Current()
+		offset := int64(value)
+		if offset+8 > idxLen {
+			issues.add("term %q : offset %v out of range %v", key, offset, idxLen)
+		} else if lens := idxMmap.ReadInt64(offset); lens <= 0 || offset+8+lens*int64(utils.DOCNODE_SIZE) > idxLen {
+			issues.add("term %q : postings length %v at offset %v out of range %v", key, lens, offset, idxLen)
+		} else {
+			for _, node := range idxMmap.ReadDocIdsArry(uint64(offset)+8, uint64(lens)) {
+				if node.Docid < f.startDocId || node.Docid >= f.maxDocId {
+					issues.add("term %q : docId %v out of range [%v, %v)", key, node.Docid, f.startDocId, f.maxDocId)
+					break
+				}
+			}
+		}
+		err = iter.Next()
+	}
+}
+
+// checkProfileIndex b+ 树中的偏移需要落在数字索引文件内，文档需要在段的范围内
+func (f *Field) checkProfileIndex(issues *issueList) {
+	if f.btree == nil {
+		issues.add("btree cannot be opened")
+		return
+	}
+	pfiMmap, err := f.pfiFile.acquire()
+	if err != nil || pfiMmap == nil {
+		issues.add("profileindex cannot be opened : %v", err)
+		return
+	}
+	defer f.pfiFile.release()
+
+	pfiLen := f.dataLength(pfiMmap)
+	err = f.btree.ForEach(f.fieldName, func(key []byte, value string) error {
+		offset, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || offset < 0 || offset+8 > pfiLen {
+			issues.add("value offset %v out of range %v", value, pfiLen)
+			return nil
+		}
+		lens := pfiMmap.ReadInt64(offset)
+		if lens <= 0 || offset+8+lens*8 > pfiLen {
+			issues.add("value length %v at offset %v out of range %v", lens, offset, pfiLen)
+			return nil
+		}
+		for _, docId := range pfiMmap.ReadIdsArray(uint64(offset)+8, int(lens)) {
+			if docId < f.startDocId || docId >= f.maxDocId {
+				issues.add("docId %v out of range [%v, %v)", docId, f.startDocId, f.maxDocId)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		issues.add("btree cannot be read : %v", err)
+	}
+}
+
+// dataLength 文件中尾部信息之前的数据长度
+func (f *Field) dataLength(mmap *utils.Mmap) int64 {
+	if footer, err := readFooter(f.dir, mmap.FileName); err == nil && footer.DataLen <= int64(len(mmap.MmapBytes)) {
+		return footer.DataLen
+	}
+	return int64(len(mmap.MmapBytes))
+}
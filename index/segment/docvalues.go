@@ -0,0 +1,275 @@
+/**
+ * @Note 列式存储的字段值，用于排序、统计和折叠
+ **/
+
+package segment
+
+import (
+	"GoDance/utils"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// 列式存储的类型
+const (
+	DV_NUMERIC uint64 = 1 // 数字，减去最小值后按位打包
+	DV_SORTED  uint64 = 2 // 关键词，有序字典加按位打包的序号
+)
+
+// 文件头: 类型、文档数、最小值或字典大小、每个值占的位数
+const dvHeaderSize int64 = 32
+
+// docValues 列式存储文件 _docvalues.dv
+//
+//	数字: [kind][count][min][bits][packed values]
+//	关键词: [kind][count][termNum][bits][term offsets][packed ords][len+term]...
+//
+// 关键词的序号从 1 开始，与字典的字节序一致，0 表示空值
+type docValues struct {
+	fieldName string
+	kind      uint64
+	count     uint64
+	min       int64
+	termNum   uint64
+	bits      uint64
+	packedOff int64
+	dvFile    *lazyFile
+}
+
+// hasDocValues 判断字段类型是否需要列式存储
+func hasDocValues(fieldType uint64) bool {
+	return fieldType == utils.IDX_TYPE_NUMBER || fieldType == utils.IDX_TYPE_DATE ||
+		fieldType == utils.IDX_TYPE_FLOAT || fieldType == utils.IDX_TYPE_DOUBLE || fieldType == utils.IDX_TYPE_DATETIME ||
+		fieldType == utils.IDX_TYPE_STRING || fieldType == utils.IDX_TYPE_IP
+}
+
+func docValuesFileName(segmentName, fieldName string) string {
+	return fmt.Sprintf("%v%v_docvalues.dv", segmentName, fieldName)
+}
+
+//
+//  writeDocValues
+//  @Description 写入列式存储文件，数字字段传 numbers，关键词和 IP 地址字段传 terms
+//  @param dir 文件所在的目录
+//  @param fileName 文件名
+//  @param fieldType 字段类型
+//  @param numbers 每个文档的数字值，空值为 -1
+//  @param terms 每个文档的关键词
+//  @return error 任何错误
+//
+func writeDocValues(dir utils.Directory, fileName string, fieldType uint64, numbers []int64, terms []string) error {
+	buffer := new(bytes.Buffer)
+	header := make([]uint64, 4)
+
+	if fieldType == utils.IDX_TYPE_STRING || fieldType == utils.IDX_TYPE_IP {
+		// 建立有序字典
+		dict := make([]string, 0)
+		seen := make(map[string]struct{})
+		for _, term := range terms {
+			if _, ok := seen[term]; ok || term == "" {
+				continue
+			}
+			seen[term] = struct{}{}
+			dict = append(dict, term)
+		}
+		sort.Strings(dict)
+		ords := make(map[string]uint64, len(dict))
+		for i, term := range dict {
+			ords[term] = uint64(i + 1)
+		}
+
+		values := make([]uint64, len(terms))
+		for i, term := range terms {
+			values[i] = ords[term]
+		}
+		bits := bitsRequired(uint64(len(dict)))
+		packed := packValues(values, bits)
+
+		header[0], header[1], header[2], header[3] = DV_SORTED, uint64(len(terms)), uint64(len(dict)), bits
+		binary.Write(buffer, binary.LittleEndian, header)
+
+		// 字典偏移表之后是序号，最后是字典内容
+		offset := uint64(dvHeaderSize) + uint64(len(dict))*8 + uint64(len(packed))*8
+		for _, term := range dict {
+			binary.Write(buffer, binary.LittleEndian, offset)
+			offset += 8 + uint64(len(term))
+		}
+		binary.Write(buffer, binary.LittleEndian, packed)
+		lenBuffer := make([]byte, 8)
+		for _, term := range dict {
+			binary.LittleEndian.PutUint64(lenBuffer, uint64(len(term)))
+			buffer.Write(lenBuffer)
+			buffer.WriteString(term)
+		}
+	} else {
+		var min int64
+		var max int64
+		for i, value := range numbers {
+			if i == 0 || value < min {
+				min = value
+			}
+			if i == 0 || value > max {
+				max = value
+			}
+		}
+		values := make([]uint64, len(numbers))
+		for i, value := range numbers {
+			values[i] = uint64(value - min)
+		}
+		bits := bitsRequired(uint64(max - min))
+		packed := packValues(values, bits)
+
+		header[0], header[1], header[2], header[3] = DV_NUMERIC, uint64(len(numbers)), uint64(min), bits
+		binary.Write(buffer, binary.LittleEndian, header)
+		binary.Write(buffer, binary.LittleEndian, packed)
+	}
+
+	return dir.WriteFile(fileName, buffer.Bytes())
+}
+
+//
+//  newDocValuesFromLocalFile
+//  @Description 加载列式存储文件，旧版本的段没有该文件时返回 nil
+//  @param dir 文件所在的目录
+//  @param fieldName 字段名
+//  @param segmentName 段名
+//  @return *docValues 列式存储
+//  @return error 任何错误
+//
+func newDocValuesFromLocalFile(dir utils.Directory, fieldName, segmentName string) (*docValues, error) {
+	fileName := docValuesFileName(segmentName, fieldName)
+	if !dir.Exist(fileName) {
+		return nil, nil
+	}
+
+	// 只读取文件头，数据在第一次读取时才映射
+	fd, err := dir.OpenFile(fileName, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	size, err := fd.Size()
+	if err != nil {
+		return nil, err
+	}
+	if size < dvHeaderSize {
+		return nil, errors.New("docvalues file is too short")
+	}
+	header := make([]byte, dvHeaderSize)
+	if _, err := fd.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+
+	dv := &docValues{
+		fieldName: fieldName,
+		kind:      binary.LittleEndian.Uint64(header),
+		count:     binary.LittleEndian.Uint64(header[8:]),
+		bits:      binary.LittleEndian.Uint64(header[24:]),
+		packedOff: dvHeaderSize,
+		dvFile:    newLazyFile(dir, fileName),
+	}
+	if dv.kind == DV_SORTED {
+		dv.termNum = binary.LittleEndian.Uint64(header[16:])
+		dv.packedOff += int64(dv.termNum) * 8
+	} else {
+		dv.min = int64(binary.LittleEndian.Uint64(header[16:]))
+	}
+
+	packedLen := int64((dv.count*dv.bits+63)/64) * 8
+	if dv.bits > 64 || dv.packedOff+packedLen > size {
+		return nil, fmt.Errorf("docvalues file %v is corrupted", fileName)
+	}
+	return dv, nil
+}
+
+// destroy 关闭列式存储文件
+func (dv *docValues) destroy() {
+	dv.dvFile.close()
+}
+
+// numeric 获取第 pos 个文档的数字值
+func (dv *docValues) numeric(pos uint64) (int64, bool) {
+	if dv.kind != DV_NUMERIC || pos >= dv.count {
+		return -1, false
+	}
+	return dv.min + int64(dv.packed(pos)), true
+}
+
+// ord 获取第 pos 个文档的关键词序号，0 表示空值
+func (dv *docValues) ord(pos uint64) uint64 {
+	if dv.kind != DV_SORTED || pos >= dv.count {
+		return 0
+	}
+	return dv.packed(pos)
+}
+
+// term 根据序号获取关键词
+func (dv *docValues) term(ord uint64) string {
+	if ord == 0 || ord > dv.termNum {
+		return ""
+	}
+	dvMmap, err := dv.dvFile.acquire()
+	if err != nil || dvMmap == nil {
+		return ""
+	}
+	defer dv.dvFile.release()
+
+	offset := dvMmap.ReadInt64(dvHeaderSize + int64(ord-1)*8)
+	lens := dvMmap.ReadInt64(offset)
+	return dvMmap.ReadString(offset+8, lens)
+}
+
+func (dv *docValues) packed(pos uint64) uint64 {
+	if dv.bits == 0 {
+		return 0
+	}
+	bitPos := pos * dv.bits
+	wordOff := dv.packedOff + int64(bitPos/64)*8
+	shift := bitPos % 64
+
+	dvMmap, err := dv.dvFile.acquire()
+	if err != nil || dvMmap == nil {
+		return 0
+	}
+	defer dv.dvFile.release()
+
+	value := dvMmap.ReadUInt64(uint64(wordOff)) >> shift
+	if shift+dv.bits > 64 {
+		value |= dvMmap.ReadUInt64(uint64(wordOff+8)) << (64 - shift)
+	}
+	if dv.bits < 64 {
+		value &= (1 << dv.bits) - 1
+	}
+	return value
+}
+
+// bitsRequired 表示 max 需要的位数
+func bitsRequired(max uint64) uint64 {
+	bits := uint64(0)
+	for max > 0 {
+		bits++
+		max >>= 1
+	}
+	return bits
+}
+
+// packValues 把每个值按 bits 位紧密排列
+func packValues(values []uint64, bits uint64) []uint64 {
+	packed := make([]uint64, (uint64(len(values))*bits+63)/64)
+	if bits == 0 {
+		return packed
+	}
+	for i, value := range values {
+		bitPos := uint64(i) * bits
+		word, shift := bitPos/64, bitPos%64
+		packed[word] |= value << shift
+		if shift+bits > 64 {
+			packed[word+1] |= value >> (64 - shift)
+		}
+	}
+	return packed
+}
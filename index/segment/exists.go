@@ -0,0 +1,151 @@
+/**
+ * @Note 字段的有值位图，区分没有值的文档和值为 -1 等合法的值
+ **/
+
+package segment
+
+import (
+	"GoDance/utils"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 文件头: 文档数
+const vbHeaderSize int64 = 8
+
+// valueBits 有值位图文件 _exists.bm，每个文档一位，1 表示有值
+//
+//	[count][bits]...
+type valueBits struct {
+	count uint64
+	words []uint64  // 内存段中的位图
+	file  *lazyFile // 持久化段的位图文件
+}
+
+func existsFileName(segmentName, fieldName string) string {
+	return fmt.Sprintf("%v%v_exists.bm", segmentName, fieldName)
+}
+
+// isPresent 判断写入的内容是否为字段的有效值，空字符串和数字、布尔、IP 字段无法解析的值都是空值
+func isPresent(fieldType uint64, contentStr string) bool {
+	if contentStr == "" {
+		return false
+	}
+
+	var err error
+	switch fieldType {
+	case utils.IDX_TYPE_NUMBER, utils.IDX_TYPE_DATETIME:
+		_, err = strconv.ParseInt(contentStr, 10, 64)
+	case utils.IDX_TYPE_FLOAT:
+		_, err = strconv.ParseFloat(strings.TrimSpace(contentStr), 64)
+	case utils.IDX_TYPE_DOUBLE:
+		_, err = utils.ParseDouble(contentStr)
+	case utils.IDX_TYPE_DATE:
+		_, err = utils.IsDateTime(contentStr)
+	case utils.IDX_TYPE_BOOL:
+		_, err = utils.ParseBool(contentStr)
+	case utils.IDX_TYPE_IP:
+		_, err = utils.ParseIP(contentStr)
+	}
+	return err == nil
+}
+
+func newEmptyValueBits() *valueBits {
+	return &valueBits{words: make([]uint64, 0)}
+}
+
+//
+//  newValueBitsFromLocalFile
+//  @Description 加载有值位图文件，旧版本的段没有该文件时返回 nil
+//  @param dir 文件所在的目录
+//  @param fileName 文件名
+//  @return *valueBits 有值位图
+//  @return error 任何错误
+//
+func newValueBitsFromLocalFile(dir utils.Directory, fileName string) (*valueBits, error) {
+	if !dir.Exist(fileName) {
+		return nil, nil
+	}
+
+	fd, err := dir.OpenFile(fileName, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	size, err := fd.Size()
+	if err != nil {
+		return nil, err
+	}
+	if size < vbHeaderSize {
+		return nil, errors.New("exists file is too short")
+	}
+	header := make([]byte, vbHeaderSize)
+	if _, err := fd.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+
+	vb := &valueBits{count: binary.LittleEndian.Uint64(header), file: newLazyFile(dir, fileName)}
+	if vbHeaderSize+int64((vb.count+63)/64)*8 > size {
+		return nil, fmt.Errorf("exists file %v is corrupted", fileName)
+	}
+	return vb, nil
+}
+
+// add 追加一个文档
+func (vb *valueBits) add(present bool) {
+	if vb.count%64 == 0 {
+		vb.words = append(vb.words, 0)
+	}
+	if present {
+		vb.words[vb.count/64] |= 1 << (vb.count % 64)
+	}
+	vb.count++
+}
+
+// has 判断第 pos 个文档是否有值
+func (vb *valueBits) has(pos uint64) bool {
+	if pos >= vb.count {
+		return false
+	}
+	if vb.file == nil {
+		return vb.words[pos/64]&(1<<(pos%64)) != 0
+	}
+
+	vbMmap, err := vb.file.acquire()
+	if err != nil || vbMmap == nil {
+		return false
+	}
+	defer vb.file.release()
+	return vbMmap.ReadUInt64(uint64(vbHeaderSize)+pos/64*8)&(1<<(pos%64)) != 0
+}
+
+// write 写入有值位图文件
+func (vb *valueBits) write(dir utils.Directory, fileName string) error {
+	return dir.WriteFile(fileName, vb.bytes())
+}
+
+// writeTo 把位图写入已经打开的文件，用于布尔型字段的正排文件
+func (vb *valueBits) writeTo(w io.Writer) error {
+	_, err := w.Write(vb.bytes())
+	return err
+}
+
+func (vb *valueBits) bytes() []byte {
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.LittleEndian, vb.count)
+	binary.Write(buffer, binary.LittleEndian, vb.words)
+	return buffer.Bytes()
+}
+
+// destroy 关闭有值位图文件
+func (vb *valueBits) destroy() {
+	if vb.file != nil {
+		vb.file.close()
+	}
+}
@@ -11,11 +11,15 @@ import (
 	"GoDance/utils"
 	"errors"
 	"fmt"
+	"math"
 )
 
 type SimpleFieldInfo struct {
-	FieldName string `json:"fieldName"`
-	FieldType uint64 `json:"fieldType"`
+	FieldName string            `json:"fieldName"`
+	FieldType uint64            `json:"fieldType"`
+	Fields    []SimpleFieldInfo `json:"fields,omitempty"`   // 子字段，从本字段的值按子字段的类型索引，名称为 字段名.子字段名
+	Format    string            `json:"format,omitempty"`   // 日期时间字段的格式，多个格式用 || 分隔
+	TimeZone  string            `json:"timeZone,omitempty"` // 日期时间字段没有时区时使用的时区，默认 UTC
 }
 
 type Field struct {
@@ -27,12 +31,17 @@ type Field struct {
 	ivt        *invert
 	pfl        *profile
 	pfi        *profileindex
-	pfiMmap    *utils.Mmap
-	idxMmap    *utils.Mmap
-	pflMmap    *utils.Mmap
-	dtlMmap    *utils.Mmap
+	pfiFile    *lazyFile
+	idxFile    *lazyFile
+	pflFile    *lazyFile
+	dtlFile    *lazyFile
+	dv         *docValues // 列式存储，只在持久化的段中存在
+	vb         *valueBits // 有值位图，旧版本的段没有时根据存储的值判断
+	indexOnly  bool       // 子字段只建索引不存储内容，内存中的值只用于生成列式存储
+	source     *Field     // 子字段的父字段，子字段的值从父字段读取
 
 	btree *tree.BTreeDB
+	dir   utils.Directory // 字段文件所在的目录
 
 	Logger *utils.Log4FE `json:"-"`
 }
@@ -51,33 +60,33 @@ func newEmptyFakeField(fieldName string, start, cur, fieldType uint64, logger *u
 	return f
 }
 
-func newEmptyField(fieldName string, start, fieldType uint64, logger *utils.Log4FE) *Field {
+func newEmptyField(fieldName string, start, fieldType uint64, dir utils.Directory, logger *utils.Log4FE) *Field {
 	f := &Field{
 		fieldName:  fieldName,
 		startDocId: start,
 		maxDocId:   start,
 		fieldType:  fieldType,
 		isMemory:   true,
+		dir:        dir,
 		Logger:     logger,
 	}
 
 	if fieldType == utils.IDX_TYPE_STRING ||
 		fieldType == utils.IDX_TYPE_STRING_SEG {
-		f.ivt = newEmptyInvert(fieldType, start, fieldName, logger)
+		f.ivt = newEmptyInvert(fieldType, start, fieldName, dir, logger)
 	}
-	if fieldType == utils.IDX_TYPE_NUMBER ||
-		fieldType == utils.IDX_TYPE_DATE ||
-		fieldType == utils.IDX_TYPE_FLOAT {
-		f.pfi = newEmptyProfileIndex(fieldType, start, fieldName, logger)
+	if hasProfileIndex(fieldType) {
+		f.pfi = newEmptyProfileIndex(fieldType, start, fieldName, dir, logger)
 	}
 
-	f.pfl = newEmptyProfile(fieldName, fieldType, start, logger)
+	f.pfl = newEmptyProfile(fieldName, fieldType, start, dir, logger)
+	f.vb = newEmptyValueBits()
 
 	return f
 }
 
 func newFieldFromLocalFile(fieldName, segmentName string, start, max uint64,
-	fieldType uint64, btree *tree.BTreeDB, logger *utils.Log4FE) *Field {
+	fieldType uint64, version uint32, indexOnly bool, btree *tree.BTreeDB, dir utils.Directory, logger *utils.Log4FE) (*Field, error) {
 
 	f := &Field{
 		fieldName:  fieldName,
@@ -85,52 +94,58 @@ func newFieldFromLocalFile(fieldName, segmentName string, start, max uint64,
 		maxDocId:   max,
 		fieldType:  fieldType,
 		isMemory:   false,
+		indexOnly:  indexOnly,
 		btree:      btree,
+		dir:        dir,
 		Logger:     logger,
 	}
-	// todo 修改mmap加载逻辑，以下文件没有必要全部加载
-	var err error
-	f.idxMmap, err = utils.NewMmap(fmt.Sprintf("%v%v_invert.idx", segmentName, f.fieldName), utils.MODE_APPEND)
-	if err != nil {
-		f.Logger.Error("[ERROR] Mmap error : %v", err)
+	// 加载时只读取文件尾部，完整的校验在检查段时进行
+	var loadErr error
+	for _, issue := range f.checkFooters(segmentName, version) {
+		f.Logger.Error("[ERROR] Field %v%v File Corrupted : %v", segmentName, fieldName, issue)
+		if loadErr == nil {
+			loadErr = fmt.Errorf("field %v %v", fieldName, issue)
+		}
 	}
-	f.idxMmap.SetFileEnd(0)
 
-	f.pflMmap, err = utils.NewMmap(fmt.Sprintf("%v%v_profile.pfl", segmentName, f.fieldName), utils.MODE_APPEND)
-	if err != nil {
-		f.Logger.Error("[ERROR] Mmap error : %v", err)
+	// 只记录字段类型用到的文件，第一次读取时才打开
+	if !indexOnly {
+		f.pflFile = newLazyFile(dir, fmt.Sprintf("%v%v_profile.pfl", segmentName, f.fieldName))
 	}
-	f.pflMmap.SetFileEnd(0)
-
-	f.dtlMmap, err = utils.NewMmap(fmt.Sprintf("%v%v_detail.dtl", segmentName, f.fieldName), utils.MODE_APPEND)
-	if err != nil {
-		f.Logger.Error("[ERROR] Mmap error : %v", err)
+	if fieldType == utils.IDX_TYPE_STRING ||
+		fieldType == utils.IDX_TYPE_STRING_SEG {
+		f.idxFile = newLazyFile(dir, fmt.Sprintf("%v%v_invert.idx", segmentName, f.fieldName))
+		f.ivt = newInvertFromLocalFile(fieldType, fieldName, segmentName, f.idxFile, dir, logger)
 	}
-	f.dtlMmap.SetFileEnd(0)
 
-	f.pfiMmap, err = utils.NewMmap(fmt.Sprintf("%v%v_profileindex.pfi", segmentName, f.fieldName), utils.MODE_APPEND)
-	if err != nil {
-		f.Logger.Error("[ERROR] Mmap error : %v", err)
+	if hasProfileIndex(fieldType) {
+		f.pfiFile = newLazyFile(dir, fmt.Sprintf("%v%v_profileindex.pfi", segmentName, f.fieldName))
+		f.pfi = newProfileIndexFromLocalFile(btree, fieldType, fieldName, segmentName, f.pfiFile, logger)
+	}
+	if hasDetail(fieldType) && !indexOnly {
+		f.dtlFile = newLazyFile(dir, fmt.Sprintf("%v%v_detail.dtl", segmentName, f.fieldName))
 	}
-	f.pfiMmap.SetFileEnd(0)
 
-	f.Logger.Info("[INFO] Field %v Load Finish", f.fieldName)
-	if fieldType == utils.IDX_TYPE_STRING ||
-		fieldType == utils.IDX_TYPE_STRING_SEG {
-		f.ivt = newInvertFromLocalFile(fieldType, fieldName, segmentName, f.idxMmap, logger)
+	if !indexOnly {
+		f.pfl = newProfileFromLocalFile(fieldName, fieldType, f.startDocId, f.maxDocId, f.pflFile, f.dtlFile, logger)
 	}
 
-	if fieldType == utils.IDX_TYPE_NUMBER ||
-		fieldType == utils.IDX_TYPE_DATE ||
-		fieldType == utils.IDX_TYPE_FLOAT {
-		f.pfi = newProfileIndexFromLocalFile(btree, fieldType, fieldName, segmentName, f.pfiMmap, logger)
+	if hasDocValues(fieldType) {
+		var err error
+		f.dv, err = newDocValuesFromLocalFile(dir, fieldName, segmentName)
+		if err != nil {
+			f.Logger.Error("[ERROR] Load DocValues error : %v", err)
+		}
 	}
 
-	f.pfl = newProfileFromLocalFile(fieldName, fieldType, f.startDocId, f.maxDocId, f.pflMmap, f.dtlMmap, logger)
+	var err error
+	if f.vb, err = newValueBitsFromLocalFile(dir, existsFileName(segmentName, fieldName)); err != nil {
+		f.Logger.Error("[ERROR] Load Exists error : %v", err)
+	}
 
-	f.setMmap()
+	f.Logger.Info("[INFO] Field %v Load Finish", f.fieldName)
 
-	return f
+	return f, loadErr
 }
 
 func (f *Field) addDocument(docId uint64, contentStr string) error {
@@ -143,6 +158,9 @@ func (f *Field) addDocument(docId uint64, contentStr string) error {
 		f.Logger.Error("[ERROR] Field AddDocument :: Add Document Error %v", err)
 		return err
 	}
+	if f.vb != nil {
+		f.vb.add(isPresent(f.fieldType, contentStr))
+	}
 
 	if (f.fieldType == utils.IDX_TYPE_STRING_SEG ||
 		f.fieldType == utils.IDX_TYPE_STRING) &&
@@ -153,10 +171,7 @@ func (f *Field) addDocument(docId uint64, contentStr string) error {
 		}
 	}
 
-	if (f.fieldType == utils.IDX_TYPE_NUMBER ||
-		f.fieldType == utils.IDX_TYPE_DATE ||
-		f.fieldType == utils.IDX_TYPE_FLOAT) &&
-		f.pfi != nil {
+	if hasProfileIndex(f.fieldType) && f.pfi != nil {
 		if err := f.pfi.addDocument(docId, contentStr); err != nil {
 			f.Logger.Error("[ERROR] Field --> AddDocument :: Add ProfileIndex Document Error %v", err)
 			return err
@@ -195,6 +210,9 @@ func (f *Field) queryFilter(filter utils.SearchFilters) ([]uint64, bool) {
 	if f.pfi == nil {
 		return nil, false
 	}
+	if f.fieldType == utils.IDX_TYPE_IP {
+		return f.queryIPFilter(filter)
+	}
 
 	var start, end int64
 
@@ -212,17 +230,79 @@ func (f *Field) queryFilter(filter utils.SearchFilters) ([]uint64, bool) {
 		start = filter.Start
 		end = filter.End
 	case utils.FILT_LESS:
-		start = 0
+		// 空值不建立索引，值可以为负数
+		start = math.MinInt64
 		end = filter.Start
 	case utils.FILT_OVER:
 		start = filter.Start
-		end = 0xFFFFFFFFFF
+		end = math.MaxInt64
 	}
 
-	return f.pfi.queryRange(start, end)
+	docIds, ok := f.pfi.queryRange(start, end)
+	// 旧版本的段中空值也建立了索引，需要去掉
+	if ok && f.vb == nil {
+		present := make([]uint64, 0, len(docIds))
+		for _, docId := range docIds {
+			if f.hasValue(docId) {
+				present = append(present, docId)
+			}
+		}
+		docIds = present
+	}
+	return docIds, ok
+}
+
+// queryIPFilter IP 地址字段按 16 字节的上下界查询，等于过滤的上下界是 CIDR 的范围
+func (f *Field) queryIPFilter(filter utils.SearchFilters) ([]uint64, bool) {
+	start, end := filter.StartTerm, filter.EndTerm
+	switch filter.Type {
+	case utils.FILT_LESS:
+		start = utils.IP_MIN
+	case utils.FILT_OVER:
+		end = utils.IP_MAX
+	}
+	return f.pfi.queryTermRange(start, end)
+}
+
+// existsDocIds 段内有值或没有值的文档
+func (f *Field) existsDocIds(exists bool) []uint64 {
+	docIds := make([]uint64, 0)
+	for docId := f.startDocId; docId < f.maxDocId; docId++ {
+		if f.hasValue(docId) == exists {
+			docIds = append(docIds, docId)
+		}
+	}
+	return docIds
+}
+
+// hasValue 判断文档在字段中是否有值，没有有值位图时数字类字段按空值判断，字符串按空字符串判断
+func (f *Field) hasValue(docId uint64) bool {
+	if docId < f.startDocId || docId >= f.maxDocId {
+		return false
+	}
+	if f.vb != nil {
+		return f.vb.has(docId - f.startDocId)
+	}
+	if f.pfi != nil {
+		value, ok := f.numericValue(docId)
+		return ok && value != utils.NullNumber(f.fieldType)
+	}
+	value, ok := f.getValue(docId)
+	return ok && value != ""
 }
 
 func (f *Field) getValue(docId uint64) (string, bool) {
+	// 子字段不存储内容，读取父字段的值
+	if f.indexOnly {
+		if f.source == nil || docId < f.startDocId || docId >= f.maxDocId {
+			return "", false
+		}
+		return f.source.getValue(docId)
+	}
+	// 布尔型字段的位图中空值为 false，需要按有值位图判断
+	if f.fieldType == utils.IDX_TYPE_BOOL && !f.hasValue(docId) {
+		return "", docId >= f.startDocId && docId < f.maxDocId
+	}
 	if docId >= f.startDocId && docId < f.maxDocId && f.pfl != nil {
 		return f.pfl.getValue(docId - f.startDocId)
 	}
@@ -232,7 +312,26 @@ func (f *Field) getValue(docId uint64) (string, bool) {
 
 func (f *Field) serialization(segmentName string, btdb *tree.BTreeDB) error {
 
-	if f.pfl != nil {
+	// 列式存储要在正排序列化之前写入，正排序列化后会释放内存中的值
+	if f.pfl != nil && hasDocValues(f.fieldType) {
+		err := writeDocValues(f.dir, docValuesFileName(segmentName, f.fieldName), f.fieldType, f.pfl.pflNumber, f.pfl.pflString)
+		if err != nil {
+			f.Logger.Error("[ERROR] Field DocValues Serialization Error : %v", err)
+			return err
+		}
+	}
+
+	if f.vb != nil {
+		if err := f.vb.write(f.dir, existsFileName(segmentName, f.fieldName)); err != nil {
+			f.Logger.Error("[ERROR] Field Exists Serialization Error : %v", err)
+			return err
+		}
+	}
+
+	if f.pfl != nil && f.indexOnly {
+		f.pfl.destroy()
+		f.pfl = nil
+	} else if f.pfl != nil {
 		err := f.pfl.serialization(segmentName)
 		if err != nil {
 			f.Logger.Error("[ERROR] Field Serialization Error : %v", err)
@@ -261,6 +360,11 @@ func (f *Field) serialization(segmentName string, btdb *tree.BTreeDB) error {
 		}
 	}
 
+	if err := f.writeFooters(segmentName); err != nil {
+		f.Logger.Error("[ERROR] Field %v Write Footer Error : %v", f.fieldName, err)
+		return err
+	}
+
 	f.Logger.Info("[INFO] Field %v Serialization Finish", f.fieldName)
 
 	return nil
@@ -278,11 +382,40 @@ func (f *Field) destroy() {
 	if f.ivt != nil {
 		f.ivt.destroy()
 	}
+
+	if f.dv != nil {
+		f.dv.destroy()
+	}
+
+	if f.vb != nil {
+		f.vb.destroy()
+	}
 }
 
 func (f *Field) mergeField(fields []*Field, segmentName string, btdb *tree.BTreeDB, delDocSet map[uint64]struct{}) error {
 
-	if f.pfl != nil {
+	if f.pfl != nil && hasDocValues(f.fieldType) {
+		if err := f.mergeDocValues(fields, segmentName, delDocSet); err != nil {
+			f.Logger.Error("[Error] Field %v merge DocValues Error : %v", f.fieldName, err)
+			return err
+		}
+	}
+
+	if err := f.mergeValueBits(fields, segmentName, delDocSet); err != nil {
+		f.Logger.Error("[Error] Field %v merge Exists Error : %v", f.fieldName, err)
+		return err
+	}
+
+	if f.indexOnly {
+		// 子字段不合并存储的内容，文档数按参与合并的字段计算
+		for _, fd := range fields {
+			f.maxDocId += fd.maxDocId - fd.startDocId
+		}
+		if f.pfl != nil {
+			f.pfl.destroy()
+			f.pfl = nil
+		}
+	} else if f.pfl != nil {
 		pfls := make([]*profile, 0)
 
 		for _, fd := range fields {
@@ -313,7 +446,7 @@ func (f *Field) mergeField(fields []*Field, segmentName string, btdb *tree.BTree
 				f.Logger.Error("[INFO] Invert %v is nil")
 			}
 		}
-		if err := f.pfi.mergeProfileIndex(pfis, segmentName, btdb); err != nil {
+		if err := f.pfi.mergeProfileIndex(pfis, segmentName, btdb, delDocSet); err != nil {
 			return err
 		}
 	}
@@ -327,41 +460,104 @@ func (f *Field) mergeField(fields []*Field, segmentName string, btdb *tree.BTree
 				f.Logger.Error("[INFO] Invert %v is nil")
 			}
 		}
-		if err := f.ivt.mergeInvert(ivts, segmentName); err != nil {
+		if err := f.ivt.mergeInvert(ivts, segmentName, delDocSet); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return f.writeFooters(segmentName)
 }
 
-func (f *Field) setMmap() {
-	f.setIdxMmap(f.idxMmap)
-	f.setPflMmap(f.pflMmap)
-	f.setDtlMmap(f.dtlMmap)
-	f.setPfiMmap(f.pfiMmap)
+// mergeDocValues 按 docId 顺序读出各段的值，重新生成列式存储，已删除的文档写入空值
+func (f *Field) mergeDocValues(fields []*Field, segmentName string, delDocSet map[uint64]struct{}) error {
+	numbers := make([]int64, 0)
+	terms := make([]string, 0)
+
+	for _, fd := range fields {
+		for docId := fd.startDocId; docId < fd.maxDocId; docId++ {
+			_, deleted := delDocSet[docId]
+			if f.fieldType == utils.IDX_TYPE_STRING || f.fieldType == utils.IDX_TYPE_IP {
+				term := ""
+				if !deleted {
+					term, _ = fd.keywordValue(docId)
+				}
+				terms = append(terms, term)
+				continue
+			}
+
+			value := utils.NullNumber(f.fieldType)
+			if !deleted {
+				value, _ = fd.numericValue(docId)
+			}
+			numbers = append(numbers, value)
+		}
+	}
+
+	return writeDocValues(f.dir, docValuesFileName(segmentName, f.fieldName), f.fieldType, numbers, terms)
 }
 
-func (f *Field) setIdxMmap(idxMmap *utils.Mmap) {
-	if f.ivt != nil {
-		f.ivt.setIdxMmap(idxMmap)
+// mergeValueBits 按 docId 顺序重新生成有值位图，已删除的文档没有值
+func (f *Field) mergeValueBits(fields []*Field, segmentName string, delDocSet map[uint64]struct{}) error {
+	vb := newEmptyValueBits()
+	for _, fd := range fields {
+		for docId := fd.startDocId; docId < fd.maxDocId; docId++ {
+			_, deleted := delDocSet[docId]
+			vb.add(!deleted && fd.hasValue(docId))
+		}
 	}
+	return vb.write(f.dir, existsFileName(segmentName, f.fieldName))
 }
 
-func (f *Field) setPflMmap(pflMmap *utils.Mmap) {
+// numericValue 获取数字字段的原始值，空值为 -1，优先读取列式存储
+func (f *Field) numericValue(docId uint64) (int64, bool) {
+	if docId < f.startDocId || docId >= f.maxDocId {
+		return -1, false
+	}
+	if f.dv != nil {
+		return f.dv.numeric(docId - f.startDocId)
+	}
 	if f.pfl != nil {
-		f.pfl.setPflMmap(pflMmap)
+		return f.pfl.getIntValue(docId - f.startDocId)
 	}
+	if f.indexOnly && f.fieldType == utils.IDX_TYPE_BOOL {
+		// 布尔型没有列式存储，按子字段的类型解析父字段的值
+		value, _ := f.getValue(docId)
+		if b, _ := utils.ParseBool(value); b {
+			return 1, true
+		}
+		return 0, true
+	}
+	return -1, false
 }
 
-func (f *Field) setPfiMmap(pflidxMmap *utils.Mmap) {
-	if f.pfi != nil {
-		f.pfi.setPfiMmap(pflidxMmap)
+// keywordValue 获取关键词字段的值，优先读取列式存储，IP 地址为 16 字节可排序的形式
+func (f *Field) keywordValue(docId uint64) (string, bool) {
+	if docId < f.startDocId || docId >= f.maxDocId {
+		return "", false
 	}
+	if f.dv != nil {
+		return f.dv.term(f.dv.ord(docId - f.startDocId)), true
+	}
+	if f.pfl != nil && f.fieldType == utils.IDX_TYPE_IP {
+		return f.pfl.getRawValue(docId - f.startDocId)
+	}
+	return f.getValue(docId)
 }
 
-func (f *Field) setDtlMmap(dtlMmap *utils.Mmap) {
+// setSource 设为 source 的子字段，持久化时不写入存储的内容
+func (f *Field) setSource(source *Field) {
+	f.indexOnly = true
+	f.source = source
+}
+
+func (f *Field) setCodec(codec string) {
 	if f.pfl != nil {
-		f.pfl.setDtlMmap(dtlMmap)
+		f.pfl.setCodec(codec)
+	}
+}
+
+func (f *Field) setAnalyzer(analyzer string) {
+	if f.ivt != nil {
+		f.ivt.analyzer = analyzer
 	}
 }
@@ -0,0 +1,199 @@
+/**
+ * @Note 段文件的延迟打开，打开的文件和映射由所有段共用的 LRU 限制数量
+ **/
+
+package segment
+
+import (
+	"GoDance/utils"
+	"container/list"
+	"sync"
+)
+
+// DEFAULT_MAX_OPEN_FILES 默认同时打开的段文件数量上限
+const DEFAULT_MAX_OPEN_FILES = 1024
+
+// lazyFile 段内的一个只读文件，第一次读取时才打开并映射
+// 使用中的文件不会被关闭，空闲的文件超过上限时按最近使用的顺序关闭，再次读取时重新打开
+type lazyFile struct {
+	dir      utils.Directory
+	fileName string
+	mmap     *utils.Mmap
+	refs     int           // 正在读取的次数
+	missing  bool          // 文件不存在，持久化的段不会再生成该文件
+	closing  bool          // 段已被回收，最后一次读取结束时关闭
+	elem     *list.Element // 在 LRU 中的位置，未打开时为 nil
+}
+
+// FileCacheStats 打开的段文件的统计信息
+type FileCacheStats struct {
+	OpenFiles    int    `json:"openFiles"`    // 当前打开的文件数
+	MappedBytes  int64  `json:"mappedBytes"`  // 当前映射的字节数
+	MaxOpenFiles int    `json:"maxOpenFiles"` // 打开文件数的上限
+	Opened       uint64 `json:"opened"`       // 累计打开的次数
+	Evicted      uint64 `json:"evicted"`      // 累计因超过上限被关闭的次数
+}
+
+// fileCache 打开的段文件的 LRU，所有段共用
+type fileCache struct {
+	mutex    sync.Mutex
+	capacity int
+	order    *list.List // 打开的文件，最近使用的在前
+	mapped   int64
+	opened   uint64
+	evicted  uint64
+}
+
+var defaultFileCache = newFileCache(DEFAULT_MAX_OPEN_FILES)
+
+func newFileCache(capacity int) *fileCache {
+	return &fileCache{
+		capacity: capacity,
+		order:    list.New(),
+	}
+}
+
+// SetMaxOpenFiles
+// @Description 设置同时打开的段文件数量上限，超出的空闲文件立即关闭
+// @Param n 上限，小于 1 时按 1 处理
+func SetMaxOpenFiles(n int) {
+	defaultFileCache.setCapacity(n)
+}
+
+// GetFileCacheStats
+// @Description 获取打开的段文件的统计信息
+// @Return FileCacheStats 统计信息
+func GetFileCacheStats() FileCacheStats {
+	return defaultFileCache.stats()
+}
+
+func newLazyFile(dir utils.Directory, fileName string) *lazyFile {
+	return &lazyFile{dir: dir, fileName: fileName}
+}
+
+// acquire 取得文件的映射，文件不存在时返回 nil，使用完后需要调用 release
+func (lf *lazyFile) acquire() (*utils.Mmap, error) {
+	return defaultFileCache.acquire(lf)
+}
+
+// release 结束读取，之后文件可能被关闭
+func (lf *lazyFile) release() {
+	defaultFileCache.release(lf)
+}
+
+// close 关闭文件，段被回收时调用，正在读取时等读取结束后再关闭
+func (lf *lazyFile) close() {
+	defaultFileCache.close(lf)
+}
+
+func (c *fileCache) acquire(lf *lazyFile) (*utils.Mmap, error) {
+	if lf == nil {
+		return nil, nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if lf.mmap == nil {
+		if lf.missing {
+			return nil, nil
+		}
+		if !lf.dir.Exist(lf.fileName) {
+			lf.missing = true
+			return nil, nil
+		}
+		mmap, err := utils.NewMmapIn(lf.dir, lf.fileName, utils.MODE_APPEND)
+		if err != nil {
+			return nil, err
+		}
+		mmap.SetFileEnd(0)
+		lf.mmap = mmap
+		lf.closing = false
+		lf.elem = c.order.PushFront(lf)
+		c.mapped += mmap.FileLen
+		c.opened++
+	} else {
+		c.order.MoveToFront(lf.elem)
+	}
+	lf.refs++
+	c.shrink()
+	return lf.mmap, nil
+}
+
+func (c *fileCache) release(lf *lazyFile) {
+	if lf == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if lf.refs > 0 {
+		lf.refs--
+	}
+	if lf.closing && lf.refs == 0 && lf.mmap != nil {
+		c.unmap(lf)
+	}
+	c.shrink()
+}
+
+func (c *fileCache) close(lf *lazyFile) {
+	if lf == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if lf.mmap == nil {
+		return
+	}
+	if lf.refs > 0 {
+		lf.closing = true
+		return
+	}
+	c.unmap(lf)
+}
+
+func (c *fileCache) setCapacity(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.capacity = n
+	c.shrink()
+}
+
+func (c *fileCache) stats() FileCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return FileCacheStats{
+		OpenFiles:    c.order.Len(),
+		MappedBytes:  c.mapped,
+		MaxOpenFiles: c.capacity,
+		Opened:       c.opened,
+		Evicted:      c.evicted,
+	}
+}
+
+// shrink 从最久未使用的开始关闭空闲的文件，所有文件都在使用时允许暂时超过上限
+func (c *fileCache) shrink() {
+	for elem := c.order.Back(); elem != nil && c.order.Len() > c.capacity; {
+		prev := elem.Prev()
+		if lf := elem.Value.(*lazyFile); lf.refs == 0 {
+			c.unmap(lf)
+			c.evicted++
+		}
+		elem = prev
+	}
+}
+
+func (c *fileCache) unmap(lf *lazyFile) {
+	// 解压的块以映射为键，重新打开后不会再命中
+	defaultBlockCache.evict(lf.mmap)
+	c.mapped -= lf.mmap.FileLen
+	lf.mmap.Unmap()
+	lf.mmap = nil
+	c.order.Remove(lf.elem)
+	lf.elem = nil
+}
@@ -0,0 +1,58 @@
+package segment
+
+import (
+	"GoDance/utils"
+	"testing"
+)
+
+// 超过上限时只关闭空闲的文件，正在读取的文件在读取结束后才关闭
+func TestFileCacheEvictionUnderRefs(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	for _, name := range []string{"/seg/a.pfl", "/seg/b.pfl"} {
+		if err := dir.WriteFile(name, []byte("0123456789abcdef")); err != nil {
+			t.Fatalf("write %v : %v", name, err)
+		}
+	}
+
+	c := newFileCache(1)
+	a, b := newLazyFile(dir, "/seg/a.pfl"), newLazyFile(dir, "/seg/b.pfl")
+	aMmap, err := c.acquire(a)
+	if err != nil || aMmap == nil {
+		t.Fatalf("acquire a = %v, %v", aMmap, err)
+	}
+	if _, err := c.acquire(b); err != nil {
+		t.Fatalf("acquire b : %v", err)
+	}
+	if stats := c.stats(); stats.OpenFiles != 2 || stats.Evicted != 0 {
+		t.Fatalf("both in use : open %v, evicted %v, want 2 and 0", stats.OpenFiles, stats.Evicted)
+	}
+
+	// b 空闲后被关闭，a 仍在读取
+	c.release(b)
+	if stats := c.stats(); stats.OpenFiles != 1 || stats.Evicted != 1 || b.mmap != nil || a.mmap == nil {
+		t.Fatalf("after release b : open %v, evicted %v", stats.OpenFiles, stats.Evicted)
+	}
+
+	// 段被回收时 a 仍在读取，映射保留到读取结束
+	c.close(a)
+	if a.mmap == nil {
+		t.Fatalf("close unmapped a file in use")
+	}
+	if got := aMmap.ReadString(0, 4); got != "0123" {
+		t.Fatalf("read after close = %q, want 0123", got)
+	}
+	c.release(a)
+	if stats := c.stats(); stats.OpenFiles != 0 || stats.MappedBytes != 0 || a.mmap != nil {
+		t.Fatalf("after release a : open %v, mapped %v", stats.OpenFiles, stats.MappedBytes)
+	}
+
+	// 再次读取时重新打开
+	if m, err := c.acquire(a); err != nil || m == nil || a.closing {
+		t.Fatalf("reacquire a = %v, %v, closing %v", m, err, a.closing)
+	}
+	c.release(a)
+	if stats := c.stats(); stats.OpenFiles != 1 || stats.Opened != 3 {
+		t.Fatalf("after reacquire : open %v, opened %v, want 1 and 3", stats.OpenFiles, stats.Opened)
+	}
+}
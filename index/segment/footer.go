@@ -0,0 +1,227 @@
+/**
+ * @Note 段文件的尾部校验信息与格式版本
+ **/
+
+package segment
+
+import (
+	"GoDance/utils"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// FORMAT_VERSION 当前写入的段文件格式版本，没有尾部信息的旧文件为版本 0，版本 2 增加了有值位图
+// 读取时遇到更高的版本会报错，旧版本的段在合并时会按当前版本重新写入
+const FORMAT_VERSION uint32 = 2
+
+// fileSinceVersion 从某个版本开始才有的文件，更早版本的段缺少这些文件不是错误
+var fileSinceVersion = map[string]uint32{
+	"_docvalues.dv": 1,
+	"_exists.bm":    2,
+}
+
+// 文件尾部: [数据长度 8][crc32 4][版本 4][magic 8]
+const (
+	footerSize  int64  = 24
+	footerMagic uint64 = 0x3145434e41444f47 // "GODANCE1"
+)
+
+// fileFooter 文件的尾部信息
+type fileFooter struct {
+	Version  uint32 // 格式版本，0 表示没有尾部信息
+	DataLen  int64  // 尾部之前的数据长度，读取数据时不能超过该长度
+	Checksum uint32 // 数据的 crc32
+}
+
+// appendFooter 计算文件当前内容的校验值，并在文件末尾写入尾部信息
+func appendFooter(dir utils.Directory, fileName string) error {
+	fd, err := dir.OpenFile(fileName, os.O_RDWR|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	hash := crc32.NewIEEE()
+	dataLen, err := io.Copy(hash, fd)
+	if err != nil {
+		return err
+	}
+
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer, uint64(dataLen))
+	binary.LittleEndian.PutUint32(footer[8:], hash.Sum32())
+	binary.LittleEndian.PutUint32(footer[12:], FORMAT_VERSION)
+	binary.LittleEndian.PutUint64(footer[16:], footerMagic)
+	if _, err := fd.Write(footer); err != nil {
+		return err
+	}
+	return fd.Sync()
+}
+
+// decodeFooter 解析文件末尾的数据，没有尾部信息时按版本 0 处理，整个文件都是数据
+func decodeFooter(tail []byte, size int64) fileFooter {
+	if int64(len(tail)) < footerSize || binary.LittleEndian.Uint64(tail[len(tail)-8:]) != footerMagic {
+		return fileFooter{DataLen: size}
+	}
+	tail = tail[int64(len(tail))-footerSize:]
+	return fileFooter{
+		DataLen:  int64(binary.LittleEndian.Uint64(tail)),
+		Checksum: binary.LittleEndian.Uint32(tail[8:]),
+		Version:  binary.LittleEndian.Uint32(tail[12:]),
+	}
+}
+
+// readFooter 读取文件的尾部信息，不校验数据
+func readFooter(dir utils.Directory, fileName string) (fileFooter, error) {
+	fd, err := dir.OpenFile(fileName, os.O_RDONLY)
+	if err != nil {
+		return fileFooter{}, err
+	}
+	defer fd.Close()
+
+	size, err := fd.Size()
+	if err != nil {
+		return fileFooter{}, err
+	}
+	if size < footerSize {
+		return fileFooter{DataLen: size}, nil
+	}
+	tail := make([]byte, footerSize)
+	if _, err := fd.ReadAt(tail, size-footerSize); err != nil {
+		return fileFooter{}, err
+	}
+	return decodeFooter(tail, size), nil
+}
+
+// checkFooter 只读取文件的尾部信息，检查版本和数据长度，不计算校验值
+// minVersion 是段的元信息中记录的版本，大于 0 时文件必须有尾部信息，避免截断的文件被当作旧文件
+func checkFooter(dir utils.Directory, fileName string, minVersion uint32) (fileFooter, error) {
+	footer, err := readFooter(dir, fileName)
+	if err != nil {
+		return footer, err
+	}
+	if footer.Version == 0 {
+		if minVersion > 0 {
+			return footer, errors.New("footer is missing")
+		}
+		return footer, nil
+	}
+	if footer.Version > FORMAT_VERSION {
+		return footer, fmt.Errorf("unsupported format version %v, max supported %v", footer.Version, FORMAT_VERSION)
+	}
+
+	size, err := dir.FileSize(fileName)
+	if err != nil {
+		return footer, err
+	}
+	if footer.DataLen != size-footerSize {
+		return footer, fmt.Errorf("footer records %v bytes, file has %v", footer.DataLen, size-footerSize)
+	}
+	return footer, nil
+}
+
+// verifyFile 校验文件的尾部信息和数据，需要读取整个文件，只在检查段时使用
+func verifyFile(dir utils.Directory, fileName string, minVersion uint32) (fileFooter, error) {
+	footer, err := checkFooter(dir, fileName, minVersion)
+	if err != nil || footer.Version == 0 {
+		return footer, err
+	}
+	checksum, err := fileChecksum(dir, fileName, footer.DataLen)
+	if err != nil {
+		return footer, err
+	}
+	if checksum != footer.Checksum {
+		return footer, fmt.Errorf("checksum mismatch, expected %08x got %08x", footer.Checksum, checksum)
+	}
+	return footer, nil
+}
+
+// fileChecksum 计算文件前 lens 个字节的 crc32，lens 小于 0 时计算整个文件
+func fileChecksum(dir utils.Directory, fileName string, lens int64) (uint32, error) {
+	fd, err := dir.OpenFile(fileName, os.O_RDONLY)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+
+	hash := crc32.NewIEEE()
+	var reader io.Reader = fd
+	if lens >= 0 {
+		reader = io.LimitReader(fd, lens)
+	}
+	if _, err := io.Copy(hash, reader); err != nil {
+		return 0, err
+	}
+	return hash.Sum32(), nil
+}
+
+// fileSuffixes 字段类型用到的段文件，子字段没有正排和字段内容文件
+func (f *Field) fileSuffixes() []string {
+	suffixes := make([]string, 0)
+	if !f.indexOnly {
+		suffixes = append(suffixes, "_profile.pfl")
+	}
+	if hasProfileIndex(f.fieldType) {
+		suffixes = append(suffixes, "_profileindex.pfi")
+	}
+	if hasDetail(f.fieldType) && !f.indexOnly {
+		suffixes = append(suffixes, "_detail.dtl")
+	}
+	if f.fieldType == utils.IDX_TYPE_STRING || f.fieldType == utils.IDX_TYPE_STRING_SEG {
+		suffixes = append(suffixes, "_invert.idx", "_invert.fst")
+	}
+	if hasDocValues(f.fieldType) {
+		suffixes = append(suffixes, "_docvalues.dv")
+	}
+	suffixes = append(suffixes, "_exists.bm")
+	return suffixes
+}
+
+// writeFooters 字段的文件全部写完后追加尾部信息
+func (f *Field) writeFooters(segmentName string) error {
+	for _, suffix := range f.fileSuffixes() {
+		fileName := fmt.Sprintf("%v%v%v", segmentName, f.fieldName, suffix)
+		if !f.dir.Exist(fileName) {
+			continue
+		}
+		if err := appendFooter(f.dir, fileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyFiles 校验字段的文件，返回每个有问题的文件及原因
+func (f *Field) verifyFiles(segmentName string, minVersion uint32) []string {
+	return f.fileIssues(segmentName, minVersion, verifyFile)
+}
+
+// checkFooters 加载字段时只检查文件的尾部信息，返回每个有问题的文件及原因
+func (f *Field) checkFooters(segmentName string, minVersion uint32) []string {
+	return f.fileIssues(segmentName, minVersion, checkFooter)
+}
+
+// fileIssues 用 verify 检查字段的每个文件
+func (f *Field) fileIssues(segmentName string, minVersion uint32,
+	verify func(dir utils.Directory, fileName string, minVersion uint32) (fileFooter, error)) []string {
+
+	issues := make([]string, 0)
+	for _, suffix := range f.fileSuffixes() {
+		fileName := fmt.Sprintf("%v%v%v", segmentName, f.fieldName, suffix)
+		if !f.dir.Exist(fileName) {
+			// 旧版本的段没有列式存储和有值位图文件
+			if since, ok := fileSinceVersion[suffix]; !ok || minVersion >= since {
+				issues = append(issues, fmt.Sprintf("%v is missing", suffix))
+			}
+			continue
+		}
+		if _, err := verify(f.dir, fileName, minVersion); err != nil {
+			issues = append(issues, fmt.Sprintf("%v : %v", suffix, err))
+		}
+	}
+	return issues
+}
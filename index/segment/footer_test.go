@@ -0,0 +1,100 @@
+package segment
+
+import (
+	"GoDance/utils"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const footerTestSegment = "/godance-footer-test/seg_1/"
+
+// newFooterTestSegment 写入一个有字符串和数字字段的段
+func newFooterTestSegment(t *testing.T, dir utils.Directory, logger *utils.Log4FE) {
+	seg := NewEmptySegmentByFieldsInfo(footerTestSegment, 0,
+		map[string]uint64{"color": utils.IDX_TYPE_STRING, "n": utils.IDX_TYPE_NUMBER}, dir, logger)
+	for i, doc := range []map[string]string{{"color": "red", "n": "1"}, {"color": "blue", "n": "2"}} {
+		if err := seg.AddDocument(uint64(i), doc); err != nil {
+			t.Fatalf("add document %v : %v", i, err)
+		}
+	}
+	if err := seg.Serialization(); err != nil {
+		t.Fatalf("serialization : %v", err)
+	}
+	if err := seg.Close(); err != nil {
+		t.Fatalf("close : %v", err)
+	}
+}
+
+// 加载时只检查文件尾部，长度不一致、版本过高或缺少尾部的文件在加载时报错，数据损坏由检查时的校验值发现
+func TestFooterRejectedOnLoad(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+
+	for _, c := range []struct {
+		name    string
+		file    string
+		corrupt func(buf []byte) []byte
+		loadErr string // 加载时的错误，为空表示加载时不报错
+		issue   string // 检查时报告的问题
+	}{
+		{"intact", "color_profile.pfl", func(buf []byte) []byte { return buf }, "", ""},
+		{"appended", "color_profile.pfl", func(buf []byte) []byte { return append(buf, 0, 0, 0, 0) }, "_profile.pfl", "footer is missing"},
+		{"wrong length", "color_invert.fst", func(buf []byte) []byte {
+			tail := buf[len(buf)-int(footerSize):]
+			binary.LittleEndian.PutUint64(tail, binary.LittleEndian.Uint64(tail)+1)
+			return buf
+		}, "_invert.fst", "footer records"},
+		{"truncated", "color_invert.idx", func(buf []byte) []byte { return buf[:len(buf)-int(footerSize)] }, "_invert.idx", "footer is missing"},
+		{"newer version", "n_profileindex.pfi", func(buf []byte) []byte {
+			binary.LittleEndian.PutUint32(buf[len(buf)-12:], FORMAT_VERSION+1)
+			return buf
+		}, "_profileindex.pfi", "unsupported format version"},
+		{"flipped byte", "n_profile.pfl", func(buf []byte) []byte {
+			buf[0] ^= 0xff
+			return buf
+		}, "", "checksum mismatch"},
+	} {
+		dir := utils.NewMemoryDirectory()
+		newFooterTestSegment(t, dir, logger)
+		fileName := footerTestSegment + c.file
+		buf, err := dir.ReadFile(fileName)
+		if err != nil {
+			t.Fatalf("%v : read %v : %v", c.name, c.file, err)
+		}
+		if err := dir.WriteFile(fileName, c.corrupt(append([]byte(nil), buf...))); err != nil {
+			t.Fatalf("%v : write %v : %v", c.name, c.file, err)
+		}
+
+		seg := NewSegmentFromLocalFile(footerTestSegment, dir, logger)
+		if c.loadErr == "" && seg.loadErr != nil {
+			t.Fatalf("%v : load error %v", c.name, seg.loadErr)
+		}
+		if c.loadErr != "" && (seg.loadErr == nil || !strings.Contains(seg.loadErr.Error(), c.loadErr)) {
+			t.Fatalf("%v : load error = %v, want one about %v", c.name, seg.loadErr, c.loadErr)
+		}
+
+		issues := seg.Check()
+		if c.issue == "" && len(issues) != 0 {
+			t.Fatalf("%v : check = %+v, want no issues", c.name, issues)
+		}
+		if c.issue != "" {
+			found := false
+			for _, issue := range issues {
+				found = found || strings.Contains(issue.Message, c.issue)
+			}
+			if !found {
+				t.Fatalf("%v : check = %+v, want an issue with %q", c.name, issues, c.issue)
+			}
+		}
+		if c.issue == "" {
+			if doc, ok := seg.GetDocument(1); !ok || doc["color"] != "blue" || doc["n"] != "2" {
+				t.Fatalf("%v : get 1 = %v, %v", c.name, doc, ok)
+			}
+		}
+		seg.Close()
+		dir.Close()
+	}
+}
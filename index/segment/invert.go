@@ -24,13 +24,15 @@ type invert struct {
 	isMemory      bool
 	fieldType     uint64
 	fieldName     string
-	idxMmap       *utils.Mmap
+	idxFile       *lazyFile
 	memoryHashMap map[string][]utils.DocIdNode
+	analyzer      string // 切词匹配字段的分词器，为空时使用 gse
 	Logger        *utils.Log4FE
 	fst           *vellum.FST
+	dir           utils.Directory
 }
 
-func newEmptyInvert(fieldType uint64, startDocId uint64, fieldName string, logger *utils.Log4FE) *invert {
+func newEmptyInvert(fieldType uint64, startDocId uint64, fieldName string, dir utils.Directory, logger *utils.Log4FE) *invert {
 	ivt := &invert{
 		curDocId:      startDocId,
 		isMemory:      true,
@@ -39,22 +41,24 @@ func newEmptyInvert(fieldType uint64, startDocId uint64, fieldName string, logge
 		memoryHashMap: nil,
 		fst:           nil,
 		Logger:        logger,
+		dir:           dir,
 	}
 	return ivt
 }
 
 func newInvertFromLocalFile(fieldType uint64, fieldName, segmentName string,
-	idxMmap *utils.Mmap, logger *utils.Log4FE) *invert {
+	idxFile *lazyFile, dir utils.Directory, logger *utils.Log4FE) *invert {
 	ivt := &invert{
 		isMemory:  false,
 		fieldType: fieldType,
 		fieldName: fieldName,
-		idxMmap:   idxMmap,
+		idxFile:   idxFile,
 		Logger:    logger,
 		fst:       nil,
+		dir:       dir,
 	}
 	// 从文件中读取fst文件
-	fst, err := vellum.Open(fmt.Sprintf("%v%v_invert.fst", segmentName, fieldName))
+	fst, err := loadFst(dir, fmt.Sprintf("%v%v_invert.fst", segmentName, fieldName))
 	// 读取失败
 	if err != nil {
 		ivt.Logger.Error("[Error] file of fst read error, file name %v%v_invert.fst", segmentName, fieldName)
@@ -65,6 +69,23 @@ func newInvertFromLocalFile(fieldType uint64, fieldName, segmentName string,
 	return ivt
 }
 
+// loadFst 读取 fst 文件，有尾部信息时只加载尾部之前的数据
+func loadFst(dir utils.Directory, fileName string) (*vellum.FST, error) {
+	footer, err := readFooter(dir, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := dir.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if footer.DataLen < 0 || footer.DataLen > int64(len(data)) {
+		return nil, fmt.Errorf("fst data length %v out of range %v", footer.DataLen, len(data))
+	}
+	return vellum.Load(data[:footer.DataLen])
+}
+
 // 添加文档
 func (ivt *invert) addDocument(docId uint64, contentStr string) error {
 	var segResult []string
@@ -72,8 +93,7 @@ func (ivt *invert) addDocument(docId uint64, contentStr string) error {
 	if ivt.fieldType == utils.IDX_TYPE_STRING {
 		segResult = []string{contentStr}
 	} else if ivt.fieldType == utils.IDX_TYPE_STRING_SEG {
-		segmenter := utils.GetGseSegmenter()
-		segResult = segmenter.CutSearch(contentStr, false)
+		segResult = utils.Analyze(ivt.analyzer, contentStr)
 	} else {
 		return errors.New("invert fieldType is not exists")
 	}
@@ -108,7 +128,7 @@ func (ivt *invert) serialization(segmentName string) error {
 	// fst存储文件名
 	fstFileName := fmt.Sprintf("%v%v_invert.fst", segmentName, ivt.fieldName)
 	// 打开fst文件
-	fstFd, err := os.OpenFile(fstFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	fstFd, err := ivt.dir.OpenFile(fstFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 	if err != nil {
 		return err
 	}
@@ -117,13 +137,13 @@ func (ivt *invert) serialization(segmentName string) error {
 
 	// 打开idx文件，用于存储memoryHashMap, 一个倒排字典
 	idxFileName := fmt.Sprintf("%v%v_invert.idx", segmentName, ivt.fieldName)
-	idxFd, err := os.OpenFile(idxFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
-	fi, _ := idxFd.Stat()
-	nowOffset := uint64(fi.Size())
-
+	idxFd, err := ivt.dir.OpenFile(idxFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 	if err != nil {
 		return err
 	}
+	size, _ := idxFd.Size()
+	nowOffset := uint64(size)
+
 	defer idxFd.Close()
 
 	// 生成fst builder用于批量写入文件
@@ -142,7 +162,7 @@ func (ivt *invert) serialization(segmentName string) error {
 	leafNodes := make(map[string]uint64)
 
 	// 因为插入fst的key必须是有序的,所以需要记录memoryHashMap中的key值，以供排序
-	keys := make([]string, len(ivt.memoryHashMap))
+	keys := make([]string, 0, len(ivt.memoryHashMap))
 
 	for key, value := range ivt.memoryHashMap {
 
@@ -189,13 +209,10 @@ func (ivt *invert) serialization(segmentName string) error {
 
 func (ivt *invert) destroy() {
 	ivt.memoryHashMap = nil
+	ivt.idxFile.close()
 }
 
-func (ivt *invert) setIdxMmap(mmap *utils.Mmap) {
-	ivt.idxMmap = mmap
-}
-
-func (ivt *invert) mergeInvert(inverts []*invert, segmentName string) error {
+func (ivt *invert) mergeInvert(inverts []*invert, segmentName string, delDocSet map[uint64]struct{}) error {
 
 	// 用于存放所有fst的迭代器
 	mergeFSTNodes := make([]*FstNode, len(inverts))
@@ -228,7 +245,7 @@ func (ivt *invert) mergeInvert(inverts []*invert, segmentName string) error {
 		}
 	}
 	// 合并fst
-	err := ivt.mergeFSTIteratorList(segmentName, mergeFSTNodes)
+	err := ivt.mergeFSTIteratorList(segmentName, mergeFSTNodes, delDocSet)
 	if err != nil {
 		return err
 	}
@@ -247,22 +264,22 @@ func (ivt *invert) mergeInvert(inverts []*invert, segmentName string) error {
 *  description : 合并k个fst
 *
 ******************************************************************************/
-func (ivt *invert) mergeFSTIteratorList(segmentName string, mergeFSTNodes []*FstNode) error {
+func (ivt *invert) mergeFSTIteratorList(segmentName string, mergeFSTNodes []*FstNode, delDocSet map[uint64]struct{}) error {
 
 	// 保存新段的倒排链
 	idxFileName := fmt.Sprintf("%v%v_invert.idx", segmentName, ivt.fieldName)
-	idxFd, err := os.OpenFile(idxFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	idxFd, err := ivt.dir.OpenFile(idxFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 	if err != nil {
 		return err
 	}
 	defer idxFd.Close()
 
-	fi, _ := idxFd.Stat()
-	totalOffset := int(fi.Size())
+	size, _ := idxFd.Size()
+	totalOffset := int(size)
 
 	// 保存新段的fst倒排索引
 	fstFileName := fmt.Sprintf("%v%v_invert.fst", segmentName, ivt.fieldName)
-	fstFd, err := os.OpenFile(fstFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	fstFd, err := ivt.dir.OpenFile(fstFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 	if err != nil {
 		return err
 	}
@@ -305,7 +322,12 @@ func (ivt *invert) mergeFSTIteratorList(segmentName string, mergeFSTNodes []*Fst
 		// 开始处理nodeList, 里面都是相同的key的node
 		for _, node := range nodeList {
 			docIds, _ := node.ivt.queryTerm(node.Key)
-			value = append(value, docIds...)
+			// 剔除已经删除的文档
+			for _, docId := range docIds {
+				if _, ok := delDocSet[docId.Docid]; !ok {
+					value = append(value, docId)
+				}
+			}
 			if node.Iter.Next() == nil {
 				key, _ := node.Iter.Current()
 				heap.Push(&fstHeap, &FstNode{
@@ -316,7 +338,11 @@ func (ivt *invert) mergeFSTIteratorList(segmentName string, mergeFSTNodes []*Fst
 			}
 		}
 
-		// TODO 通过BitMap将value中已经删除的id剔除
+		// 所有文档都被删除的词不再写入
+		if len(value) == 0 {
+			continue
+		}
+
 		// 将新的倒排链写入文件
 		lens := len(value)
 		lenBuffer := make([]byte, 8)
@@ -342,7 +368,7 @@ func (ivt *invert) queryTerm(keyStr string) ([]utils.DocIdNode, bool) {
 		if ok {
 			return docIds, true
 		}
-	} else if ivt.idxMmap != nil {
+	} else if ivt.fst != nil {
 		// ok, offset := ivt.btree.Search(ivt.fieldName, keyStr)
 		offset, ok, err := ivt.fst.Get([]byte(keyStr))
 		if !ok {
@@ -351,9 +377,19 @@ func (ivt *invert) queryTerm(keyStr string) ([]utils.DocIdNode, bool) {
 		if err != nil {
 			ivt.Logger.Error("[Error] queryTerm fail")
 		}
-		lens := ivt.idxMmap.ReadInt64(int64(offset))
+		idxMmap, err := ivt.idxFile.acquire()
+		if err != nil || idxMmap == nil {
+			if err != nil {
+				ivt.Logger.Error("[ERROR] Mmap error : %v", err)
+			}
+			return nil, false
+		}
+		defer ivt.idxFile.release()
+		lens := idxMmap.ReadInt64(int64(offset))
 
-		res := ivt.idxMmap.ReadDocIdsArry(uint64(offset)+8, uint64(lens))
+		// 倒排链直接引用映射的内存，文件可能在释放后被关闭，需要复制
+		res := make([]utils.DocIdNode, lens)
+		copy(res, idxMmap.ReadDocIdsArry(uint64(offset)+8, uint64(lens)))
 		return res, true
 	}
 
@@ -26,8 +26,11 @@ type profile struct {
 	pflNumber []int64
 	pflString []string
 	pflFloat  []float64
-	pflMmap   *utils.Mmap
-	dtlMmap   *utils.Mmap
+	pflBits   *valueBits // 布尔型字段的值，每个文档一位
+	pflFile   *lazyFile
+	dtlFile   *lazyFile
+	codec     string // 字段内容的压缩方式
+	dir       utils.Directory
 
 	Logger *utils.Log4FE `json:"-"`
 }
@@ -61,7 +64,7 @@ func newEmptyFakeProfile(fieldName string, fieldType, start, cur uint64, logger
 //  @param fieldType 字段类型
 //  @param start 起始文档ID
 //  @return *profile 新的正排索引
-func newEmptyProfile(fieldName string, fieldType, start uint64, logger *utils.Log4FE) *profile {
+func newEmptyProfile(fieldName string, fieldType, start uint64, dir utils.Directory, logger *utils.Log4FE) *profile {
 	pfl := &profile{
 		startDocId: start,
 		maxDocId:   start,
@@ -72,8 +75,12 @@ func newEmptyProfile(fieldName string, fieldType, start uint64, logger *utils.Lo
 		pflNumber:  make([]int64, 0),
 		pflString:  make([]string, 0),
 		pflFloat:   make([]float64, 0),
+		dir:        dir,
 		Logger:     logger,
 	}
+	if fieldType == utils.IDX_TYPE_BOOL {
+		pfl.pflBits = newEmptyValueBits()
+	}
 	return pfl
 }
 
@@ -84,21 +91,25 @@ func newEmptyProfile(fieldName string, fieldType, start uint64, logger *utils.Lo
 //  @param fieldType 字段类型
 //  @param start 起始文档ID
 //  @param cur 最大文档ID
-//  @param pflMmap 正排文件的Mmap
-//  @param dtlMmap 字段内容的Mmap
+//  @param pflFile 正排文件
+//  @param dtlFile 字段内容文件
 //  @return *profile 正排对象
 //
-func newProfileFromLocalFile(fieldName string, fieldType, start, cur uint64, pflMmap, dtlMmap *utils.Mmap, logger *utils.Log4FE) *profile {
+func newProfileFromLocalFile(fieldName string, fieldType, start, cur uint64, pflFile, dtlFile *lazyFile, logger *utils.Log4FE) *profile {
 	pfl := &profile{
 		isMemory:   false,
 		startDocId: start,
 		maxDocId:   cur,
 		fieldType:  fieldType,
 		fieldName:  fieldName,
-		pflMmap:    pflMmap,
-		dtlMmap:    dtlMmap,
+		pflFile:    pflFile,
+		dtlFile:    dtlFile,
 		Logger:     logger,
 	}
+	if fieldType == utils.IDX_TYPE_BOOL {
+		// 布尔型字段的正排文件与有值位图的格式相同
+		pfl.pflBits = &valueBits{count: cur - start, file: pflFile}
+	}
 	return pfl
 }
 
@@ -129,6 +140,17 @@ func (pfl *profile) addDocument(docId uint64, contentStr string) error {
 
 		pfl.pflNumber = append(pfl.pflNumber, value)
 
+	} else if pfl.fieldType == utils.IDX_TYPE_DOUBLE {
+		// 按可排序的整数存储，无法解析时为 DOUBLE_NULL
+		value, _ = utils.ParseDouble(contentStr)
+		pfl.pflNumber = append(pfl.pflNumber, value)
+	} else if pfl.fieldType == utils.IDX_TYPE_DATETIME {
+		// 索引层已经转换为毫秒时间戳，无法解析时为 DATETIME_NULL
+		value, err = strconv.ParseInt(contentStr, 10, 64)
+		if err != nil {
+			value = utils.DATETIME_NULL
+		}
+		pfl.pflNumber = append(pfl.pflNumber, value)
 	} else if pfl.fieldType == utils.IDX_TYPE_FLOAT {
 		f, err := strconv.ParseFloat(contentStr, 64)
 		if err != nil {
@@ -136,6 +158,17 @@ func (pfl *profile) addDocument(docId uint64, contentStr string) error {
 		}
 		value = int64(f * 100)
 		pfl.pflNumber = append(pfl.pflNumber, value)
+	} else if pfl.fieldType == utils.IDX_TYPE_BOOL {
+		// 无法解析时按 false 存储，由有值位图区分空值
+		b, _ := utils.ParseBool(contentStr)
+		pfl.pflBits.add(b)
+	} else if pfl.fieldType == utils.IDX_TYPE_IP {
+		// 按 16 字节可排序的形式存储，无法解析时为空值
+		ip, err := utils.ParseIP(contentStr)
+		if err != nil {
+			ip = ""
+		}
+		pfl.pflString = append(pfl.pflString, ip)
 	} else {
 		pfl.pflString = append(pfl.pflString, contentStr)
 	}
@@ -153,14 +186,19 @@ func (pfl *profile) serialization(segmentName string) error {
 
 	pflFileName := fmt.Sprintf("%v%v_profile.pfl", segmentName, pfl.fieldName)
 
-	pflFd, err := os.OpenFile(pflFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	pflFd, err := pfl.dir.OpenFile(pflFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 	if err != nil {
 		return err
 	}
 	defer pflFd.Close()
 
-	if pfl.fieldType == utils.IDX_TYPE_NUMBER || pfl.fieldType == utils.IDX_TYPE_DATE ||
-		pfl.fieldType == utils.IDX_TYPE_FLOAT {
+	if pfl.fieldType == utils.IDX_TYPE_BOOL {
+		if err := pfl.pflBits.writeTo(pflFd); err != nil {
+			pfl.Logger.Error("[ERROR] BoolProfile --> Serialization :: Write Error %v", err)
+			return err
+		}
+	} else if pfl.fieldType == utils.IDX_TYPE_NUMBER || pfl.fieldType == utils.IDX_TYPE_DATE ||
+		pfl.fieldType == utils.IDX_TYPE_FLOAT || pfl.fieldType == utils.IDX_TYPE_DOUBLE || pfl.fieldType == utils.IDX_TYPE_DATETIME {
 		valueBuffer := make([]byte, 8)
 
 		for _, info := range pfl.pflNumber {
@@ -173,20 +211,14 @@ func (pfl *profile) serialization(segmentName string) error {
 	} else {
 		dtlFileName := fmt.Sprintf("%v%v_detail.dtl", segmentName, pfl.fieldName)
 
-		dtlFd, err := os.OpenFile(dtlFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+		dtl, err := newDtlWriter(pfl.dir, dtlFileName, pfl.codec)
 		if err != nil {
 			return err
 		}
-		defer dtlFd.Close()
 		lenBuffer := make([]byte, 8)
-		var nowOffset int64 = 0
-		for _, value := range pfl.pflString {
-			valueLen := len(value)
-			binary.LittleEndian.PutUint64(lenBuffer, uint64(valueLen))
-			_, err := dtlFd.Write(lenBuffer)
-			cnt, err := dtlFd.WriteString(value)
-
-			if err != nil || cnt != valueLen {
+		for pos, value := range pfl.pflString {
+			nowOffset, err := dtl.add(uint64(pos), value)
+			if err != nil {
 				pfl.Logger.Error("[ERROR] StringProfile Write Error : %v", err)
 			}
 
@@ -195,7 +227,9 @@ func (pfl *profile) serialization(segmentName string) error {
 			if err != nil {
 				pfl.Logger.Error("[ERROR] StringProfile Write Error : %v", err)
 			}
-			nowOffset = nowOffset + int64(valueLen) + 8
+		}
+		if err := dtl.close(); err != nil {
+			return err
 		}
 	}
 
@@ -213,14 +247,13 @@ func (pfl *profile) serialization(segmentName string) error {
 func (pfl *profile) destroy() {
 	pfl.pflString = nil
 	pfl.pflNumber = nil
+	pfl.pflBits = nil
+	pfl.pflFile.close()
+	pfl.dtlFile.close()
 }
 
-func (pfl *profile) setPflMmap(pflMmap *utils.Mmap) {
-	pfl.pflMmap = pflMmap
-}
-
-func (pfl *profile) setDtlMmap(dtlMmap *utils.Mmap) {
-	pfl.dtlMmap = dtlMmap
+func (pfl *profile) setCodec(codec string) {
+	pfl.codec = codec
 }
 
 //
@@ -233,7 +266,7 @@ func (pfl *profile) setDtlMmap(dtlMmap *utils.Mmap) {
 func (pfl *profile) mergeProfiles(profiles []*profile, segmentName string, delDocSet map[uint64]struct{}) (uint64, error) {
 	pflFileName := fmt.Sprintf("%v%v_profile.pfl", segmentName, pfl.fieldName)
 
-	pflFd, err := os.OpenFile(pflFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	pflFd, err := pfl.dir.OpenFile(pflFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 	if err != nil {
 		return 0, err
 	}
@@ -241,12 +274,31 @@ func (pfl *profile) mergeProfiles(profiles []*profile, segmentName string, delDo
 	defer pflFd.Close()
 	var lens uint64
 
-	if pfl.fieldType == utils.IDX_TYPE_NUMBER || pfl.fieldType == utils.IDX_TYPE_DATE ||
-		pfl.fieldType == utils.IDX_TYPE_FLOAT {
+	if pfl.fieldType == utils.IDX_TYPE_BOOL {
+		bits := newEmptyValueBits()
+		for _, p := range profiles {
+			for i := uint64(0); i < (p.maxDocId - p.startDocId); i++ {
+				// 已删除的文档写入 false
+				val, _ := p.getIntValue(i)
+				_, deleted := delDocSet[p.startDocId+i]
+				bits.add(!deleted && val == 1)
+				pfl.maxDocId++
+			}
+		}
+		if err := bits.writeTo(pflFd); err != nil {
+			return 0, err
+		}
+		lens = pfl.maxDocId - pfl.startDocId
+	} else if pfl.fieldType == utils.IDX_TYPE_NUMBER || pfl.fieldType == utils.IDX_TYPE_DATE ||
+		pfl.fieldType == utils.IDX_TYPE_FLOAT || pfl.fieldType == utils.IDX_TYPE_DOUBLE || pfl.fieldType == utils.IDX_TYPE_DATETIME {
 		valBuffer := make([]byte, 8)
 		for _, p := range profiles {
 			for i := uint64(0); i < (p.maxDocId - p.startDocId); i++ {
 				val, _ := p.getIntValue(i)
+				// 已删除的文档写入空值
+				if _, ok := delDocSet[p.startDocId+i]; ok {
+					val = utils.NullNumber(pfl.fieldType)
+				}
 				binary.LittleEndian.PutUint64(valBuffer, uint64(val))
 				_, err := pflFd.Write(valBuffer)
 				if err != nil {
@@ -258,42 +310,22 @@ func (pfl *profile) mergeProfiles(profiles []*profile, segmentName string, delDo
 		lens = pfl.maxDocId - pfl.startDocId
 	} else {
 		dtlFileName := fmt.Sprintf("%v%v_detail.dtl", segmentName, pfl.fieldName)
-		dtlFd, err := os.OpenFile(dtlFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+		dtl, err := newDtlWriter(pfl.dir, dtlFileName, pfl.codec)
 		if err != nil {
 			return 0, err
 		}
-		defer dtlFd.Close()
-		fi, _ := dtlFd.Stat()
-		dtlOffset := fi.Size()
 
 		lenBuffer := make([]byte, 8)
 		for _, p := range profiles {
 			for i := uint64(0); i < (p.maxDocId - p.startDocId); i++ {
-				if _, ok := delDocSet[p.startDocId+i]; ok {
-
-					binary.LittleEndian.PutUint64(lenBuffer, uint64(0))
-					_, err := dtlFd.Write(lenBuffer)
-					if err != nil {
-						pfl.Logger.Error("[ERROR] StringProfile Write Error : %v", err)
-					}
-
-					binary.LittleEndian.PutUint64(lenBuffer, uint64(dtlOffset))
-					_, err = pflFd.Write(lenBuffer)
-					if err != nil {
-						pfl.Logger.Error("[ERROR] StringProfile Write Error : %v", err)
-					}
-					dtlOffset += 8
-					pfl.maxDocId++
-
-					continue
+				// 已删除的文档写入空值
+				val := ""
+				if _, ok := delDocSet[p.startDocId+i]; !ok {
+					val, _ = p.getRawValue(i)
 				}
 
-				val, _ := p.getValue(i)
-				valLen := len(val)
-				binary.LittleEndian.PutUint64(lenBuffer, uint64(valLen))
-				_, err := dtlFd.Write(lenBuffer)
-				cnt, err := dtlFd.WriteString(val)
-				if err != nil || cnt != valLen {
+				dtlOffset, err := dtl.add(pfl.maxDocId-pfl.startDocId, val)
+				if err != nil {
 					pfl.Logger.Error("[ERROR] StringProfile Write Error : %v", err)
 				}
 
@@ -302,10 +334,12 @@ func (pfl *profile) mergeProfiles(profiles []*profile, segmentName string, delDo
 				if err != nil {
 					pfl.Logger.Error("[ERROR] StringProfile Write Error : %v", err)
 				}
-				dtlOffset += int64(valLen) + 8
 				pfl.maxDocId++
 			}
 		}
+		if err := dtl.close(); err != nil {
+			return 0, err
+		}
 		lens = pfl.maxDocId - pfl.startDocId
 	}
 	pfl.isMemory = false
@@ -315,48 +349,118 @@ func (pfl *profile) mergeProfiles(profiles []*profile, segmentName string, delDo
 	return lens, nil
 }
 
+// hasDetail 判断字段类型是否把内容存储在字段内容文件中，数字类字段和布尔型字段只有正排文件
+func hasDetail(fieldType uint64) bool {
+	return fieldType != utils.IDX_TYPE_NUMBER && fieldType != utils.IDX_TYPE_DATE && fieldType != utils.IDX_TYPE_FLOAT &&
+		fieldType != utils.IDX_TYPE_DOUBLE && fieldType != utils.IDX_TYPE_DATETIME && fieldType != utils.IDX_TYPE_BOOL
+}
+
+// FormatNumber
+// @Description 把数字类字段存储的原始值转换为字符串，浮点数存储时乘了 100，日期存储的是时间戳，
+// 双精度浮点数存储的是可排序的整数，日期时间存储的是毫秒时间戳，布尔值存储的是 0 和 1，空值转换为空字符串
+// @Param fieldType 字段类型
+// @Param value 原始值
+// @Return string 字符串形式的值
+// @Return bool 是否转换成功
+func FormatNumber(fieldType uint64, value int64) (string, bool) {
+	if fieldType == utils.IDX_TYPE_DATE {
+		return utils.FormatDateTime(value)
+	} else if fieldType == utils.IDX_TYPE_DOUBLE {
+		return utils.FormatDouble(value), true
+	} else if fieldType == utils.IDX_TYPE_DATETIME {
+		return utils.FormatMillis(value), true
+	} else if fieldType == utils.IDX_TYPE_BOOL {
+		return strconv.FormatBool(value == 1), true
+	} else if fieldType == utils.IDX_TYPE_FLOAT {
+		return fmt.Sprintf("%v", float64(value)/100), true
+	}
+	return fmt.Sprintf("%v", value), true
+}
+
+// formatTerm 把关键词类字段存储的原始值转换为字符串，IP 地址存储的是 16 字节的地址
+func formatTerm(fieldType uint64, term string) string {
+	if fieldType == utils.IDX_TYPE_IP {
+		return utils.FormatIP(term)
+	}
+	return term
+}
+
 // getValue
 // @Description
 // @Param pos
 // @Return string
 // @Return bool
 func (pfl *profile) getValue(pos uint64) (string, bool) {
+	if pfl.fieldType == utils.IDX_TYPE_BOOL && !pfl.fake {
+		value, ok := pfl.getIntValue(pos)
+		if !ok {
+			return "", false
+		}
+		return FormatNumber(pfl.fieldType, value)
+	}
+
+	value, ok := pfl.getRawValue(pos)
+	return formatTerm(pfl.fieldType, value), ok
+}
+
+// getRawValue
+// @Description 读取存储的原始字符串，IP 地址为 16 字节的形式，合并时原样写入新的段
+// @Param pos 段内的位置
+// @Return string 原始值
+// @Return bool 是否读取成功
+func (pfl *profile) getRawValue(pos uint64) (string, bool) {
 	if pfl.fake {
 		return "", true
 	}
 
-	if pfl.isMemory && pos < uint64(len(pfl.pflNumber)) {
-		if pfl.fieldType == utils.IDX_TYPE_NUMBER {
-			return fmt.Sprintf("%v", pfl.pflNumber[pos]), true
-		} else if pfl.fieldType == utils.IDX_TYPE_DATE {
-			return utils.FormatDateTime(pfl.pflNumber[pos])
-		} else if pfl.fieldType == utils.IDX_TYPE_FLOAT {
-			return fmt.Sprintf("%v", float64(pfl.pflNumber[pos])/100), true
+	if pfl.isMemory {
+		if pfl.fieldType == utils.IDX_TYPE_NUMBER || pfl.fieldType == utils.IDX_TYPE_DATE || pfl.fieldType == utils.IDX_TYPE_FLOAT || pfl.fieldType == utils.IDX_TYPE_DOUBLE || pfl.fieldType == utils.IDX_TYPE_DATETIME {
+			if pos >= uint64(len(pfl.pflNumber)) {
+				return "", false
+			}
+			return FormatNumber(pfl.fieldType, pfl.pflNumber[pos])
+		}
+		if pos >= uint64(len(pfl.pflString)) {
+			return "", false
 		}
 		return pfl.pflString[pos], true
 	}
 
-	if pfl.pflMmap == nil {
+	pflMmap, err := pfl.pflFile.acquire()
+	if err != nil || pflMmap == nil {
+		if err != nil {
+			pfl.Logger.Error("[ERROR] Mmap error : %v", err)
+		}
 		return "", false
 	}
+	defer pfl.pflFile.release()
 
 	offset := int64(pos) * 8
-	if pfl.fieldType == utils.IDX_TYPE_NUMBER {
-		return fmt.Sprintf("%v", pfl.pflMmap.ReadInt64(offset)), true
-	} else if pfl.fieldType == utils.IDX_TYPE_DATE {
-		return utils.FormatDateTime(pfl.pflMmap.ReadInt64(offset))
-	} else if pfl.fieldType == utils.IDX_TYPE_FLOAT {
-		val := pfl.pflMmap.ReadInt64(offset)
-		return fmt.Sprintf("%v", float64(val)/100), true
+	if pfl.fieldType == utils.IDX_TYPE_NUMBER || pfl.fieldType == utils.IDX_TYPE_DATE ||
+		pfl.fieldType == utils.IDX_TYPE_FLOAT || pfl.fieldType == utils.IDX_TYPE_DOUBLE || pfl.fieldType == utils.IDX_TYPE_DATETIME {
+		return FormatNumber(pfl.fieldType, pflMmap.ReadInt64(offset))
 	}
 
-	if pfl.dtlMmap == nil {
+	dtlMmap, err := pfl.dtlFile.acquire()
+	if err != nil || dtlMmap == nil {
+		if err != nil {
+			pfl.Logger.Error("[ERROR] Mmap error : %v", err)
+		}
 		return "", false
 	}
+	defer pfl.dtlFile.release()
 
-	dtlOffset := pfl.pflMmap.ReadInt64(offset)
-	lens := pfl.dtlMmap.ReadInt64(dtlOffset)
-	return pfl.dtlMmap.ReadString(dtlOffset+8, lens), true
+	dtlOffset := pflMmap.ReadInt64(offset)
+	if isCompressed(pfl.codec) {
+		value, err := readBlockValue(dtlMmap, dtlOffset, pos)
+		if err != nil {
+			pfl.Logger.Error("[ERROR] StringProfile Read Error : %v", err)
+			return "", false
+		}
+		return value, true
+	}
+	lens := dtlMmap.ReadInt64(dtlOffset)
+	return dtlMmap.ReadString(dtlOffset+8, lens), true
 }
 
 // getIntValue
@@ -366,25 +470,40 @@ func (pfl *profile) getValue(pos uint64) (string, bool) {
 // @Return bool
 func (pfl *profile) getIntValue(pos uint64) (int64, bool) {
 	if pfl.fake {
-		return -1, true
+		return utils.NullNumber(pfl.fieldType), true
+	}
+
+	if pfl.fieldType == utils.IDX_TYPE_BOOL {
+		if pos >= pfl.pflBits.count {
+			return -1, false
+		}
+		if pfl.pflBits.has(pos) {
+			return 1, true
+		}
+		return 0, true
 	}
 
 	if pfl.isMemory {
 		if (pfl.fieldType == utils.IDX_TYPE_NUMBER || pfl.fieldType == utils.IDX_TYPE_DATE ||
-			pfl.fieldType == utils.IDX_TYPE_FLOAT) && pos < uint64(len(pfl.pflNumber)) {
+			pfl.fieldType == utils.IDX_TYPE_FLOAT || pfl.fieldType == utils.IDX_TYPE_DOUBLE || pfl.fieldType == utils.IDX_TYPE_DATETIME) && pos < uint64(len(pfl.pflNumber)) {
 			return pfl.pflNumber[pos], true
 		}
 		return -1, false
 	}
 
-	if pfl.pflMmap == nil {
-		return -1, true
+	pflMmap, err := pfl.pflFile.acquire()
+	if err != nil || pflMmap == nil {
+		if err != nil {
+			pfl.Logger.Error("[ERROR] Mmap error : %v", err)
+		}
+		return utils.NullNumber(pfl.fieldType), true
 	}
+	defer pfl.pflFile.release()
 
 	offset := int64(pos) * 8
 	if pfl.fieldType == utils.IDX_TYPE_NUMBER || pfl.fieldType == utils.IDX_TYPE_DATE ||
-		pfl.fieldType == utils.IDX_TYPE_FLOAT {
-		return pfl.pflMmap.ReadInt64(offset), true
+		pfl.fieldType == utils.IDX_TYPE_FLOAT || pfl.fieldType == utils.IDX_TYPE_DOUBLE || pfl.fieldType == utils.IDX_TYPE_DATETIME {
+		return pflMmap.ReadInt64(offset), true
 	}
 
 	return -1, false
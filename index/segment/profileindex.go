@@ -1,7 +1,7 @@
 /**
  * @Author hz
  * @Date 6:08 AM$ 5/28/22$
- * @Note B+树 正排索引，用于 数值类型和日期时间类型
+ * @Note B+树 正排索引，用于 数值类型、日期时间类型、布尔类型和 IP 地址类型
  **/
 
 package segment
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"sort"
 	"strconv"
 )
 
@@ -23,10 +24,12 @@ type profileindex struct {
 	isMemory      bool
 	fieldType     uint64
 	fieldName     string
-	pfiMmap       *utils.Mmap
+	pfiFile       *lazyFile
 	memoryHashMap map[int64][]uint64
+	memoryTermMap map[string][]uint64 // IP 地址字段以 16 字节的地址为键
 	Logger        *utils.Log4FE
 	btree         *tree.BTreeDB
+	dir           utils.Directory
 }
 
 // newEmptyProfileIndex
@@ -34,28 +37,38 @@ type profileindex struct {
 // @Param fieldType 字段类型
 // @Param startDocId 起始文档ID
 // @Param fieldName 字段名
+// @Param dir 文件所在的目录
 // @Param logger  日志
 // @Return *profileindex 正排索引的引用
-func newEmptyProfileIndex(fieldType, startDocId uint64, fieldName string, logger *utils.Log4FE) *profileindex {
+func newEmptyProfileIndex(fieldType, startDocId uint64, fieldName string, dir utils.Directory, logger *utils.Log4FE) *profileindex {
 	pfi := &profileindex{
 		curDocId:      startDocId,
 		isMemory:      true,
 		fieldType:     fieldType,
 		fieldName:     fieldName,
 		memoryHashMap: make(map[int64][]uint64),
+		memoryTermMap: make(map[string][]uint64),
 		Logger:        logger,
+		dir:           dir,
 	}
 	return pfi
 }
 
+// hasProfileIndex 判断字段类型是否建立 B+ 树正排索引
+func hasProfileIndex(fieldType uint64) bool {
+	return fieldType == utils.IDX_TYPE_NUMBER || fieldType == utils.IDX_TYPE_DATE ||
+		fieldType == utils.IDX_TYPE_FLOAT || fieldType == utils.IDX_TYPE_DOUBLE || fieldType == utils.IDX_TYPE_DATETIME ||
+		fieldType == utils.IDX_TYPE_BOOL || fieldType == utils.IDX_TYPE_IP
+}
+
 func newProfileIndexFromLocalFile(btdb *tree.BTreeDB, fieldType uint64, fieldName, segmentName string,
-	pfiMmap *utils.Mmap, logger *utils.Log4FE) *profileindex {
+	pfiFile *lazyFile, logger *utils.Log4FE) *profileindex {
 
 	pfi := &profileindex{
 		isMemory:  false,
 		fieldType: fieldType,
 		fieldName: fieldName,
-		pfiMmap:   pfiMmap,
+		pfiFile:   pfiFile,
 		Logger:    logger,
 		btree:     btdb,
 	}
@@ -73,6 +86,19 @@ func (pfi *profileindex) addDocument(docId uint64, contentStr string) error {
 	}
 	pfi.Logger.Trace("[TRACE] profileindex AddDocument :: docid %v content %v", docId, contentStr)
 
+	// 空值不建立索引，由有值位图区分
+	if !isPresent(pfi.fieldType, contentStr) {
+		pfi.curDocId++
+		return nil
+	}
+
+	if pfi.fieldType == utils.IDX_TYPE_IP {
+		ip, _ := utils.ParseIP(contentStr)
+		pfi.memoryTermMap[ip] = append(pfi.memoryTermMap[ip], docId)
+		pfi.curDocId++
+		return nil
+	}
+
 	var value int64 = -1
 
 	switch pfi.fieldType {
@@ -89,8 +115,19 @@ func (pfi *profileindex) addDocument(docId uint64, contentStr string) error {
 			floatValue = -100
 		}
 		value = int64(floatValue * 100)
+	case utils.IDX_TYPE_DOUBLE:
+		value, _ = utils.ParseDouble(contentStr)
+	case utils.IDX_TYPE_DATETIME:
+		// 索引层已经转换为毫秒时间戳
+		value, _ = strconv.ParseInt(contentStr, 10, 64)
 	case utils.IDX_TYPE_DATE:
 		value, _ = utils.IsDateTime(contentStr)
+	case utils.IDX_TYPE_BOOL:
+		if b, _ := utils.ParseBool(contentStr); b {
+			value = 1
+		} else {
+			value = 0
+		}
 	}
 
 	if _, ok := pfi.memoryHashMap[value]; !ok {
@@ -107,7 +144,7 @@ func (pfi *profileindex) addDocument(docId uint64, contentStr string) error {
 
 func (pfi *profileindex) serialization(segmentName string, btdb *tree.BTreeDB) error {
 	pfiFileName := fmt.Sprintf("%v%v_profileindex.pfi", segmentName, pfi.fieldName)
-	idxFd, err := os.OpenFile(pfiFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	idxFd, err := pfi.dir.OpenFile(pfiFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 
 	pfi.btree = btdb
 
@@ -116,6 +153,19 @@ func (pfi *profileindex) serialization(segmentName string, btdb *tree.BTreeDB) e
 	}
 	defer idxFd.Close()
 
+	if pfi.fieldType == utils.IDX_TYPE_IP {
+		termNodes, err := pfi.writeTermPostings(idxFd, pfi.memoryTermMap, 0)
+		if err != nil {
+			return err
+		}
+		if err := pfi.btree.SetBatchString(pfi.fieldName, termNodes); err != nil {
+			return err
+		}
+		pfi.memoryTermMap = nil
+		pfi.isMemory = false
+		return nil
+	}
+
 	leafNodes := make(map[int64]string)
 	nowOffset := uint64(0)
 
@@ -136,7 +186,7 @@ func (pfi *profileindex) serialization(segmentName string, btdb *tree.BTreeDB) e
 		}
 
 		idxFd.Write(stringBuffer.Bytes())
-		leafNodes[key] = fmt.Sprintf("%v", nowOffset)
+		leafNodes[pfi.btreeKey(key)] = fmt.Sprintf("%v", nowOffset)
 
 		nowOffset += uint64(lens)*8 + 8
 	}
@@ -157,28 +207,31 @@ func (pfi *profileindex) serialization(segmentName string, btdb *tree.BTreeDB) e
 
 func (pfi *profileindex) destroy() {
 	pfi.memoryHashMap = nil
-}
-
-func (pfi *profileindex) setPfiMmap(mmap *utils.Mmap) {
-	pfi.pfiMmap = mmap
+	pfi.memoryTermMap = nil
+	pfi.pfiFile.close()
 }
 
 func (pfi *profileindex) setBtree(btdb *tree.BTreeDB) {
 	pfi.btree = btdb
 }
 
-func (pfi *profileindex) mergeProfileIndex(profileindexs []*profileindex, segmentName string, btdb *tree.BTreeDB) error {
+func (pfi *profileindex) mergeProfileIndex(profileindexs []*profileindex, segmentName string, btdb *tree.BTreeDB,
+	delDocSet map[uint64]struct{}) error {
 	pfiFileName := fmt.Sprintf("%v%v_profileindex.pfi", segmentName, pfi.fieldName)
-	idxFd, err := os.OpenFile(pfiFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	idxFd, err := pfi.dir.OpenFile(pfiFileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
 	if err != nil {
 		return err
 	}
 	defer idxFd.Close()
 
-	fi, _ := idxFd.Stat()
-	totalOffset := int(fi.Size())
+	size, _ := idxFd.Size()
+	totalOffset := int(size)
 
 	pfi.btree = btdb
+	if pfi.fieldType == utils.IDX_TYPE_IP {
+		return pfi.mergeTermPostings(profileindexs, idxFd, uint64(totalOffset), delDocSet)
+	}
+
 	type pfiMerge struct {
 		p      *profileindex
 		key    int64
@@ -213,11 +266,14 @@ func (pfi *profileindex) mergeProfileIndex(profileindexs []*profileindex, segmen
 	}
 	flag := 0
 	for flag != resflag {
-		var minKey int64 = math.MaxInt64
+		// 按 B+ 树的字节序合并，与 GetNextKV 的遍历顺序一致，负数不会被当作更小的值提前取出
+		var minKey int64
+		var minOrder uint64 = math.MaxUint64
 		meridxs := make([]int, 0)
 		for idx, p := range pfis {
-			if flag>>uint(idx)&1 == 0 && minKey > p.key {
-				minKey = p.key
+			order := uint64(pfi.btreeKey(p.key))
+			if flag>>uint(idx)&1 == 0 && (len(meridxs) == 0 || minOrder > order) {
+				minKey, minOrder = p.key, order
 				meridxs = make([]int, 0)
 				meridxs = append(meridxs, idx)
 				continue
@@ -231,7 +287,11 @@ func (pfi *profileindex) mergeProfileIndex(profileindexs []*profileindex, segmen
 		value := make([]uint64, 0)
 
 		for _, idx := range meridxs {
-			value = append(value, pfis[idx].docids...)
+			for _, docId := range pfis[idx].docids {
+				if _, ok := delDocSet[docId]; !ok {
+					value = append(value, docId)
+				}
+			}
 
 			key, _, ok := pfis[idx].p.GetNextKV(pfis[idx].key)
 			if !ok {
@@ -243,6 +303,11 @@ func (pfi *profileindex) mergeProfileIndex(profileindexs []*profileindex, segmen
 			pfis[idx].docids, ok = pfis[idx].p.queryTerm(key)
 		}
 
+		// 所有文档都被删除的值不再写入
+		if len(value) == 0 {
+			continue
+		}
+
 		lens := len(value)
 		lenBuffer := make([]byte, 8)
 		binary.LittleEndian.PutUint64(lenBuffer, uint64(lens))
@@ -255,7 +320,7 @@ func (pfi *profileindex) mergeProfileIndex(profileindexs []*profileindex, segmen
 		}
 		idxFd.Write(buffer.Bytes())
 
-		leafNodes[minKey] = fmt.Sprintf("%v", uint64(totalOffset))
+		leafNodes[pfi.btreeKey(minKey)] = fmt.Sprintf("%v", uint64(totalOffset))
 
 		totalOffset = totalOffset + 8 + lens*8
 	}
@@ -272,7 +337,8 @@ func (pfi *profileindex) GetFirstKV() (int64, uint64, bool) {
 	if pfi.btree == nil {
 		return 0, 0, false
 	}
-	return pfi.btree.GetFirstKV(pfi.fieldName)
+	key, offset, ok := pfi.btree.GetFirstKV(pfi.fieldName)
+	return pfi.btreeKey(key), offset, ok
 }
 
 func (pfi *profileindex) GetNextKV(key int64) (int64, uint64, bool) {
@@ -281,7 +347,8 @@ func (pfi *profileindex) GetNextKV(key int64) (int64, uint64, bool) {
 		return 0, 0, false
 	}
 
-	return pfi.btree.GetNextKV(pfi.fieldName, key)
+	next, offset, ok := pfi.btree.GetNextKV(pfi.fieldName, pfi.btreeKey(key))
+	return pfi.btreeKey(next), offset, ok
 }
 
 func (pfi *profileindex) queryTerm(key int64) ([]uint64, bool) {
@@ -291,14 +358,15 @@ func (pfi *profileindex) queryTerm(key int64) ([]uint64, bool) {
 		if ok {
 			return docIds, true
 		}
-	} else if pfi.pfiMmap != nil {
-		ok, offset := pfi.btree.Search(pfi.fieldName, key)
+	} else if pfiMmap := pfi.acquire(); pfiMmap != nil {
+		defer pfi.pfiFile.release()
+		ok, offset := pfi.btree.Search(pfi.fieldName, pfi.btreeKey(key))
 		if !ok {
 			return nil, false
 		}
-		lens := pfi.pfiMmap.ReadInt64(int64(offset))
+		lens := pfiMmap.ReadInt64(int64(offset))
 
-		res := pfi.pfiMmap.ReadIdsArray(uint64(offset)+8, int(lens))
+		res := pfiMmap.ReadIdsArray(uint64(offset)+8, int(lens))
 		return res, true
 	}
 
@@ -315,12 +383,13 @@ func (pfi *profileindex) queryRange(keyMin, keyMax int64) ([]uint64, bool) {
 			}
 		}
 		return res, true
-	} else if pfi.pfiMmap != nil {
-		ok, offsets := pfi.btree.SearchRange(pfi.fieldName, keyMin, keyMax)
+	} else if pfiMmap := pfi.acquire(); pfiMmap != nil {
+		defer pfi.pfiFile.release()
+		ok, offsets := pfi.searchRange(keyMin, keyMax)
 		if ok {
 			for _, offset := range offsets {
-				lens := pfi.pfiMmap.ReadInt64(int64(offset))
-				IdsArray := pfi.pfiMmap.ReadIdsArray(uint64(offset)+8, int(lens))
+				lens := pfiMmap.ReadInt64(int64(offset))
+				IdsArray := pfiMmap.ReadIdsArray(uint64(offset)+8, int(lens))
 				res = append(res, IdsArray...)
 			}
 			return res, true
@@ -328,3 +397,138 @@ func (pfi *profileindex) queryRange(keyMin, keyMax int64) ([]uint64, bool) {
 	}
 	return nil, false
 }
+
+// acquire 取得数字索引文件的映射，不为 nil 时使用完需要 release
+func (pfi *profileindex) acquire() *utils.Mmap {
+	pfiMmap, err := pfi.pfiFile.acquire()
+	if err != nil {
+		pfi.Logger.Error("[ERROR] Mmap error : %v", err)
+	}
+	return pfiMmap
+}
+
+// btreeKey 数字和 B+ 树中的键相互转换，B+ 树中的键按字节序排列
+// 双精度浮点数和日期时间翻转符号位，使负数排在正数之前，转换两次得到原值
+func (pfi *profileindex) btreeKey(key int64) int64 {
+	if pfi.fieldType == utils.IDX_TYPE_DOUBLE || pfi.fieldType == utils.IDX_TYPE_DATETIME {
+		return key ^ math.MinInt64
+	}
+	return key
+}
+
+// searchRange 在 B+ 树中查找范围内的值，范围跨过 0 时分成两段查找
+// 没有翻转符号位的键中负数按字节序排在正数之后，翻转后的键跨过 0 时有符号比较的大小会颠倒
+func (pfi *profileindex) searchRange(keyMin, keyMax int64) (bool, []uint64) {
+	if keyMin > keyMax {
+		return pfi.btree.SearchRange(pfi.fieldName, keyMin, keyMax)
+	}
+	if pfi.btreeKey(0) == 0 {
+		if keyMin >= 0 || keyMax < 0 {
+			return pfi.btree.SearchRange(pfi.fieldName, keyMin, keyMax)
+		}
+		_, positives := pfi.btree.SearchRange(pfi.fieldName, 0, keyMax)
+		_, negatives := pfi.btree.SearchRange(pfi.fieldName, keyMin, -1)
+		return true, append(negatives, positives...)
+	}
+
+	min, max := pfi.btreeKey(keyMin), pfi.btreeKey(keyMax)
+	if min <= max {
+		return pfi.btree.SearchRange(pfi.fieldName, min, max)
+	}
+	_, negatives := pfi.btree.SearchRange(pfi.fieldName, min, math.MaxInt64)
+	_, positives := pfi.btree.SearchRange(pfi.fieldName, math.MinInt64, max)
+	return true, append(negatives, positives...)
+}
+
+// writeTermPostings 按键的字节序写入 IP 地址的文档列表，返回键到文件偏移的映射
+func (pfi *profileindex) writeTermPostings(idxFd utils.File, postings map[string][]uint64, offset uint64) (map[string]string, error) {
+	keys := make([]string, 0, len(postings))
+	for key := range postings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	termNodes := make(map[string]string, len(keys))
+	for _, key := range keys {
+		buffer := new(bytes.Buffer)
+		binary.Write(buffer, binary.LittleEndian, uint64(len(postings[key])))
+		binary.Write(buffer, binary.LittleEndian, postings[key])
+		if _, err := idxFd.Write(buffer.Bytes()); err != nil {
+			pfi.Logger.Error("[ERROR] profileindex Write Error : %v", err)
+			return nil, err
+		}
+		termNodes[key] = fmt.Sprintf("%v", offset)
+		offset += uint64(buffer.Len())
+	}
+	return termNodes, nil
+}
+
+// mergeTermPostings 合并 IP 地址字段，按 docId 顺序收集各段的文档列表后重新写入，已删除的文档不再写入
+func (pfi *profileindex) mergeTermPostings(profileindexs []*profileindex, idxFd utils.File, offset uint64,
+	delDocSet map[uint64]struct{}) error {
+
+	postings := make(map[string][]uint64)
+	for _, p := range profileindexs {
+		if p.btree == nil {
+			continue
+		}
+		pfiMmap := p.acquire()
+		if pfiMmap == nil {
+			continue
+		}
+		p.btree.ForEach(p.fieldName, func(key []byte, value string) error {
+			off, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			lens := pfiMmap.ReadInt64(int64(off))
+			for _, docId := range pfiMmap.ReadIdsArray(off+8, int(lens)) {
+				if _, ok := delDocSet[docId]; !ok {
+					postings[string(key)] = append(postings[string(key)], docId)
+				}
+			}
+			return nil
+		})
+		p.pfiFile.release()
+	}
+
+	termNodes, err := pfi.writeTermPostings(idxFd, postings, offset)
+	if err != nil {
+		return err
+	}
+	if err := pfi.btree.SetBatchString(pfi.fieldName, termNodes); err != nil {
+		return err
+	}
+	pfi.memoryTermMap = nil
+	pfi.isMemory = false
+	return nil
+}
+
+// queryTermRange 查询 IP 地址在 [keyMin, keyMax] 范围内的文档，按字节序比较
+func (pfi *profileindex) queryTermRange(keyMin, keyMax string) ([]uint64, bool) {
+
+	res := make([]uint64, 0)
+	if keyMin > keyMax {
+		return res, true
+	}
+	if pfi.isMemory {
+		for k, v := range pfi.memoryTermMap {
+			if k >= keyMin && k <= keyMax {
+				res = append(res, v...)
+			}
+		}
+		return res, true
+	} else if pfiMmap := pfi.acquire(); pfiMmap != nil {
+		defer pfi.pfiFile.release()
+		ok, offsets := pfi.btree.SearchRangeString(pfi.fieldName, keyMin, keyMax)
+		if !ok {
+			return nil, false
+		}
+		for _, offset := range offsets {
+			lens := pfiMmap.ReadInt64(int64(offset))
+			res = append(res, pfiMmap.ReadIdsArray(offset+8, int(lens))...)
+		}
+		return res, true
+	}
+	return nil, false
+}
@@ -12,18 +12,30 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"sync"
 )
 
 type Segment struct {
-	StartDocId  uint64            `json:"startDocId"`  // 段内docId的最小值
-	MaxDocId    uint64            `json:"maxDocId"`    // 段内docId的最大值
-	SegmentName string            `json:"segmentName"` // 段的名称，序列化时文件名的一部分
-	FieldInfos  map[string]uint64 `json:"fields"`      // 记录段内字段的类型信息
+	StartDocId  uint64            `json:"startDocId"`          // 段内docId的最小值
+	MaxDocId    uint64            `json:"maxDocId"`            // 段内docId的最大值
+	SegmentName string            `json:"segmentName"`         // 段的名称，序列化时文件名的一部分
+	FieldInfos  map[string]uint64 `json:"fields"`              // 记录段内字段的类型信息
+	SubFields   map[string]string `json:"subFields,omitempty"` // 子字段对应的父字段，子字段只建索引，值从父字段读取
+	Codec       string            `json:"codec"`               // 字段内容的压缩方式，为空表示不压缩
+	Analyzer    string            `json:"analyzer,omitempty"`  // 切词匹配字段的分词器，为空表示 gse
+	Version     uint32            `json:"version"`             // 段文件的格式版本，旧版本的段为 0
+	BtChecksum  uint32            `json:"btChecksum"`          // seg.bt 的 crc32，boltdb 文件不能追加尾部信息，记录在元信息中
 	Logger      *utils.Log4FE     `json:"-"`
 	fields      map[string]*Field // 段内字段的
 	isMemory    bool              // 标识段是否在内存中
 	btdb        *tree.BTreeDB     // 段的数据库，用于存储各字段的正排索引
+	dir         utils.Directory   // 段文件所在的目录
+	loadErr     error             // 加载元信息或字段文件尾部时的错误，检查段时报告
+	memoryBytes int64             // 内存段中写入的字段内容的字节数
+	refMutex    sync.Mutex        // 保护 refs、retired 和 destroy
+	refs        int               // 正在读取段的搜索数
+	retired     bool              // 段已被移出段列表，最后一个读取方结束时关闭
+	destroy     bool              // 关闭时同时删除段文件
 }
 
 // NewEmptySegmentByFieldsInfo
@@ -31,8 +43,9 @@ type Segment struct {
 // @Param segmentName  段名
 // @Param start  文档起始Id
 // @Param fields  字段信息
+// @Param dir  段文件所在的目录
 // @Return 新建的段
-func NewEmptySegmentByFieldsInfo(segmentName string, start uint64, fields map[string]uint64, logger *utils.Log4FE) *Segment {
+func NewEmptySegmentByFieldsInfo(segmentName string, start uint64, fields map[string]uint64, dir utils.Directory, logger *utils.Log4FE) *Segment {
 	seg := &Segment{
 		StartDocId:  start,
 		MaxDocId:    start,
@@ -42,10 +55,11 @@ func NewEmptySegmentByFieldsInfo(segmentName string, start uint64, fields map[st
 		fields:      make(map[string]*Field),
 		isMemory:    true,
 		btdb:        nil,
+		dir:         dir,
 	}
 
 	for fieldName, fieldType := range fields {
-		f := newEmptyField(fieldName, start, fieldType, logger)
+		f := newEmptyField(fieldName, start, fieldType, dir, logger)
 		seg.fields[fieldName] = f
 	}
 
@@ -55,8 +69,9 @@ func NewEmptySegmentByFieldsInfo(segmentName string, start uint64, fields map[st
 // NewSegmentFromLocalFile
 // @Description 反序列化段
 // @Param segmentName  段名
+// @Param dir  段文件所在的目录
 // @Return 反序列化的段
-func NewSegmentFromLocalFile(segmentName string, logger *utils.Log4FE) *Segment {
+func NewSegmentFromLocalFile(segmentName string, dir utils.Directory, logger *utils.Log4FE) *Segment {
 
 	seg := &Segment{
 		StartDocId:  0,
@@ -67,51 +82,182 @@ func NewSegmentFromLocalFile(segmentName string, logger *utils.Log4FE) *Segment
 		fields:      make(map[string]*Field),
 		isMemory:    false,
 		btdb:        nil,
+		dir:         dir,
 	}
 
 	metaFileName := fmt.Sprintf("%v%v", segmentName, "seg.meta")
-	buf, err := utils.ReadFromJson(metaFileName)
+	buf, err := utils.ReadFromJsonIn(dir, metaFileName)
 
 	if err != nil {
+		seg.loadErr = err
+		logger.Error("[ERROR] Load Segment %v Meta Error : %v", segmentName, err)
 		return seg
 	}
 
 	err = json.Unmarshal(buf, &seg)
 	if err != nil {
+		seg.loadErr = err
+		logger.Error("[ERROR] Load Segment %v Meta Error : %v", segmentName, err)
 		return seg
 	}
+	// 元信息中记录的是写入时的路径，数据目录移动后以加载的路径为准
+	seg.SegmentName = segmentName
 
-	btdbName := fmt.Sprintf("%v%v", segmentName, "seg.bt")
-	if utils.Exist(btdbName) {
-		seg.btdb = tree.NewBTDB(btdbName, logger)
+	if seg.Version > FORMAT_VERSION {
+		seg.loadErr = fmt.Errorf("unsupported format version %v, max supported %v", seg.Version, FORMAT_VERSION)
+		logger.Error("[ERROR] Load Segment %v Error : %v", segmentName, seg.loadErr)
+		return seg
+	}
+
+	if dir.Exist(seg.btdbFileName()) {
+		seg.btdb = seg.openBtree()
 	}
 
 	for name := range seg.FieldInfos {
-		nowField := newFieldFromLocalFile(name, segmentName, seg.StartDocId, seg.MaxDocId, seg.FieldInfos[name], seg.btdb, seg.Logger)
+		_, indexOnly := seg.SubFields[name]
+		nowField, err := newFieldFromLocalFile(name, segmentName, seg.StartDocId, seg.MaxDocId, seg.FieldInfos[name], seg.Version, indexOnly, seg.btdb, dir, seg.Logger)
+		if err != nil && seg.loadErr == nil {
+			seg.loadErr = err
+		}
+		nowField.setCodec(seg.Codec)
 		seg.fields[name] = nowField
 	}
+	for sub, parent := range seg.SubFields {
+		if field, ok := seg.fields[sub]; ok {
+			field.source = seg.fields[parent]
+		}
+	}
 
 	return seg
 }
 
 // AddField
-// @Description 添加字段
+// @Description 添加字段，内存段中已有的文档在新字段中为空值
 // @Param newField  字段信息
 // @Return 任何错误
 func (seg *Segment) AddField(newField SimpleFieldInfo) error {
+	return seg.addField(newField, "")
+}
+
+// AddSubField
+// @Description 添加子字段，子字段只建索引不存储内容，值从父字段读取
+// @Param newField 子字段信息
+// @Param parent 父字段名，需要已经在段中
+// @Return error 任何错误
+func (seg *Segment) AddSubField(newField SimpleFieldInfo, parent string) error {
+	if _, ok := seg.fields[parent]; !ok {
+		return fmt.Errorf("segment doesn't has field %v", parent)
+	}
+	return seg.addField(newField, parent)
+}
+
+// addField 添加字段，parent 不为空时作为 parent 的子字段
+func (seg *Segment) addField(newField SimpleFieldInfo, parent string) error {
 	if _, ok := seg.FieldInfos[newField.FieldName]; ok {
 		seg.Logger.Warn("[WARN] Segment has field [%v]", newField.FieldName)
 		return errors.New("segment has field")
 	}
-	if seg.isMemory && !seg.IsEmpty() {
-		seg.Logger.Warn("[WARN] Segment has field [%v]", newField.FieldName)
-		return errors.New("segment can't add field")
+	if !seg.isMemory {
+		seg.Logger.Warn("[WARN] Segment can't add field [%v]", newField.FieldName)
+		return errors.New("segment is already serialized")
+	}
+
+	f := newEmptyField(newField.FieldName, seg.StartDocId, newField.FieldType, seg.dir, seg.Logger)
+	f.setCodec(seg.Codec)
+	f.setAnalyzer(seg.Analyzer)
+	if parent != "" {
+		f.setSource(seg.fields[parent])
+	}
+	for docId := seg.StartDocId; docId < seg.MaxDocId; docId++ {
+		if err := f.addDocument(docId, ""); err != nil {
+			return err
+		}
+	}
+
+	// 复制后整体替换，不加锁读取文档的请求仍然使用原来的字段
+	fields := make(map[string]*Field, len(seg.fields)+1)
+	for name, field := range seg.fields {
+		fields[name] = field
+	}
+	fields[newField.FieldName] = f
+	fieldInfos := make(map[string]uint64, len(seg.FieldInfos)+1)
+	for name, fieldType := range seg.FieldInfos {
+		fieldInfos[name] = fieldType
+	}
+	fieldInfos[newField.FieldName] = newField.FieldType
+	if parent != "" {
+		subFields := make(map[string]string, len(seg.SubFields)+1)
+		for sub, p := range seg.SubFields {
+			subFields[sub] = p
+		}
+		subFields[newField.FieldName] = parent
+		seg.SubFields = subFields
+	}
+	seg.fields = fields
+	seg.FieldInfos = fieldInfos
+
+	return nil
+}
+
+// SetCodec
+// @Description 设置字段内容的压缩方式，只能在段写入磁盘前设置
+// @Param codec 压缩方式
+// @Return error 任何错误
+func (seg *Segment) SetCodec(codec string) error {
+	if !IsValidCodec(codec) {
+		return fmt.Errorf("unknown codec %v", codec)
+	}
+	if !seg.isMemory {
+		return errors.New("segment is already serialized")
+	}
+	if codec == CODEC_NONE {
+		codec = ""
+	}
+
+	seg.Codec = codec
+	for _, field := range seg.fields {
+		field.setCodec(codec)
+	}
+	return nil
+}
+
+// SetSubFields
+// @Description 设置子字段对应的父字段，只能在段写入文档前设置，段中没有的字段忽略
+// @Param subFields 子字段名到父字段名的映射
+// @Return error 任何错误
+func (seg *Segment) SetSubFields(subFields map[string]string) error {
+	if !seg.isMemory || !seg.IsEmpty() {
+		return errors.New("segment already has documents")
+	}
+
+	seg.SubFields = make(map[string]string, len(subFields))
+	for sub, parent := range subFields {
+		field, ok := seg.fields[sub]
+		if _, hasParent := seg.fields[parent]; !ok || !hasParent {
+			continue
+		}
+		field.setSource(seg.fields[parent])
+		seg.SubFields[sub] = parent
 	}
+	return nil
+}
 
-	f := newEmptyField(newField.FieldName, seg.StartDocId, newField.FieldType, seg.Logger)
-	seg.FieldInfos[newField.FieldName] = newField.FieldType
-	seg.fields[newField.FieldName] = f
+// SetAnalyzer
+// @Description 设置切词匹配字段的分词器，只能在段写入磁盘前设置
+// @Param analyzer 分词器名称
+// @Return error 任何错误
+func (seg *Segment) SetAnalyzer(analyzer string) error {
+	if !utils.IsValidAnalyzer(analyzer) {
+		return fmt.Errorf("unknown analyzer %v", analyzer)
+	}
+	if !seg.isMemory {
+		return errors.New("segment is already serialized")
+	}
 
+	seg.Analyzer = analyzer
+	for _, field := range seg.fields {
+		field.setAnalyzer(analyzer)
+	}
 	return nil
 }
 
@@ -134,6 +280,13 @@ func (seg *Segment) DeleteField(fieldName string) error {
 	seg.fields[fieldName].destroy()
 	delete(seg.FieldInfos, fieldName)
 	delete(seg.fields, fieldName)
+	delete(seg.SubFields, fieldName)
+	for sub, parent := range seg.SubFields {
+		if parent == fieldName {
+			seg.fields[sub].source = nil
+			delete(seg.SubFields, sub)
+		}
+	}
 
 	seg.Logger.Info("[INFO] Segment DeleteField %v", fieldName)
 
@@ -164,6 +317,7 @@ func (seg *Segment) AddDocument(docId uint64, content map[string]string) error {
 		if err := seg.fields[name].addDocument(docId, content[name]); err != nil {
 			seg.Logger.Error("[ERROR] Segment AddDocument :: field[%v] value[%v] error[%v]", name, content[name], err)
 		}
+		seg.memoryBytes += int64(len(content[name]))
 	}
 
 	seg.MaxDocId++
@@ -191,6 +345,112 @@ func (seg *Segment) GetDocument(docId uint64) (map[string]string, bool) {
 
 }
 
+// GetValue
+// @Description 获取文档某个字段的值
+// @Param docId 文档ID
+// @Param fieldName 字段名
+// @Return string 字段的值
+// @Return bool 是否找到
+func (seg *Segment) GetValue(docId uint64, fieldName string) (string, bool) {
+	field, ok := seg.fields[fieldName]
+	if !ok || docId < seg.StartDocId || docId >= seg.MaxDocId {
+		return "", false
+	}
+	return field.getValue(docId)
+}
+
+// NumericValue
+// @Description 获取数字类字段的原始值，优先读取列式存储，用于排序
+// @Param docId 文档ID
+// @Param fieldName 字段名
+// @Return int64 原始值，空值为 -1
+// @Return bool 是否找到
+func (seg *Segment) NumericValue(docId uint64, fieldName string) (int64, bool) {
+	field, ok := seg.fields[fieldName]
+	if !ok {
+		return -1, false
+	}
+	return field.numericValue(docId)
+}
+
+// HasValue
+// @Description 判断文档在字段中是否有值，用于区分空值和值为 -1 等合法的值
+// @Param docId 文档ID
+// @Param fieldName 字段名
+// @Return bool 是否有值，段中没有该字段时为 false
+func (seg *Segment) HasValue(docId uint64, fieldName string) bool {
+	field, ok := seg.fields[fieldName]
+	if !ok {
+		return false
+	}
+	return field.hasValue(docId)
+}
+
+// KeywordValue
+// @Description 获取关键词字段的值，优先读取列式存储，用于排序和折叠
+// @Param docId 文档ID
+// @Param fieldName 字段名
+// @Return string 字段的值
+// @Return bool 是否找到
+func (seg *Segment) KeywordValue(docId uint64, fieldName string) (string, bool) {
+	field, ok := seg.fields[fieldName]
+	if !ok {
+		return "", false
+	}
+	return field.keywordValue(docId)
+}
+
+// FacetCounts
+// @Description 统计段内文档某个字段各个值出现的次数，关键词字段先按序号计数再转换为字符串，空值不统计
+// @Param fieldName 字段名
+// @Param docIds 段内的文档
+// @Param counts 统计结果，累加到其中
+func (seg *Segment) FacetCounts(fieldName string, docIds []uint64, counts map[string]int) {
+	field, ok := seg.fields[fieldName]
+	if !ok {
+		return
+	}
+
+	if field.dv != nil && field.dv.kind == DV_SORTED {
+		ordCounts := make(map[uint64]int)
+		for _, docId := range docIds {
+			if docId >= field.startDocId && docId < field.maxDocId {
+				ordCounts[field.dv.ord(docId-field.startDocId)]++
+			}
+		}
+		for ord, count := range ordCounts {
+			if ord != 0 {
+				counts[formatTerm(field.fieldType, field.dv.term(ord))] += count
+			}
+		}
+		return
+	}
+
+	switch field.fieldType {
+	case utils.IDX_TYPE_NUMBER, utils.IDX_TYPE_DATE, utils.IDX_TYPE_FLOAT, utils.IDX_TYPE_DOUBLE, utils.IDX_TYPE_DATETIME, utils.IDX_TYPE_BOOL:
+		valueCounts := make(map[int64]int)
+		for _, docId := range docIds {
+			if !field.hasValue(docId) {
+				continue
+			}
+			if value, ok := field.numericValue(docId); ok {
+				valueCounts[value]++
+			}
+		}
+		for value, count := range valueCounts {
+			if str, ok := FormatNumber(field.fieldType, value); ok {
+				counts[str] += count
+			}
+		}
+	default:
+		for _, docId := range docIds {
+			if value, ok := field.keywordValue(docId); ok && value != "" {
+				counts[formatTerm(field.fieldType, value)]++
+			}
+		}
+	}
+}
+
 // SearchDocIds
 // @Description 搜索段的方法
 // @Param query 查询结构体
@@ -205,10 +465,12 @@ func (seg *Segment) SearchDocIds(query utils.SearchQuery,
 	var docIds []utils.DocIdNode
 	var ok bool
 
-	if query.Value == "" {
+	// 字段在段写入之后才新增时，段内没有该字段
+	field, hasField := seg.fields[query.FieldName]
+	if query.Value == "" || !hasField {
 		return nowDocNodes, false
 	} else {
-		docIds, ok = seg.fields[query.FieldName].query(query.Value)
+		docIds, ok = field.query(query.Value)
 		if !ok {
 			return nowDocNodes, false
 		}
@@ -242,11 +504,12 @@ func (seg *Segment) SearchDocIdsSync(query utils.SearchQuery,
 	returnDocIds := make([]utils.DocIdNode, 0)
 	var ok bool
 
-	if query.Value == "" {
+	field, hasField := seg.fields[query.FieldName]
+	if query.Value == "" || !hasField {
 		utils.DocIdChan <- make([]utils.DocIdNode, 0)
 		return
 	} else {
-		docIds, ok = seg.fields[query.FieldName].query(query.Value)
+		docIds, ok = field.query(query.Value)
 		if !ok {
 			utils.DocIdChan <- make([]utils.DocIdNode, 0)
 			return
@@ -273,13 +536,18 @@ func (seg *Segment) SearchDocFilter(filter utils.SearchFilters, bitmap *utils.Bi
 	// 倒排查询的 ID 切片
 	var docIds []uint64
 
-	if _, ok := seg.fields[filter.FieldName]; !ok {
-		return nowDocIds, false
-	}
-
-	docIds, ok := seg.fields[filter.FieldName].queryFilter(filter)
-	if !ok {
+	field, hasField := seg.fields[filter.FieldName]
+	switch {
+	case filter.Type == utils.FILT_EXISTS || filter.Type == utils.FILT_MISSING:
+		docIds = seg.existsDocIds(field, filter.Type == utils.FILT_EXISTS)
+	case !hasField:
 		return nowDocIds, false
+	default:
+		var ok bool
+		docIds, ok = field.queryFilter(filter)
+		if !ok {
+			return nowDocIds, false
+		}
 	}
 
 	// bitmap去除被删除的文档
@@ -296,15 +564,28 @@ func (seg *Segment) SearchDocFilter(filter utils.SearchFilters, bitmap *utils.Bi
 
 }
 
+// existsDocIds 段内字段有值或没有值的文档，段中没有该字段时所有文档都没有值
+func (seg *Segment) existsDocIds(field *Field, exists bool) []uint64 {
+	if field != nil {
+		return field.existsDocIds(exists)
+	}
+	docIds := make([]uint64, 0)
+	if !exists {
+		for docId := seg.StartDocId; docId < seg.MaxDocId; docId++ {
+			docIds = append(docIds, docId)
+		}
+	}
+	return docIds
+}
+
 // Serialization
 // @Description 序列化段
 // @Return 任何error
 func (seg *Segment) Serialization() error {
-	os.MkdirAll(fmt.Sprintf(seg.SegmentName), 0755)
+	seg.dir.MkdirAll(fmt.Sprintf(seg.SegmentName))
 
-	btdbName := fmt.Sprintf("%v%v", seg.SegmentName, "seg.bt")
 	if seg.btdb == nil {
-		seg.btdb = tree.NewBTDB(btdbName, seg.Logger)
+		seg.btdb = seg.openBtree()
 	}
 	seg.Logger.Debug("[INFO] Serialization Segment : [%v] start", seg.SegmentName)
 
@@ -315,6 +596,9 @@ func (seg *Segment) Serialization() error {
 		}
 	}
 
+	if err := seg.checksumBtree(); err != nil {
+		return err
+	}
 	if err := seg.storeSegment(); err != nil {
 		return err
 	}
@@ -358,13 +642,62 @@ func (seg *Segment) Destroy() error {
 	dirName := fmt.Sprintf("%v", seg.SegmentName)
 	// fmt.Println(dirName)
 
-	err := os.RemoveAll(dirName)
+	err := seg.dir.RemoveAll(dirName)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// Acquire
+// @Description 读取段之前增加引用计数，段被移出段列表后等引用全部释放才关闭
+func (seg *Segment) Acquire() {
+	seg.refMutex.Lock()
+	seg.refs++
+	seg.refMutex.Unlock()
+}
+
+// Release
+// @Description 读取结束后减少引用计数，段已被移出段列表时由最后一个读取方关闭
+func (seg *Segment) Release() {
+	seg.refMutex.Lock()
+	seg.refs--
+	done := seg.retired && seg.refs == 0
+	seg.refMutex.Unlock()
+
+	if done {
+		seg.shutdown()
+	}
+}
+
+// Retire
+// @Description 段被移出段列表后调用，没有正在进行的读取时立即关闭，否则由最后一个读取方关闭
+// @Param destroy 关闭时是否同时删除段文件
+func (seg *Segment) Retire(destroy bool) {
+	seg.refMutex.Lock()
+	seg.retired = true
+	seg.destroy = destroy
+	done := seg.refs == 0
+	seg.refMutex.Unlock()
+
+	if done {
+		seg.shutdown()
+	}
+}
+
+// shutdown 关闭或删除已经移出段列表的段
+func (seg *Segment) shutdown() {
+	var err error
+	if seg.destroy {
+		err = seg.Destroy()
+	} else {
+		err = seg.Close()
+	}
+	if err != nil {
+		seg.Logger.Error("[ERROR] Retire Segment %v Error : %v", seg.SegmentName, err)
+	}
+}
+
 // IsEmpty
 // @Description 判断是否是空段
 // @Return 如果是空段就返回 true
@@ -372,6 +705,13 @@ func (seg *Segment) IsEmpty() bool {
 	return seg.StartDocId == seg.MaxDocId
 }
 
+// MemoryBytes
+// @Description 内存段中写入的字段内容的字节数，用于按大小持久化内存段
+// @Return int64 字节数
+func (seg *Segment) MemoryBytes() int64 {
+	return seg.memoryBytes
+}
+
 // MergeSegments
 // @Description 合并段
 // @Param sgs  需要合并的段
@@ -379,9 +719,8 @@ func (seg *Segment) IsEmpty() bool {
 func (seg *Segment) MergeSegments(sgs []*Segment, delDocSet map[uint64]struct{}) error {
 	seg.Logger.Info("[INFO] MergeSegments [%v] Start", seg.SegmentName)
 
-	btdbName := fmt.Sprintf("%v%v", seg.SegmentName, "seg.bt")
 	if seg.btdb == nil {
-		seg.btdb = tree.NewBTDB(btdbName, seg.Logger)
+		seg.btdb = seg.openBtree()
 	}
 
 	for name, _ := range seg.FieldInfos {
@@ -400,13 +739,63 @@ func (seg *Segment) MergeSegments(sgs []*Segment, delDocSet map[uint64]struct{})
 	seg.isMemory = false
 	seg.MaxDocId = sgs[len(sgs)-1].MaxDocId
 
+	if err := seg.checksumBtree(); err != nil {
+		return err
+	}
 	return seg.storeSegment()
 }
 
+// checksumBtree 所有字段写完后记录格式版本和 seg.bt 的校验值
+func (seg *Segment) checksumBtree() error {
+	seg.Version = FORMAT_VERSION
+	seg.BtChecksum = 0
+
+	btdbName := seg.btdbFileName()
+	if !seg.dir.Exist(btdbName) {
+		return nil
+	}
+	checksum, err := fileChecksum(seg.dir, btdbName, -1)
+	if err != nil {
+		return err
+	}
+	seg.BtChecksum = checksum
+	return nil
+}
+
+// verifyBtree 校验 seg.bt，旧版本的段没有记录校验值
+func (seg *Segment) verifyBtree() error {
+	if seg.Version == 0 {
+		return nil
+	}
+	checksum, err := fileChecksum(seg.dir, seg.btdbFileName(), -1)
+	if err != nil {
+		return err
+	}
+	if checksum != seg.BtChecksum {
+		return fmt.Errorf("seg.bt checksum mismatch, expected %08x got %08x", seg.BtChecksum, checksum)
+	}
+	return nil
+}
+
+// btdbFileName seg.bt 在目录中的文件名
+func (seg *Segment) btdbFileName() string {
+	return fmt.Sprintf("%v%v", seg.SegmentName, "seg.bt")
+}
+
+// openBtree 打开 seg.bt，boltdb 需要本地文件，通过目录取得本地路径
+func (seg *Segment) openBtree() *tree.BTreeDB {
+	path, err := seg.dir.LocalPath(seg.btdbFileName())
+	if err != nil {
+		seg.Logger.Error("[ERROR] Segment %v Open seg.bt Error : %v", seg.SegmentName, err)
+		return nil
+	}
+	return tree.NewBTDB(path, seg.Logger)
+}
+
 // 内部方法
 func (seg *Segment) storeSegment() error {
 	metaFileName := fmt.Sprintf("%v%v.meta", seg.SegmentName, "seg")
-	if err := utils.WriteToJson(seg, metaFileName); err != nil {
+	if err := utils.WriteToJsonIn(seg.dir, seg, metaFileName); err != nil {
 		return err
 	}
 	return nil
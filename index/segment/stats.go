@@ -0,0 +1,105 @@
+/**
+ * @Note 段和字段的统计信息
+ **/
+
+package segment
+
+import (
+	"GoDance/utils"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// FieldStats 字段的统计信息
+type FieldStats struct {
+	Name  string `json:"name"`
+	Type  uint64 `json:"type"`
+	Terms uint64 `json:"terms"` // 倒排索引中的词数，数字字段为不同取值的个数
+	Bytes int64  `json:"bytes"` // 字段文件占用的磁盘空间
+}
+
+// SegmentStats 段的统计信息
+type SegmentStats struct {
+	Name        string       `json:"name"`
+	StartDocId  uint64       `json:"startDocId"`
+	MaxDocId    uint64       `json:"maxDocId"`
+	DocCount    uint64       `json:"docCount"`    // 未删除的文档数
+	DeletedDocs uint64       `json:"deletedDocs"` // 已标记删除但还未合并清理的文档数
+	IsMemory    bool         `json:"isMemory"`
+	Codec       string       `json:"codec"`
+	Version     uint32       `json:"version"` // 段文件的格式版本
+	Bytes       int64        `json:"bytes"`   // 段目录占用的磁盘空间
+	Fields      []FieldStats `json:"fields"`
+}
+
+// Stats
+// @Description 统计段的文档数、磁盘占用和各字段的词数
+// @Param bitmap 索引的删除标记
+// @Return SegmentStats 统计信息
+func (seg *Segment) Stats(bitmap *utils.Bitmap) SegmentStats {
+	stats := SegmentStats{
+		Name:       seg.SegmentName,
+		StartDocId: seg.StartDocId,
+		MaxDocId:   seg.MaxDocId,
+		IsMemory:   seg.isMemory,
+		Codec:      seg.Codec,
+		Version:    seg.Version,
+		Fields:     make([]FieldStats, 0, len(seg.fields)),
+	}
+	if bitmap != nil {
+		stats.DeletedDocs = bitmap.Count(seg.StartDocId, seg.MaxDocId)
+	}
+	stats.DocCount = seg.MaxDocId - seg.StartDocId - stats.DeletedDocs
+
+	for name, field := range seg.fields {
+		fieldStats := FieldStats{Name: name, Type: seg.FieldInfos[name], Terms: field.termCount()}
+		if !seg.isMemory {
+			fieldStats.Bytes = field.fileBytes(seg.SegmentName)
+		}
+		stats.Fields = append(stats.Fields, fieldStats)
+	}
+	sort.Slice(stats.Fields, func(i, j int) bool { return stats.Fields[i].Name < stats.Fields[j].Name })
+
+	if !seg.isMemory {
+		names, _ := seg.dir.List(seg.SegmentName)
+		for _, name := range names {
+			if size, err := seg.dir.FileSize(filepath.Join(seg.SegmentName, name)); err == nil {
+				stats.Bytes += size
+			}
+		}
+	}
+	return stats
+}
+
+// termCount 倒排索引的词数或数字字段不同取值的个数
+func (f *Field) termCount() uint64 {
+	if f.ivt != nil {
+		if f.ivt.isMemory {
+			return uint64(len(f.ivt.memoryHashMap))
+		}
+		if f.ivt.fst != nil {
+			return uint64(f.ivt.fst.Len())
+		}
+	}
+	if f.pfi != nil {
+		if f.pfi.isMemory {
+			return uint64(len(f.pfi.memoryHashMap))
+		}
+		if f.pfi.btree != nil {
+			return uint64(f.pfi.btree.KeyCount(f.fieldName))
+		}
+	}
+	return 0
+}
+
+// fileBytes 字段文件占用的磁盘空间
+func (f *Field) fileBytes(segmentName string) int64 {
+	var bytes int64
+	for _, suffix := range f.fileSuffixes() {
+		if size, err := f.dir.FileSize(fmt.Sprintf("%v%v%v", segmentName, f.fieldName, suffix)); err == nil {
+			bytes += size
+		}
+	}
+	return bytes
+}
@@ -0,0 +1,257 @@
+/**
+ * @Note 字段内容文件 _detail.dtl 的写入与按块压缩
+ **/
+
+package segment
+
+import (
+	"GoDance/utils"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+// 字段内容的压缩方式
+const (
+	CODEC_NONE   = "none"   // 不压缩，每个文档一条 [len][value]
+	CODEC_SNAPPY = "snappy" // 按块使用 snappy 压缩
+)
+
+const (
+	dtlBlockSize     = 16 << 10 // 每个块压缩前的目标大小
+	dtlBlockHeadSize = 16       // 块头: 块内第一个文档的位置、压缩后的长度
+	blockCacheSize   = 256      // 缓存解压后的块的个数
+)
+
+// IsValidCodec 判断压缩方式是否支持，空字符串等同于不压缩
+func IsValidCodec(codec string) bool {
+	return codec == "" || codec == CODEC_NONE || codec == CODEC_SNAPPY
+}
+
+// isCompressed 判断压缩方式是否需要按块读取
+func isCompressed(codec string) bool {
+	return codec == CODEC_SNAPPY
+}
+
+// dtlWriter 顺序写入字段内容，返回每个文档写入正排文件的偏移
+//
+//	不压缩: 偏移指向 [len][value]
+//	压缩: 偏移指向所在的块 [firstPos][compressedLen][snappy(offsets + [len][value]...)]
+//
+// 块内的 offsets 是每条记录相对于解压后内容起点的偏移，个数为 offsets[0] / 8
+type dtlWriter struct {
+	fd       utils.File
+	codec    string
+	offset   int64
+	firstPos uint64
+	values   []string
+	buffered int
+}
+
+func newDtlWriter(dir utils.Directory, fileName, codec string) (*dtlWriter, error) {
+	fd, err := dir.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND)
+	if err != nil {
+		return nil, err
+	}
+	size, err := fd.Size()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return &dtlWriter{fd: fd, codec: codec, offset: size}, nil
+}
+
+// add 写入第 pos 个文档的内容
+func (w *dtlWriter) add(pos uint64, value string) (int64, error) {
+	if !isCompressed(w.codec) {
+		offset := w.offset
+		lenBuffer := make([]byte, 8)
+		binary.LittleEndian.PutUint64(lenBuffer, uint64(len(value)))
+		if _, err := w.fd.Write(lenBuffer); err != nil {
+			return offset, err
+		}
+		if _, err := w.fd.Write([]byte(value)); err != nil {
+			return offset, err
+		}
+		w.offset += int64(len(value)) + 8
+		return offset, nil
+	}
+
+	if len(w.values) == 0 {
+		w.firstPos = pos
+	}
+	w.values = append(w.values, value)
+	w.buffered += len(value) + 16
+	// 块写入前 offset 不变，即为当前块的偏移
+	offset := w.offset
+	if w.buffered >= dtlBlockSize {
+		return offset, w.flush()
+	}
+	return offset, nil
+}
+
+// flush 压缩并写入缓存的块
+func (w *dtlWriter) flush() error {
+	if len(w.values) == 0 {
+		return nil
+	}
+
+	count := len(w.values)
+	raw := make([]byte, count*8, w.buffered)
+	lenBuffer := make([]byte, 8)
+	for i, value := range w.values {
+		binary.LittleEndian.PutUint64(raw[i*8:], uint64(len(raw)))
+		binary.LittleEndian.PutUint64(lenBuffer, uint64(len(value)))
+		raw = append(raw, lenBuffer...)
+		raw = append(raw, value...)
+	}
+	compressed := snappy.Encode(nil, raw)
+
+	head := make([]byte, dtlBlockHeadSize)
+	binary.LittleEndian.PutUint64(head, w.firstPos)
+	binary.LittleEndian.PutUint64(head[8:], uint64(len(compressed)))
+	if _, err := w.fd.Write(head); err != nil {
+		return err
+	}
+	if _, err := w.fd.Write(compressed); err != nil {
+		return err
+	}
+
+	w.offset += dtlBlockHeadSize + int64(len(compressed))
+	w.values = w.values[:0]
+	w.buffered = 0
+	return nil
+}
+
+func (w *dtlWriter) close() error {
+	err := w.flush()
+	if cerr := w.fd.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readBlockValue 从压缩块中读取第 pos 个文档的内容
+func readBlockValue(dtlMmap *utils.Mmap, blockOffset int64, pos uint64) (string, error) {
+	block, err := loadBlock(dtlMmap, blockOffset)
+	if err != nil {
+		return "", err
+	}
+
+	firstPos := dtlMmap.ReadUInt64(uint64(blockOffset))
+	if len(block) < 8 || pos < firstPos {
+		return "", errors.New("stored fields block mismatch")
+	}
+	index := pos - firstPos
+	count := binary.LittleEndian.Uint64(block) / 8
+	if index >= count {
+		return "", errors.New("stored fields block mismatch")
+	}
+
+	start := binary.LittleEndian.Uint64(block[index*8:])
+	if start+8 > uint64(len(block)) {
+		return "", errors.New("stored fields block is corrupted")
+	}
+	lens := binary.LittleEndian.Uint64(block[start:])
+	if start+8+lens > uint64(len(block)) {
+		return "", errors.New("stored fields block is corrupted")
+	}
+	return string(block[start+8 : start+8+lens]), nil
+}
+
+// loadBlock 读取并解压一个块，优先从缓存中获取
+func loadBlock(dtlMmap *utils.Mmap, blockOffset int64) ([]byte, error) {
+	key := blockKey{dtlMmap: dtlMmap, offset: blockOffset}
+	if block, ok := defaultBlockCache.get(key); ok {
+		return block, nil
+	}
+
+	if blockOffset < 0 || blockOffset+dtlBlockHeadSize > dtlMmap.FileLen {
+		return nil, fmt.Errorf("stored fields block offset %v out of range", blockOffset)
+	}
+	compressedLen := int64(dtlMmap.ReadUInt64(uint64(blockOffset + 8)))
+	start := blockOffset + dtlBlockHeadSize
+	if compressedLen < 0 || start+compressedLen > dtlMmap.FileLen {
+		return nil, fmt.Errorf("stored fields block at %v is corrupted", blockOffset)
+	}
+
+	block, err := snappy.Decode(nil, dtlMmap.Read(start, start+compressedLen))
+	if err != nil {
+		return nil, err
+	}
+	defaultBlockCache.put(key, block)
+	return block, nil
+}
+
+// blockCache 解压后的块的 LRU 缓存，所有段共用
+type blockCache struct {
+	mutex    sync.Mutex
+	capacity int
+	items    map[blockKey]*list.Element
+	order    *list.List
+}
+
+type blockKey struct {
+	dtlMmap *utils.Mmap
+	offset  int64
+}
+
+type blockEntry struct {
+	key   blockKey
+	block []byte
+}
+
+var defaultBlockCache = newBlockCache(blockCacheSize)
+
+func newBlockCache(capacity int) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		items:    make(map[blockKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *blockCache) get(key blockKey) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*blockEntry).block, true
+	}
+	return nil, false
+}
+
+func (c *blockCache) put(key blockKey, block []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&blockEntry{key: key, block: block})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*blockEntry).key)
+	}
+}
+
+// evict 移除某个文件的所有缓存块，文件被回收时调用
+func (c *blockCache) evict(dtlMmap *utils.Mmap) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, elem := range c.items {
+		if key.dtlMmap == dtlMmap {
+			c.order.Remove(elem)
+			delete(c.items, key)
+		}
+	}
+}
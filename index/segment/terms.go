@@ -0,0 +1,192 @@
+/**
+ * @Note 按字典序遍历多个段中某个字段的词
+ **/
+
+package segment
+
+import (
+	"GoDance/utils"
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/blevesearch/vellum"
+)
+
+// TermsOptions 遍历词典的条件
+type TermsOptions struct {
+	Prefix         string // 词的前缀
+	From           string // 起始词，包含
+	To             string // 结束词，不包含
+	After          string // 分页游标，从该词之后开始
+	Size           int    // 返回的词数，小于等于 0 表示不限制
+	ExcludeDeleted bool   // 文档数中是否减去已删除的文档
+}
+
+// TermFreq 词以及包含该词的文档数
+type TermFreq struct {
+	Term    string `json:"term"`
+	DocFreq uint64 `json:"docFreq"`
+}
+
+// Terms
+// @Description 合并多个段的 fst 迭代器，按字典序返回字段中的词及其文档数
+// @Param segs 需要遍历的段，可以包含内存段
+// @Param fieldName 字段名
+// @Param opts 遍历条件
+// @Param bitmap 索引的删除标记，ExcludeDeleted 为 true 时使用
+// @Return []TermFreq 词及文档数
+// @Return bool 是否还有更多的词
+// @Return error 任何错误
+func Terms(segs []*Segment, fieldName string, opts TermsOptions, bitmap *utils.Bitmap) ([]TermFreq, bool, error) {
+	start, end := termsRange(opts)
+	if end != nil && bytes.Compare(start, end) >= 0 {
+		return []TermFreq{}, false, nil
+	}
+
+	var fstHeap FstHeap
+	heap.Init(&fstHeap)
+	for _, seg := range segs {
+		field, ok := seg.fields[fieldName]
+		if !ok || field.ivt == nil {
+			continue
+		}
+		node, err := field.ivt.termIterator(start, end)
+		if err != nil {
+			return nil, false, err
+		}
+		if node != nil {
+			heap.Push(&fstHeap, node)
+		}
+	}
+
+	res := make([]TermFreq, 0)
+	for fstHeap.Len() > 0 {
+		key := fstHeap[0].Key
+		var docFreq uint64
+		// 把所有段中相同的词合并
+		for fstHeap.Len() > 0 && fstHeap[0].Key == key {
+			node := heap.Pop(&fstHeap).(*FstNode)
+			docFreq += node.ivt.docFreq(node, opts.ExcludeDeleted, bitmap)
+			if node.Iter.Next() == nil {
+				next, _ := node.Iter.Current()
+				node.Key = string(next)
+				heap.Push(&fstHeap, node)
+			}
+		}
+
+		if docFreq == 0 {
+			continue
+		}
+		if opts.Size > 0 && len(res) == opts.Size {
+			return res, true, nil
+		}
+		res = append(res, TermFreq{Term: key, DocFreq: docFreq})
+	}
+	return res, false, nil
+}
+
+// termsRange 根据前缀、起止词和游标计算遍历的范围 [start, end)，end 为 nil 表示不限制
+func termsRange(opts TermsOptions) ([]byte, []byte) {
+	start := []byte(opts.From)
+	if opts.Prefix > opts.From {
+		start = []byte(opts.Prefix)
+	}
+	if opts.After != "" && opts.After >= string(start) {
+		start = append([]byte(opts.After), 0)
+	}
+
+	var end []byte
+	if opts.To != "" {
+		end = []byte(opts.To)
+	}
+	if prefixEnd := prefixSuccessor(opts.Prefix); prefixEnd != nil && (end == nil || bytes.Compare(prefixEnd, end) < 0) {
+		end = prefixEnd
+	}
+	return start, end
+}
+
+// prefixSuccessor 大于所有以 prefix 开头的词的最小值，不存在时返回 nil
+func prefixSuccessor(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// termIterator 创建 [start, end) 范围内的迭代器，范围内没有词时返回 nil
+// 内存中的倒排没有 fst，临时构建一个
+func (ivt *invert) termIterator(start, end []byte) (*FstNode, error) {
+	fst := ivt.fst
+	if ivt.isMemory {
+		if len(ivt.memoryHashMap) == 0 {
+			return nil, nil
+		}
+		keys := make([]string, 0, len(ivt.memoryHashMap))
+		for key := range ivt.memoryHashMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buffer := new(bytes.Buffer)
+		builder, err := vellum.New(buffer, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if err := builder.Insert([]byte(key), uint64(len(ivt.memoryHashMap[key]))); err != nil {
+				return nil, err
+			}
+		}
+		if err := builder.Close(); err != nil {
+			return nil, err
+		}
+		if fst, err = vellum.Load(buffer.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if fst == nil {
+		return nil, nil
+	}
+
+	iter, err := fst.Iterator(start, end)
+	if errors.Is(err, vellum.ErrIteratorDone) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("field %v iterator error : %v", ivt.fieldName, err)
+	}
+	key, _ := iter.Current()
+	return &FstNode{Key: string(key), ivt: ivt, Iter: iter}, nil
+}
+
+// docFreq 迭代器当前词的文档数
+func (ivt *invert) docFreq(node *FstNode, excludeDeleted bool, bitmap *utils.Bitmap) uint64 {
+	if !excludeDeleted || bitmap == nil {
+		if ivt.isMemory {
+			return uint64(len(ivt.memoryHashMap[node.Key]))
+		}
+		idxMmap, err := ivt.idxFile.acquire()
+		if err != nil || idxMmap == nil {
+			return 0
+		}
+		defer ivt.idxFile.release()
+		_, offset := node.Iter.Current()
+		return uint64(idxMmap.ReadInt64(int64(offset)))
+	}
+
+	docIds, _ := ivt.queryTerm(node.Key)
+	var count uint64
+	for _, docId := range docIds {
+		if bitmap.GetBit(docId.Docid) == 0 {
+			count++
+		}
+	}
+	return count
+}
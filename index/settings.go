@@ -0,0 +1,218 @@
+/**
+ * @Note 索引的设置，创建索引时指定并保存在索引的元信息中，除分词器外都可以在运行时修改
+ **/
+
+package gdindex
+
+import (
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 设置的默认值
+const (
+	DEFAULT_MAX_MERGE_DOCS     uint64 = 1000000 // 文档数不超过该值的段才参与合并
+	DEFAULT_SEGMENTS_PER_MERGE        = 10      // 小段的个数到达该值时合并，也是一次最多合并的段数
+	DEFAULT_PK_BATCH_SIZE      uint64 = 500000  // 主键信息每积累多少条写入一次 B+ 树
+)
+
+// 相关度算法
+const (
+	SIMILARITY_TFIDF   = "tfidf"   // TF-IDF 加向量空间模型，默认的算法
+	SIMILARITY_BOOLEAN = "boolean" // 只按命中的关键词个数排序
+)
+
+// MIN_REFRESH_INTERVAL 定时持久化的最小间隔，后台每秒检查一次
+const MIN_REFRESH_INTERVAL = time.Second
+
+// MergePolicy 段的合并策略，为零值的设置使用默认值
+type MergePolicy struct {
+	MaxMergeDocs     uint64 `json:"maxMergeDocs,omitempty"`     // 文档数不超过该值的段才参与合并，默认 DEFAULT_MAX_MERGE_DOCS
+	SegmentsPerMerge int    `json:"segmentsPerMerge,omitempty"` // 小段的个数到达该值时合并，默认 DEFAULT_SEGMENTS_PER_MERGE
+}
+
+// IndexSettings 索引的设置，为零值的设置使用默认值
+type IndexSettings struct {
+	FlushDocs       uint64      `json:"flushDocs,omitempty"`       // 内存段的文档数到达该值时持久化，默认 utils.MAX_SEGMENT_SIZE
+	FlushBytes      int64       `json:"flushBytes,omitempty"`      // 内存段写入的内容到达该字节数时持久化，0 表示不限制
+	Merge           MergePolicy `json:"merge"`                     // 段的合并策略
+	PkBatchSize     uint64      `json:"pkBatchSize,omitempty"`     // 主键信息每积累多少条写入一次 B+ 树，默认 DEFAULT_PK_BATCH_SIZE
+	RefreshInterval string      `json:"refreshInterval,omitempty"` // 内存段定时持久化的间隔，如 30s、5m，为空或 -1 表示不定时持久化
+	Analyzer        string      `json:"analyzer,omitempty"`        // 切词匹配字段的分词器，默认 gse，写入文档后不能修改
+	Similarity      string      `json:"similarity,omitempty"`      // 相关度算法，tfidf 或 boolean，默认 tfidf
+	Codec           string      `json:"codec,omitempty"`           // 新段中字段内容的压缩方式，none 或 snappy，默认不压缩，已有的段在合并时重写
+}
+
+// Validate
+// @Description 检查设置的取值
+// @Return error 不合法时返回错误
+func (s IndexSettings) Validate() error {
+	if s.FlushBytes < 0 {
+		return fmt.Errorf("invalid flushBytes %v", s.FlushBytes)
+	}
+	if s.Merge.SegmentsPerMerge < 0 || s.Merge.SegmentsPerMerge == 1 {
+		return fmt.Errorf("invalid merge.segmentsPerMerge %v, must be at least 2", s.Merge.SegmentsPerMerge)
+	}
+	if _, err := parseRefreshInterval(s.RefreshInterval); err != nil {
+		return err
+	}
+	if !utils.IsValidAnalyzer(s.Analyzer) {
+		return fmt.Errorf("unknown analyzer %v", s.Analyzer)
+	}
+	switch s.Similarity {
+	case "", SIMILARITY_TFIDF, SIMILARITY_BOOLEAN:
+	default:
+		return fmt.Errorf("unknown similarity %v", s.Similarity)
+	}
+	if !segment.IsValidCodec(s.Codec) {
+		return fmt.Errorf("unknown codec %v", s.Codec)
+	}
+	return nil
+}
+
+// withDefaults 把为零值的设置替换为默认值
+func (s IndexSettings) withDefaults() IndexSettings {
+	if s.FlushDocs == 0 {
+		s.FlushDocs = utils.MAX_SEGMENT_SIZE
+	}
+	if s.Merge.MaxMergeDocs == 0 {
+		s.Merge.MaxMergeDocs = DEFAULT_MAX_MERGE_DOCS
+	}
+	if s.Merge.SegmentsPerMerge == 0 {
+		s.Merge.SegmentsPerMerge = DEFAULT_SEGMENTS_PER_MERGE
+	}
+	if s.PkBatchSize == 0 {
+		s.PkBatchSize = DEFAULT_PK_BATCH_SIZE
+	}
+	if s.Analyzer == "" {
+		s.Analyzer = utils.ANALYZER_GSE
+	}
+	if s.Similarity == "" {
+		s.Similarity = SIMILARITY_TFIDF
+	}
+	if s.Codec == "" {
+		s.Codec = segment.CODEC_NONE
+	}
+	return s
+}
+
+// parseRefreshInterval 解析定时持久化的间隔，为空或 -1 时返回 0
+func parseRefreshInterval(interval string) (time.Duration, error) {
+	interval = strings.TrimSpace(interval)
+	if interval == "" || interval == "-1" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil || d < MIN_REFRESH_INTERVAL {
+		return 0, fmt.Errorf("invalid refreshInterval %v, must be -1 or at least %v", interval, MIN_REFRESH_INTERVAL)
+	}
+	return d, nil
+}
+
+// EffectiveSettings
+// @Description 获取索引当前生效的设置，没有设置的项为默认值，只持有设置的读锁，搜索时不需要等待写入
+// @Return IndexSettings 设置
+func (idx *Index) EffectiveSettings() IndexSettings {
+	idx.settingsMutex.RLock()
+	defer idx.settingsMutex.RUnlock()
+	return idx.Settings.withDefaults()
+}
+
+// SetSettings
+// @Description 替换索引的设置，对之后的写入、持久化和合并生效，分词器只能在写入文档前修改
+// @Param settings 新的设置
+// @Return error 任何错误
+func (idx *Index) SetSettings(settings IndexSettings) error {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	return idx.applySettings(settings)
+}
+
+// UpdateSettings
+// @Description 把 Json 格式的设置合并到索引原有的设置上，请求中没有的项保持不变，没有指定过的项仍然使用默认值
+// @Param body Json 格式的设置
+// @Return IndexSettings 修改后生效的设置
+// @Return error 任何错误
+func (idx *Index) UpdateSettings(body []byte) (IndexSettings, error) {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	settings := idx.Settings
+	if err := json.Unmarshal(body, &settings); err != nil {
+		return IndexSettings{}, err
+	}
+	if err := idx.applySettings(settings); err != nil {
+		return IndexSettings{}, err
+	}
+	return settings.withDefaults(), nil
+}
+
+// applySettings 检查并替换设置后写入元信息，调用前需持有 docMutex 和 segmentMutex
+func (idx *Index) applySettings(settings IndexSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	if settings.withDefaults().Analyzer != idx.Settings.withDefaults().Analyzer {
+		if idx.MaxDocId > 0 {
+			return errors.New("analyzer can't be changed after documents are written")
+		}
+		if idx.memorySegment != nil {
+			if err := idx.memorySegment.SetAnalyzer(settings.Analyzer); err != nil {
+				return err
+			}
+		}
+	}
+
+	if idx.memorySegment != nil && settings.withDefaults().Codec != idx.Settings.withDefaults().Codec {
+		// 内存段在持久化时才写入字段内容，直接使用新的压缩方式
+		if err := idx.memorySegment.SetCodec(settings.Codec); err != nil {
+			return err
+		}
+	}
+
+	idx.settingsMutex.Lock()
+	idx.Settings = settings
+	idx.settingsMutex.Unlock()
+	return idx.storeIndex()
+}
+
+// needFlush 内存段的文档数或写入的字节数到达阈值时需要持久化，调用前需持有 docMutex
+func (idx *Index) needFlush() bool {
+	if idx.memorySegment == nil {
+		return false
+	}
+	settings := idx.Settings.withDefaults()
+	if idx.memorySegment.MaxDocId-idx.memorySegment.StartDocId >= settings.FlushDocs {
+		return true
+	}
+	return settings.FlushBytes > 0 && idx.memorySegment.MemoryBytes() >= settings.FlushBytes
+}
+
+// RefreshIfDue
+// @Description 距离上次持久化超过 refreshInterval 时持久化内存段，由后台定时调用
+// @Param now 当前时间
+// @Return error 任何错误
+func (idx *Index) RefreshIfDue(now time.Time) error {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+
+	interval, err := parseRefreshInterval(idx.Settings.RefreshInterval)
+	if err != nil || interval == 0 {
+		return err
+	}
+	if idx.memorySegment == nil || idx.memorySegment.IsEmpty() || now.Sub(idx.refreshedAt) < interval {
+		return nil
+	}
+	return idx.syncMemorySegment()
+}
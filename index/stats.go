@@ -0,0 +1,151 @@
+/**
+ * @Note 索引的统计信息
+ **/
+
+package gdindex
+
+import (
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"fmt"
+)
+
+// IndexStats 索引的统计信息
+type IndexStats struct {
+	Name          string                     `json:"name"`
+	DocCount      uint64                     `json:"docCount"`    // 未删除的文档数
+	DeletedDocs   uint64                     `json:"deletedDocs"` // 已标记删除但还未合并清理的文档数
+	MaxDocId      uint64                     `json:"maxDocId"`
+	SegmentCount  int                        `json:"segmentCount"` // 磁盘上的段数，不含内存段
+	Bytes         int64                      `json:"bytes"`        // 所有段以及主键、删除标记文件占用的磁盘空间
+	Codec         string                     `json:"codec"`
+	TTL           int64                      `json:"ttl"`
+	Dynamic       string                     `json:"dynamic,omitempty"`
+	MemorySegment MemorySegmentStats         `json:"memorySegment"`
+	Bitmap        BitmapStats                `json:"bitmap"`
+	Fields        map[string]IndexFieldStats `json:"fields"`
+}
+
+// MemorySegmentStats 内存段的填充情况
+type MemorySegmentStats struct {
+	Name     string  `json:"name"`
+	DocCount uint64  `json:"docCount"`
+	Capacity uint64  `json:"capacity"` // 文档数达到该值时写入磁盘
+	Fill     float64 `json:"fill"`     // DocCount / Capacity
+}
+
+// BitmapStats 删除标记的使用情况
+type BitmapStats struct {
+	Bytes   int64  `json:"bytes"`   // 文件大小
+	SetBits uint64 `json:"setBits"` // 被标记删除的文档数
+}
+
+// IndexFieldStats 字段在所有段中的统计信息
+type IndexFieldStats struct {
+	Type  uint64 `json:"type"`
+	Terms uint64 `json:"terms"` // 各段词数之和，不同段中相同的词会重复计数
+	Bytes int64  `json:"bytes"`
+}
+
+// Stats
+// @Description 统计索引的文档数、段、磁盘占用和字段信息
+// @Return IndexStats 统计信息
+func (idx *Index) Stats() IndexStats {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	stats := IndexStats{
+		Name:         idx.Name,
+		MaxDocId:     idx.MaxDocId,
+		SegmentCount: len(idx.segments),
+		Codec:        idx.Settings.withDefaults().Codec,
+		TTL:          idx.TTL,
+		Dynamic:      idx.Dynamic,
+		Fields:       make(map[string]IndexFieldStats),
+	}
+	for name, fieldType := range idx.FieldTypes() {
+		stats.Fields[name] = IndexFieldStats{Type: fieldType}
+	}
+
+	flushDocs := idx.Settings.withDefaults().FlushDocs
+	for _, segStats := range idx.segmentStats() {
+		stats.DocCount += segStats.DocCount
+		stats.DeletedDocs += segStats.DeletedDocs
+		stats.Bytes += segStats.Bytes
+		for _, fieldStats := range segStats.Fields {
+			field := stats.Fields[fieldStats.Name]
+			field.Type = fieldStats.Type
+			field.Terms += fieldStats.Terms
+			field.Bytes += fieldStats.Bytes
+			stats.Fields[fieldStats.Name] = field
+		}
+		if segStats.IsMemory {
+			stats.MemorySegment = MemorySegmentStats{
+				Name:     segStats.Name,
+				DocCount: segStats.MaxDocId - segStats.StartDocId,
+				Capacity: flushDocs,
+				Fill:     float64(segStats.MaxDocId-segStats.StartDocId) / float64(flushDocs),
+			}
+		}
+	}
+	// 主键在段内按字符串存储
+	for _, name := range idx.PrimaryKeyFields {
+		field := stats.Fields[name]
+		field.Type = utils.IDX_TYPE_PK
+		stats.Fields[name] = field
+	}
+
+	stats.Bitmap.SetBits = idx.bitmap.Count(idx.StartDocId, idx.MaxDocId)
+	if size, err := idx.dir.FileSize(fmt.Sprintf("%v%v.bitmap", idx.PathName, idx.Name)); err == nil {
+		stats.Bitmap.Bytes = size
+		stats.Bytes += size
+	}
+	if size, err := idx.dir.FileSize(fmt.Sprintf("%v%v_primary.pk", idx.PathName, idx.Name)); err == nil {
+		stats.Bytes += size
+	}
+	return stats
+}
+
+// Segments
+// @Description 获取每个段的统计信息，内存段在最后
+// @Return []segment.SegmentStats 段的统计信息
+func (idx *Index) Segments() []segment.SegmentStats {
+	idx.docMutex.Lock()
+	defer idx.docMutex.Unlock()
+	idx.segmentMutex.Lock()
+	defer idx.segmentMutex.Unlock()
+
+	return idx.segmentStats()
+}
+
+// segmentStats 调用者需要持有 docMutex 和 segmentMutex
+func (idx *Index) segmentStats() []segment.SegmentStats {
+	res := make([]segment.SegmentStats, 0, len(idx.segments)+1)
+	for _, seg := range idx.segments {
+		res = append(res, seg.Stats(idx.bitmap))
+	}
+	if idx.memorySegment != nil {
+		res = append(res, idx.memorySegment.Stats(idx.bitmap))
+	}
+
+	// 合并清理掉的文档在删除标记中仍然是 1，删除文档数只统计删除文件中还没有被合并清理的文档
+	delDocSet, err := idx.readDelDocs()
+	if err != nil {
+		idx.Logger.Error("[ERROR] Read DelDocs Error : %v", err)
+		return res
+	}
+	for i := range res {
+		res[i].DeletedDocs = 0
+	}
+	for docId := range delDocSet {
+		for i := range res {
+			if docId >= res[i].StartDocId && docId < res[i].MaxDocId {
+				res[i].DeletedDocs++
+				break
+			}
+		}
+	}
+	return res
+}
@@ -143,6 +143,45 @@ func (bh *BoltHelper) SetBatch(tablename string, kv map[int64]string) error {
 
 }
 
+// SetBatchBytes function description : 以字节串为 key 批量更新数据
+func (bh *BoltHelper) SetBatchBytes(tablename string, kv map[string]string) error {
+
+	err := bh.db.Batch(func(tx *bolt.Tx) error {
+
+		b := tx.Bucket([]byte(tablename))
+		if b == nil {
+			bh.Logger.Error("[ERROR] Tablename[%v] not found", tablename)
+			return fmt.Errorf("Tablename[%v] not found", tablename)
+		}
+		for k, v := range kv {
+			if err := b.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return err
+}
+
+// DeleteBatchBytes function description : 以字节串为 key 批量删除数据，key 不存在时忽略
+func (bh *BoltHelper) DeleteBatchBytes(tablename string, keys []string) error {
+
+	return bh.db.Batch(func(tx *bolt.Tx) error {
+
+		b := tx.Bucket([]byte(tablename))
+		if b == nil {
+			return fmt.Errorf("Tablename[%v] not found", tablename)
+		}
+		for _, k := range keys {
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (bh *BoltHelper) UpdateObj(tablename string, key int64, obj interface{}) error {
 
 	value, err := json.Marshal(obj)
@@ -248,6 +287,53 @@ func (bh *BoltHelper) Get(btName string, key int64) (string, error) {
 	return string(value), nil
 }
 
+// GetBytes function description : 以字节串为 key 查询数据
+func (bh *BoltHelper) GetBytes(btName string, key []byte) (string, error) {
+
+	var value []byte
+	bh.db.View(func(tx *bolt.Tx) error {
+
+		b := tx.Bucket([]byte(btName))
+		if b == nil {
+			return nil
+		}
+		value = b.Get(key)
+		return nil
+	})
+
+	if value == nil {
+		return "", fmt.Errorf("Key[%v] Not Found", string(key))
+	}
+
+	return string(value), nil
+}
+
+// ForEach function description : 按 key 的顺序遍历一棵树，fn 返回错误时停止遍历
+func (bh *BoltHelper) ForEach(btName string, fn func(k, v []byte) error) error {
+
+	return bh.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(btName))
+		if b == nil {
+			return fmt.Errorf("Tablename[%v] not found", btName)
+		}
+		return b.ForEach(fn)
+	})
+}
+
+// KeyCount function description : 统计一棵树中 key 的个数
+func (bh *BoltHelper) KeyCount(btName string) (int, error) {
+	count := 0
+	err := bh.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(btName))
+		if b == nil {
+			return fmt.Errorf("Tablename[%v] not found", btName)
+		}
+		count = b.Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
 func (bh *BoltHelper) GetRange(btName string, keyMin int64, keyMax int64) ([]string, error) {
 
 	var s1 = make([]byte, 0)
@@ -273,6 +359,26 @@ func (bh *BoltHelper) GetRange(btName string, keyMin int64, keyMax int64) ([]str
 	return res, nil
 }
 
+// GetRangeBytes function description : 查询字节串 key 在 [keyMin, keyMax] 范围内的数据，按字节序比较
+func (bh *BoltHelper) GetRangeBytes(btName string, keyMin, keyMax []byte) ([]string, error) {
+
+	res := make([]string, 0)
+	err := bh.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(btName))
+		if b == nil {
+			return fmt.Errorf("Tablename[%v] not found", btName)
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek(keyMin); k != nil && bytes.Compare(k, keyMax) <= 0; k, v = c.Next() {
+			res = append(res, string(v))
+		}
+		return nil
+	})
+
+	return res, err
+}
+
 func (bh *BoltHelper) CloseDB() error {
 	return bh.db.Close()
 }
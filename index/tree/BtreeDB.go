@@ -37,6 +37,49 @@ func (db *BTreeDB) SetBatch(btname string, kv map[int64]string) error {
 	return db.dbHelper.SetBatch(btname, kv)
 }
 
+func (db *BTreeDB) SetBatchString(btname string, kv map[string]string) error {
+	return db.dbHelper.SetBatchBytes(btname, kv)
+}
+
+// DeleteBatchString 批量删除字节串 key
+func (db *BTreeDB) DeleteBatchString(btname string, keys []string) error {
+	return db.dbHelper.DeleteBatchBytes(btname, keys)
+}
+
+func (db *BTreeDB) SearchString(btname string, key string) (bool, uint64) {
+
+	vstr, err := db.dbHelper.GetBytes(btname, []byte(key))
+	if err != nil {
+		return false, 0
+	}
+	res, e := strconv.ParseUint(vstr, 10, 64)
+	if e != nil {
+		return false, 0
+	}
+	return true, res
+}
+
+// ForEach 按 key 的字节序遍历一棵树
+func (db *BTreeDB) ForEach(btname string, fn func(key []byte, value string) error) error {
+	return db.dbHelper.ForEach(btname, func(k, v []byte) error {
+		return fn(k, string(v))
+	})
+}
+
+// KeyCount 统计一棵树中 key 的个数，树不存在时返回 0
+func (db *BTreeDB) KeyCount(btname string) int {
+	count, err := db.dbHelper.KeyCount(btname)
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// DeleteBTree 删除一棵树
+func (db *BTreeDB) DeleteBTree(name string) error {
+	return db.dbHelper.DeleteBtree(name)
+}
+
 func (db *BTreeDB) Search(btname string, key int64) (bool, uint64) {
 
 	//db.logger.Info("Search btname : %v  key : %v  ",btname,key)
@@ -75,6 +118,28 @@ func (db *BTreeDB) SearchRange(btname string, keyMin, keyMax int64) (bool, []uin
 	return true, res
 }
 
+// SearchRangeString 查询字节串 key 在 [keyMin, keyMax] 范围内的值
+func (db *BTreeDB) SearchRangeString(btname string, keyMin, keyMax string) (bool, []uint64) {
+
+	if keyMin > keyMax {
+		return false, nil
+	}
+	vstr, err := db.dbHelper.GetRangeBytes(btname, []byte(keyMin), []byte(keyMax))
+	if err != nil {
+		return false, nil
+	}
+
+	res := make([]uint64, 0, len(vstr))
+	for _, v := range vstr {
+		u, e := strconv.ParseUint(v, 10, 64)
+		if e != nil {
+			return false, nil
+		}
+		res = append(res, u)
+	}
+	return true, res
+}
+
 func (db *BTreeDB) GetFirstKV(btname string) (int64, uint64, bool) {
 
 	key, vstr, err := db.dbHelper.GetFirstKV(btname)
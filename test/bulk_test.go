@@ -0,0 +1,75 @@
+package test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// 批量请求中每个操作单独返回状态，单个操作失败不影响其他操作
+func TestBulkItemStatus(t *testing.T) {
+	gde := newTestEngine(t)
+	createTestIndex(t, gde, "bulk", `{"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"color","fieldType":1}]}`)
+
+	body := strings.Join([]string{
+		`{"index":{"_index":"bulk"}}`,
+		`{"id":"a","color":"red"}`,
+		`{"index":{}}`,
+		`{"id":"b","color":"blue"}`,
+		`not json`,
+		`{"delete":{"_id":"a"}}`,
+		`{"update":{"_id":"c"}}`,
+		`{"id":"c","color":"green"}`,
+		`{"delete":{"_index":"missing","_id":"x"}}`,
+		`{"index":{"if_version":5}}`,
+		`{"id":"b","color":"green"}`,
+		`{"frob":{}}`,
+		`{"delete":{}}`,
+		`{"index":{}}`,
+	}, "\n")
+	result, err := gde.Bulk(map[string]string{"index": "bulk"}, []byte(body))
+	if err != nil {
+		t.Fatalf("bulk : %v", err)
+	}
+	if !result.Errors {
+		t.Fatalf("bulk with failed items reported no errors")
+	}
+
+	want := []struct {
+		action string
+		index  string
+		status int
+	}{
+		{"index", "bulk", http.StatusOK},
+		{"index", "bulk", http.StatusOK},
+		{"", "", http.StatusBadRequest},
+		{"delete", "bulk", http.StatusOK},
+		{"update", "bulk", http.StatusBadRequest},
+		{"delete", "missing", http.StatusNotFound},
+		{"index", "bulk", http.StatusConflict},
+		{"frob", "bulk", http.StatusBadRequest},
+		{"delete", "bulk", http.StatusBadRequest},
+		{"index", "bulk", http.StatusBadRequest},
+	}
+	if len(result.Items) != len(want) {
+		t.Fatalf("bulk items = %+v, want %v items", result.Items, len(want))
+	}
+	for i, item := range result.Items {
+		if item.Action != want[i].action || item.Index != want[i].index || item.Status != want[i].status {
+			t.Fatalf("item %v = %+v, want %+v", i, item, want[i])
+		}
+		if (item.Status == http.StatusOK) != (item.Error == "") {
+			t.Fatalf("item %v = %+v, error does not match status", i, item)
+		}
+	}
+
+	if _, err := gde.GetDocByKey(map[string]string{"index": "bulk", "pk": "a"}); err == nil {
+		t.Fatalf("a deleted in bulk is still found")
+	}
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "bulk", "pk": "b"}); err != nil || doc["color"] != "blue" {
+		t.Fatalf("get b = %v, %v, want the color before the conflicting write", doc, err)
+	}
+	if _, err := gde.GetDocByKey(map[string]string{"index": "bulk", "pk": "c"}); err == nil {
+		t.Fatalf("update of a missing document created it")
+	}
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/utils"
+	"path/filepath"
+	"testing"
+)
+
+// 检查报告损坏的段，隔离后段内的文档和主键从索引中移除，其余的段不受影响
+func TestCheckQuarantinesCorruptSegment(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	index := newMergeTestIndex(t, dir)
+	defer index.Close()
+
+	addSegments(t, index, [][]string{{"a", "b"}, {"c", "d"}})
+	if report, err := index.Check(false); err != nil || len(report.Issues) != 0 || report.Segments != 2 {
+		t.Fatalf("check intact index = %+v, %v", report, err)
+	}
+
+	corrupt := index.SegmentNames[0]
+	fileName := corrupt + "color_profile.pfl"
+	buf, err := dir.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("read %v : %v", fileName, err)
+	}
+	buf[0] ^= 0xff
+	if err := dir.WriteFile(fileName, buf); err != nil {
+		t.Fatalf("write %v : %v", fileName, err)
+	}
+
+	report, err := index.Check(false)
+	if err != nil || len(report.Issues) == 0 || len(report.Quarantined) != 0 {
+		t.Fatalf("check = %+v, %v, want issues without quarantine", report, err)
+	}
+	for _, issue := range report.Issues {
+		if issue.Segment != corrupt {
+			t.Fatalf("issue in intact segment : %+v", issue)
+		}
+	}
+	if len(index.SegmentNames) != 2 {
+		t.Fatalf("check without quarantine removed a segment")
+	}
+
+	report, err = index.Check(true)
+	if err != nil || len(report.Quarantined) != 1 || report.Quarantined[0] != corrupt {
+		t.Fatalf("check with quarantine = %+v, %v", report, err)
+	}
+	quarantined := filepath.Join("/godance-merge-test/", gdindex.QUARANTINE_DIR, filepath.Base(filepath.Clean(corrupt)), "color_profile.pfl")
+	if !dir.Exist(quarantined) || dir.Exist(fileName) {
+		t.Fatalf("segment %v was not moved to %v", corrupt, quarantined)
+	}
+	if len(index.SegmentNames) != 1 {
+		t.Fatalf("segments after quarantine = %v", index.SegmentNames)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if _, ok := index.GetDocumentByKey(key); ok {
+			t.Fatalf("document %v of the quarantined segment is still found", key)
+		}
+	}
+	docIds, _ := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if got := docKeys(index, nodeDocIds(docIds)); got != "c,d" {
+		t.Fatalf("search after quarantine = %v, want c,d", got)
+	}
+	if report, err := index.Check(false); err != nil || len(report.Issues) != 0 {
+		t.Fatalf("check after quarantine = %+v, %v", report, err)
+	}
+
+	// 隔离的主键可以重新写入
+	addSegments(t, index, [][]string{{"a"}})
+	if doc, ok := index.GetDocumentByKey("a"); !ok || doc["id"] != "a" {
+		t.Fatalf("get re-added a = %v, %v", doc, ok)
+	}
+	if report, err := index.Check(false); err != nil || len(report.Issues) != 0 {
+		t.Fatalf("check after re-adding = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"GoDance/engine"
+	"GoDance/utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 数据目录去掉空白和重复的路径后统一以分隔符结尾，第一个为数据根目录
+func TestSetDataPaths(t *testing.T) {
+	for _, paths := range [][]string{nil, {"", "  "}} {
+		if err := utils.SetDataPaths(paths); err == nil {
+			t.Fatalf("set data paths %q succeeded", paths)
+		}
+	}
+
+	root, other := t.TempDir(), filepath.Join(t.TempDir(), "disk2")
+	if err := utils.SetDataPaths([]string{root, " ", root + "/", other}); err != nil {
+		t.Fatalf("set data paths : %v", err)
+	}
+	sep := string(filepath.Separator)
+	paths := utils.DataPaths()
+	if len(paths) != 2 || paths[0] != root+sep || paths[1] != other+sep {
+		t.Fatalf("data paths = %v, want %v and %v", paths, root+sep, other+sep)
+	}
+	if info, err := os.Stat(other); err != nil || !info.IsDir() {
+		t.Fatalf("missing data path %v was not created : %v", other, err)
+	}
+	if utils.DataRoot() != root+sep || utils.TriePath() != root+sep+utils.TRIE_FILE {
+		t.Fatalf("data root = %v, trie path = %v", utils.DataRoot(), utils.TriePath())
+	}
+	if picked := utils.PickDataPath(); picked != paths[0] && picked != paths[1] {
+		t.Fatalf("picked data path %v is not one of %v", picked, paths)
+	}
+}
+
+// 新索引放在选出的数据目录中并记录在索引管理器里，引擎的元信息保存在数据根目录
+func TestIndexPlacedInDataPath(t *testing.T) {
+	root, other := t.TempDir(), t.TempDir()
+	if err := utils.SetDataPaths([]string{root, other}); err != nil {
+		t.Fatalf("set data paths : %v", err)
+	}
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	gde := engine.NewDefaultEngine(logger)
+	createTestIndex(t, gde, "placed", `{"fieldsmapping":[{"fieldName":"id","fieldType":21}]}`)
+	addTestDocuments(t, gde, "placed", `{"id":"a"}`)
+	if err := gde.SyncIndex("placed"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+
+	stats := gde.Stats()
+	path := stats.Indexes["placed"].Path
+	if path != utils.DataPaths()[0] && path != utils.DataPaths()[1] {
+		t.Fatalf("index path %v is not a data path", path)
+	}
+	for _, name := range []string{"placed.meta", "placed_primary.pk"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+			t.Fatalf("index file %v not in %v : %v", name, path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, utils.GODANCEENGINE+".idm.meta")); err != nil {
+		t.Fatalf("engine meta not in the data root : %v", err)
+	}
+
+	if len(stats.DataPaths) != 2 {
+		t.Fatalf("data path stats = %+v", stats.DataPaths)
+	}
+	for _, pathStats := range stats.DataPaths {
+		placedHere := len(pathStats.Indexes) == 1 && pathStats.Indexes[0] == "placed"
+		if placedHere != (pathStats.Path == path) {
+			t.Fatalf("data path stats = %+v, index is in %v", stats.DataPaths, path)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"GoDance/utils"
+	"testing"
+	"time"
+)
+
+func TestDateParserParse(t *testing.T) {
+	cases := []struct {
+		format   string
+		timeZone string
+		value    string
+		want     string
+	}{
+		{"", "", "2026-01-02", "2026-01-02T00:00:00.000Z"},
+		{"", "+08:00", "2026-01-02 10:00:00", "2026-01-02T02:00:00.000Z"},
+		{"", "-05:00", "2026-01-02T10:00:00", "2026-01-02T15:00:00.000Z"},
+		// 自带时区的时间不受解析器时区的影响
+		{"", "+08:00", "2026-01-02T10:00:00.250+01:00", "2026-01-02T09:00:00.250Z"},
+		{"", "", "1969-12-31T23:59:59.999Z", "1969-12-31T23:59:59.999Z"},
+		{"", "", "-1", "1969-12-31T23:59:59.999Z"},
+		{utils.DATE_FORMAT_EPOCH_SECOND, "", "-86400", "1969-12-31T00:00:00.000Z"},
+		{"2006/01/02||" + utils.DATE_FORMAT_EPOCH_MILLIS, "+08:00", "1960/06/01", "1960-05-31T16:00:00.000Z"},
+	}
+	for _, c := range cases {
+		parser, err := utils.NewDateParser(c.format, c.timeZone)
+		if err != nil {
+			t.Fatalf("NewDateParser(%q, %q) : %v", c.format, c.timeZone, err)
+		}
+		ms, err := parser.Parse(c.value)
+		if err != nil {
+			t.Errorf("Parse(%q) in %q : %v", c.value, c.timeZone, err)
+			continue
+		}
+		if got := utils.FormatMillis(ms); got != c.want {
+			t.Errorf("Parse(%q) in %q = %v, want %v", c.value, c.timeZone, got, c.want)
+		}
+	}
+
+	parser, _ := utils.NewDateParser("", "")
+	if ms, err := parser.Parse("not a date"); err == nil || ms != utils.DATETIME_NULL {
+		t.Errorf("Parse(not a date) = %v, %v, want DATETIME_NULL and error", ms, err)
+	}
+	if _, err := utils.NewDateParser("", "Mars/Olympus"); err == nil {
+		t.Errorf("NewDateParser with unknown time zone succeeded")
+	}
+}
+
+func TestDateParserParseMath(t *testing.T) {
+	// 2026-10-21 是周三
+	now := time.Date(2026, 10, 21, 15, 30, 45, 123e6, time.UTC)
+	cases := []struct {
+		expr     string
+		timeZone string
+		lo, hi   string
+	}{
+		{"now", "", "2026-10-21T15:30:45.123Z", "2026-10-21T15:30:45.123Z"},
+		{"now-7d", "", "2026-10-14T15:30:45.123Z", "2026-10-14T15:30:45.123Z"},
+		{"now/d", "", "2026-10-21T00:00:00.000Z", "2026-10-21T23:59:59.999Z"},
+		{"now-7d/d", "", "2026-10-14T00:00:00.000Z", "2026-10-14T23:59:59.999Z"},
+		// 按时区取整，+08:00 已经是 23:30，-05:00 是 10:30
+		{"now/d", "+08:00", "2026-10-20T16:00:00.000Z", "2026-10-21T15:59:59.999Z"},
+		{"now/d", "-05:00", "2026-10-21T05:00:00.000Z", "2026-10-22T04:59:59.999Z"},
+		{"now+1h/h", "", "2026-10-21T16:00:00.000Z", "2026-10-21T16:59:59.999Z"},
+		{"now/H", "+05:30", "2026-10-21T15:30:00.000Z", "2026-10-21T16:29:59.999Z"},
+		{"now/m", "", "2026-10-21T15:30:00.000Z", "2026-10-21T15:30:59.999Z"},
+		{"now/s", "", "2026-10-21T15:30:45.000Z", "2026-10-21T15:30:45.999Z"},
+		// 一周从周一开始
+		{"now/w", "", "2026-10-19T00:00:00.000Z", "2026-10-25T23:59:59.999Z"},
+		{"2026-10-25||/w", "", "2026-10-19T00:00:00.000Z", "2026-10-25T23:59:59.999Z"},
+		{"2026-10-19||/w", "", "2026-10-19T00:00:00.000Z", "2026-10-25T23:59:59.999Z"},
+		{"now/M", "", "2026-10-01T00:00:00.000Z", "2026-10-31T23:59:59.999Z"},
+		{"now/y", "", "2026-01-01T00:00:00.000Z", "2026-12-31T23:59:59.999Z"},
+		{"2026-01-02||+1M", "", "2026-02-02T00:00:00.000Z", "2026-02-02T00:00:00.000Z"},
+		{"2026-01-02 10:00:00||+1M", "+08:00", "2026-02-02T02:00:00.000Z", "2026-02-02T02:00:00.000Z"},
+		{"2026-02-10||+1M/M", "", "2026-03-01T00:00:00.000Z", "2026-03-31T23:59:59.999Z"},
+		{"2026-01-02", "", "2026-01-02T00:00:00.000Z", "2026-01-02T00:00:00.000Z"},
+		// 早于 1970 年的时间
+		{"1969-07-20T20:17:40Z||/d", "", "1969-07-20T00:00:00.000Z", "1969-07-20T23:59:59.999Z"},
+		{"1969-07-20T20:17:40Z||/M", "", "1969-07-01T00:00:00.000Z", "1969-07-31T23:59:59.999Z"},
+		{"1970-01-01||-1d/d", "+08:00", "1969-12-30T16:00:00.000Z", "1969-12-31T15:59:59.999Z"},
+		{"1969-12-31||+1y/y", "", "1970-01-01T00:00:00.000Z", "1970-12-31T23:59:59.999Z"},
+	}
+	for _, c := range cases {
+		parser, err := utils.NewDateParser("", c.timeZone)
+		if err != nil {
+			t.Fatalf("NewDateParser(%q) : %v", c.timeZone, err)
+		}
+		lo, hi, err := parser.ParseMath(c.expr, now)
+		if err != nil {
+			t.Errorf("ParseMath(%q) in %q : %v", c.expr, c.timeZone, err)
+			continue
+		}
+		if gotLo, gotHi := utils.FormatMillis(lo), utils.FormatMillis(hi); gotLo != c.lo || gotHi != c.hi {
+			t.Errorf("ParseMath(%q) in %q = [%v, %v], want [%v, %v]", c.expr, c.timeZone, gotLo, gotHi, c.lo, c.hi)
+		}
+	}
+
+	parser, _ := utils.NewDateParser("", "")
+	for _, expr := range []string{"now/", "now/x", "now+", "now-7", "now+1x", "now*1d", "bad||+1d", "2026-01-02||/"} {
+		if lo, hi, err := parser.ParseMath(expr, now); err == nil {
+			t.Errorf("ParseMath(%q) = [%v, %v], want error", expr, lo, hi)
+		}
+	}
+}
+
+func TestFloorDiv(t *testing.T) {
+	cases := []struct {
+		a, b, want int64
+	}{
+		{0, 1000, 0},
+		{999, 1000, 0},
+		{1000, 1000, 1},
+		{1500, 1000, 1},
+		{-1, 1000, -1},
+		{-999, 1000, -1},
+		{-1000, 1000, -1},
+		{-1001, 1000, -2},
+		{-1500, 1000, -2},
+		{-86400000, 1000, -86400},
+	}
+	for _, c := range cases {
+		if got := utils.FloorDiv(c.a, c.b); got != c.want {
+			t.Errorf("FloorDiv(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
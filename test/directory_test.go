@@ -0,0 +1,131 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// 内存目录的索引路径，测试结束后磁盘上不应该出现
+const memoryIndexPath = "/godance-memory-test/"
+
+func TestMemoryDirectoryFiles(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	if err := dir.MkdirAll("/mem/seg/"); err != nil {
+		t.Fatalf("mkdir : %v", err)
+	}
+	fd, err := dir.Create("/mem/seg/a.pfl")
+	if err != nil {
+		t.Fatalf("create : %v", err)
+	}
+	if _, err := fd.Write([]byte("hello")); err != nil {
+		t.Fatalf("write : %v", err)
+	}
+	fd.Close()
+
+	if size, err := dir.FileSize("/mem/seg/a.pfl"); err != nil || size != 5 {
+		t.Fatalf("size = %v, %v, want 5", size, err)
+	}
+
+	mapped, err := dir.Map("/mem/seg/a.pfl", false)
+	if err != nil {
+		t.Fatalf("map : %v", err)
+	}
+	if err := mapped.Resize(8); err != nil {
+		t.Fatalf("resize : %v", err)
+	}
+	copy(mapped.Bytes()[5:], "!!!")
+	mapped.Close()
+	if buf, err := dir.ReadFile("/mem/seg/a.pfl"); err != nil || string(buf) != "hello!!!" {
+		t.Fatalf("read = %q, %v, want hello!!!", buf, err)
+	}
+
+	if err := dir.Rename("/mem/seg/", "/mem/seg2/"); err != nil {
+		t.Fatalf("rename : %v", err)
+	}
+	if dir.Exist("/mem/seg/a.pfl") || !dir.Exist("/mem/seg2/a.pfl") {
+		t.Fatalf("rename did not move the files in the directory")
+	}
+	names, err := dir.List("/mem/seg2/")
+	if err != nil || len(names) != 1 || names[0] != "a.pfl" {
+		t.Fatalf("list = %v, %v, want [a.pfl]", names, err)
+	}
+
+	if err := dir.RemoveAll("/mem/"); err != nil {
+		t.Fatalf("remove : %v", err)
+	}
+	if dir.Exist("/mem/seg2/a.pfl") {
+		t.Fatalf("file exists after remove")
+	}
+	if _, err := dir.ReadFile("/mem/seg2/a.pfl"); !os.IsNotExist(err) {
+		t.Fatalf("read removed file err = %v, want not exist", err)
+	}
+}
+
+func TestMemoryDirectoryIndex(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	index := gdindex.NewEmptyIndexIn(dir, "mem", memoryIndexPath, logger)
+	fields := []segment.SimpleFieldInfo{
+		{FieldName: "id", FieldType: utils.IDX_TYPE_PK},
+		{FieldName: "year", FieldType: utils.IDX_TYPE_NUMBER},
+		{FieldName: "region", FieldType: utils.IDX_TYPE_STRING},
+	}
+	for _, field := range fields {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field %v : %v", field.FieldName, err)
+		}
+	}
+
+	regions := []string{"北京", "上海", "北京", "天津"}
+	for i, region := range regions {
+		content := map[string]string{"id": strconv.Itoa(i), "year": strconv.Itoa(2000 + i), "region": region}
+		if _, err := index.AddDocument(content); err != nil {
+			t.Fatalf("add document %v : %v", i, err)
+		}
+	}
+	if err := index.SyncMemorySegment(); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	if err := index.DeleteDocument("3"); err != nil {
+		t.Fatalf("delete : %v", err)
+	}
+	if err := index.Close(); err != nil {
+		t.Fatalf("close : %v", err)
+	}
+
+	if _, err := os.Stat(memoryIndexPath); !os.IsNotExist(err) {
+		t.Fatalf("index path %v exists on disk, err = %v", memoryIndexPath, err)
+	}
+
+	// 从同一个内存目录重新加载
+	index = gdindex.NewIndexFromLocalFileIn(dir, "mem", memoryIndexPath, logger)
+	defer index.Close()
+
+	docIds, ok := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "region", Value: "北京"})
+	if !ok || len(docIds) != 2 {
+		t.Fatalf("search region = %v, %v, want 2 docs", docIds, ok)
+	}
+	doc, ok := index.GetDocumentByKey("1")
+	if !ok || doc["region"] != "上海" || doc["year"] != "2001" {
+		t.Fatalf("get 1 = %v, %v", doc, ok)
+	}
+	if _, ok := index.GetDocumentByKey("3"); ok {
+		t.Fatalf("deleted document found after reload")
+	}
+
+	report, err := index.Check(false)
+	if err != nil || len(report.Issues) != 0 {
+		t.Fatalf("check = %+v, %v, want no issues", report.Issues, err)
+	}
+}
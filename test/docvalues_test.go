@@ -0,0 +1,123 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"testing"
+)
+
+const docValuesIndexPath = "/godance-docvalues-test/"
+
+// checkDocValues 按列式存储排序、统计和折叠
+func checkDocValues(t *testing.T, stage string, index *gdindex.Index) {
+	all := []uint64{}
+	for docId := uint64(0); docId < index.MaxDocId; docId++ {
+		if _, ok := index.GetDocument(docId); ok {
+			all = append(all, docId)
+		}
+	}
+
+	for _, c := range []struct {
+		specs []gdindex.SortSpec
+		want  string
+	}{
+		{[]gdindex.SortSpec{{Field: "n"}}, "2,5,1,3,4"},
+		{[]gdindex.SortSpec{{Field: "n", Desc: true}}, "3,1,5,2,4"},
+		{[]gdindex.SortSpec{{Field: "n", MissingFirst: true}}, "4,2,5,1,3"},
+		{[]gdindex.SortSpec{{Field: "color"}, {Field: "n", Desc: true}}, "5,2,4,3,1"},
+	} {
+		if err := index.SortDocIds(all, c.specs); err != nil {
+			t.Fatalf("%v : sort %+v : %v", stage, c.specs, err)
+		}
+		if got := sortedKeys(index, all); got != c.want {
+			t.Fatalf("%v : sort %+v = %v, want %v", stage, c.specs, got, c.want)
+		}
+	}
+
+	if err := index.SortDocIds(all, []gdindex.SortSpec{{Field: "n"}}); err != nil {
+		t.Fatalf("%v : sort : %v", stage, err)
+	}
+	collapsed, err := index.Collapse(all, "color")
+	if err != nil {
+		t.Fatalf("%v : collapse : %v", stage, err)
+	}
+	if got := sortedKeys(index, collapsed); got != "2,1,4" {
+		t.Fatalf("%v : collapse by color = %v, want 2,1,4", stage, got)
+	}
+
+	facets, err := index.Facet(all, "color", 2)
+	want := []utils.FacetItem{{Value: "blue", Count: 2}, {Value: "red", Count: 2}}
+	if err != nil || len(facets) != 2 || facets[0] != want[0] || facets[1] != want[1] {
+		t.Fatalf("%v : facet color = %v, %v, want %v", stage, facets, err, want)
+	}
+	facets, err = index.Facet(all, "n", 0)
+	if err != nil || len(facets) != 4 {
+		t.Fatalf("%v : facet n = %v, %v, want 4 values without the missing one", stage, facets, err)
+	}
+
+	if err := index.SortDocIds(all, []gdindex.SortSpec{{Field: "missing"}}); err == nil {
+		t.Fatalf("%v : sort by an unknown field succeeded", stage)
+	}
+}
+
+// 排序、统计和折叠读取持久化段的列式存储，合并和重新加载后结果不变
+func TestDocValuesSort(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	index := gdindex.NewEmptyIndexIn(dir, "dv", docValuesIndexPath, logger)
+	for _, field := range []segment.SimpleFieldInfo{
+		{FieldName: "id", FieldType: utils.IDX_TYPE_PK},
+		{FieldName: "color", FieldType: utils.IDX_TYPE_STRING},
+		{FieldName: "n", FieldType: utils.IDX_TYPE_NUMBER},
+	} {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field %v : %v", field.FieldName, err)
+		}
+	}
+
+	docs := []map[string]string{
+		{"id": "1", "color": "red", "n": "5"},
+		{"id": "2", "color": "blue", "n": "-1"},
+		{"id": "3", "color": "red", "n": "20"},
+		{"id": "4", "color": "green"},
+		{"id": "5", "color": "blue", "n": "3"},
+	}
+	for i, doc := range docs {
+		if _, err := index.AddDocument(doc); err != nil {
+			t.Fatalf("add document %v : %v", doc["id"], err)
+		}
+		if i == 2 {
+			if err := index.SyncMemorySegment(); err != nil {
+				t.Fatalf("sync : %v", err)
+			}
+		}
+	}
+	if err := index.SyncMemorySegment(); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	for _, name := range index.SegmentNames {
+		for _, field := range []string{"n", "color"} {
+			if !dir.Exist(name + field + "_docvalues.dv") {
+				t.Fatalf("segment %v has no doc values for %v", name, field)
+			}
+		}
+	}
+	checkDocValues(t, "persisted", index)
+
+	if _, err := index.ForceMerge(gdindex.ForceMergeOptions{MaxNumSegments: 1}); err != nil {
+		t.Fatalf("force merge : %v", err)
+	}
+	checkDocValues(t, "merged", index)
+	if err := index.Close(); err != nil {
+		t.Fatalf("close : %v", err)
+	}
+
+	index = gdindex.NewIndexFromLocalFileIn(dir, "dv", docValuesIndexPath, logger)
+	defer index.Close()
+	checkDocValues(t, "reloaded", index)
+}
@@ -0,0 +1,164 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDoubleOrder(t *testing.T) {
+	values := []float64{math.Inf(-1), -1e300, -2.5, -1, -1e-300, 0, 1e-300, 1, 2.5, 1e300, math.Inf(1)}
+	for i, f := range values {
+		encoded := utils.EncodeDouble(f)
+		if encoded == utils.DOUBLE_NULL {
+			t.Errorf("EncodeDouble(%v) is DOUBLE_NULL", f)
+		}
+		if got := utils.DecodeDouble(encoded); got != f {
+			t.Errorf("DecodeDouble(EncodeDouble(%v)) = %v", f, got)
+		}
+		if i > 0 && utils.EncodeDouble(values[i-1]) >= encoded {
+			t.Errorf("EncodeDouble(%v) >= EncodeDouble(%v)", values[i-1], f)
+		}
+	}
+	if utils.EncodeDouble(math.Copysign(0, -1)) != utils.EncodeDouble(0) {
+		t.Errorf("-0 and 0 are encoded differently")
+	}
+}
+
+func TestParseAndFormatDouble(t *testing.T) {
+	cases := []struct {
+		value  string
+		format string
+		err    bool
+	}{
+		{"0", "0", false},
+		{"-0", "0", false},
+		{" 2.50 ", "2.5", false},
+		{"-1.25", "-1.25", false},
+		{"0.1", "0.1", false},
+		{"1e-7", "1e-07", false},
+		{"-3e21", "-3e+21", false},
+		{"", "", true},
+		{"abc", "", true},
+		{"NaN", "", true},
+	}
+	for _, c := range cases {
+		encoded, err := utils.ParseDouble(c.value)
+		if (err != nil) != c.err {
+			t.Errorf("ParseDouble(%q) err = %v", c.value, err)
+			continue
+		}
+		if err != nil {
+			if encoded != utils.DOUBLE_NULL {
+				t.Errorf("ParseDouble(%q) = %v on error, want DOUBLE_NULL", c.value, encoded)
+			}
+			continue
+		}
+		if got := utils.FormatDouble(encoded); got != c.format {
+			t.Errorf("FormatDouble(ParseDouble(%q)) = %q, want %q", c.value, got, c.format)
+		}
+	}
+	if got := utils.FormatDouble(utils.DOUBLE_NULL); got != "" {
+		t.Errorf("FormatDouble(DOUBLE_NULL) = %q, want empty", got)
+	}
+}
+
+// 双精度浮点数的键翻转了符号位，跨过 0 的范围需要分段查找；数字字段小于过滤的下界需要包含负数
+func TestNumericFiltersAcrossZero(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	index := gdindex.NewEmptyIndexIn(dir, "num", "/godance-double-test/", logger)
+	defer index.Close()
+	fields := []segment.SimpleFieldInfo{
+		{FieldName: "id", FieldType: utils.IDX_TYPE_PK},
+		{FieldName: "price", FieldType: utils.IDX_TYPE_DOUBLE},
+		{FieldName: "qty", FieldType: utils.IDX_TYPE_NUMBER},
+	}
+	for _, field := range fields {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field %v : %v", field.FieldName, err)
+		}
+	}
+
+	// 分两次持久化，得到两个段
+	batches := [][]map[string]string{
+		{
+			{"id": "a", "price": "-2.5", "qty": "-5"},
+			{"id": "b", "price": "-1", "qty": "-1"},
+			{"id": "c", "price": "0", "qty": "0"},
+		},
+		{
+			{"id": "d", "price": "", "qty": ""},
+			{"id": "e", "price": "1.5", "qty": "3"},
+			{"id": "f", "price": "3", "qty": "10"},
+		},
+	}
+	for _, batch := range batches {
+		for _, doc := range batch {
+			if _, err := index.AddDocument(doc); err != nil {
+				t.Fatalf("add document %v : %v", doc["id"], err)
+			}
+		}
+		if err := index.SyncMemorySegment(); err != nil {
+			t.Fatalf("sync : %v", err)
+		}
+	}
+
+	double := utils.EncodeDouble
+	cases := []struct {
+		name   string
+		filter utils.SearchFilters
+		want   string
+	}{
+		{"price < 0", utils.SearchFilters{FieldName: "price", Type: utils.FILT_LESS, Start: double(-0.5)}, "a,b"},
+		{"price <= 0", utils.SearchFilters{FieldName: "price", Type: utils.FILT_LESS, Start: double(0)}, "a,b,c"},
+		{"price > -1.5", utils.SearchFilters{FieldName: "price", Type: utils.FILT_OVER, Start: double(-1.5)}, "b,c,e,f"},
+		{"price in [-1, 1.5]", utils.SearchFilters{FieldName: "price", Type: utils.FILT_RANGE, Start: double(-1), End: double(1.5)}, "b,c,e"},
+		{"price in [-3, -2]", utils.SearchFilters{FieldName: "price", Type: utils.FILT_RANGE, Start: double(-3), End: double(-2)}, "a"},
+		{"price = 0", utils.SearchFilters{FieldName: "price", Type: utils.FILT_EQ, Start: double(0)}, "c"},
+		{"price missing", utils.SearchFilters{FieldName: "price", Type: utils.FILT_MISSING}, "d"},
+		{"qty < 0", utils.SearchFilters{FieldName: "qty", Type: utils.FILT_LESS, Start: -1}, "a,b"},
+		{"qty > -2", utils.SearchFilters{FieldName: "qty", Type: utils.FILT_OVER, Start: -2}, "b,c,e,f"},
+		{"qty in [-5, 3]", utils.SearchFilters{FieldName: "qty", Type: utils.FILT_RANGE, Start: -5, End: 3}, "a,b,c,e"},
+		{"qty = -1", utils.SearchFilters{FieldName: "qty", Type: utils.FILT_EQ, Start: -1}, "b"},
+		{"qty missing", utils.SearchFilters{FieldName: "qty", Type: utils.FILT_MISSING}, "d"},
+	}
+	check := func(stage string) {
+		for _, c := range cases {
+			docIds, _ := index.SearchFilterDocIds(c.filter)
+			if got := docKeys(index, docIds); got != c.want {
+				t.Errorf("%v : %v = %v, want %v", stage, c.name, got, c.want)
+			}
+		}
+	}
+
+	check("before merge")
+	if _, err := index.ForceMerge(gdindex.ForceMergeOptions{}); err != nil {
+		t.Fatalf("force merge : %v", err)
+	}
+	if segments := index.Stats().SegmentCount; segments != 1 {
+		t.Fatalf("segments after merge = %v, want 1", segments)
+	}
+	check("after merge")
+}
+
+// docKeys 文档的主键，排序后用逗号连接
+func docKeys(index *gdindex.Index, docIds []uint64) string {
+	keys := make([]string, 0, len(docIds))
+	for _, docId := range docIds {
+		if doc, ok := index.GetDocument(docId); ok {
+			keys = append(keys, doc["id"])
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
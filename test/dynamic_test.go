@@ -0,0 +1,97 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"testing"
+)
+
+// 动态新增的字段在之前写入的段中不存在，搜索时跳过这些段
+func TestSearchDynamicFieldMissingInOldSegments(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	index := gdindex.NewEmptyIndexIn(dir, "dyn", "/godance-dynamic-test/", logger)
+	defer index.Close()
+	if err := index.AddField(segment.SimpleFieldInfo{FieldName: "id", FieldType: utils.IDX_TYPE_PK}); err != nil {
+		t.Fatalf("add field : %v", err)
+	}
+	if err := index.SetDynamic(gdindex.DYNAMIC_TRUE); err != nil {
+		t.Fatalf("set dynamic : %v", err)
+	}
+
+	docs := []map[string]string{
+		{"id": "1", "title": "a"},
+		{"id": "2", "title": "b", "color": "red"},
+	}
+	for _, doc := range docs {
+		if _, err := index.AddDocument(doc); err != nil {
+			t.Fatalf("add document %v : %v", doc["id"], err)
+		}
+		if err := index.SyncMemorySegment(); err != nil {
+			t.Fatalf("sync : %v", err)
+		}
+	}
+
+	docIds, ok := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if !ok || len(docIds) != 1 || docIds[0].Docid != 1 {
+		t.Fatalf("search color = %v, %v, want docId 1", docIds, ok)
+	}
+	docIds, ok = index.SearchKeyDocIds(utils.SearchQuery{FieldName: "title", Value: "a"})
+	if !ok || len(docIds) != 1 || docIds[0].Docid != 0 {
+		t.Fatalf("search title = %v, %v, want docId 0", docIds, ok)
+	}
+
+	filterIds, ok := index.SearchFilterDocIds(utils.SearchFilters{FieldName: "color", Type: utils.FILT_MISSING})
+	if !ok || len(filterIds) != 1 || filterIds[0] != 0 {
+		t.Fatalf("missing color = %v, %v, want docId 0", filterIds, ok)
+	}
+}
+
+// 动态新增字段直接加到内存段中，不会把内存段写入磁盘
+func TestDynamicFieldKeepsMemorySegment(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	index := gdindex.NewEmptyIndexIn(dir, "dyn", "/godance-dynamic-test/", logger)
+	defer index.Close()
+	if err := index.AddField(segment.SimpleFieldInfo{FieldName: "id", FieldType: utils.IDX_TYPE_PK}); err != nil {
+		t.Fatalf("add field : %v", err)
+	}
+	if err := index.SetDynamic(gdindex.DYNAMIC_TRUE); err != nil {
+		t.Fatalf("set dynamic : %v", err)
+	}
+
+	for _, doc := range []map[string]string{{"id": "1", "title": "a"}, {"id": "2", "color": "red"}} {
+		if _, err := index.AddDocument(doc); err != nil {
+			t.Fatalf("add document %v : %v", doc["id"], err)
+		}
+	}
+	if stats := index.Stats(); stats.SegmentCount != 0 || stats.MemorySegment.DocCount != 2 {
+		t.Fatalf("segments = %v, memory docs = %v, want 0 and 2", stats.SegmentCount, stats.MemorySegment.DocCount)
+	}
+	if fieldType, ok := index.FieldTypes()["color"]; !ok || fieldType != utils.IDX_TYPE_STRING {
+		t.Fatalf("color type = %v, %v", fieldType, ok)
+	}
+
+	if err := index.SyncMemorySegment(); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	docIds, ok := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if !ok || len(docIds) != 1 || docIds[0].Docid != 1 {
+		t.Fatalf("search color = %v, %v, want docId 1", docIds, ok)
+	}
+	doc, ok := index.GetDocumentByKey("1")
+	if !ok || doc["title"] != "a" || doc["color"] != "" {
+		t.Fatalf("get 1 = %v, %v", doc, ok)
+	}
+}
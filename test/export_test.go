@@ -0,0 +1,141 @@
+package test
+
+import (
+	"GoDance/engine"
+	"GoDance/utils"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestEngine 在临时数据目录中新建引擎
+func newTestEngine(t *testing.T) *engine.GoDanceEngine {
+	if err := utils.SetDataPaths([]string{t.TempDir()}); err != nil {
+		t.Fatalf("set data paths : %v", err)
+	}
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	return engine.NewDefaultEngine(logger)
+}
+
+// createTestIndex 按 Json 格式的请求体新建索引
+func createTestIndex(t *testing.T, gde *engine.GoDanceEngine, indexName, body string) {
+	if err := gde.CreateIndex(indexName, []byte(body)); err != nil {
+		t.Fatalf("create index %v : %v", indexName, err)
+	}
+}
+
+// addTestDocuments 逐个写入文档
+func addTestDocuments(t *testing.T, gde *engine.GoDanceEngine, indexName string, docs ...string) {
+	for _, doc := range docs {
+		if _, err := gde.AddDocument(map[string]string{"index": indexName}, []byte(doc)); err != nil {
+			t.Fatalf("add document %v : %v", doc, err)
+		}
+	}
+}
+
+// exportKeys 导出为 jsonl 后按导出顺序列出 id
+func exportKeys(t *testing.T, gde *engine.GoDanceEngine, params map[string]string) string {
+	var out bytes.Buffer
+	if err := gde.Export(params, &out); err != nil {
+		t.Fatalf("export %v : %v", params, err)
+	}
+	keys := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		doc := make(map[string]string)
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			t.Fatalf("export line %q : %v", line, err)
+		}
+		keys = append(keys, doc["id"])
+	}
+	return strings.Join(keys, ",")
+}
+
+// 导出按 docId 顺序输出持久化的段和内存段中未删除的文档，可以带上查询条件
+func TestExportOrderAndFilter(t *testing.T) {
+	gde := newTestEngine(t)
+	createTestIndex(t, gde, "export", `{"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"color","fieldType":1},{"fieldName":"n","fieldType":11}]}`)
+	addTestDocuments(t, gde, "export",
+		`{"id":"c","color":"red","n":"3"}`,
+		`{"id":"a","color":"blue","n":"1"}`,
+		`{"id":"b","color":"red","n":"2"}`)
+	if err := gde.SyncIndex("export"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	addTestDocuments(t, gde, "export", `{"id":"e","color":"red","n":"5"}`, `{"id":"d","color":"blue","n":"4"}`)
+	if _, err := gde.DeleteDocument(map[string]string{"index": "export", "id": "b"}); err != nil {
+		t.Fatalf("delete : %v", err)
+	}
+
+	if got := exportKeys(t, gde, map[string]string{"index": "export"}); got != "c,a,e,d" {
+		t.Fatalf("export = %v, want c,a,e,d", got)
+	}
+
+	if err := gde.SyncIndex("export"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	if got := exportKeys(t, gde, map[string]string{"index": "export", "color": "red"}); got != "c,e" {
+		t.Fatalf("export color=red = %v, want c,e", got)
+	}
+	if got := exportKeys(t, gde, map[string]string{"index": "export", ">n": "1", "_color": "blue"}); got != "c,e" {
+		t.Fatalf("export n>1 without blue = %v, want c,e", got)
+	}
+
+	var out bytes.Buffer
+	if err := gde.Export(map[string]string{"index": "export", "format": "csv", "fields": "id,n", "-n": "4"}, &out); err != nil {
+		t.Fatalf("export csv : %v", err)
+	}
+	if got := out.String(); got != "id,n\nd,4\n" {
+		t.Fatalf("export csv = %q", got)
+	}
+}
+
+// 遍历文档时不持有索引的锁，回调中可以写入同一个索引
+func TestForEachDocumentDoesNotBlockWrites(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	index := newMergeTestIndex(t, dir)
+	defer index.Close()
+
+	addSegments(t, index, [][]string{{"a", "b"}})
+	if _, err := index.AddDocument(map[string]string{"id": "c", "color": "red"}); err != nil {
+		t.Fatalf("add document : %v", err)
+	}
+
+	visited := make([]string, 0)
+	err := index.ForEachDocument(func(docId uint64, doc map[string]string) error {
+		visited = append(visited, doc["id"])
+		done := make(chan error, 1)
+		go func() {
+			_, err := index.AddDocument(map[string]string{"id": "new-" + doc["id"], "color": "blue"})
+			if err == nil {
+				err = index.SyncMemorySegment()
+			}
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatalf("write blocked while iterating documents")
+			return nil
+		}
+	})
+	if err != nil {
+		t.Fatalf("for each : %v", err)
+	}
+	// 只遍历开始时已有的文档
+	if got := strings.Join(visited, ","); got != "a,b,c" {
+		t.Fatalf("visited = %v, want a,b,c", got)
+	}
+	if _, ok := index.GetDocumentByKey("new-c"); !ok {
+		t.Fatalf("document written during iteration not found")
+	}
+}
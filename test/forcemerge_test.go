@@ -0,0 +1,239 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// newMergeTestIndex 建立只有主键和一个字符串字段的内存目录索引
+func newMergeTestIndex(t *testing.T, dir utils.Directory) *gdindex.Index {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	index := gdindex.NewEmptyIndexIn(dir, "merge", "/godance-merge-test/", logger)
+	fields := []segment.SimpleFieldInfo{
+		{FieldName: "id", FieldType: utils.IDX_TYPE_PK},
+		{FieldName: "color", FieldType: utils.IDX_TYPE_STRING},
+	}
+	for _, field := range fields {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field %v : %v", field.FieldName, err)
+		}
+	}
+	return index
+}
+
+// 强制合并持久化内存段时，并发的写入不会写进正在持久化的段
+func TestForceMergeConcurrentWrites(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	index := newMergeTestIndex(t, dir)
+	defer index.Close()
+
+	const docs = 300
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := index.ForceMerge(gdindex.ForceMergeOptions{}); err != nil {
+				t.Errorf("force merge : %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < docs; i++ {
+		if _, err := index.AddDocument(map[string]string{"id": strconv.Itoa(i), "color": "red"}); err != nil {
+			t.Errorf("add document %v : %v", i, err)
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	if err := index.SyncMemorySegment(); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	for i := 0; i < docs; i++ {
+		if doc, ok := index.GetDocumentByKey(strconv.Itoa(i)); !ok || doc["color"] != "red" {
+			t.Fatalf("get %v = %v, %v", i, doc, ok)
+		}
+	}
+	docIds, _ := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if len(docIds) != docs {
+		t.Fatalf("search color = %v docs, want %v", len(docIds), docs)
+	}
+}
+
+// 合并替换下来的段在正在进行的搜索结束后才删除，搜索期间一直能读到文档
+func TestSearchDuringMerge(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	index := newMergeTestIndex(t, dir)
+	defer index.Close()
+
+	const seeded = 100
+	for i := 0; i < seeded; i++ {
+		if _, err := index.AddDocument(map[string]string{"id": strconv.Itoa(i), "color": "red"}); err != nil {
+			t.Fatalf("add document %v : %v", i, err)
+		}
+		if i%10 == 9 {
+			if err := index.SyncMemorySegment(); err != nil {
+				t.Fatalf("sync : %v", err)
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				docIds, _ := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+				if len(docIds) < seeded {
+					t.Errorf("search color = %v docs, want at least %v", len(docIds), seeded)
+					return
+				}
+				if doc, ok := index.GetDocument(docIds[0].Docid); !ok || doc["color"] != "red" {
+					t.Errorf("get %v = %v, %v", docIds[0].Docid, doc, ok)
+					return
+				}
+			}
+		}()
+	}
+	for i := seeded; i < seeded+20 && !t.Failed(); i++ {
+		if _, err := index.AddDocument(map[string]string{"id": strconv.Itoa(i), "color": "red"}); err != nil {
+			t.Errorf("add document %v : %v", i, err)
+			break
+		}
+		if _, err := index.ForceMerge(gdindex.ForceMergeOptions{}); err != nil {
+			t.Errorf("force merge : %v", err)
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// addSegments 每组文档写入后持久化为一个段
+func addSegments(t *testing.T, index *gdindex.Index, groups [][]string) {
+	for _, ids := range groups {
+		for _, id := range ids {
+			if _, err := index.AddDocument(map[string]string{"id": id, "color": "red"}); err != nil {
+				t.Fatalf("add document %v : %v", id, err)
+			}
+		}
+		if err := index.SyncMemorySegment(); err != nil {
+			t.Fatalf("sync : %v", err)
+		}
+	}
+}
+
+// 按策略合并时只清理被合并的段中的删除记录，其余段的删除记录留给之后的合并
+func TestMergeSegmentsKeepsOtherDeletes(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	index := newMergeTestIndex(t, dir)
+	defer index.Close()
+	if err := index.SetSettings(gdindex.IndexSettings{Merge: gdindex.MergePolicy{MaxMergeDocs: 3, SegmentsPerMerge: 2}}); err != nil {
+		t.Fatalf("set settings : %v", err)
+	}
+
+	addSegments(t, index, [][]string{{"a", "b", "c", "d", "e"}, {"f", "g"}, {"h", "i"}})
+	for _, key := range []string{"b", "f"} {
+		if err := index.DeleteDocument(key); err != nil {
+			t.Fatalf("delete %v : %v", key, err)
+		}
+	}
+
+	if err := index.MergeSegments(); err != nil {
+		t.Fatalf("merge : %v", err)
+	}
+	if segments := index.Stats().SegmentCount; segments != 2 {
+		t.Fatalf("segments after merge = %v, want 2", segments)
+	}
+	docIds, _ := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if got := docKeys(index, nodeDocIds(docIds)); got != "a,c,d,e,g,h,i" {
+		t.Fatalf("after merge = %v", got)
+	}
+
+	// 第一个段中的删除记录还在，强制合并时清理
+	res, err := index.ForceMerge(gdindex.ForceMergeOptions{})
+	if err != nil {
+		t.Fatalf("force merge : %v", err)
+	}
+	if res.ExpungedDocs != 1 || res.SegmentsAfter != 1 {
+		t.Fatalf("force merge = %+v, want 1 expunged doc and 1 segment", res)
+	}
+	docIds, _ = index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if got := docKeys(index, nodeDocIds(docIds)); got != "a,c,d,e,g,h,i" {
+		t.Fatalf("after force merge = %v", got)
+	}
+}
+
+// 只清理删除文档时，只重写删除比例超过阈值的段
+func TestForceMergeOnlyExpungeDeletes(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	index := newMergeTestIndex(t, dir)
+	defer index.Close()
+
+	addSegments(t, index, [][]string{{"a", "b", "c", "d", "e"}, {"f", "g"}, {"h", "i"}})
+	for _, key := range []string{"b", "i"} {
+		if err := index.DeleteDocument(key); err != nil {
+			t.Fatalf("delete %v : %v", key, err)
+		}
+	}
+
+	if _, err := index.ForceMerge(gdindex.ForceMergeOptions{OnlyExpungeDeletes: true, MaxNumSegments: 1}); err == nil {
+		t.Fatalf("only_expunge_deletes with max_num_segments succeeded")
+	}
+	res, err := index.ForceMerge(gdindex.ForceMergeOptions{OnlyExpungeDeletes: true, DeletesPctAllowed: 30})
+	if err != nil {
+		t.Fatalf("force merge : %v", err)
+	}
+	want := gdindex.ForceMergeResult{SegmentsBefore: 3, SegmentsAfter: 3, MergedSegments: 1, ExpungedDocs: 1}
+	if res != want {
+		t.Fatalf("force merge = %+v, want %+v", res, want)
+	}
+	docIds, _ := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if got := docKeys(index, nodeDocIds(docIds)); got != "a,c,d,e,f,g,h" {
+		t.Fatalf("after expunge = %v", got)
+	}
+
+	// 默认阈值 0 时剩下有删除文档的段也被重写
+	res, err = index.ForceMerge(gdindex.ForceMergeOptions{OnlyExpungeDeletes: true})
+	if err != nil || res.MergedSegments != 1 || res.ExpungedDocs != 1 {
+		t.Fatalf("force merge = %+v, %v, want 1 merged segment and 1 expunged doc", res, err)
+	}
+}
+
+// nodeDocIds 搜索结果中的文档 id
+func nodeDocIds(nodes []utils.DocIdNode) []uint64 {
+	docIds := make([]uint64, 0, len(nodes))
+	for _, node := range nodes {
+		docIds = append(docIds, node.Docid)
+	}
+	return docIds
+}
@@ -0,0 +1,172 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"testing"
+)
+
+func TestParseIPOrder(t *testing.T) {
+	// IPv4 地址按 IPv4-mapped 地址存储，排在 ::ffff:0:0/96 中
+	values := []string{"::", "::1", "0.0.0.0", "9.255.255.255", "10.0.0.1", "10.0.0.2", "192.168.1.1", "255.255.255.255", "2001:db8::1", "ffff::"}
+	prev := ""
+	for i, value := range values {
+		ip, err := utils.ParseIP(value)
+		if err != nil {
+			t.Fatalf("ParseIP(%q) : %v", value, err)
+		}
+		if len(ip) != utils.IP_LEN {
+			t.Errorf("ParseIP(%q) has %v bytes, want %v", value, len(ip), utils.IP_LEN)
+		}
+		if i > 0 && prev >= ip {
+			t.Errorf("ParseIP(%q) >= ParseIP(%q)", values[i-1], value)
+		}
+		if got := utils.FormatIP(ip); got != value {
+			t.Errorf("FormatIP(ParseIP(%q)) = %q", value, got)
+		}
+		prev = ip
+	}
+
+	v4, _ := utils.ParseIP("10.0.0.1")
+	mapped, _ := utils.ParseIP("::ffff:10.0.0.1")
+	if v4 != mapped {
+		t.Errorf("10.0.0.1 and ::ffff:10.0.0.1 are parsed differently")
+	}
+	for _, value := range []string{"", "10.0.0", "10.0.0.256", "abc", "10.0.0.0/8"} {
+		if _, err := utils.ParseIP(value); err == nil {
+			t.Errorf("ParseIP(%q) succeeded", value)
+		}
+	}
+	if got := utils.FormatIP("short"); got != "" {
+		t.Errorf("FormatIP(short) = %q, want empty", got)
+	}
+}
+
+func TestParseIPRange(t *testing.T) {
+	cases := []struct {
+		value  string
+		lo, hi string
+		err    bool
+	}{
+		{"10.0.0.1", "10.0.0.1", "10.0.0.1", false},
+		{" 10.1.2.3/8 ", "10.0.0.0", "10.255.255.255", false},
+		{"192.168.1.0/24", "192.168.1.0", "192.168.1.255", false},
+		{"192.168.1.7/32", "192.168.1.7", "192.168.1.7", false},
+		{"0.0.0.0/0", "0.0.0.0", "255.255.255.255", false},
+		{"2001:db8::/32", "2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", false},
+		{"::1/128", "::1", "::1", false},
+		{"10.0.0.0/33", "", "", true},
+		{"10.0.0.0/", "", "", true},
+		{"abc/8", "", "", true},
+		{"abc", "", "", true},
+	}
+	for _, c := range cases {
+		lo, hi, err := utils.ParseIPRange(c.value)
+		if (err != nil) != c.err {
+			t.Errorf("ParseIPRange(%q) err = %v", c.value, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if gotLo, gotHi := utils.FormatIP(lo), utils.FormatIP(hi); gotLo != c.lo || gotHi != c.hi {
+			t.Errorf("ParseIPRange(%q) = [%v, %v], want [%v, %v]", c.value, gotLo, gotHi, c.lo, c.hi)
+		}
+	}
+}
+
+// IP 地址字段的过滤条件按 16 字节的地址比较，等于过滤和范围的两端可以是 CIDR
+func TestIPFilters(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	index := gdindex.NewEmptyIndexIn(dir, "ip", "/godance-ip-test/", logger)
+	defer index.Close()
+	fields := []segment.SimpleFieldInfo{
+		{FieldName: "id", FieldType: utils.IDX_TYPE_PK},
+		{FieldName: "addr", FieldType: utils.IDX_TYPE_IP},
+	}
+	for _, field := range fields {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field %v : %v", field.FieldName, err)
+		}
+	}
+
+	batches := [][]map[string]string{
+		{
+			{"id": "a", "addr": "9.255.255.255"},
+			{"id": "b", "addr": "10.0.0.1"},
+			{"id": "c", "addr": "10.200.3.4"},
+		},
+		{
+			{"id": "d", "addr": "192.168.1.20"},
+			{"id": "e", "addr": "2001:db8::5"},
+			{"id": "f", "addr": ""},
+			{"id": "g", "addr": "::ffff:11.0.0.1"},
+		},
+	}
+	for _, batch := range batches {
+		for _, doc := range batch {
+			if _, err := index.AddDocument(doc); err != nil {
+				t.Fatalf("add document %v : %v", doc["id"], err)
+			}
+		}
+		if err := index.SyncMemorySegment(); err != nil {
+			t.Fatalf("sync : %v", err)
+		}
+	}
+
+	// 和搜索请求一样，由地址或 CIDR 得到过滤的上下界
+	ipRange := func(value string) (string, string) {
+		lo, hi, err := utils.ParseIPRange(value)
+		if err != nil {
+			t.Fatalf("ParseIPRange(%q) : %v", value, err)
+		}
+		return lo, hi
+	}
+	cidr8Lo, cidr8Hi := ipRange("10.0.0.0/8")
+	single, _ := ipRange("10.0.0.1")
+	v6Lo, v6Hi := ipRange("2001:db8::/32")
+	rangeLo, _ := ipRange("10.0.0.0/8")
+	_, rangeHi := ipRange("192.168.0.0/16")
+	overLo, _ := ipRange("11.0.0.0/8")
+	_, lessHi := ipRange("10.0.0.0/8")
+
+	cases := []struct {
+		name   string
+		filter utils.SearchFilters
+		want   string
+	}{
+		{"addr = 10.0.0.1", utils.SearchFilters{FieldName: "addr", Type: utils.FILT_EQ, StartTerm: single, EndTerm: single}, "b"},
+		{"addr = 10.0.0.0/8", utils.SearchFilters{FieldName: "addr", Type: utils.FILT_EQ, StartTerm: cidr8Lo, EndTerm: cidr8Hi}, "b,c"},
+		{"addr = 2001:db8::/32", utils.SearchFilters{FieldName: "addr", Type: utils.FILT_EQ, StartTerm: v6Lo, EndTerm: v6Hi}, "e"},
+		{"addr in 10.0.0.0/8 ~ 192.168.0.0/16", utils.SearchFilters{FieldName: "addr", Type: utils.FILT_RANGE, StartTerm: rangeLo, EndTerm: rangeHi}, "b,c,d,g"},
+		{"addr > 11.0.0.0/8", utils.SearchFilters{FieldName: "addr", Type: utils.FILT_OVER, StartTerm: overLo}, "d,e,g"},
+		{"addr < 10.0.0.0/8", utils.SearchFilters{FieldName: "addr", Type: utils.FILT_LESS, EndTerm: lessHi}, "a,b,c"},
+		{"addr missing", utils.SearchFilters{FieldName: "addr", Type: utils.FILT_MISSING}, "f"},
+	}
+	check := func(stage string) {
+		for _, c := range cases {
+			docIds, _ := index.SearchFilterDocIds(c.filter)
+			if got := docKeys(index, docIds); got != c.want {
+				t.Errorf("%v : %v = %v, want %v", stage, c.name, got, c.want)
+			}
+		}
+	}
+
+	check("before merge")
+	if _, err := index.ForceMerge(gdindex.ForceMergeOptions{}); err != nil {
+		t.Fatalf("force merge : %v", err)
+	}
+	check("after merge")
+
+	doc, ok := index.GetDocumentByKey("g")
+	if !ok || doc["addr"] != "11.0.0.1" {
+		t.Errorf("get g = %v, %v, want addr 11.0.0.1", doc, ok)
+	}
+}
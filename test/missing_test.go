@@ -0,0 +1,65 @@
+package test
+
+import (
+	"GoDance/engine"
+	"strings"
+	"testing"
+)
+
+// searchKeys 搜索后按返回的顺序列出 id
+func searchKeys(t *testing.T, gde *engine.GoDanceEngine, params map[string]string) string {
+	query := map[string]string{"pageSize": "20", "curPage": "1"}
+	for key, value := range params {
+		query[key] = value
+	}
+	result, err := gde.Search(query)
+	if err != nil {
+		t.Fatalf("search %v : %v", params, err)
+	}
+	keys := make([]string, 0, len(result.Results))
+	for _, doc := range result.Results {
+		keys = append(keys, doc["id"])
+	}
+	return strings.Join(keys, ",")
+}
+
+// 有值位图区分空值和值为 -1 的文档，exists/missing 过滤和排序时空值的位置都按它判断
+func TestExistsMissingAndSortMissing(t *testing.T) {
+	gde := newTestEngine(t)
+	createTestIndex(t, gde, "nulls", `{"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"n","fieldType":11},{"fieldName":"tag","fieldType":1}]}`)
+	addTestDocuments(t, gde, "nulls",
+		`{"id":"1","n":"5","tag":"a"}`,
+		`{"id":"2","n":"-1","tag":"a"}`,
+		`{"id":"3","tag":"a"}`,
+		`{"id":"4","n":"3"}`,
+		`{"id":"5","n":"","tag":"a"}`)
+	if err := gde.SyncIndex("nulls"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+
+	for _, c := range []struct {
+		params map[string]string
+		want   string
+	}{
+		{map[string]string{"index": "nulls", "exists": "n", "sort": "id"}, "1,2,4"},
+		{map[string]string{"index": "nulls", "missing": "n", "sort": "id"}, "3,5"},
+		{map[string]string{"index": "nulls", "exists": "n,tag", "sort": "id"}, "1,2"},
+		{map[string]string{"index": "nulls", "missing": "tag", "sort": "id"}, "4"},
+		// 范围和等值过滤不匹配空值
+		{map[string]string{"index": "nulls", ">n": "-5", "sort": "id"}, "1,2,4"},
+		{map[string]string{"index": "nulls", "-n": "-1", "sort": "id"}, "2"},
+		{map[string]string{"index": "nulls", "tag": "a", "missing": "n", "sort": "id"}, "3,5"},
+		{map[string]string{"index": "nulls", "tag": "a", "sort": "n,id"}, "2,1,3,5"},
+		{map[string]string{"index": "nulls", "tag": "a", "sort": "n:desc:last,id"}, "1,2,3,5"},
+		{map[string]string{"index": "nulls", "tag": "a", "sort": "n:asc:first,id"}, "3,5,2,1"},
+		{map[string]string{"index": "nulls", "tag": "a", "sort": "n:desc:first,id:desc"}, "5,3,1,2"},
+	} {
+		if got := searchKeys(t, gde, c.params); got != c.want {
+			t.Fatalf("search %v = %v, want %v", c.params, got, c.want)
+		}
+	}
+
+	if _, err := gde.Search(map[string]string{"index": "nulls", "pageSize": "20", "curPage": "1", "tag": "a", "sort": "n:asc:middle"}); err == nil {
+		t.Fatalf("sort with an unknown missing option succeeded")
+	}
+}
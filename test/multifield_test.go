@@ -0,0 +1,157 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"strings"
+	"testing"
+)
+
+const multiFieldIndexPath = "/godance-multifield-test/"
+
+// newMultiFieldIndex 建立 title 带全词匹配子字段、price 带数字子字段、flag 带布尔子字段的索引
+func newMultiFieldIndex(t *testing.T, dir utils.Directory) *gdindex.Index {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	index := gdindex.NewEmptyIndexIn(dir, "multi", multiFieldIndexPath, logger)
+	if err := index.SetSettings(gdindex.IndexSettings{Analyzer: utils.ANALYZER_WHITESPACE}); err != nil {
+		t.Fatalf("set settings : %v", err)
+	}
+	fields := []segment.SimpleFieldInfo{
+		{FieldName: "id", FieldType: utils.IDX_TYPE_PK},
+		{FieldName: "title", FieldType: utils.IDX_TYPE_STRING_SEG, Fields: []segment.SimpleFieldInfo{{FieldName: "keyword", FieldType: utils.IDX_TYPE_STRING}}},
+		{FieldName: "price", FieldType: utils.IDX_TYPE_STRING, Fields: []segment.SimpleFieldInfo{{FieldName: "num", FieldType: utils.IDX_TYPE_NUMBER}}},
+		{FieldName: "flag", FieldType: utils.IDX_TYPE_STRING, Fields: []segment.SimpleFieldInfo{{FieldName: "b", FieldType: utils.IDX_TYPE_BOOL}}},
+	}
+	for _, field := range fields {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field %v : %v", field.FieldName, err)
+		}
+	}
+	return index
+}
+
+// checkMultiFields 按子字段检索、统计和排序，返回的文档中只有父字段
+func checkMultiFields(t *testing.T, stage string, index *gdindex.Index) {
+	docIds, _ := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "title.keyword", Value: "red apple"})
+	if got := docKeys(index, nodeDocIds(docIds)); got != "1,3" {
+		t.Fatalf("%v : title.keyword = %v, want 1,3", stage, got)
+	}
+	if docIds, _ := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "title.keyword", Value: "red"}); len(docIds) != 0 {
+		t.Fatalf("%v : title.keyword matched a partial value", stage)
+	}
+	docIds, _ = index.SearchKeyDocIds(utils.SearchQuery{FieldName: "title", Value: "red"})
+	if got := docKeys(index, nodeDocIds(docIds)); got != "1,3,4" {
+		t.Fatalf("%v : title = %v, want 1,3,4", stage, got)
+	}
+
+	all := []uint64{}
+	for docId := uint64(0); docId < index.MaxDocId; docId++ {
+		if _, ok := index.GetDocument(docId); ok {
+			all = append(all, docId)
+		}
+	}
+	facets, err := index.Facet(all, "title.keyword", 10)
+	if err != nil || len(facets) == 0 || facets[0] != (utils.FacetItem{Value: "red apple", Count: 2}) {
+		t.Fatalf("%v : facet title.keyword = %v, %v", stage, facets, err)
+	}
+	if err := index.SortDocIds(all, []gdindex.SortSpec{{Field: "price.num"}}); err != nil {
+		t.Fatalf("%v : sort : %v", stage, err)
+	}
+	if got := sortedKeys(index, all); got != "4,2,1,3" {
+		t.Fatalf("%v : sort by price.num = %v, want 4,2,1,3", stage, got)
+	}
+	if err := index.SortDocIds(all, []gdindex.SortSpec{{Field: "flag.b", Desc: true}, {Field: "price.num"}}); err != nil {
+		t.Fatalf("%v : sort : %v", stage, err)
+	}
+	if got := sortedKeys(index, all); got != "2,3,1,4" {
+		t.Fatalf("%v : sort by flag.b = %v, want 2,3,1,4", stage, got)
+	}
+
+	doc, ok := index.GetDocumentByKey("1")
+	if !ok || doc["title"] != "red apple" || doc["price"] != "30" || doc["flag"] != "false" {
+		t.Fatalf("%v : get 1 = %v, %v", stage, doc, ok)
+	}
+	for _, sub := range []string{"title.keyword", "price.num", "flag.b"} {
+		if _, ok := doc[sub]; ok {
+			t.Fatalf("%v : document has sub field %v", stage, sub)
+		}
+	}
+}
+
+// 子字段按父字段的值建索引，内容只存储在父字段中，合并和重新加载后仍然可以按子字段检索
+func TestMultiFieldIndexOnly(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	index := newMultiFieldIndex(t, dir)
+
+	docs := []map[string]string{
+		{"id": "1", "title": "red apple", "price": "30", "flag": "false"},
+		{"id": "2", "title": "green pear", "price": "20", "flag": "true"},
+		{"id": "3", "title": "red apple", "price": "40", "flag": "true"},
+		{"id": "4", "title": "red grape", "price": "10", "title.keyword": "ignored"},
+	}
+	for i, doc := range docs {
+		if _, err := index.AddDocument(doc); err != nil {
+			t.Fatalf("add document %v : %v", doc["id"], err)
+		}
+		if i == 1 {
+			if err := index.SyncMemorySegment(); err != nil {
+				t.Fatalf("sync : %v", err)
+			}
+		}
+	}
+	// 内存段中的子字段不返回
+	if doc, ok := index.GetDocumentByKey("4"); !ok || doc["title"] != "red grape" || doc["title.keyword"] != "" {
+		t.Fatalf("get 4 from memory = %v, %v", doc, ok)
+	}
+
+	if err := index.SyncMemorySegment(); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	checkMultiFields(t, "persisted", index)
+	for _, name := range index.SegmentNames {
+		if !dir.Exist(name + "title_detail.dtl") {
+			t.Fatalf("segment %v has no stored title", name)
+		}
+		for _, file := range []string{"title.keyword_profile.pfl", "title.keyword_detail.dtl", "price.num_profile.pfl", "flag.b_profile.pfl"} {
+			if dir.Exist(name + file) {
+				t.Fatalf("segment %v stores sub field file %v", name, file)
+			}
+		}
+	}
+
+	if _, err := index.ForceMerge(gdindex.ForceMergeOptions{MaxNumSegments: 1}); err != nil {
+		t.Fatalf("force merge : %v", err)
+	}
+	checkMultiFields(t, "merged", index)
+	if report, err := index.Check(false); err != nil || len(report.Issues) != 0 {
+		t.Fatalf("check after merge = %+v, %v", report, err)
+	}
+	if err := index.Close(); err != nil {
+		t.Fatalf("close : %v", err)
+	}
+
+	logger, _ := utils.NewLogger("GoDanceTest")
+	index = gdindex.NewIndexFromLocalFileIn(dir, "multi", multiFieldIndexPath, logger)
+	defer index.Close()
+	checkMultiFields(t, "reloaded", index)
+	for _, name := range index.SegmentNames {
+		if dir.Exist(name + "title.keyword_detail.dtl") {
+			t.Fatalf("merged segment %v stores sub field content", name)
+		}
+	}
+}
+
+// sortedKeys 按排序后的顺序列出文档的主键
+func sortedKeys(index *gdindex.Index, docIds []uint64) string {
+	keys := make([]string, 0, len(docIds))
+	for _, docId := range docIds {
+		doc, _ := index.GetDocument(docId)
+		keys = append(keys, doc["id"])
+	}
+	return strings.Join(keys, ",")
+}
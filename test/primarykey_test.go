@@ -0,0 +1,153 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/index/tree"
+	"GoDance/utils"
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+const primaryKeyIndexPath = "/godance-pk-test/"
+
+// 字符串主键和联合主键可以写入、按主键取回、替换和删除，重新加载后仍然有效
+func TestStringAndCompositePrimaryKey(t *testing.T) {
+	gde := newTestEngine(t)
+	createTestIndex(t, gde, "users", `{"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"name","fieldType":1}]}`)
+	createTestIndex(t, gde, "orders", `{"fieldsmapping":[{"fieldName":"region","fieldType":21},{"fieldName":"no","fieldType":21},{"fieldName":"item","fieldType":1}]}`)
+
+	addTestDocuments(t, gde, "users", `{"id":"user-a@example.com","name":"a"}`, `{"id":"007","name":"b"}`)
+	addTestDocuments(t, gde, "orders", `{"region":"eu","no":"1","item":"pen"}`, `{"region":"us","no":"1","item":"ink"}`,
+		`{"region":"eu","no":"1","item":"cup"}`)
+
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "users", "pk": "user-a@example.com"}); err != nil || doc["name"] != "a" {
+		t.Fatalf("get user a = %v, %v", doc, err)
+	}
+	// 字符串主键不会按数字归一化
+	if _, err := gde.GetDocByKey(map[string]string{"index": "users", "pk": "7"}); err == nil {
+		t.Fatalf("get 7 matched the key 007")
+	}
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "orders", "region": "eu", "no": "1"}); err != nil || doc["item"] != "cup" {
+		t.Fatalf("get eu/1 = %v, %v, want the replaced item", doc, err)
+	}
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "orders", "pk": "us" + gdindex.PK_SEPARATOR + "1"}); err != nil || doc["item"] != "ink" {
+		t.Fatalf("get us/1 by joined key = %v, %v", doc, err)
+	}
+	if _, err := gde.GetDocByKey(map[string]string{"index": "orders", "region": "eu"}); err == nil {
+		t.Fatalf("get with part of a composite key succeeded")
+	}
+
+	if _, err := gde.DeleteDocument(map[string]string{"index": "orders", "region": "us", "no": "1"}); err != nil {
+		t.Fatalf("delete us/1 : %v", err)
+	}
+	if err := gde.SyncIndex("orders"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	if _, err := gde.GetDocByKey(map[string]string{"index": "orders", "region": "us", "no": "1"}); err == nil {
+		t.Fatalf("deleted us/1 is still found")
+	}
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "orders", "region": "eu", "no": "1"}); err != nil || doc["item"] != "cup" {
+		t.Fatalf("get eu/1 after sync = %v, %v", doc, err)
+	}
+}
+
+// 旧版本以 int64 为 key 的主键树在加载时迁移为字符串主键
+func TestLegacyPrimaryKeyMigration(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+
+	index := gdindex.NewEmptyIndexIn(dir, "legacy", primaryKeyIndexPath, logger)
+	for _, field := range []segment.SimpleFieldInfo{
+		{FieldName: "id", FieldType: utils.IDX_TYPE_PK},
+		{FieldName: "color", FieldType: utils.IDX_TYPE_STRING},
+	} {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field %v : %v", field.FieldName, err)
+		}
+	}
+	for _, id := range []string{"10", "-3", "20"} {
+		if _, err := index.AddDocument(map[string]string{"id": id, "color": "red"}); err != nil {
+			t.Fatalf("add document %v : %v", id, err)
+		}
+	}
+	if err := index.SyncMemorySegment(); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	if err := index.Close(); err != nil {
+		t.Fatalf("close : %v", err)
+	}
+
+	// 改写为旧版本的格式：主键树以主键字段名为树名、以 int64 为 key，元信息中没有主键字段列表
+	path, err := dir.LocalPath(primaryKeyIndexPath + "legacy_primary.pk")
+	if err != nil {
+		t.Fatalf("local path : %v", err)
+	}
+	primary := tree.NewBTDB(path, logger)
+	legacy := make(map[int64]string)
+	err = primary.ForEach(gdindex.PRIMARY_BTREE, func(key []byte, value string) error {
+		id, err := strconv.ParseInt(string(key), 10, 64)
+		legacy[id] = value
+		return err
+	})
+	if err != nil || len(legacy) != 3 {
+		t.Fatalf("read primary keys = %v, %v", legacy, err)
+	}
+	if err := primary.AddBTree("id"); err != nil {
+		t.Fatalf("add legacy tree : %v", err)
+	}
+	if err := primary.SetBatch("id", legacy); err != nil {
+		t.Fatalf("write legacy keys : %v", err)
+	}
+	if err := primary.DeleteBTree(gdindex.PRIMARY_BTREE); err != nil {
+		t.Fatalf("delete primary tree : %v", err)
+	}
+	primary.Close()
+
+	metaName := primaryKeyIndexPath + "legacy.meta"
+	buf, err := dir.ReadFile(metaName)
+	if err != nil {
+		t.Fatalf("read meta : %v", err)
+	}
+	meta := make(map[string]interface{})
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		t.Fatalf("parse meta : %v", err)
+	}
+	delete(meta, "primaryKeyFields")
+	if buf, err = json.Marshal(meta); err != nil {
+		t.Fatalf("encode meta : %v", err)
+	}
+	if err := dir.WriteFile(metaName, buf); err != nil {
+		t.Fatalf("write meta : %v", err)
+	}
+
+	index = gdindex.NewIndexFromLocalFileIn(dir, "legacy", primaryKeyIndexPath, logger)
+	defer index.Close()
+	if len(index.PrimaryKeyFields) != 1 || index.PrimaryKeyFields[0] != "id" {
+		t.Fatalf("primary key fields = %v, want [id]", index.PrimaryKeyFields)
+	}
+	for _, id := range []string{"10", "-3", "20"} {
+		if doc, ok := index.GetDocumentByKey(id); !ok || doc["id"] != id {
+			t.Fatalf("get migrated %v = %v, %v", id, doc, ok)
+		}
+	}
+
+	// 迁移后的主键可以继续替换和删除
+	if _, err := index.AddDocument(map[string]string{"id": "10", "color": "blue"}); err != nil {
+		t.Fatalf("replace 10 : %v", err)
+	}
+	if doc, ok := index.GetDocumentByKey("10"); !ok || doc["color"] != "blue" {
+		t.Fatalf("get replaced 10 = %v, %v", doc, ok)
+	}
+	if err := index.DeleteDocument("20"); err != nil {
+		t.Fatalf("delete 20 : %v", err)
+	}
+	if _, ok := index.GetDocumentByKey("20"); ok {
+		t.Fatalf("deleted 20 is still found")
+	}
+}
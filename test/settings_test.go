@@ -0,0 +1,187 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 修改设置时合并到原有的设置上，没有指定过的项不会被固定为当前的默认值
+func TestUpdateSettingsMergesRawSettings(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	index := gdindex.NewEmptyIndexIn(dir, "settings", "/godance-settings-test/", logger)
+	defer index.Close()
+	if err := index.AddField(segment.SimpleFieldInfo{FieldName: "id", FieldType: utils.IDX_TYPE_PK}); err != nil {
+		t.Fatalf("add field : %v", err)
+	}
+	if err := index.SetSettings(gdindex.IndexSettings{FlushBytes: 1024}); err != nil {
+		t.Fatalf("set settings : %v", err)
+	}
+
+	effective, err := index.UpdateSettings([]byte(`{"similarity":"boolean","merge":{"segmentsPerMerge":4}}`))
+	if err != nil {
+		t.Fatalf("update settings : %v", err)
+	}
+	want := gdindex.IndexSettings{FlushBytes: 1024, Similarity: gdindex.SIMILARITY_BOOLEAN, Merge: gdindex.MergePolicy{SegmentsPerMerge: 4}}
+	if index.Settings != want {
+		t.Fatalf("raw settings = %+v, want %+v", index.Settings, want)
+	}
+	if effective != index.EffectiveSettings() || effective.FlushDocs != utils.MAX_SEGMENT_SIZE ||
+		effective.Merge.MaxMergeDocs != gdindex.DEFAULT_MAX_MERGE_DOCS {
+		t.Fatalf("effective settings = %+v", effective)
+	}
+
+	for _, body := range []string{`{"merge":{"segmentsPerMerge":1}}`, `{"similarity":"bm25"}`, `{`} {
+		if _, err := index.UpdateSettings([]byte(body)); err == nil {
+			t.Errorf("update settings %v succeeded", body)
+		}
+	}
+	if index.Settings != want {
+		t.Fatalf("raw settings after rejected updates = %+v, want %+v", index.Settings, want)
+	}
+}
+
+// 读取设置不需要等待文档写入，与修改设置并发时读到的是完整的设置
+func TestEffectiveSettingsConcurrentUpdate(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	index := gdindex.NewEmptyIndexIn(dir, "settings", "/godance-settings-test/", logger)
+	defer index.Close()
+	if err := index.AddField(segment.SimpleFieldInfo{FieldName: "id", FieldType: utils.IDX_TYPE_PK}); err != nil {
+		t.Fatalf("add field : %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			similarity := gdindex.SIMILARITY_TFIDF
+			if i%2 == 0 {
+				similarity = gdindex.SIMILARITY_BOOLEAN
+			}
+			if err := index.SetSettings(gdindex.IndexSettings{Similarity: similarity}); err != nil {
+				t.Errorf("set settings : %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 500; i++ {
+		switch similarity := index.EffectiveSettings().Similarity; similarity {
+		case gdindex.SIMILARITY_TFIDF, gdindex.SIMILARITY_BOOLEAN:
+		default:
+			t.Fatalf("similarity = %q", similarity)
+		}
+	}
+	wg.Wait()
+}
+
+// 压缩方式属于索引的设置，修改后对内存段生效，跨多个压缩块的内容读取不变，重新加载后仍然生效
+func TestCodecSetting(t *testing.T) {
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+
+	index := gdindex.NewEmptyIndexIn(dir, "codec", "/godance-codec-test/", logger)
+	for _, field := range []segment.SimpleFieldInfo{{FieldName: "id", FieldType: utils.IDX_TYPE_PK}, {FieldName: "body", FieldType: utils.IDX_TYPE_STRING}} {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field : %v", err)
+		}
+	}
+	if _, err := index.UpdateSettings([]byte(`{"codec":"lz4"}`)); err == nil {
+		t.Fatalf("unknown codec accepted")
+	}
+	if effective := index.EffectiveSettings(); effective.Codec != segment.CODEC_NONE {
+		t.Fatalf("default codec = %q, want none", effective.Codec)
+	}
+
+	// 写入第一条文档后再修改，内存段中已有的文档也按新的压缩方式写入
+	body := func(i int) string {
+		if i%500 == 7 {
+			return strings.Repeat(fmt.Sprintf("large-%v ", i), 4000)
+		}
+		return fmt.Sprintf("document body number %v %v", i, strings.Repeat("x", i%50))
+	}
+	const docs = 3000
+	rawBytes := 0
+	for i := 0; i < docs; i++ {
+		if _, err := index.AddDocument(map[string]string{"id": strconv.Itoa(i), "body": body(i)}); err != nil {
+			t.Fatalf("add document %v : %v", i, err)
+		}
+		rawBytes += len(body(i))
+		if i == 0 {
+			if _, err := index.UpdateSettings([]byte(`{"codec":"snappy"}`)); err != nil {
+				t.Fatalf("update settings : %v", err)
+			}
+		}
+	}
+	if err := index.SyncMemorySegment(); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	if index.Settings.Codec != segment.CODEC_SNAPPY || index.Stats().Codec != segment.CODEC_SNAPPY {
+		t.Fatalf("codec = %q, stats %q", index.Settings.Codec, index.Stats().Codec)
+	}
+	size, err := dir.FileSize(index.SegmentNames[0] + "body_detail.dtl")
+	if err != nil || size >= int64(rawBytes)/2 {
+		t.Fatalf("detail size = %v, %v, raw %v bytes", size, err, rawBytes)
+	}
+
+	checkBodies := func(stage string, index *gdindex.Index) {
+		for i := 0; i < docs; i++ {
+			doc, ok := index.GetDocumentByKey(strconv.Itoa(i))
+			if !ok || doc["body"] != body(i) {
+				t.Fatalf("%v : get %v = %.40q, %v", stage, i, doc["body"], ok)
+			}
+		}
+	}
+	checkBodies("persisted", index)
+	if err := index.Close(); err != nil {
+		t.Fatalf("close : %v", err)
+	}
+
+	// 旧版本的元信息把压缩方式记录在顶层
+	metaName := "/godance-codec-test/codec.meta"
+	buf, err := dir.ReadFile(metaName)
+	if err != nil {
+		t.Fatalf("read meta : %v", err)
+	}
+	meta := make(map[string]interface{})
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		t.Fatalf("parse meta : %v", err)
+	}
+	delete(meta["settings"].(map[string]interface{}), "codec")
+	meta["codec"] = segment.CODEC_SNAPPY
+	if buf, err = json.Marshal(meta); err != nil {
+		t.Fatalf("marshal meta : %v", err)
+	}
+	if err := dir.WriteFile(metaName, buf); err != nil {
+		t.Fatalf("write meta : %v", err)
+	}
+
+	index = gdindex.NewIndexFromLocalFileIn(dir, "codec", "/godance-codec-test/", logger)
+	defer index.Close()
+	if codec := index.EffectiveSettings().Codec; codec != segment.CODEC_SNAPPY {
+		t.Fatalf("codec after loading legacy meta = %q, want snappy", codec)
+	}
+	checkBodies("reloaded", index)
+}
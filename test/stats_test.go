@@ -0,0 +1,93 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/utils"
+	"testing"
+)
+
+// 统计持久化的段和内存段中的文档数和删除文档数，合并清理后的文档不再计为删除
+func TestIndexStats(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	index := newMergeTestIndex(t, dir)
+	defer index.Close()
+
+	addSegments(t, index, [][]string{{"a", "b", "c", "d", "e"}})
+	for _, id := range []string{"f", "g", "h"} {
+		if _, err := index.AddDocument(map[string]string{"id": id, "color": "blue"}); err != nil {
+			t.Fatalf("add document %v : %v", id, err)
+		}
+	}
+	for _, key := range []string{"b", "g"} {
+		if err := index.DeleteDocument(key); err != nil {
+			t.Fatalf("delete %v : %v", key, err)
+		}
+	}
+
+	stats := index.Stats()
+	if stats.DocCount != 6 || stats.DeletedDocs != 2 || stats.MaxDocId != 8 || stats.SegmentCount != 1 {
+		t.Fatalf("stats = %+v, want 6 docs, 2 deleted, max docId 8 and 1 segment", stats)
+	}
+	if stats.Codec != "none" || stats.MemorySegment.DocCount != 3 || stats.Bitmap.SetBits != 2 || stats.Bytes <= 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.Fields["id"].Type != utils.IDX_TYPE_PK || stats.Fields["color"].Type != utils.IDX_TYPE_STRING || stats.Fields["color"].Terms != 2 {
+		t.Fatalf("field stats = %+v", stats.Fields)
+	}
+
+	segments := index.Segments()
+	if len(segments) != 2 || segments[0].IsMemory || !segments[1].IsMemory {
+		t.Fatalf("segments = %+v, want a persisted segment and the memory segment", segments)
+	}
+	if segments[0].DocCount != 4 || segments[0].DeletedDocs != 1 || segments[0].Bytes <= 0 {
+		t.Fatalf("persisted segment = %+v, want 4 docs and 1 deleted", segments[0])
+	}
+	if segments[1].DocCount != 2 || segments[1].DeletedDocs != 1 {
+		t.Fatalf("memory segment = %+v, want 2 docs and 1 deleted", segments[1])
+	}
+
+	if _, err := index.ForceMerge(gdindex.ForceMergeOptions{MaxNumSegments: 1}); err != nil {
+		t.Fatalf("force merge : %v", err)
+	}
+	stats = index.Stats()
+	if stats.DocCount != 6 || stats.DeletedDocs != 0 || stats.SegmentCount != 1 {
+		t.Fatalf("stats after merge = %+v, want 6 docs, no deleted docs and 1 segment", stats)
+	}
+	if segments := index.Segments(); segments[0].DocCount != 6 || segments[0].DeletedDocs != 0 {
+		t.Fatalf("merged segment = %+v", segments[0])
+	}
+}
+
+// 引擎汇总所有索引的统计信息
+func TestEngineStats(t *testing.T) {
+	gde := newTestEngine(t)
+	createTestIndex(t, gde, "s1", `{"fieldsmapping":[{"fieldName":"id","fieldType":21}]}`)
+	createTestIndex(t, gde, "s2", `{"fieldsmapping":[{"fieldName":"id","fieldType":21}]}`)
+	addTestDocuments(t, gde, "s1", `{"id":"a"}`, `{"id":"b"}`)
+	addTestDocuments(t, gde, "s2", `{"id":"c"}`)
+	if err := gde.SyncIndex("s1"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	if _, err := gde.DeleteDocument(map[string]string{"index": "s1", "pk": "a"}); err != nil {
+		t.Fatalf("delete : %v", err)
+	}
+
+	stats := gde.Stats()
+	if stats.IndexCount != 2 || stats.DocCount != 2 || stats.DeletedDocs != 1 || stats.SegmentCount != 1 {
+		t.Fatalf("engine stats = %+v", stats)
+	}
+	if s1 := stats.Indexes["s1"]; s1.DocCount != 1 || s1.DeletedDocs != 1 || s1.Path == "" {
+		t.Fatalf("s1 summary = %+v", s1)
+	}
+	if len(stats.DataPaths) != 1 || len(stats.DataPaths[0].Indexes) != 2 {
+		t.Fatalf("data paths = %+v", stats.DataPaths)
+	}
+
+	if indexStats, err := gde.IndexStats("s2"); err != nil || indexStats.DocCount != 1 {
+		t.Fatalf("s2 stats = %+v, %v", indexStats, err)
+	}
+	if _, err := gde.IndexStats("missing"); err == nil {
+		t.Fatalf("stats of a missing index succeeded")
+	}
+}
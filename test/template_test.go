@@ -0,0 +1,92 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 向不存在的索引写入文档时，按优先级最高的匹配模板创建索引，没有匹配的模板时写入失败
+func TestTemplateAutoCreate(t *testing.T) {
+	gde := newTestEngine(t)
+	if err := gde.PutTemplate("logs", []byte(`{"indexPatterns":["logs-*"],"priority":1,"ttl":"7d",
+		"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"msg","fieldType":1}]}`)); err != nil {
+		t.Fatalf("put template logs : %v", err)
+	}
+	if err := gde.PutTemplate("special", []byte(`{"indexPatterns":["logs-special-*"],"priority":5,
+		"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"level","fieldType":1}],"settings":{"codec":"snappy"}}`)); err != nil {
+		t.Fatalf("put template special : %v", err)
+	}
+	for _, body := range []string{
+		`{"indexPatterns":[]}`,
+		`{"indexPatterns":["logs-["]}`,
+		`{"indexPatterns":["x-*"],"ttl":"soon"}`,
+	} {
+		if err := gde.PutTemplate("bad", []byte(body)); err == nil {
+			t.Fatalf("put template %v succeeded", body)
+		}
+	}
+	if templates := gde.GetTemplates(); len(templates) != 2 || templates[0].Name != "logs" || templates[1].Name != "special" {
+		t.Fatalf("templates = %+v", templates)
+	}
+
+	addTestDocuments(t, gde, "logs-2026.10.19", `{"id":"1","msg":"hello","level":"info"}`)
+	mapping, err := gde.IndexMapping("logs-2026.10.19")
+	if err != nil || mapping["msg"] == 0 || mapping["level"] != 0 {
+		t.Fatalf("mapping of logs-2026.10.19 = %v, %v, want the fields of logs", mapping, err)
+	}
+	doc, err := gde.GetDocByKey(map[string]string{"index": "logs-2026.10.19", "pk": "1"})
+	if err != nil || doc["msg"] != "hello" || doc["_expire"] == "" {
+		t.Fatalf("get 1 = %v, %v, want a document with the template ttl", doc, err)
+	}
+
+	body := strings.Join([]string{`{"index":{"_index":"logs-special-a"}}`, `{"id":"1","level":"warn"}`}, "\n")
+	result, err := gde.Bulk(map[string]string{}, []byte(body))
+	if err != nil || result.Errors || result.Items[0].Status != http.StatusOK {
+		t.Fatalf("bulk into logs-special-a = %+v, %v", result, err)
+	}
+	if mapping, err := gde.IndexMapping("logs-special-a"); err != nil || mapping["level"] == 0 || mapping["msg"] != 0 {
+		t.Fatalf("mapping of logs-special-a = %v, %v, want the fields of special", mapping, err)
+	}
+	if settings, err := gde.GetSettings("logs-special-a"); err != nil || settings.Codec != "snappy" {
+		t.Fatalf("settings of logs-special-a = %+v, %v", settings, err)
+	}
+
+	// 并发写入同一个新索引时只创建一次，所有写入都成功
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doc := fmt.Sprintf(`{"id":"%v","msg":"m"}`, i)
+			if _, err := gde.AddDocument(map[string]string{"index": "logs-concurrent"}, []byte(doc)); err != nil {
+				t.Errorf("concurrent add %v : %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stats, err := gde.IndexStats("logs-concurrent"); err != nil || stats.DocCount != 8 {
+		t.Fatalf("logs-concurrent stats = %+v, %v, want 8 docs", stats, err)
+	}
+
+	if _, err := gde.AddDocument(map[string]string{"index": "metrics-1"}, []byte(`{"id":"1"}`)); err == nil {
+		t.Fatalf("write to an index without a template succeeded")
+	}
+	if _, err := gde.IndexMapping("metrics-1"); err == nil {
+		t.Fatalf("index without a template was created")
+	}
+
+	// 删除模板后不再自动创建，已经创建的索引不受影响
+	if err := gde.DeleteTemplate("logs"); err != nil {
+		t.Fatalf("delete template : %v", err)
+	}
+	if err := gde.DeleteTemplate("logs"); err == nil {
+		t.Fatalf("delete a missing template succeeded")
+	}
+	if _, err := gde.AddDocument(map[string]string{"index": "logs-2026.10.20"}, []byte(`{"id":"1"}`)); err == nil {
+		t.Fatalf("write after deleting the template succeeded")
+	}
+	addTestDocuments(t, gde, "logs-2026.10.19", `{"id":"2","msg":"again"}`)
+}
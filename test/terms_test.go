@@ -0,0 +1,73 @@
+package test
+
+import (
+	"GoDance/engine"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// termsString 按 词:文档数 的形式列出词典的一页
+func termsString(t *testing.T, gde *engine.GoDanceEngine, params map[string]string) (string, string) {
+	res, err := gde.Terms(params)
+	if err != nil {
+		t.Fatalf("terms %v : %v", params, err)
+	}
+	terms := make([]string, 0, len(res.Terms))
+	for _, term := range res.Terms {
+		terms = append(terms, fmt.Sprintf("%v:%v", term.Term, term.DocFreq))
+	}
+	return strings.Join(terms, ","), res.Next
+}
+
+// 词典合并持久化的段和内存段中的词，支持前缀、范围、分页和去掉已删除的文档
+func TestTermsEnumeration(t *testing.T) {
+	gde := newTestEngine(t)
+	createTestIndex(t, gde, "terms", `{"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"tag","fieldType":1},{"fieldName":"n","fieldType":11}]}`)
+	addTestDocuments(t, gde, "terms", `{"id":"1","tag":"apple"}`, `{"id":"2","tag":"apricot"}`, `{"id":"3","tag":"banana"}`)
+	if err := gde.SyncIndex("terms"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	addTestDocuments(t, gde, "terms", `{"id":"4","tag":"apple"}`, `{"id":"5","tag":"cherry"}`)
+	for _, key := range []string{"1", "3"} {
+		if _, err := gde.DeleteDocument(map[string]string{"index": "terms", "pk": key}); err != nil {
+			t.Fatalf("delete %v : %v", key, err)
+		}
+	}
+
+	for _, c := range []struct {
+		params map[string]string
+		terms  string
+		next   string
+	}{
+		{map[string]string{}, "apple:2,apricot:1,banana:1,cherry:1", ""},
+		{map[string]string{"exclude_deleted": "true"}, "apple:1,apricot:1,cherry:1", ""},
+		{map[string]string{"prefix": "ap"}, "apple:2,apricot:1", ""},
+		{map[string]string{"from": "b", "to": "c"}, "banana:1", ""},
+		{map[string]string{"size": "2"}, "apple:2,apricot:1", "apricot"},
+		{map[string]string{"size": "2", "after": "apricot"}, "banana:1,cherry:1", ""},
+		{map[string]string{"prefix": "z"}, "", ""},
+	} {
+		params := map[string]string{"index": "terms", "field": "tag"}
+		for key, value := range c.params {
+			params[key] = value
+		}
+		terms, next := termsString(t, gde, params)
+		if terms != c.terms || next != c.next {
+			t.Fatalf("terms %v = %v next %q, want %v next %q", c.params, terms, next, c.terms, c.next)
+		}
+	}
+
+	for _, params := range []map[string]string{
+		{"index": "terms", "field": "n"},
+		{"index": "terms", "field": "missing"},
+		{"index": "terms", "field": "tag", "size": "0"},
+		{"index": "terms", "field": "tag", "exclude_deleted": "maybe"},
+		{"index": "terms"},
+		{"index": "missing", "field": "tag"},
+	} {
+		if _, err := gde.Terms(params); err == nil {
+			t.Fatalf("terms %v succeeded", params)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	gdindex "GoDance/index"
+	"GoDance/index/segment"
+	"GoDance/utils"
+	"strings"
+	"testing"
+)
+
+// 过期的文档在后台清理之前就不再被取回、检索和遍历，清理时标记为删除
+func TestTTLHidesExpiredDocuments(t *testing.T) {
+	dir := utils.NewMemoryDirectory()
+	defer dir.Close()
+	logger, err := utils.NewLogger("GoDanceTest")
+	if err != nil {
+		t.Fatalf("logger : %v", err)
+	}
+	index := gdindex.NewEmptyIndexIn(dir, "ttl", "/godance-ttl-test/", logger)
+	defer index.Close()
+	for _, field := range []segment.SimpleFieldInfo{
+		{FieldName: "id", FieldType: utils.IDX_TYPE_PK},
+		{FieldName: "color", FieldType: utils.IDX_TYPE_STRING},
+		{FieldName: "day", FieldType: utils.IDX_TYPE_DATE},
+	} {
+		if err := index.AddField(field); err != nil {
+			t.Fatalf("add field %v : %v", field.FieldName, err)
+		}
+	}
+	// 过期时间为 day 加上一天
+	if err := index.SetTTL(86400, "day"); err != nil {
+		t.Fatalf("set ttl : %v", err)
+	}
+
+	docs := []map[string]string{
+		{"id": "old", "color": "red", "day": "2000-01-01"},
+		{"id": "new", "color": "red", "day": "2999-01-01"},
+		{"id": "none", "color": "red"},
+		{"id": "own", "color": "red", "day": "2000-01-01", "_ttl": "1h"},
+	}
+	for _, doc := range docs {
+		if _, err := index.AddDocument(doc); err != nil {
+			t.Fatalf("add document %v : %v", doc["id"], err)
+		}
+	}
+
+	// 还在内存段中时按主键取不到
+	if _, ok := index.GetDocumentByKey("old"); ok {
+		t.Fatalf("expired document found in the memory segment")
+	}
+	doc, ok := index.GetDocumentByKey("own")
+	if !ok || doc["_expire"] == "" || doc["_ttl"] != "" {
+		t.Fatalf("get own = %v, %v, want _expire from _ttl and no _ttl", doc, ok)
+	}
+	// 没有日期的文档不过期
+	if _, ok := index.GetDocumentByKey("none"); !ok {
+		t.Fatalf("document without a date not found")
+	}
+
+	if err := index.SyncMemorySegment(); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	if _, ok := index.GetDocumentByKey("old"); ok {
+		t.Fatalf("expired document found in a persisted segment")
+	}
+	docIds, _ := index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if got := docKeys(index, nodeDocIds(docIds)); got != "new,none,own" {
+		t.Fatalf("search = %v, want new,none,own", got)
+	}
+	visited := make([]string, 0)
+	err = index.ForEachDocument(func(docId uint64, doc map[string]string) error {
+		visited = append(visited, doc["id"])
+		return nil
+	})
+	if err != nil || strings.Join(visited, ",") != "new,none,own" {
+		t.Fatalf("for each = %v, %v, want new,none,own", visited, err)
+	}
+	if deleted := index.Stats().DeletedDocs; deleted != 0 {
+		t.Fatalf("deleted docs before expiry = %v, want 0", deleted)
+	}
+
+	count, err := index.ExpireDocuments()
+	if err != nil || count != 1 {
+		t.Fatalf("expire = %v, %v, want 1", count, err)
+	}
+	if deleted := index.Stats().DeletedDocs; deleted != 1 {
+		t.Fatalf("deleted docs after expiry = %v, want 1", deleted)
+	}
+	if count, err := index.ExpireDocuments(); err != nil || count != 0 {
+		t.Fatalf("second expire = %v, %v, want 0", count, err)
+	}
+
+	// 合并时清理已经标记删除的过期文档
+	res, err := index.ForceMerge(gdindex.ForceMergeOptions{OnlyExpungeDeletes: true})
+	if err != nil || res.ExpungedDocs != 1 {
+		t.Fatalf("force merge = %+v, %v, want 1 expunged doc", res, err)
+	}
+	docIds, _ = index.SearchKeyDocIds(utils.SearchQuery{FieldName: "color", Value: "red"})
+	if got := docKeys(index, nodeDocIds(docIds)); got != "new,none,own" {
+		t.Fatalf("search after merge = %v, want new,none,own", got)
+	}
+
+	if err := index.SetTTL(-1, ""); err == nil {
+		t.Fatalf("negative ttl accepted")
+	}
+	if err := index.SetTTL(60, "color"); err == nil {
+		t.Fatalf("ttl field that is not a date accepted")
+	}
+}
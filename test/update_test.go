@@ -0,0 +1,58 @@
+package test
+
+import (
+	"testing"
+)
+
+// 部分更新只覆盖给出的字段，upsert 在主键不存在时新增文档
+func TestPartialUpdateAndUpsert(t *testing.T) {
+	gde := newTestEngine(t)
+	createTestIndex(t, gde, "items", `{"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"color","fieldType":1},{"fieldName":"n","fieldType":11}]}`)
+	addTestDocuments(t, gde, "items", `{"id":"a","color":"red","n":"1"}`)
+	if err := gde.SyncIndex("items"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+
+	if _, err := gde.UpdateDocument(map[string]string{"index": "items", "partial": "true"}, []byte(`{"id":"a","n":"2"}`)); err != nil {
+		t.Fatalf("partial update : %v", err)
+	}
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "items", "pk": "a"}); err != nil || doc["color"] != "red" || doc["n"] != "2" {
+		t.Fatalf("get a after partial update = %v, %v", doc, err)
+	}
+
+	// 不是部分更新时用请求体整体替换原文档
+	if _, err := gde.UpdateDocument(map[string]string{"index": "items"}, []byte(`{"id":"a","n":"3"}`)); err != nil {
+		t.Fatalf("update : %v", err)
+	}
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "items", "pk": "a"}); err != nil || doc["color"] != "" || doc["n"] != "3" {
+		t.Fatalf("get a after full update = %v, %v", doc, err)
+	}
+
+	if _, err := gde.UpdateDocument(map[string]string{"index": "items", "partial": "true"}, []byte(`{"id":"b","n":"1"}`)); err == nil {
+		t.Fatalf("update of a missing document without upsert succeeded")
+	}
+	if _, err := gde.UpdateDocument(map[string]string{"index": "items", "partial": "true", "upsert": "true"}, []byte(`{"id":"b","color":"blue"}`)); err != nil {
+		t.Fatalf("upsert : %v", err)
+	}
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "items", "pk": "b"}); err != nil || doc["color"] != "blue" {
+		t.Fatalf("get upserted b = %v, %v", doc, err)
+	}
+
+	// 删除后的文档可以通过 upsert 重新写入
+	if _, err := gde.DeleteDocument(map[string]string{"index": "items", "pk": "a"}); err != nil {
+		t.Fatalf("delete a : %v", err)
+	}
+	if _, err := gde.UpdateDocument(map[string]string{"index": "items", "partial": "true"}, []byte(`{"id":"a","n":"4"}`)); err == nil {
+		t.Fatalf("partial update of a deleted document succeeded")
+	}
+	if _, err := gde.UpdateDocument(map[string]string{"index": "items", "partial": "true", "upsert": "true"}, []byte(`{"id":"a","n":"4"}`)); err != nil {
+		t.Fatalf("upsert deleted a : %v", err)
+	}
+	if doc, err := gde.GetDocByKey(map[string]string{"index": "items", "pk": "a"}); err != nil || doc["color"] != "" || doc["n"] != "4" {
+		t.Fatalf("get re-created a = %v, %v", doc, err)
+	}
+
+	if _, err := gde.UpdateDocument(map[string]string{"index": "items", "partial": "true"}, []byte(`{"n":"5"}`)); err == nil {
+		t.Fatalf("update without a primary key succeeded")
+	}
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"GoDance/engine"
+	"testing"
+)
+
+// docVersion 按主键取回文档的 _version
+func docVersion(t *testing.T, gde *engine.GoDanceEngine, indexName, key string) string {
+	doc, err := gde.GetDocByKey(map[string]string{"index": indexName, "pk": key})
+	if err != nil {
+		t.Fatalf("get %v : %v", key, err)
+	}
+	return doc["_version"]
+}
+
+// 每次写入版本加一，if_version 与当前版本不一致时返回冲突且不修改文档
+func TestIfVersionConflict(t *testing.T) {
+	gde := newTestEngine(t)
+	createTestIndex(t, gde, "versioned", `{"fieldsmapping":[{"fieldName":"id","fieldType":21},{"fieldName":"color","fieldType":1}]}`)
+	addTestDocuments(t, gde, "versioned", `{"id":"a","color":"red"}`)
+	if v := docVersion(t, gde, "versioned", "a"); v != "1" {
+		t.Fatalf("version after add = %v, want 1", v)
+	}
+
+	msg, err := gde.AddDocument(map[string]string{"index": "versioned", "if_version": "2"}, []byte(`{"id":"a","color":"blue"}`))
+	if !engine.IsConflict(err) || msg != engine.Conflict {
+		t.Fatalf("add with stale version = %v, %v, want conflict", msg, err)
+	}
+	if _, err := gde.AddDocument(map[string]string{"index": "versioned", "if_version": "1"}, []byte(`{"id":"a","color":"blue"}`)); err != nil {
+		t.Fatalf("add with current version : %v", err)
+	}
+	if v := docVersion(t, gde, "versioned", "a"); v != "2" {
+		t.Fatalf("version after second write = %v, want 2", v)
+	}
+
+	if err := gde.SyncIndex("versioned"); err != nil {
+		t.Fatalf("sync : %v", err)
+	}
+	if _, err := gde.UpdateDocument(map[string]string{"index": "versioned", "if_version": "1"}, []byte(`{"id":"a","color":"green"}`)); !engine.IsConflict(err) {
+		t.Fatalf("update with stale version = %v, want conflict", err)
+	}
+	if _, err := gde.DeleteDocument(map[string]string{"index": "versioned", "pk": "a", "if_version": "1"}); !engine.IsConflict(err) {
+		t.Fatalf("delete with stale version = %v, want conflict", err)
+	}
+	doc, err := gde.GetDocByKey(map[string]string{"index": "versioned", "pk": "a"})
+	if err != nil || doc["color"] != "blue" || doc["_version"] != "2" {
+		t.Fatalf("get a after conflicts = %v, %v", doc, err)
+	}
+
+	if _, err := gde.UpdateDocument(map[string]string{"index": "versioned", "partial": "true", "if_version": "2"}, []byte(`{"id":"a","color":"green"}`)); err != nil {
+		t.Fatalf("update with current version : %v", err)
+	}
+	if _, err := gde.DeleteDocument(map[string]string{"index": "versioned", "pk": "a", "if_version": "3"}); err != nil {
+		t.Fatalf("delete with current version : %v", err)
+	}
+
+	// 删除也会增加版本，删除前读到的版本不能再写回
+	if _, err := gde.AddDocument(map[string]string{"index": "versioned", "if_version": "3"}, []byte(`{"id":"a","color":"red"}`)); !engine.IsConflict(err) {
+		t.Fatalf("add with the version before delete = %v, want conflict", err)
+	}
+	if _, err := gde.AddDocument(map[string]string{"index": "versioned", "if_version": "4"}, []byte(`{"id":"a","color":"red"}`)); err != nil {
+		t.Fatalf("add with the version after delete : %v", err)
+	}
+	if v := docVersion(t, gde, "versioned", "a"); v != "5" {
+		t.Fatalf("version after re-create = %v, want 5", v)
+	}
+
+	for _, value := range []string{"0", "x"} {
+		if _, err := gde.AddDocument(map[string]string{"index": "versioned", "if_version": value}, []byte(`{"id":"a"}`)); err == nil || engine.IsConflict(err) {
+			t.Fatalf("add with if_version %v = %v, want a parameter error", value, err)
+		}
+	}
+}
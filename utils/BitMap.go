@@ -1,12 +1,8 @@
 package utils
 
 import (
-	"errors"
 	"fmt"
-	"os"
-	"reflect"
-	"syscall"
-	"unsafe"
+	"math/bits"
 )
 
 // 暂时只支持 1 << 32 位（可以扩展到 1 << 64)
@@ -22,7 +18,8 @@ type Bitmap struct {
 	// 该 Bitmap 被设置为 1 的最大位置（方便遍历）
 	Maxpostion uint64
 
-	bitmapMmap *Mmap
+	dir    Directory
+	mapped MappedFile
 }
 
 // NewBitmap 使用默认容量实例化一个 Bitmap
@@ -30,7 +27,17 @@ func NewBitmap(indexname string) *Bitmap {
 	return NewBitmapSize(BitmapSize, indexname)
 }
 
+// NewBitmapIn 从目录中的文件实例化一个 Bitmap
+func NewBitmapIn(dir Directory, indexname string) *Bitmap {
+	return NewBitmapSizeIn(dir, BitmapSize, indexname)
+}
+
 func MakeBitmapFile(indexname string) error {
+	return MakeBitmapFileIn(DefaultDirectory, indexname)
+}
+
+// MakeBitmapFileIn 在目录中创建 Bitmap 文件
+func MakeBitmapFileIn(dir Directory, indexname string) error {
 	size := BitmapSize
 	if size == 0 || size > BitmapSize {
 		size = BitmapSize
@@ -38,12 +45,18 @@ func MakeBitmapFile(indexname string) error {
 		size += 8 - remainder
 	}
 
-	fout, err := os.Create(indexname)
-	defer fout.Close()
+	fout, err := dir.Create(indexname)
+	if err != nil {
+		return err
+	}
+	fout.Close()
+
+	mapped, err := dir.Map(indexname, false)
 	if err != nil {
 		return err
 	}
-	err = syscall.Ftruncate(int(fout.Fd()), int64(size>>8))
+	defer mapped.Close()
+	err = mapped.Resize(int64(size >> 8))
 	if err != nil {
 		fmt.Printf("ftruncate error : %v\n", err)
 		return err
@@ -55,12 +68,17 @@ func MakeBitmapFile(indexname string) error {
 
 // NewBitmapSize 根据指定的 size 实例化一个 Bitmap
 func NewBitmapSize(size int, indexname string) *Bitmap {
+	return NewBitmapSizeIn(DefaultDirectory, size, indexname)
+}
+
+// NewBitmapSizeIn 根据指定的 size 从目录中的文件实例化一个 Bitmap
+func NewBitmapSizeIn(dir Directory, size int, indexname string) *Bitmap {
 	if size == 0 || size > BitmapSize {
 		size = BitmapSize
 	} else if remainder := size % 8; remainder != 0 {
 		size += 8 - remainder
 	}
-	this := &Bitmap{Data: make([]byte, size>>3), BitSize: uint64(size - 1)}
+	this := &Bitmap{Data: make([]byte, size>>3), BitSize: uint64(size - 1), dir: dir}
 
 	this.ReadBitmapFile(indexname)
 	return this
@@ -101,6 +119,37 @@ func (this *Bitmap) GetBit(offset uint64) uint8 {
 	return (this.Data[index] >> pos) & 0x01
 }
 
+// Count 统计 [start, end) 范围内被置为 1 的 bit 数
+func (this *Bitmap) Count(start, end uint64) uint64 {
+	if maxBit := uint64(len(this.Data)) * 8; end > maxBit {
+		end = maxBit
+	}
+
+	var count uint64
+	for offset := start; offset < end; {
+		// 整字节一次统计
+		if offset%8 == 0 && offset+8 <= end {
+			count += uint64(bits.OnesCount8(this.Data[offset/8]))
+			offset += 8
+			continue
+		}
+		count += uint64(this.GetBit(offset))
+		offset++
+	}
+	return count
+}
+
+// Copy 复制 [0, end) 范围内的 bit，返回只在内存中的位图，之后对原位图的修改不影响副本
+func (this *Bitmap) Copy(end uint64) *Bitmap {
+	size := end/8 + 1
+	if size > uint64(len(this.Data)) {
+		size = uint64(len(this.Data))
+	}
+	data := make([]byte, size)
+	copy(data, this.Data[:size])
+	return &Bitmap{Data: data, BitSize: size*8 - 1, Maxpostion: this.Maxpostion, dir: this.dir}
+}
+
 // Maxpos 获的置为 1 的最大位置
 func (this *Bitmap) Maxpos() uint64 {
 	return this.Maxpostion
@@ -128,41 +177,35 @@ func (this *Bitmap) String() string {
 
 func (this *Bitmap) ReadBitmapFile(indexname string) error {
 
-	f, err := os.OpenFile(indexname, os.O_RDWR, 0664)
+	mapped, err := this.dir.Map(indexname, false)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	fi, err := f.Stat()
-	if err != nil {
-		fmt.Printf("ERR:%v", err)
-	}
 
-	this.Data, err = syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		fmt.Printf("MAPPING ERROR  %v \n", err)
-		return err
-	}
-	//this.FileFd = f
+	this.Data = mapped.Bytes()
+	this.mapped = mapped
 
 	return nil
 
 }
 
 func (this *Bitmap) Sync() error {
-	dh := (*reflect.SliceHeader)(unsafe.Pointer(&this.Data))
-	_, _, err := syscall.Syscall(syscall.SYS_MSYNC, dh.Data, uintptr(dh.Len), syscall.MS_SYNC)
-	if err != 0 {
+	if this.mapped == nil {
+		return nil
+	}
+	if err := this.mapped.Sync(); err != nil {
 		fmt.Printf("Sync Error ")
-		return errors.New("Sync Error")
+		return err
 	}
 	return nil
 }
 
 func (this *Bitmap) Destroy(indexbitmapname string) error {
 
-	syscall.Munmap(this.Data)
-	os.Remove(indexbitmapname)
+	if this.mapped != nil {
+		this.mapped.Close()
+	}
+	this.dir.Remove(indexbitmapname)
 	return nil
 }
 
@@ -170,6 +213,8 @@ func (this *Bitmap) Close() error {
 
 	this.Sync()
 
-	syscall.Munmap(this.Data)
+	if this.mapped != nil {
+		return this.mapped.Close()
+	}
 	return nil
 }
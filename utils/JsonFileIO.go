@@ -11,7 +11,9 @@ package utils
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"os"
 	//"sort"
@@ -59,6 +61,27 @@ func ReadFromJson(file_name string) ([]byte, error) {
 
 }
 
+// WriteToJsonIn function description : 写入目录中的json文件
+// params :
+// return :
+func WriteToJsonIn(dir Directory, data interface{}, file_name string) error {
+
+	info_json, err := json.Marshal(data)
+	if err != nil {
+		fmt.Printf("Marshal err %v\n", file_name)
+		return err
+	}
+	return dir.WriteFile(file_name, info_json)
+
+}
+
+// ReadFromJsonIn function description : 读取目录中的json文件
+// params :
+// return :
+func ReadFromJsonIn(dir Directory, file_name string) ([]byte, error) {
+	return dir.ReadFile(file_name)
+}
+
 func ReadFile(path string) (string, error) {
 	fi, err := os.Open(path)
 	if err != nil {
@@ -85,3 +108,76 @@ func WriteFile(path, content string) error {
 	return nil
 
 }
+
+// JsonLinesReader 流式读取 JSONL 文件，每行一个 JSON 对象
+type JsonLinesReader struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewJsonLinesReader function description : 打开一个 JSONL 文件
+// params : 文件名
+// return : 读取器
+func NewJsonLinesReader(file_name string) (*JsonLinesReader, error) {
+
+	fin, err := os.Open(file_name)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(fin)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	return &JsonLinesReader{file: fin, scanner: scanner}, nil
+}
+
+// Next function description : 读取下一行，值统一转换为字符串，空行会被跳过且不计入记录数
+// return : 一行的 JSON 无法解析时返回 *RecordError，可以继续读取；行过长或读取文件出错时返回其他错误，不能继续读取
+func (r *JsonLinesReader) Next() (map[string]string, error) {
+
+	var line []byte
+	for {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		line = bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) > 0 {
+			break
+		}
+	}
+	r.line++
+
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	record := make(map[string]interface{})
+	if err := decoder.Decode(&record); err != nil {
+		return nil, &RecordError{Line: r.line, Err: err}
+	}
+
+	res := make(map[string]string, len(record))
+	for key, value := range record {
+		switch v := value.(type) {
+		case nil:
+			res[key] = ""
+		case string:
+			res[key] = v
+		case json.Number, bool:
+			res[key] = fmt.Sprintf("%v", v)
+		default:
+			buf, _ := json.Marshal(v)
+			res[key] = string(buf)
+		}
+	}
+	return res, nil
+}
+
+func (r *JsonLinesReader) Line() int {
+	return r.line
+}
+
+func (r *JsonLinesReader) Close() error {
+	return r.file.Close()
+}
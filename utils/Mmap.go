@@ -11,11 +11,8 @@ package utils
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
-	"os"
 	"reflect"
-	"syscall"
 	"unsafe"
 )
 
@@ -25,7 +22,7 @@ type Mmap struct {
 	FileLen     int64
 	FilePointer int64
 	MapType     int64
-	FileFd      *os.File
+	mapped      MappedFile
 }
 
 const APPEND_DATA int64 = 1024 * 1024
@@ -36,43 +33,31 @@ const (
 
 // 新建一个 Mmap
 func NewMmap(file_name string, mode int) (*Mmap, error) {
+	return NewMmapIn(DefaultDirectory, file_name, mode)
+}
 
-	this := &Mmap{MmapBytes: make([]byte, 0), FileName: file_name, FileLen: 0, MapType: 0, FilePointer: 0, FileFd: nil}
-
-	file_mode := os.O_RDWR
-	file_create_mode := os.O_RDWR | os.O_CREATE | os.O_APPEND
-	if mode == MODE_CREATE {
-		file_mode = os.O_RDWR | os.O_CREATE | os.O_APPEND
-	}
-
-	f, err := os.OpenFile(file_name, file_mode, 0664)
+// NewMmapIn 映射目录中的文件
+func NewMmapIn(dir Directory, file_name string, mode int) (*Mmap, error) {
 
-	if err != nil {
-		f, err = os.OpenFile(file_name, file_create_mode, 0664)
-		if err != nil {
-			return nil, err
-		}
-	}
+	this := &Mmap{MmapBytes: make([]byte, 0), FileName: file_name, FileLen: 0, MapType: 0, FilePointer: 0}
 
-	fi, err := f.Stat()
+	mapped, err := dir.Map(file_name, true)
 	if err != nil {
-		fmt.Printf("ERR:%v", err)
+		return nil, err
 	}
 
-	this.FileLen = fi.Size()
+	this.FileLen = int64(len(mapped.Bytes()))
 	if mode == MODE_CREATE || this.FileLen == 0 {
-		syscall.Ftruncate(int(f.Fd()), fi.Size()+APPEND_DATA)
-		this.FileLen = APPEND_DATA
-	}
-
-	this.MmapBytes, err = syscall.Mmap(int(f.Fd()), 0, int(this.FileLen), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-
-	if err != nil {
-		fmt.Printf("MAPPING ERROR  %v \n", err)
-		return nil, err
+		if err := mapped.Resize(this.FileLen + APPEND_DATA); err != nil {
+			fmt.Printf("MAPPING ERROR  %v \n", err)
+			mapped.Close()
+			return nil, err
+		}
+		this.FileLen += APPEND_DATA
 	}
 
-	this.FileFd = f
+	this.MmapBytes = mapped.Bytes()
+	this.mapped = mapped
 	return this, nil
 }
 
@@ -83,19 +68,13 @@ func (m *Mmap) SetFileEnd(file_len int64) {
 func (m *Mmap) checkFilePointer(check_value int64) error {
 
 	if m.FilePointer+check_value >= m.FileLen {
-		err := syscall.Ftruncate(int(m.FileFd.Fd()), m.FileLen+APPEND_DATA)
+		err := m.mapped.Resize(m.FileLen + APPEND_DATA)
 		if err != nil {
 			fmt.Printf("ftruncate error : %v\n", err)
 			return err
 		}
 		m.FileLen += APPEND_DATA
-		syscall.Munmap(m.MmapBytes)
-		m.MmapBytes, err = syscall.Mmap(int(m.FileFd.Fd()), 0, int(m.FileLen), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-
-		if err != nil {
-			fmt.Printf("MAPPING ERROR  %v \n", err)
-			return err
-		}
+		m.MmapBytes = m.mapped.Bytes()
 	}
 
 	return nil
@@ -104,13 +83,14 @@ func (m *Mmap) checkFilePointer(check_value int64) error {
 func (m *Mmap) checkFileCap(start, lens int64) error {
 
 	if start+lens >= m.FileLen {
-		err := syscall.Ftruncate(int(m.FileFd.Fd()), m.FileLen+APPEND_DATA)
+		err := m.mapped.Resize(m.FileLen + APPEND_DATA)
 		if err != nil {
 			fmt.Printf("ftruncate error : %v\n", err)
 			return err
 		}
 
 		m.FileLen += APPEND_DATA
+		m.MmapBytes = m.mapped.Bytes()
 		m.FilePointer = start + lens
 	}
 
@@ -287,25 +267,18 @@ func (m *Mmap) WriteBytes(start int64, value []byte) error {
 
 func (m *Mmap) Unmap() error {
 
-	syscall.Munmap(m.MmapBytes)
-	m.FileFd.Close()
-	return nil
+	m.MmapBytes = nil
+	return m.mapped.Close()
 }
 
 func (m *Mmap) GetPointer() int64 {
 	return m.FilePointer
 }
 
-func (m *Mmap) header() *reflect.SliceHeader {
-	return (*reflect.SliceHeader)(unsafe.Pointer(&m.MmapBytes))
-}
-
 func (m *Mmap) Sync() error {
-	dh := m.header()
-	_, _, err := syscall.Syscall(syscall.SYS_MSYNC, dh.Data, uintptr(dh.Len), syscall.MS_SYNC)
-	if err != 0 {
+	if err := m.mapped.Sync(); err != nil {
 		fmt.Printf("Sync Error ")
-		return errors.New("Sync Error")
+		return err
 	}
 	return nil
 }
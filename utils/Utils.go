@@ -1,19 +1,28 @@
 package utils
 
 import (
+	"container/list"
+	"fmt"
 	"math"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// IDX_ROOT_PATH 默认索引存放位置
+// IDX_ROOT_PATH 默认的数据根目录，启动时可以通过 SetDataPaths 修改
 const IDX_ROOT_PATH string = "./data/"
-const TRIE_PATH string = "./data/trieTree.tr"
+
+// TRIE_PATH 默认数据根目录下的联想词文件，实际路径见 TriePath
+const TRIE_PATH string = IDX_ROOT_PATH + TRIE_FILE
 
 // FALCONENGINENAME base名称
 const GODANCEENGINE string = "GoDanceEngine"
 const MAX_SEGMENT_SIZE uint64 = 100000
 
+// BULK_BATCH_SIZE 批量写入时每次加锁处理的最大操作数
+const BULK_BATCH_SIZE int = 1000
+
 // 停用词文件
 // const STOP_WORD_FILE_PATH = "utils/stopWords.txt"
 
@@ -21,6 +30,43 @@ const STOP_WORD_FILE_PATH = "utils/stopWord-CN.txt"
 
 var DocIdChan chan []DocIdNode
 
+// GetDocIDsChan 从复用池中取出 DocIdNode 切片，GiveDocIDsChan 把用完的切片放回，由 DocIdsMaker 创建
+var GetDocIDsChan, GiveDocIDsChan chan []DocIdNode
+
+// 复用池中切片的初始容量和最多保留的切片数
+const (
+	DOCIDS_POOL_CAP  = 1024
+	DOCIDS_POOL_SIZE = 64
+)
+
+// DocIdsMaker function description : 启动复用 DocIdNode 切片的协程，池为空时新建切片，池满时丢弃放回的切片
+// params :
+// return : 取出切片的通道，放回切片的通道
+func DocIdsMaker() (get, give chan []DocIdNode) {
+	get = make(chan []DocIdNode)
+	give = make(chan []DocIdNode)
+
+	go func() {
+		pool := list.New()
+		for {
+			if pool.Len() == 0 {
+				pool.PushFront(make([]DocIdNode, 0, DOCIDS_POOL_CAP))
+			}
+
+			e := pool.Front()
+			select {
+			case ids := <-give:
+				if pool.Len() < DOCIDS_POOL_SIZE {
+					pool.PushFront(ids[:0])
+				}
+			case get <- e.Value.([]DocIdNode):
+				pool.Remove(e)
+			}
+		}
+	}()
+	return get, give
+}
+
 type DocIdNode struct {
 	Docid  uint64
 	WordTF float64
@@ -94,10 +140,15 @@ const (
 
 	IDX_TYPE_NUMBER = 11 // 数字型索引，只支持整数，数字型索引只建立正排
 	IDX_TYPE_FLOAT  = 12 // 数字型索引，支持浮点数，只能保留两位小数，数字型索引只建立正排
+	IDX_TYPE_DOUBLE = 13 // 数字型索引，双精度浮点数，按可排序的整数存储，空值为 DOUBLE_NULL
 
-	IDX_TYPE_DATE = 15 // 日期型索引 '2015-11-11 00:11:12'，日期型只建立正排，转成时间戳存储
+	IDX_TYPE_DATE     = 15 // 日期型索引 '2015-11-11 00:11:12'，日期型只建立正排，转成时间戳存储
+	IDX_TYPE_DATETIME = 16 // 日期时间型索引，支持时区和自定义格式，按毫秒时间戳存储，空值为 DATETIME_NULL
 
-	IDX_TYPE_PK = 21 //主键类型，倒排正排都需要，倒排使用B+树存储
+	IDX_TYPE_BOOL = 17 // 布尔型索引 true/false，正排按位图存储
+	IDX_TYPE_IP   = 18 // IP 地址型索引，支持 IPv4 和 IPv6，按 16 字节可排序的形式存储，支持 CIDR 过滤
+
+	IDX_TYPE_PK = 21 //主键类型，任意字符串，可以由多个字段组成联合主键，主键到文档的映射使用B+树存储
 
 	IDX_TYPE_DESC = 31 // 只存储不索引的类型
 )
@@ -108,6 +159,9 @@ const (
 	FILT_OVER  uint64 = 2 //大于
 	FILT_LESS  uint64 = 3 //小于
 	FILT_RANGE uint64 = 4 //范围内
+
+	FILT_EXISTS  uint64 = 5 //字段有值
+	FILT_MISSING uint64 = 6 //字段没有值
 )
 
 type TermInfo struct {
@@ -134,17 +188,29 @@ type SearchFilters struct {
 	End       int64   `json:"_end"`
 	Range     []int64 `json:"_range"`
 	Type      uint64  `json:"_type"`
+
+	// IP 地址字段按字节序比较的上下界，为 16 字节的地址
+	StartTerm string `json:"_startTerm,omitempty"`
+	EndTerm   string `json:"_endTerm,omitempty"`
 }
 
 // DefaultResult
 // @Description: 返回给Web层的 Json
 type DefaultResult struct {
-	TotalCount int64               `json:"totalCount"`
-	From       int64               `json:"from"`
-	To         int64               `json:"to"`
-	Status     string              `json:"status"`
-	CostTime   string              `json:"costTime"`
-	Results    []map[string]string `json:"results"`
+	TotalCount int64                  `json:"totalCount"`
+	From       int64                  `json:"from"`
+	To         int64                  `json:"to"`
+	Status     string                 `json:"status"`
+	CostTime   string                 `json:"costTime"`
+	Results    []map[string]string    `json:"results"`
+	Facets     map[string][]FacetItem `json:"facets,omitempty"`
+}
+
+// FacetItem
+// @Description: 字段统计结果中的一项
+type FacetItem struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
 }
 
 func Exist(filename string) bool {
@@ -181,6 +247,34 @@ func IsDateTime(datetime string) (int64, error) {
 
 }
 
+// ParseTTL function description : 解析存活时间，支持纯数字的秒数、7d 形式的天数以及 time.ParseDuration 的格式
+// params : 字符串，如 3600、7d、12h、30m
+// return : 秒数
+func ParseTTL(ttl string) (int64, error) {
+
+	ttl = strings.TrimSpace(ttl)
+	if seconds, err := strconv.ParseInt(ttl, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("invalid ttl [%v]", ttl)
+		}
+		return seconds, nil
+	}
+
+	if strings.HasSuffix(ttl, "d") {
+		days, err := strconv.ParseInt(strings.TrimSuffix(ttl, "d"), 10, 64)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid ttl [%v]", ttl)
+		}
+		return days * 86400, nil
+	}
+
+	duration, err := time.ParseDuration(ttl)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid ttl [%v]", ttl)
+	}
+	return int64(duration / time.Second), nil
+}
+
 func FormatDateTime(timestamp int64) (string, bool) {
 
 	if timestamp == 0 {
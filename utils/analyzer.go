@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 切词匹配字段的分词器
+const (
+	ANALYZER_GSE        = "gse"        // gse 搜索引擎模式分词并去掉停用词，默认的分词器
+	ANALYZER_WHITESPACE = "whitespace" // 按空白字符切分
+	ANALYZER_SIMPLE     = "simple"     // 按字母和数字以外的字符切分并转为小写
+	ANALYZER_KEYWORD    = "keyword"    // 整个值作为一个词
+)
+
+// IsValidAnalyzer function description : 判断是否为支持的分词器
+// params : 分词器名称，为空表示默认的 gse
+// return : 是否支持
+func IsValidAnalyzer(analyzer string) bool {
+
+	switch analyzer {
+	case "", ANALYZER_GSE, ANALYZER_WHITESPACE, ANALYZER_SIMPLE, ANALYZER_KEYWORD:
+		return true
+	}
+	return false
+}
+
+// Analyze function description : 按分词器切分文本，写入文档和搜索时使用同一个分词器
+// params : 分词器名称，为空时使用 gse；文本
+// return : 切分后的词
+func Analyze(analyzer, text string) []string {
+
+	switch analyzer {
+	case ANALYZER_WHITESPACE:
+		return strings.Fields(text)
+	case ANALYZER_SIMPLE:
+		return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+	case ANALYZER_KEYWORD:
+		if text == "" {
+			return []string{}
+		}
+		return []string{text}
+	}
+	segmenter := GetGseSegmenter()
+	return segmenter.CutSearch(text, false)
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CoerceValue function description : 按字段类型转换输入的值，用于导入外部数据
+// params : 字段类型，原始值
+// return : 转换后的值，无法转换时返回错误
+func CoerceValue(fieldType uint64, value string) (string, error) {
+
+	switch fieldType {
+	case IDX_TYPE_NUMBER:
+		v := strings.ReplaceAll(strings.TrimSpace(value), ",", "")
+		if v == "" {
+			return v, nil
+		}
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return v, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f != math.Trunc(f) || f > math.MaxInt64 || f < math.MinInt64 {
+			return "", fmt.Errorf("value [%v] is not an integer", value)
+		}
+		return strconv.FormatInt(int64(f), 10), nil
+	case IDX_TYPE_FLOAT, IDX_TYPE_DOUBLE:
+		v := strings.ReplaceAll(strings.TrimSpace(value), ",", "")
+		if v == "" {
+			return v, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("value [%v] is not a number", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case IDX_TYPE_DATE:
+		v := strings.TrimSpace(value)
+		if v == "" {
+			return v, nil
+		}
+		if _, err := IsDateTime(v); err != nil {
+			return "", fmt.Errorf("value [%v] is not a date", value)
+		}
+		return v, nil
+	case IDX_TYPE_BOOL:
+		v := strings.TrimSpace(value)
+		if v == "" {
+			return v, nil
+		}
+		b, err := ParseBool(v)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	case IDX_TYPE_IP:
+		v := strings.TrimSpace(value)
+		if v == "" {
+			return v, nil
+		}
+		ip, err := ParseIP(v)
+		if err != nil {
+			return "", err
+		}
+		return FormatIP(ip), nil
+	case IDX_TYPE_PK:
+		v := strings.TrimSpace(value)
+		if v == "" {
+			return "", fmt.Errorf("primary key is empty")
+		}
+		return v, nil
+	}
+
+	return value, nil
+}
+
+// ParseFieldType function description : 将字段类型的名称转换为类型常量，也可以直接传数字
+// params : 类型名称，如 string、text、number、float、double、date、datetime、bool、ip、pk、desc
+// return : 类型常量
+func ParseFieldType(name string) (uint64, error) {
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "string", "keyword":
+		return IDX_TYPE_STRING, nil
+	case "text":
+		return IDX_TYPE_STRING_SEG, nil
+	case "number", "int", "long":
+		return IDX_TYPE_NUMBER, nil
+	case "float":
+		return IDX_TYPE_FLOAT, nil
+	case "double":
+		return IDX_TYPE_DOUBLE, nil
+	case "date":
+		return IDX_TYPE_DATE, nil
+	case "datetime":
+		return IDX_TYPE_DATETIME, nil
+	case "bool", "boolean":
+		return IDX_TYPE_BOOL, nil
+	case "ip":
+		return IDX_TYPE_IP, nil
+	case "pk":
+		return IDX_TYPE_PK, nil
+	case "desc":
+		return IDX_TYPE_DESC, nil
+	}
+
+	t, err := strconv.ParseUint(name, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unknown field type [%v]", name)
+	}
+	return t, nil
+}
+
+// InferFieldType function description : 根据值推断字段类型，用于动态映射
+// params : 字段的值，不能为空
+// return : 整数为 number，小数为 double，true/false 为 bool，RFC3339 格式的为 datetime，符合 IsDateTime 格式的为 date，
+// 不超过 keywordMaxLen 个字符的字符串为全词匹配，更长的为切词匹配
+func InferFieldType(value string, keywordMaxLen int) uint64 {
+
+	v := strings.TrimSpace(value)
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return IDX_TYPE_NUMBER
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return IDX_TYPE_DOUBLE
+	}
+	if v == "true" || v == "false" {
+		return IDX_TYPE_BOOL
+	}
+	if _, err := time.Parse(time.RFC3339, v); err == nil {
+		return IDX_TYPE_DATETIME
+	}
+	if _, err := IsDateTime(v); err == nil {
+		return IDX_TYPE_DATE
+	}
+	if len([]rune(value)) <= keywordMaxLen {
+		return IDX_TYPE_STRING
+	}
+	return IDX_TYPE_STRING_SEG
+}
@@ -2,11 +2,44 @@ package utils
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 )
 
+// RecordReader 流式读取记录的接口，读到文件末尾时返回 io.EOF
+type RecordReader interface {
+	// Next 读取下一条记录，返回 *RecordError 时表示这一条记录有问题，可以继续读取，其他错误表示无法继续读取
+	Next() (map[string]string, error)
+	// Line 当前已经读取的记录数（不含表头）
+	Line() int
+	Close() error
+}
+
+// RecordError 单条记录的内容有问题，跳过这一条可以继续读取
+type RecordError struct {
+	Line int
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("line %v : %v", e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// CsvStreamReader 流式读取 csv 文件，每次只读一行，不会把整个文件读入内存
+type CsvStreamReader struct {
+	file   *os.File
+	reader *csv.Reader
+	header []string
+	line   int
+}
+
 type CsvTable struct {
 	FileName string
 	Records  []CsvRecord
@@ -111,3 +144,71 @@ func (c *CsvRecord) GetString(fieldName string) string {
 		return ""
 	}
 }
+
+// NewCsvStreamReader
+// @Description 打开一个 csv 文件，第一行作为表头
+// @Param filename 文件名
+// @Return *CsvStreamReader 读取器
+// @Return error 任何错误
+func NewCsvStreamReader(filename string) (*CsvStreamReader, error) {
+	file, err := os.OpenFile(filename, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(file)
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		file.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s is empty", filename)
+		}
+		return nil, err
+	}
+
+	return &CsvStreamReader{
+		file:   file,
+		reader: reader,
+		header: append([]string(nil), header...),
+	}, nil
+}
+
+// Header 返回表头
+func (r *CsvStreamReader) Header() []string {
+	return r.header
+}
+
+func (r *CsvStreamReader) Next() (map[string]string, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		// 只有格式错误可以跳过，读取文件出错时不能继续读取
+		var parseErr *csv.ParseError
+		if !errors.As(err, &parseErr) {
+			return nil, err
+		}
+		r.line++
+		return nil, &RecordError{Line: r.line, Err: err}
+	}
+	r.line++
+	if len(record) != len(r.header) {
+		return nil, &RecordError{Line: r.line, Err: fmt.Errorf("record has %v columns, header has %v", len(record), len(r.header))}
+	}
+
+	res := make(map[string]string, len(record))
+	for i, col := range r.header {
+		res[col] = record[i]
+	}
+	return res, nil
+}
+
+func (r *CsvStreamReader) Line() int {
+	return r.line
+}
+
+func (r *CsvStreamReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// TRIE_FILE 数据根目录下保存联想词的文件名
+const TRIE_FILE string = "trieTree.tr"
+
+var (
+	dataPathsLocker sync.RWMutex
+	dataPaths       = []string{IDX_ROOT_PATH}
+)
+
+// SetDataPaths function description : 设置数据目录，第一个为数据根目录，保存引擎的元信息和联想词，新建的索引放在剩余空间最大的目录中
+// params : 数据目录，相对路径按当前工作目录转换为绝对路径，目录不存在时创建
+// return : 目录为空或无法创建时返回错误
+func SetDataPaths(paths []string) error {
+
+	res := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		abs = filepath.Clean(abs) + string(filepath.Separator)
+		if seen[abs] {
+			continue
+		}
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			return err
+		}
+		seen[abs] = true
+		res = append(res, abs)
+	}
+	if len(res) == 0 {
+		return errors.New("no data path")
+	}
+
+	dataPathsLocker.Lock()
+	defer dataPathsLocker.Unlock()
+	dataPaths = res
+	return nil
+}
+
+// DataPaths function description : 获取所有数据目录
+// params :
+// return : 数据目录，以路径分隔符结尾
+func DataPaths() []string {
+
+	dataPathsLocker.RLock()
+	defer dataPathsLocker.RUnlock()
+	return append([]string(nil), dataPaths...)
+}
+
+// DataRoot function description : 获取数据根目录
+// params :
+// return : 数据根目录，以路径分隔符结尾
+func DataRoot() string {
+
+	dataPathsLocker.RLock()
+	defer dataPathsLocker.RUnlock()
+	return dataPaths[0]
+}
+
+// TriePath function description : 获取联想词文件的路径
+// params :
+// return : 数据根目录下的联想词文件
+func TriePath() string {
+	return DataRoot() + TRIE_FILE
+}
+
+// FreeSpace function description : 获取目录所在磁盘的剩余空间
+// params : 目录
+// return : 非特权用户可用的字节数
+func FreeSpace(path string) (uint64, error) {
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// PickDataPath function description : 选择剩余空间最大的数据目录存放新索引
+// params :
+// return : 数据目录，都无法获取剩余空间时为数据根目录
+func PickDataPath() string {
+
+	paths := DataPaths()
+	res := paths[0]
+	var maxFree uint64
+	for _, path := range paths {
+		free, err := FreeSpace(path)
+		if err != nil {
+			continue
+		}
+		if free > maxFree {
+			res, maxFree = path, free
+		}
+	}
+	return res
+}
@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DATETIME_NULL 日期时间字段的空值，早于 1970 年的时间为负数，不能用 -1 表示空值
+const DATETIME_NULL int64 = math.MinInt64
+
+// 日期时间字段的格式名称，其余的格式按 Go 的时间布局解析，多个格式用 || 分隔
+const (
+	DATE_FORMAT_RFC3339      = "rfc3339"      // 2006-01-02T15:04:05.000Z07:00
+	DATE_FORMAT_EPOCH_MILLIS = "epoch_millis" // 毫秒时间戳
+	DATE_FORMAT_EPOCH_SECOND = "epoch_second" // 秒时间戳
+	DATE_FORMAT_SEPARATOR    = "||"
+)
+
+// DEFAULT_DATE_FORMAT 没有指定格式时依次尝试的格式
+const DEFAULT_DATE_FORMAT = DATE_FORMAT_RFC3339 + "||2006-01-02T15:04:05||2006-01-02 15:04:05||2006-01-02 15:04||2006-01-02||" + DATE_FORMAT_EPOCH_MILLIS
+
+// DATETIME_OUTPUT_LAYOUT 日期时间字段返回的格式，UTC 时间精确到毫秒
+const DATETIME_OUTPUT_LAYOUT = "2006-01-02T15:04:05.000Z07:00"
+
+// DateParser 按字段的格式和时区解析日期时间
+type DateParser struct {
+	formats  []string
+	location *time.Location
+}
+
+// NewDateParser function description : 创建日期时间解析器
+// params : 格式，为空时使用 DEFAULT_DATE_FORMAT；时区，如 Asia/Shanghai、+08:00，为空时使用 UTC
+// return : 解析器，时区无法识别时返回错误
+func NewDateParser(format, timeZone string) (*DateParser, error) {
+
+	if strings.TrimSpace(format) == "" {
+		format = DEFAULT_DATE_FORMAT
+	}
+	formats := make([]string, 0)
+	for _, f := range strings.Split(format, DATE_FORMAT_SEPARATOR) {
+		if f = strings.TrimSpace(f); f != "" {
+			formats = append(formats, f)
+		}
+	}
+
+	location, err := ParseTimeZone(timeZone)
+	if err != nil {
+		return nil, err
+	}
+	return &DateParser{formats: formats, location: location}, nil
+}
+
+// ParseTimeZone function description : 解析时区
+// params : 时区名称或 +08:00 形式的偏移，为空时为 UTC
+// return : 时区
+func ParseTimeZone(timeZone string) (*time.Location, error) {
+
+	timeZone = strings.TrimSpace(timeZone)
+	if timeZone == "" || timeZone == "Z" {
+		return time.UTC, nil
+	}
+	if timeZone[0] == '+' || timeZone[0] == '-' {
+		offset, err := time.Parse("-07:00", timeZone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone [%v]", timeZone)
+		}
+		_, seconds := offset.Zone()
+		return time.FixedZone(timeZone, seconds), nil
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone [%v]", timeZone)
+	}
+	return location, nil
+}
+
+// Parse function description : 按格式依次尝试解析，都失败时再按返回的格式解析
+// params : 日期时间字符串
+// return : 毫秒时间戳
+func (p *DateParser) Parse(value string) (int64, error) {
+
+	value = strings.TrimSpace(value)
+	for _, format := range p.formats {
+		if ms, ok := p.parseFormat(format, value); ok {
+			return ms, nil
+		}
+	}
+	if tm, err := time.Parse(DATETIME_OUTPUT_LAYOUT, value); err == nil {
+		return tm.UnixMilli(), nil
+	}
+	return DATETIME_NULL, fmt.Errorf("failed to parse date [%v]", value)
+}
+
+func (p *DateParser) parseFormat(format, value string) (int64, bool) {
+
+	switch format {
+	case DATE_FORMAT_EPOCH_MILLIS:
+		ms, err := strconv.ParseInt(value, 10, 64)
+		return ms, err == nil
+	case DATE_FORMAT_EPOCH_SECOND:
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		return seconds * 1000, err == nil
+	case DATE_FORMAT_RFC3339:
+		format = time.RFC3339
+	}
+	tm, err := time.ParseInLocation(format, value, p.location)
+	if err != nil {
+		return 0, false
+	}
+	return tm.UnixMilli(), true
+}
+
+// ParseMath function description : 解析带日期运算的表达式，如 now-7d/d、2026-01-02||+1M
+// 运算为 +N单位、-N单位 和 /单位 取整，单位为 y、M、w、d、h(H)、m、s，取整按解析器的时区计算
+// params : 表达式；当前时间
+// return : 向下取整的结果和向上取整的结果（所在单位的最后一毫秒），没有取整时两者相同
+func (p *DateParser) ParseMath(expr string, now time.Time) (int64, int64, error) {
+
+	expr = strings.TrimSpace(expr)
+	var anchor time.Time
+	var ops string
+	switch {
+	case strings.HasPrefix(expr, "now"):
+		anchor, ops = now, expr[len("now"):]
+	case strings.Contains(expr, DATE_FORMAT_SEPARATOR):
+		i := strings.Index(expr, DATE_FORMAT_SEPARATOR)
+		ms, err := p.Parse(expr[:i])
+		if err != nil {
+			return DATETIME_NULL, DATETIME_NULL, err
+		}
+		anchor, ops = time.UnixMilli(ms), expr[i+len(DATE_FORMAT_SEPARATOR):]
+	default:
+		ms, err := p.Parse(expr)
+		return ms, ms, err
+	}
+
+	lo, hi := anchor.In(p.location), anchor.In(p.location)
+	for len(ops) > 0 {
+		op := ops[0]
+		ops = ops[1:]
+		if op == '/' {
+			if ops == "" {
+				return DATETIME_NULL, DATETIME_NULL, fmt.Errorf("invalid date math [%v]", expr)
+			}
+			start, ok := truncateTime(lo, ops[0])
+			if !ok {
+				return DATETIME_NULL, DATETIME_NULL, fmt.Errorf("invalid date math [%v]", expr)
+			}
+			end, _ := truncateTime(hi, ops[0])
+			lo, hi = start, addTime(end, ops[0], 1).Add(-time.Millisecond)
+			ops = ops[1:]
+			continue
+		}
+		if op != '+' && op != '-' {
+			return DATETIME_NULL, DATETIME_NULL, fmt.Errorf("invalid date math [%v]", expr)
+		}
+
+		n := 0
+		for n < len(ops) && ops[n] >= '0' && ops[n] <= '9' {
+			n++
+		}
+		if n == len(ops) {
+			return DATETIME_NULL, DATETIME_NULL, fmt.Errorf("invalid date math [%v]", expr)
+		}
+		num := 1
+		if n > 0 {
+			num, _ = strconv.Atoi(ops[:n])
+		}
+		if op == '-' {
+			num = -num
+		}
+		if _, ok := truncateTime(lo, ops[n]); !ok {
+			return DATETIME_NULL, DATETIME_NULL, fmt.Errorf("invalid date math [%v]", expr)
+		}
+		lo, hi = addTime(lo, ops[n], num), addTime(hi, ops[n], num)
+		ops = ops[n+1:]
+	}
+	return lo.UnixMilli(), hi.UnixMilli(), nil
+}
+
+// truncateTime 取整到单位的起点
+func truncateTime(tm time.Time, unit byte) (time.Time, bool) {
+	y, mon, d := tm.Date()
+	loc := tm.Location()
+	switch unit {
+	case 'y':
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, loc), true
+	case 'M':
+		return time.Date(y, mon, 1, 0, 0, 0, 0, loc), true
+	case 'w':
+		offset := (int(tm.Weekday()) + 6) % 7 // 一周从周一开始
+		return time.Date(y, mon, d-offset, 0, 0, 0, 0, loc), true
+	case 'd':
+		return time.Date(y, mon, d, 0, 0, 0, 0, loc), true
+	case 'h', 'H':
+		return time.Date(y, mon, d, tm.Hour(), 0, 0, 0, loc), true
+	case 'm':
+		return time.Date(y, mon, d, tm.Hour(), tm.Minute(), 0, 0, loc), true
+	case 's':
+		return time.Date(y, mon, d, tm.Hour(), tm.Minute(), tm.Second(), 0, loc), true
+	}
+	return tm, false
+}
+
+// addTime 加上若干个单位的时间
+func addTime(tm time.Time, unit byte, num int) time.Time {
+	switch unit {
+	case 'y':
+		return tm.AddDate(num, 0, 0)
+	case 'M':
+		return tm.AddDate(0, num, 0)
+	case 'w':
+		return tm.AddDate(0, 0, 7*num)
+	case 'd':
+		return tm.AddDate(0, 0, num)
+	case 'h', 'H':
+		return tm.Add(time.Duration(num) * time.Hour)
+	case 'm':
+		return tm.Add(time.Duration(num) * time.Minute)
+	case 's':
+		return tm.Add(time.Duration(num) * time.Second)
+	}
+	return tm
+}
+
+// FloorDiv function description : 向下取整的整数除法，用于早于 1970 年的时间戳换算
+// params : 被除数；除数，必须大于 0
+// return : 商
+func FloorDiv(a, b int64) int64 {
+
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+// FormatMillis function description : 把毫秒时间戳转换为 UTC 时间字符串
+// params : 毫秒时间戳
+// return : 字符串，空值为空字符串
+func FormatMillis(ms int64) string {
+
+	if ms == DATETIME_NULL {
+		return ""
+	}
+	return time.UnixMilli(ms).UTC().Format(DATETIME_OUTPUT_LAYOUT)
+}
@@ -0,0 +1,229 @@
+/**
+ * @Note 索引文件的存储抽象，索引、段和字段的文件都通过 Directory 读写
+ **/
+
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// File 目录中打开的文件
+type File interface {
+	io.Reader
+	io.Writer
+	io.ReaderAt
+	io.Closer
+	Size() (int64, error)
+	Sync() error
+}
+
+// MappedFile 映射到内存的文件，修改 Bytes 返回的内容即修改文件
+type MappedFile interface {
+	Bytes() []byte           // 映射的内容，长度等于文件长度
+	Resize(size int64) error // 修改文件长度并重新映射，之前 Bytes 返回的切片不再可用
+	Sync() error
+	Close() error
+}
+
+// Directory 索引文件的存储，文件名为包含索引路径的完整文件名
+type Directory interface {
+	Create(name string) (File, error)                 // 创建文件，文件已存在时清空
+	OpenFile(name string, flag int) (File, error)     // flag 与 os.OpenFile 相同
+	Map(name string, create bool) (MappedFile, error) // 映射文件，create 为 true 时文件不存在则创建
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	FileSize(name string) (int64, error)
+	Exist(name string) bool
+	List(dir string) ([]string, error) // 目录下的文件和子目录名，按名字排序
+	MkdirAll(dir string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldName, newName string) error
+	LocalPath(name string) (string, error) // 需要自己打开文件的组件（如 boltdb）使用的本地文件路径
+	Close() error
+}
+
+// DefaultDirectory 没有指定目录时使用的本地文件目录
+var DefaultDirectory Directory = NewMmapDirectory()
+
+// MmapDirectory 本地文件目录，映射文件使用 mmap
+type MmapDirectory struct{}
+
+func NewMmapDirectory() *MmapDirectory {
+	return &MmapDirectory{}
+}
+
+func (d *MmapDirectory) Create(name string) (File, error) {
+	fd, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &osFile{fd}, nil
+}
+
+func (d *MmapDirectory) OpenFile(name string, flag int) (File, error) {
+	fd, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &osFile{fd}, nil
+}
+
+func (d *MmapDirectory) Map(name string, create bool) (MappedFile, error) {
+	flag := os.O_RDWR
+	if create {
+		flag |= os.O_CREATE
+	}
+	fd, err := os.OpenFile(name, flag, 0664)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+
+	m := &mmapFile{fd: fd}
+	if err := m.mmap(fi.Size()); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (d *MmapDirectory) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (d *MmapDirectory) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0644)
+}
+
+func (d *MmapDirectory) FileSize(name string) (int64, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (d *MmapDirectory) Exist(name string) bool {
+	return Exist(name)
+}
+
+func (d *MmapDirectory) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+func (d *MmapDirectory) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0755)
+}
+
+func (d *MmapDirectory) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (d *MmapDirectory) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (d *MmapDirectory) Rename(oldName, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (d *MmapDirectory) LocalPath(name string) (string, error) {
+	return name, nil
+}
+
+func (d *MmapDirectory) Close() error {
+	return nil
+}
+
+// osFile 本地文件
+type osFile struct {
+	*os.File
+}
+
+func (f *osFile) Size() (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// mmapFile 使用 mmap 映射的本地文件
+type mmapFile struct {
+	fd   *os.File
+	data []byte
+}
+
+func (m *mmapFile) Bytes() []byte {
+	return m.data
+}
+
+func (m *mmapFile) Resize(size int64) error {
+	if err := m.munmap(); err != nil {
+		return err
+	}
+	if err := m.fd.Truncate(size); err != nil {
+		return err
+	}
+	return m.mmap(size)
+}
+
+func (m *mmapFile) Sync() error {
+	if len(m.data) == 0 {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&m.data[0])), uintptr(len(m.data)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errors.New("Sync Error")
+	}
+	return nil
+}
+
+func (m *mmapFile) Close() error {
+	err := m.munmap()
+	if cerr := m.fd.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// mmap 空文件不能映射，映射为空切片
+func (m *mmapFile) mmap(size int64) error {
+	if size == 0 {
+		m.data = nil
+		return nil
+	}
+	data, err := syscall.Mmap(int(m.fd.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	m.data = data
+	return nil
+}
+
+func (m *mmapFile) munmap() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	return err
+}
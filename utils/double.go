@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DOUBLE_NULL 双精度浮点数字段的空值，对应的位模式是 NaN，不会与真实的值冲突
+const DOUBLE_NULL int64 = math.MinInt64
+
+// EncodeDouble function description : 把浮点数转换为可排序的整数，整数的大小顺序与浮点数一致
+// params : 浮点数，不能为 NaN
+// return : 可排序的整数，-0 与 0 相同
+func EncodeDouble(f float64) int64 {
+
+	if f == 0 {
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if bits>>63 == 1 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return int64(bits ^ (1 << 63))
+}
+
+// DecodeDouble function description : 把 EncodeDouble 得到的整数还原为浮点数
+// params : 可排序的整数
+// return : 浮点数
+func DecodeDouble(value int64) float64 {
+
+	bits := uint64(value) ^ (1 << 63)
+	if bits>>63 == 1 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+// ParseDouble function description : 解析浮点数并转换为可排序的整数
+// params : 字符串形式的浮点数
+// return : 可排序的整数，空值或无法解析时返回 DOUBLE_NULL 和错误
+func ParseDouble(value string) (int64, error) {
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(f) {
+		return DOUBLE_NULL, fmt.Errorf("value [%v] is not a number", value)
+	}
+	return EncodeDouble(f), nil
+}
+
+// FormatDouble function description : 把可排序的整数转换为最短的能还原原值的字符串，
+// 绝对值很大或很小时使用科学计数法
+// params : 可排序的整数
+// return : 字符串，空值为空字符串
+func FormatDouble(value int64) string {
+
+	if value == DOUBLE_NULL {
+		return ""
+	}
+	f := DecodeDouble(value)
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// NullNumber function description : 数字类字段存储的空值
+// params : 字段类型
+// return : 双精度浮点数为 DOUBLE_NULL，日期时间为 DATETIME_NULL，其余为 -1
+func NullNumber(fieldType uint64) int64 {
+
+	if fieldType == IDX_TYPE_DOUBLE {
+		return DOUBLE_NULL
+	}
+	if fieldType == IDX_TYPE_DATETIME {
+		return DATETIME_NULL
+	}
+	return -1
+}
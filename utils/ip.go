@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IP_LEN IP 地址字段存储的字节数，IPv4 地址按 IPv4-mapped IPv6 地址存储
+const IP_LEN = net.IPv6len
+
+// IP_MIN、IP_MAX 最小和最大的 IP 地址，用于没有下界或上界的过滤
+var (
+	IP_MIN = string(make([]byte, IP_LEN))
+	IP_MAX = strings.Repeat("\xff", IP_LEN)
+)
+
+// ParseIP function description : 把 IP 地址转换为 16 字节可排序的形式，按字节序比较即按地址大小比较
+// params : IPv4 或 IPv6 地址
+// return : 16 字节的地址，无法解析时返回错误
+func ParseIP(value string) (string, error) {
+
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return "", fmt.Errorf("value [%v] is not an ip address", value)
+	}
+	return string(ip.To16()), nil
+}
+
+// FormatIP function description : 把 16 字节的地址转换为字符串，IPv4-mapped 地址转换为 IPv4 的形式
+// params : 16 字节的地址
+// return : 字符串，空值或长度不对时为空字符串
+func FormatIP(value string) string {
+
+	if len(value) != IP_LEN {
+		return ""
+	}
+	return net.IP(value).String()
+}
+
+// ParseIPRange function description : 解析 IP 地址或 CIDR，如 10.0.0.0/8、2001:db8::/32
+// params : IP 地址或 CIDR
+// return : 范围内最小和最大的 16 字节地址，单个地址时两者相同
+func ParseIPRange(value string) (string, string, error) {
+
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip, err := ParseIP(value)
+		return ip, ip, err
+	}
+
+	_, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		return "", "", fmt.Errorf("value [%v] is not a cidr", value)
+	}
+	lo := ipNet.IP.To16()
+	mask := ipNet.Mask
+	if len(mask) == net.IPv4len {
+		mask = append(net.CIDRMask(96, 128)[:IP_LEN-net.IPv4len], mask...)
+	}
+	hi := make(net.IP, IP_LEN)
+	for i := range lo {
+		hi[i] = lo[i] | ^mask[i]
+	}
+	return string(lo), string(hi), nil
+}
+
+// ParseBool function description : 解析布尔值，支持 true/false、1/0、t/f 等
+// params : 布尔值字符串
+// return : 布尔值，无法解析时返回错误
+func ParseBool(value string) (bool, error) {
+
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, fmt.Errorf("value [%v] is not a boolean", value)
+	}
+	return b, nil
+}
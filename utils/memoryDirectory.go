@@ -0,0 +1,415 @@
+/**
+ * @Note 内存中的目录，用于测试和不需要持久化的临时索引
+ **/
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryDirectory 文件内容保存在内存中的目录
+// boltdb 只能打开本地文件，LocalPath 返回的文件放在临时目录中，Close 时删除
+type MemoryDirectory struct {
+	mutex    sync.Mutex
+	files    map[string]*memoryData
+	dirs     map[string]struct{}
+	local    map[string]string // 文件名到临时目录中本地文件的映射
+	localDir string
+	localSeq int
+}
+
+// memoryData 文件的内容，映射和打开的文件共用
+type memoryData struct {
+	mutex sync.RWMutex
+	data  []byte
+}
+
+func NewMemoryDirectory() *MemoryDirectory {
+	return &MemoryDirectory{
+		files: make(map[string]*memoryData),
+		dirs:  make(map[string]struct{}),
+		local: make(map[string]string),
+	}
+}
+
+func (d *MemoryDirectory) Create(name string) (File, error) {
+	return d.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+func (d *MemoryDirectory) OpenFile(name string, flag int) (File, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	name = filepath.Clean(name)
+	if path, ok := d.local[name]; ok {
+		return NewMmapDirectory().OpenFile(path, flag)
+	}
+
+	file, ok := d.files[name]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		file = &memoryData{}
+		d.files[name] = file
+	}
+	if flag&os.O_TRUNC != 0 {
+		file.mutex.Lock()
+		file.data = file.data[:0]
+		file.mutex.Unlock()
+	}
+	return &memoryFile{file: file, append: flag&os.O_APPEND != 0}, nil
+}
+
+func (d *MemoryDirectory) Map(name string, create bool) (MappedFile, error) {
+	flag := os.O_RDWR
+	if create {
+		flag |= os.O_CREATE
+	}
+	f, err := d.OpenFile(name, flag)
+	if err != nil {
+		return nil, err
+	}
+	if file, ok := f.(*memoryFile); ok {
+		return &memoryMapping{file: file.file}, nil
+	}
+	// 本地文件
+	f.Close()
+	path, _ := d.LocalPath(name)
+	return NewMmapDirectory().Map(path, create)
+}
+
+func (d *MemoryDirectory) ReadFile(name string) ([]byte, error) {
+	f, err := d.OpenFile(name, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (d *MemoryDirectory) WriteFile(name string, data []byte) error {
+	f, err := d.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
+
+func (d *MemoryDirectory) FileSize(name string) (int64, error) {
+	f, err := d.OpenFile(name, os.O_RDONLY)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Size()
+}
+
+func (d *MemoryDirectory) Exist(name string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	name = filepath.Clean(name)
+	if path, ok := d.local[name]; ok {
+		return Exist(path)
+	}
+	_, isFile := d.files[name]
+	_, isDir := d.dirs[name]
+	return isFile || isDir
+}
+
+func (d *MemoryDirectory) List(dir string) ([]string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	dir = filepath.Clean(dir)
+	if _, ok := d.dirs[dir]; !ok {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrNotExist}
+	}
+
+	seen := make(map[string]struct{})
+	collect := func(name string) {
+		if rel, ok := childOf(dir, name); ok {
+			seen[strings.SplitN(rel, string(filepath.Separator), 2)[0]] = struct{}{}
+		}
+	}
+	for name := range d.files {
+		collect(name)
+	}
+	for name := range d.dirs {
+		collect(name)
+	}
+	for name := range d.local {
+		collect(name)
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (d *MemoryDirectory) MkdirAll(dir string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+		d.dirs[dir] = struct{}{}
+		if parent := filepath.Dir(dir); parent == dir {
+			return nil
+		}
+	}
+}
+
+func (d *MemoryDirectory) Remove(name string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	name = filepath.Clean(name)
+	if path, ok := d.local[name]; ok {
+		delete(d.local, name)
+		return os.Remove(path)
+	}
+	if _, ok := d.files[name]; ok {
+		delete(d.files, name)
+		return nil
+	}
+	if _, ok := d.dirs[name]; ok {
+		delete(d.dirs, name)
+		return nil
+	}
+	return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+}
+
+func (d *MemoryDirectory) RemoveAll(name string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	name = filepath.Clean(name)
+	var err error
+	for key, path := range d.local {
+		if _, ok := childOf(name, key); ok || key == name {
+			delete(d.local, key)
+			if rerr := os.Remove(path); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+	}
+	for key := range d.files {
+		if _, ok := childOf(name, key); ok || key == name {
+			delete(d.files, key)
+		}
+	}
+	for key := range d.dirs {
+		if _, ok := childOf(name, key); ok || key == name {
+			delete(d.dirs, key)
+		}
+	}
+	return err
+}
+
+// Rename 重命名文件或目录，本地文件只修改映射，已打开的文件不受影响
+func (d *MemoryDirectory) Rename(oldName, newName string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	oldName, newName = filepath.Clean(oldName), filepath.Clean(newName)
+	found := false
+	rename := func(key string) (string, bool) {
+		if key == oldName {
+			return newName, true
+		}
+		if rel, ok := childOf(oldName, key); ok {
+			return filepath.Join(newName, rel), true
+		}
+		return "", false
+	}
+
+	for key, path := range d.local {
+		if target, ok := rename(key); ok {
+			delete(d.local, key)
+			d.local[target] = path
+			found = true
+		}
+	}
+	for key, file := range d.files {
+		if target, ok := rename(key); ok {
+			delete(d.files, key)
+			d.files[target] = file
+			found = true
+		}
+	}
+	for key := range d.dirs {
+		if target, ok := rename(key); ok {
+			delete(d.dirs, key)
+			d.dirs[target] = struct{}{}
+			found = true
+		}
+	}
+	if !found {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+func (d *MemoryDirectory) LocalPath(name string) (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	name = filepath.Clean(name)
+	if path, ok := d.local[name]; ok {
+		return path, nil
+	}
+	if d.localDir == "" {
+		localDir, err := os.MkdirTemp("", "godance-memory-")
+		if err != nil {
+			return "", err
+		}
+		d.localDir = localDir
+	}
+	d.localSeq++
+	path := filepath.Join(d.localDir, fmt.Sprintf("%v_%v", d.localSeq, filepath.Base(name)))
+	d.local[name] = path
+	return path, nil
+}
+
+// Close 释放所有文件，删除本地文件使用的临时目录
+func (d *MemoryDirectory) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.files = make(map[string]*memoryData)
+	d.dirs = make(map[string]struct{})
+	d.local = make(map[string]string)
+	if d.localDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(d.localDir)
+	d.localDir = ""
+	return err
+}
+
+// childOf name 在 dir 下时返回相对路径
+func childOf(dir, name string) (string, bool) {
+	prefix := dir + string(filepath.Separator)
+	if dir == string(filepath.Separator) {
+		prefix = dir
+	}
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	return name[len(prefix):], true
+}
+
+// memoryFile 打开的内存文件，每个打开的文件有自己的读写位置
+type memoryFile struct {
+	file   *memoryData
+	offset int64
+	append bool
+}
+
+func (f *memoryFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	f.file.mutex.RLock()
+	defer f.file.mutex.RUnlock()
+
+	if off >= int64(len(f.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.file.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memoryFile) Write(p []byte) (int, error) {
+	f.file.mutex.Lock()
+	defer f.file.mutex.Unlock()
+
+	if f.append {
+		f.offset = int64(len(f.file.data))
+	}
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.file.data)) {
+		f.file.resize(end)
+	}
+	copy(f.file.data[f.offset:], p)
+	f.offset = end
+	return len(p), nil
+}
+
+func (f *memoryFile) Size() (int64, error) {
+	f.file.mutex.RLock()
+	defer f.file.mutex.RUnlock()
+	return int64(len(f.file.data)), nil
+}
+
+func (f *memoryFile) Sync() error {
+	return nil
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+// resize 修改文件长度，容量足够时复用原来的数组，这样之前映射的切片仍然指向文件内容
+func (m *memoryData) resize(size int64) {
+	if size <= int64(cap(m.data)) {
+		old := int64(len(m.data))
+		m.data = m.data[:size]
+		// 截断后再扩展的部分需要清零
+		for i := old; i < size; i++ {
+			m.data[i] = 0
+		}
+		return
+	}
+	data := make([]byte, size, size+size/2)
+	copy(data, m.data)
+	m.data = data
+}
+
+// memoryMapping 内存文件的映射，直接读写文件的内容
+type memoryMapping struct {
+	file *memoryData
+}
+
+func (m *memoryMapping) Bytes() []byte {
+	m.file.mutex.RLock()
+	defer m.file.mutex.RUnlock()
+	return m.file.data
+}
+
+func (m *memoryMapping) Resize(size int64) error {
+	m.file.mutex.Lock()
+	defer m.file.mutex.Unlock()
+	m.file.resize(size)
+	return nil
+}
+
+func (m *memoryMapping) Sync() error {
+	return nil
+}
+
+func (m *memoryMapping) Close() error {
+	return nil
+}
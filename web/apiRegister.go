@@ -12,11 +12,28 @@ func Register(r *gin.Engine) {
 
 	// 对索引的操作
 	r.POST("/create", idxopt.CreateIndex())
+	r.GET("/_stats", idxopt.EngineStats())
+	r.GET("/:index/_stats", idxopt.IndexStats())
+	r.GET("/:index/_segments", idxopt.IndexSegments())
+	r.GET("/:index/_settings", idxopt.GetSettings())
+	r.PUT("/:index/_settings", idxopt.UpdateSettings())
+	r.GET("/:index/_terms", idxopt.Terms())
+	r.GET("/:index/_check", idxopt.Check())
+	r.POST("/:index/_check", idxopt.Check())
+	r.POST("/:index/_forcemerge", idxopt.ForceMerge())
+	r.GET("/_tasks", idxopt.Tasks())
+	r.GET("/_tasks/:id", idxopt.GetTask())
+	r.PUT("/_template/:name", idxopt.PutTemplate())
+	r.GET("/_template", idxopt.Templates())
+	r.GET("/_template/:name", idxopt.GetTemplate())
+	r.DELETE("/_template/:name", idxopt.DeleteTemplate())
 
 	// 对文档的操作
 	r.POST("/update", idxopt.AddDocument())
 	r.DELETE("/update", idxopt.DeleteDocument())
 	r.PUT("/update", idxopt.UpdateDocument())
+	r.POST("/_bulk", idxopt.Bulk())
+	r.GET("/_export", idxopt.Export())
 
 	// 搜索相关的API
 	r.GET("/search_related", websearch.GetRelated())
@@ -2,6 +2,7 @@ package idxopt
 
 import (
 	"GoDance/engine"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -15,9 +16,12 @@ func AddDocument() func(c *gin.Context) {
 
 		params := make(map[string]string)
 		params["index"] = indexName
+		params["if_version"] = c.Query("if_version")
 		msg, err := engine.Engine.AddDocument(params, data)
 		if err == nil {
 			c.JSON(http.StatusOK, msg)
+		} else if engine.IsConflict(err) {
+			c.JSON(http.StatusConflict, msg)
 		} else {
 			c.JSON(http.StatusBadRequest, msg)
 		}
@@ -28,14 +32,17 @@ func AddDocument() func(c *gin.Context) {
 // @Description 删除文档
 func DeleteDocument() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		indexName := c.Query("index")
 		params := make(map[string]string)
-		params["index"] = indexName
+		for k, v := range c.Request.URL.Query() {
+			params[k] = v[0]
+		}
 
 		msg, err := engine.Engine.DeleteDocument(params)
 
 		if err == nil {
 			c.JSON(http.StatusOK, msg)
+		} else if engine.IsConflict(err) {
+			c.JSON(http.StatusConflict, msg)
 		} else {
 			c.JSON(http.StatusBadRequest, msg)
 		}
@@ -47,16 +54,64 @@ func DeleteDocument() func(c *gin.Context) {
 func UpdateDocument() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		data, _ := c.GetRawData()
-		indexName := c.Query("index")
 		params := make(map[string]string)
-		params["index"] = indexName
+		params["index"] = c.Query("index")
+		params["partial"] = c.Query("partial")
+		params["upsert"] = c.Query("upsert")
+		params["if_version"] = c.Query("if_version")
 
 		msg, err := engine.Engine.UpdateDocument(params, data)
 
 		if err == nil {
 			c.JSON(http.StatusOK, msg)
+		} else if engine.IsConflict(err) {
+			c.JSON(http.StatusConflict, msg)
 		} else {
 			c.JSON(http.StatusBadRequest, msg)
 		}
 	}
 }
+
+// Bulk
+// @Description 批量操作文档，请求体为 NDJSON 格式
+func Bulk() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		data, _ := c.GetRawData()
+		params := make(map[string]string)
+		params["index"] = c.Query("index")
+
+		result, err := engine.Engine.Bulk(params, data)
+		if err == nil {
+			c.JSON(http.StatusOK, result)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("err : %v", err),
+			})
+		}
+	}
+}
+
+// Export
+// @Description 流式导出索引中的文档，支持 jsonl 和 csv 格式
+func Export() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		params := make(map[string]string)
+		for k, v := range c.Request.URL.Query() {
+			params[k] = v[0]
+		}
+
+		if params["format"] == engine.EXPORT_CSV {
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+		}
+
+		err := engine.Engine.Export(params, c.Writer)
+		// 已经开始输出时无法再修改状态码，只能中断输出
+		if err != nil && !c.Writer.Written() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("err : %v", err),
+			})
+		}
+	}
+}
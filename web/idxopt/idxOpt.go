@@ -14,10 +14,202 @@ func CreateIndex() func(c *gin.Context) {
 		data, _ := c.GetRawData()
 		err := engine.Engine.CreateIndex(indexName, data)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusOK, "OK")
 		}
 
 	}
 }
+
+// IndexStats
+// @Description 获取索引的统计信息
+func IndexStats() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		stats, err := engine.Engine.IndexStats(c.Param("index"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+// GetSettings
+// @Description 获取索引当前生效的设置
+func GetSettings() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		settings, err := engine.Engine.GetSettings(c.Param("index"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"settings": settings})
+	}
+}
+
+// UpdateSettings
+// @Description 修改索引的设置
+func UpdateSettings() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		data, _ := c.GetRawData()
+		settings, err := engine.Engine.UpdateSettings(c.Param("index"), data)
+		if err != nil {
+			status := http.StatusBadRequest
+			if err.Error() == engine.IndexNotFound {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"settings": settings})
+	}
+}
+
+// IndexSegments
+// @Description 获取索引中每个段的统计信息
+func IndexSegments() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		segments, err := engine.Engine.IndexSegments(c.Param("index"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"segments": segments})
+	}
+}
+
+// EngineStats
+// @Description 获取所有索引的汇总信息
+func EngineStats() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, engine.Engine.Stats())
+	}
+}
+
+// Terms
+// @Description 按字典序列出字段中的词及文档数
+func Terms() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		params := make(map[string]string)
+		for k, v := range c.Request.URL.Query() {
+			params[k] = v[0]
+		}
+		params["index"] = c.Param("index")
+
+		res, err := engine.Engine.Terms(params)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// ForceMerge
+// @Description 在后台强制合并索引的段，返回任务信息，通过 /_tasks/:id 查看进度
+func ForceMerge() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		params := make(map[string]string)
+		for k, v := range c.Request.URL.Query() {
+			params[k] = v[0]
+		}
+		params["index"] = c.Param("index")
+
+		task, err := engine.Engine.ForceMerge(params)
+		if err != nil {
+			if err.Error() == engine.IndexNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, task)
+	}
+}
+
+// Tasks
+// @Description 获取所有后台任务
+func Tasks() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tasks": engine.Engine.Tasks()})
+	}
+}
+
+// GetTask
+// @Description 获取后台任务的状态和结果
+func GetTask() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		task, err := engine.Engine.GetTask(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, task)
+	}
+}
+
+// PutTemplate
+// @Description 新增或替换索引模板
+func PutTemplate() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		data, _ := c.GetRawData()
+		if err := engine.Engine.PutTemplate(c.Param("name"), data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, "OK")
+	}
+}
+
+// Templates
+// @Description 获取所有索引模板
+func Templates() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"templates": engine.Engine.GetTemplates()})
+	}
+}
+
+// GetTemplate
+// @Description 获取索引模板
+func GetTemplate() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		template, err := engine.Engine.GetTemplate(c.Param("name"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+// DeleteTemplate
+// @Description 删除索引模板
+func DeleteTemplate() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if err := engine.Engine.DeleteTemplate(c.Param("name")); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, "OK")
+	}
+}
+
+// Check
+// @Description 检查索引文件的完整性，POST 并且 quarantine=true 时隔离损坏的段
+func Check() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		quarantine := c.Request.Method == http.MethodPost && c.Query("quarantine") == "true"
+		reports, err := engine.Engine.Check(c.Param("index"), quarantine)
+		if err != nil {
+			if err.Error() == engine.IndexNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "reports": reports})
+			return
+		}
+		c.JSON(http.StatusOK, reports[0])
+	}
+}
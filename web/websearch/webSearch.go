@@ -57,10 +57,23 @@ func GetDocument() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		indexName := c.PostForm("index")
 		id := c.PostForm("id")
-		doc, err := engine.Engine.GetDocById(indexName, id)
+
+		var doc map[string]string
+		var err error
+		if id != "" {
+			doc, err = engine.Engine.GetDocById(indexName, id)
+		} else {
+			// 没有 docId 时按主键获取
+			c.Request.ParseMultipartForm(32 << 20)
+			params := make(map[string]string)
+			for k, v := range c.Request.PostForm {
+				params[k] = v[0]
+			}
+			doc, err = engine.Engine.GetDocByKey(params)
+		}
 		if err == nil {
 			//返回数据
-			var res gin.H
+			res := make(gin.H)
 			for key, val := range doc {
 				res[key] = val
 			}